@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// aacProfile describe un perfil AAC: el nombre de -profile:a en cada
+// codificador ("" si no lo admite) y su bitrate por defecto
+type aacProfile struct {
+	native  string
+	fdk     string
+	bitrate string
+	// stereo fuerza dos canales (HE-AACv2 usa parametric stereo)
+	stereo bool
+}
+
+// aacProfiles son los valores aceptados en aac_profile. El codificador nativo
+// de ffmpeg solo implementa AAC-LC de forma usable; HE-AAC requiere libfdk_aac.
+var aacProfiles = map[string]aacProfile{
+	"lc":    {native: "aac_low", fdk: "aac_low", bitrate: "128k"},
+	"he":    {fdk: "aac_he", bitrate: "64k"},
+	"he_v2": {fdk: "aac_he_v2", bitrate: "32k", stereo: true},
+}
+
+var (
+	// aacEncoderSetting es AAC_ENCODER: auto (libfdk_aac si existe), libfdk_aac o aac
+	aacEncoderSetting string
+	libfdkAvailable   bool
+	// defaultAACEncoder es el codificador resuelto para las salidas sin aac_encoder
+	defaultAACEncoder string
+)
+
+func loadAACConfig() {
+	libfdkAvailable = detectLibfdkAAC()
+
+	aacEncoderSetting = strings.TrimSpace(os.Getenv("AAC_ENCODER"))
+	if aacEncoderSetting == "" {
+		aacEncoderSetting = "auto"
+	}
+
+	encoder, err := resolveAACEncoder(aacEncoderSetting)
+	if err != nil {
+		fmt.Printf("AAC_ENCODER inválido (%v), usando aac\n", err)
+		encoder = "aac"
+	}
+	defaultAACEncoder = encoder
+	fmt.Printf("Codificador AAC: %s (libfdk_aac disponible: %v)\n", defaultAACEncoder, libfdkAvailable)
+}
+
+// detectLibfdkAAC revisa si el build de ffmpeg incluye libfdk_aac
+func detectLibfdkAAC() bool {
+	output, err := exec.Command("ffmpeg", "-hide_banner", "-encoders").Output()
+	if err != nil {
+		return false
+	}
+	return bytes.Contains(output, []byte(" libfdk_aac "))
+}
+
+// resolveAACEncoder traduce auto/libfdk_aac/aac al codificador a usar
+func resolveAACEncoder(encoder string) (string, error) {
+	switch encoder {
+	case "auto":
+		if libfdkAvailable {
+			return "libfdk_aac", nil
+		}
+		return "aac", nil
+	case "libfdk_aac":
+		if !libfdkAvailable {
+			return "", fmt.Errorf("este ffmpeg no incluye libfdk_aac")
+		}
+		return encoder, nil
+	case "aac":
+		return encoder, nil
+	}
+	return "", invalidParam("aac_encoder", "aac_encoder inválido %q (auto, libfdk_aac o aac)", encoder)
+}
+
+// aacEncoderArgs arma -c:a, -profile:a y -b:a para aac_encoder/aac_profile.
+// Sin aac_encoder se usa el codificador del servidor, salvo que el perfil
+// pida HE-AAC, en cuyo caso se exige libfdk_aac.
+func aacEncoderArgs(encoder, profileName string) ([]string, error) {
+	if profileName == "" {
+		profileName = "lc"
+	}
+	profile, ok := aacProfiles[profileName]
+	if !ok {
+		return nil, invalidParam("aac_profile", "aac_profile inválido %q (lc, he o he_v2)", profileName)
+	}
+
+	resolved := defaultAACEncoder
+	if encoder != "" {
+		var err error
+		if resolved, err = resolveAACEncoder(encoder); err != nil {
+			return nil, err
+		}
+	}
+	if profile.native == "" && resolved != "libfdk_aac" {
+		if encoder == "aac" || !libfdkAvailable {
+			return nil, fmt.Errorf("el perfil %s requiere libfdk_aac", profileName)
+		}
+		resolved = "libfdk_aac"
+	}
+
+	args := []string{"-c:a", resolved}
+	if resolved == "libfdk_aac" {
+		args = append(args, "-profile:a", profile.fdk)
+	} else {
+		args = append(args, "-profile:a", profile.native)
+	}
+	args = append(args, "-b:a", profile.bitrate)
+	if profile.stereo {
+		args = append(args, "-ac", "2")
+	}
+	return args, nil
+}
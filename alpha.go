@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// alphaTarget son las opciones de un formato de salida que conserva el canal
+// alfa
+type alphaTarget struct {
+	videoArgs []string
+	audioArgs []string
+	muxer     string
+}
+
+var alphaTargets = map[string]alphaTarget{
+	// VP9 guarda el alfa como un plano adicional (alpha_mode=1)
+	"webm": {
+		videoArgs: []string{"-c:v", "libvpx-vp9", "-pix_fmt", "yuva420p", "-b:v", "0", "-crf", "30", "-auto-alt-ref", "0", "-row-mt", "1"},
+		audioArgs: []string{"-c:a", "libopus", "-b:a", "128k"},
+		muxer:     "webm",
+	},
+	// ProRes 4444 (perfil 4) con alfa de 16 bits para edición
+	"mov": {
+		videoArgs: []string{"-c:v", "prores_ks", "-profile:v", "4", "-pix_fmt", "yuva444p10le", "-alpha_bits", "16", "-vendor", "apl0"},
+		audioArgs: []string{"-c:a", "pcm_s16le"},
+		muxer:     "mov",
+	},
+}
+
+// alphaMP4Warning se devuelve cuando una entrada con alfa se aplana a H.264
+const alphaMP4Warning = "input has an alpha channel; H.264 MP4 cannot store transparency and it was flattened to black (use /transparent-video to keep it)"
+
+// videoAlphaInfo describe el primer stream de video respecto al canal alfa
+type videoAlphaInfo struct {
+	HasAlpha bool
+	PixFmt   string
+	// decoder fuerza libvpx al leer VP8/VP9 con alfa: el decodificador nativo
+	// ignora el plano alfa
+	decoder string
+}
+
+// probeVideoAlpha detecta si la entrada tiene transparencia
+func probeVideoAlpha(ctx context.Context, inputData []byte) (*videoAlphaInfo, error) {
+	_, probe, err := probeMedia(ctx, inputData)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, stream := range probe.Streams {
+		if stream.CodecType != "video" {
+			continue
+		}
+		info := &videoAlphaInfo{PixFmt: stream.PixFmt, HasAlpha: pixFmtHasAlpha(stream.PixFmt)}
+		if stream.Tags["alpha_mode"] == "1" || stream.Tags["ALPHA_MODE"] == "1" {
+			info.HasAlpha = true
+			switch stream.CodecName {
+			case "vp8":
+				info.decoder = "libvpx"
+			case "vp9":
+				info.decoder = "libvpx-vp9"
+			}
+		}
+		return info, nil
+	}
+	return nil, fmt.Errorf("la entrada no contiene video")
+}
+
+// pixFmtHasAlpha reconoce los formatos de píxel con componente alfa
+// (yuva420p, rgba, bgra, argb, gbrap, ya8, ...)
+func pixFmtHasAlpha(pixFmt string) bool {
+	for _, prefix := range []string{"yuva", "rgba", "bgra", "argb", "abgr", "gbrap", "ya8", "ya16", "rgb32", "bgr32"} {
+		if strings.HasPrefix(pixFmt, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// convertWithAlpha transcodifica la entrada a WebM VP9 o ProRes 4444
+// conservando la transparencia
+func convertWithAlpha(ctx context.Context, inputData []byte, format string) ([]byte, *videoAlphaInfo, error) {
+	target, ok := alphaTargets[format]
+	if !ok {
+		return nil, nil, invalidParam("output_format", "output_format inválido %q (webm o mov)", format)
+	}
+
+	info, err := probeVideoAlpha(ctx, inputData)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	inputPath, cleanup, err := writeTempInput(inputData, "alpha-input-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cleanup()
+
+	outputPath, cleanupOutput, err := createTempOutput("alpha-output-*." + format)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cleanupOutput()
+
+	var args []string
+	if info.decoder != "" {
+		args = append(args, "-c:v", info.decoder)
+	}
+	args = append(args, "-i", inputPath, "-map", "0:v:0", "-map", "0:a:0?")
+	// VP9 y yuv420 requieren dimensiones pares
+	args = append(args, "-vf", "scale=trunc(iw/2)*2:trunc(ih/2)*2")
+	args = append(args, target.videoArgs...)
+	args = append(args, target.audioArgs...)
+	args = append(args, classThreadArgs(ctx, classBatch)...)
+	args = append(args, "-f", target.muxer, "-y", outputPath)
+
+	cmd := ffmpegCommand(ctx, classBatch, args...)
+	var errBuffer bytes.Buffer
+	cmd.Stderr = &errBuffer
+
+	fmt.Printf("[convertWithAlpha] Entrada %s (alfa: %v) -> %s\n", info.PixFmt, info.HasAlpha, format)
+	if err := cmd.Run(); err != nil {
+		return nil, nil, fmt.Errorf("error en conversión con alfa: %v, detalles: %s", err, errBuffer.String())
+	}
+
+	outputData, err := os.ReadFile(outputPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error al leer archivo de salida: %v", err)
+	}
+	if len(outputData) == 0 {
+		return nil, nil, fmt.Errorf("la conversión produjo un archivo vacío")
+	}
+	return outputData, info, nil
+}
+
+// processTransparentVideo atiende /transparent-video: animaciones y capturas
+// de pantalla a WebM VP9 o ProRes 4444 conservando el alfa
+func processTransparentVideo(c *gin.Context) {
+	if !validateAPIKey(c) {
+		return
+	}
+
+	inputData, err := getInputData(c)
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+
+	format := negotiateFormat(c, []string{"webm", "mov"}, "webm")
+	if _, ok := alphaTargets[format]; !ok {
+		respondError(c, http.StatusBadRequest, invalidParam("output_format", "output_format inválido %q (webm o mov)", format))
+		return
+	}
+
+	outputData, info, err := convertWithAlpha(c.Request.Context(), inputData, format)
+	if err == nil {
+		outputData, err = interceptOutput(c.Request.Context(), format, outputData)
+	}
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusInternalServerError), err)
+		return
+	}
+
+	if wantsBinaryResponse(c, "") {
+		writeBinaryResponse(c, outputData, "video."+format, contentTypeForFormat(format), map[string]string{
+			"X-Format":    format,
+			"X-Has-Alpha": strconv.FormatBool(info.HasAlpha),
+		})
+		return
+	}
+	response := gin.H{
+		"format":    format,
+		"has_alpha": info.HasAlpha,
+		"video":     base64.StdEncoding.EncodeToString(outputData),
+	}
+	if !info.HasAlpha {
+		response["warnings"] = []string{"input has no alpha channel; the output is fully opaque"}
+	}
+	c.JSON(http.StatusOK, attachDebug(c.Request.Context(), response))
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loudnessSpec son los límites opcionales de /analyze-loudness, p. ej. la
+// especificación de loudness de un podcast. nil en cada campo es "sin límite".
+type loudnessSpec struct {
+	TargetLUFS  *float64
+	Tolerance   float64
+	MaxTruePeak *float64
+	MaxRange    *float64
+}
+
+// parseLoudnessLimit valida un límite opcional dentro de [min, max]
+func parseLoudnessLimit(name, value string, min, max float64) (*float64, error) {
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil || parsed < min || parsed > max {
+		return nil, invalidParam(name, "%s inválido %q (entre %s y %s)", name, value,
+			strconv.FormatFloat(min, 'f', -1, 64), strconv.FormatFloat(max, 'f', -1, 64))
+	}
+	return &parsed, nil
+}
+
+// parseLoudnessSpec lee target_lufs y lufs_tolerance (1 LU por defecto),
+// max_true_peak (dBTP) y max_lra (LU). Devuelve nil si no se pidió ningún
+// límite.
+func parseLoudnessSpec(c *gin.Context) (*loudnessSpec, error) {
+	spec := &loudnessSpec{Tolerance: 1}
+	var err error
+	if spec.TargetLUFS, err = parseLoudnessLimit("target_lufs", c.PostForm("target_lufs"), -70, -5); err != nil {
+		return nil, err
+	}
+	if tolerance, err := parseLoudnessLimit("lufs_tolerance", c.PostForm("lufs_tolerance"), 0, 10); err != nil {
+		return nil, err
+	} else if tolerance != nil {
+		spec.Tolerance = *tolerance
+	}
+	if spec.MaxTruePeak, err = parseLoudnessLimit("max_true_peak", c.PostForm("max_true_peak"), -20, 3); err != nil {
+		return nil, err
+	}
+	if spec.MaxRange, err = parseLoudnessLimit("max_lra", c.PostForm("max_lra"), 0, 50); err != nil {
+		return nil, err
+	}
+	if spec.TargetLUFS == nil && spec.MaxTruePeak == nil && spec.MaxRange == nil {
+		return nil, nil
+	}
+	return spec, nil
+}
+
+// violations compara la medición con los límites. Una entrada en silencio
+// (-inf LUFS) no cumple ningún objetivo de loudness integrado.
+func (spec *loudnessSpec) violations(stats *loudnessStats) []gin.H {
+	violations := []gin.H{}
+	if spec.TargetLUFS != nil {
+		min, max := *spec.TargetLUFS-spec.Tolerance, *spec.TargetLUFS+spec.Tolerance
+		if stats.Integrated < min || stats.Integrated > max {
+			violations = append(violations, gin.H{"metric": "integrated_lufs", "value": finiteOrNil(stats.Integrated), "min": min, "max": max})
+		}
+	}
+	if spec.MaxTruePeak != nil && stats.TruePeak > *spec.MaxTruePeak {
+		violations = append(violations, gin.H{"metric": "true_peak_dbtp", "value": stats.TruePeak, "max": *spec.MaxTruePeak})
+	}
+	if spec.MaxRange != nil && stats.Range > *spec.MaxRange {
+		violations = append(violations, gin.H{"metric": "loudness_range_lu", "value": stats.Range, "max": *spec.MaxRange})
+	}
+	return violations
+}
+
+// finiteOrNil devuelve nil para -inf (entrada en silencio), que JSON no
+// puede representar
+func finiteOrNil(value float64) interface{} {
+	if math.IsInf(value, 0) || math.IsNaN(value) {
+		return nil
+	}
+	return value
+}
+
+// processAnalyzeLoudness atiende POST /analyze-loudness: mide el loudness
+// EBU R128 de la entrada sin convertirla, para rechazar subidas fuera de
+// especificación antes de procesarlas
+func processAnalyzeLoudness(c *gin.Context) {
+	if !validateAPIKey(c) {
+		return
+	}
+
+	inputData, err := getInputData(c)
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+
+	spec, err := parseLoudnessSpec(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	stats, err := measureLoudness(c.Request.Context(), inputData)
+	if err != nil {
+		respondError(c, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	response := gin.H{
+		"integrated_lufs":   finiteOrNil(stats.Integrated),
+		"loudness_range_lu": stats.Range,
+		"true_peak_dbtp":    finiteOrNil(stats.TruePeak),
+	}
+	if spec != nil {
+		violations := spec.violations(stats)
+		response["compliant"] = len(violations) == 0
+		response["violations"] = violations
+	}
+	c.JSON(http.StatusOK, attachDebug(c.Request.Context(), response))
+}
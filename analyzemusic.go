@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/cmplx"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// musicSampleRate alcanza para el tempo y para las notas hasta 5 kHz
+	musicSampleRate = 22050
+	// musicWindow son los segundos iniciales que se analizan
+	musicWindow = 180
+	// musicMinSeconds es lo mínimo para que la autocorrelación tenga varios
+	// compases
+	musicMinSeconds = 10
+	// Tramas del flujo espectral (tempo): ~86 por segundo
+	onsetFrameSize = 1024
+	onsetHop       = 256
+	// Tramas del cromagrama (tonalidad): resolución de ~2.7 Hz
+	chromaFrameSize = 8192
+	chromaHop       = 4096
+)
+
+// pitchClassNames son los nombres habituales en software de DJ
+var pitchClassNames = []string{"C", "C#", "D", "Eb", "E", "F", "F#", "G", "Ab", "A", "Bb", "B"}
+
+// Perfiles tonales de Krumhansl-Kessler, desde la tónica
+var (
+	majorKeyProfile = []float64{6.35, 2.23, 3.48, 2.33, 4.38, 4.09, 2.52, 5.19, 2.39, 3.66, 2.29, 2.88}
+	minorKeyProfile = []float64{6.33, 2.68, 3.52, 5.38, 2.60, 3.53, 2.54, 4.75, 3.98, 2.69, 3.34, 3.17}
+)
+
+// musicAnalysis es el tempo y la tonalidad estimados
+type musicAnalysis struct {
+	BPM           float64
+	BPMConfidence float64
+	Tonic         int
+	Minor         bool
+	KeyConfidence float64
+	Seconds       float64
+}
+
+// parseBPMRange lee min_bpm y max_bpm (entre 30 y 300, 60 y 200 por
+// defecto). Acotar el rango evita que se reporte la mitad o el doble del tempo.
+func parseBPMRange(minValue, maxValue string) (float64, float64, error) {
+	parse := func(name, value string, fallback float64) (float64, error) {
+		if value == "" {
+			return fallback, nil
+		}
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < 30 || parsed > 300 {
+			return 0, invalidParam(name, "%s inválido %q (entre 30 y 300)", name, value)
+		}
+		return parsed, nil
+	}
+	minBPM, err := parse("min_bpm", minValue, 60)
+	if err != nil {
+		return 0, 0, err
+	}
+	maxBPM, err := parse("max_bpm", maxValue, 200)
+	if err != nil {
+		return 0, 0, err
+	}
+	if maxBPM < minBPM*1.5 {
+		return 0, 0, errors.New("max_bpm debe ser al menos 1.5 veces min_bpm")
+	}
+	return minBPM, maxBPM, nil
+}
+
+// analyzeMusic decodifica la entrada a mono y estima el tempo y la tonalidad
+func analyzeMusic(ctx context.Context, inputData []byte, minBPM, maxBPM float64) (*musicAnalysis, error) {
+	pcm, err := decodeMonoPCM(ctx, inputData, musicSampleRate, musicWindow)
+	if err != nil {
+		return nil, err
+	}
+	samples := pcmSamples(pcm)
+	seconds := float64(len(samples)) / musicSampleRate
+	if seconds < musicMinSeconds {
+		return nil, inputOutOfRange("la entrada es demasiado corta para estimar el tempo (mínimo %d s)", musicMinSeconds)
+	}
+
+	analysis := &musicAnalysis{Seconds: seconds}
+	analysis.BPM, analysis.BPMConfidence = estimateTempo(samples, minBPM, maxBPM)
+	analysis.Tonic, analysis.Minor, analysis.KeyConfidence = estimateKey(samples)
+	if analysis.BPM == 0 {
+		return nil, errors.New("no se detectó un pulso rítmico en la entrada")
+	}
+	return analysis, nil
+}
+
+// estimateTempo calcula el flujo espectral (el aumento de energía por banda
+// entre tramas, que marca los ataques) y busca su periodicidad con la
+// autocorrelación. Un peso log-normal centrado en 120 BPM desempata entre
+// el tempo y sus múltiplos.
+func estimateTempo(samples []float64, minBPM, maxBPM float64) (float64, float64) {
+	window := hannWindow(onsetFrameSize)
+	var previous []float64
+	var envelope []float64
+	for start := 0; start+onsetFrameSize <= len(samples); start += onsetHop {
+		magnitudes := frameMagnitudes(samples[start:start+onsetFrameSize], window)
+		flux := 0.0
+		for k, magnitude := range magnitudes {
+			magnitude = math.Log1p(1000 * magnitude)
+			if previous != nil && magnitude > previous[k] {
+				flux += magnitude - previous[k]
+			}
+			magnitudes[k] = magnitude
+		}
+		envelope = append(envelope, flux)
+		previous = magnitudes
+	}
+
+	mean, _ := meanAndDeviation(envelope)
+	for i := range envelope {
+		envelope[i] -= mean
+	}
+	framesPerSecond := float64(musicSampleRate) / onsetHop
+	minLag := int(math.Floor(60 * framesPerSecond / maxBPM))
+	maxLag := int(math.Ceil(60 * framesPerSecond / minBPM))
+	if maxLag+1 >= len(envelope) {
+		return 0, 0
+	}
+
+	autocorrelation := func(lag int) float64 {
+		sum := 0.0
+		for i := lag; i < len(envelope); i++ {
+			sum += envelope[i] * envelope[i-lag]
+		}
+		return sum / float64(len(envelope)-lag)
+	}
+	energy := autocorrelation(0)
+	if energy <= 0 {
+		return 0, 0
+	}
+
+	values := make([]float64, maxLag+2)
+	bestLag, bestScore := 0, math.Inf(-1)
+	for lag := minLag - 1; lag <= maxLag+1; lag++ {
+		if lag < 1 {
+			continue
+		}
+		values[lag] = autocorrelation(lag)
+		if lag < minLag || lag > maxLag {
+			continue
+		}
+		bpm := 60 * framesPerSecond / float64(lag)
+		prior := math.Exp(-0.5 * math.Pow(math.Log2(bpm/120), 2))
+		if score := values[lag] * prior; score > bestScore {
+			bestLag, bestScore = lag, score
+		}
+	}
+	if bestLag == 0 || values[bestLag] <= 0 {
+		return 0, 0
+	}
+
+	// Interpolación parabólica para afinar entre dos lags enteros
+	lag := float64(bestLag)
+	if left, right := values[bestLag-1], values[bestLag+1]; left != 0 && right != 0 {
+		if denominator := left - 2*values[bestLag] + right; denominator != 0 {
+			lag += 0.5 * (left - right) / denominator
+		}
+	}
+	bpm := 60 * framesPerSecond / lag
+	confidence := math.Max(0, math.Min(1, values[bestLag]/energy))
+	return math.Round(bpm*10) / 10, math.Round(confidence*100) / 100
+}
+
+// estimateKey suma la energía de cada clase de altura (cromagrama) entre
+// 55 Hz y 5 kHz y la correlaciona con los perfiles mayor y menor en las 12
+// tónicas. La confianza es la correlación de la mejor tonalidad.
+func estimateKey(samples []float64) (int, bool, float64) {
+	window := hannWindow(chromaFrameSize)
+	chroma := make([]float64, 12)
+	binHz := float64(musicSampleRate) / chromaFrameSize
+	for start := 0; start+chromaFrameSize <= len(samples); start += chromaHop {
+		magnitudes := frameMagnitudes(samples[start:start+chromaFrameSize], window)
+		for k, magnitude := range magnitudes {
+			frequency := float64(k) * binHz
+			if frequency < 55 || frequency > 5000 {
+				continue
+			}
+			midi := 69 + 12*math.Log2(frequency/440)
+			pitchClass := (int(math.Round(midi))%12 + 12) % 12
+			chroma[pitchClass] += magnitude
+		}
+	}
+
+	bestTonic, bestMinor, bestCorrelation := 0, false, math.Inf(-1)
+	for tonic := 0; tonic < 12; tonic++ {
+		rotated := make([]float64, 12)
+		for i := range rotated {
+			rotated[i] = chroma[(tonic+i)%12]
+		}
+		for _, minor := range []bool{false, true} {
+			profile := majorKeyProfile
+			if minor {
+				profile = minorKeyProfile
+			}
+			if correlation := pearson(rotated, profile); correlation > bestCorrelation {
+				bestTonic, bestMinor, bestCorrelation = tonic, minor, correlation
+			}
+		}
+	}
+	if math.IsNaN(bestCorrelation) || math.IsInf(bestCorrelation, 0) {
+		bestCorrelation = 0
+	}
+	return bestTonic, bestMinor, math.Round(math.Max(0, bestCorrelation)*100) / 100
+}
+
+func pearson(a, b []float64) float64 {
+	meanA, deviationA := meanAndDeviation(a)
+	meanB, deviationB := meanAndDeviation(b)
+	if deviationA == 0 || deviationB == 0 {
+		return 0
+	}
+	sum := 0.0
+	for i := range a {
+		sum += (a[i] - meanA) * (b[i] - meanB)
+	}
+	return sum / float64(len(a)) / (deviationA * deviationB)
+}
+
+func hannWindow(size int) []float64 {
+	window := make([]float64, size)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(size-1))
+	}
+	return window
+}
+
+// frameMagnitudes devuelve la magnitud de las frecuencias positivas de una
+// trama con ventana (el tamaño debe ser potencia de 2)
+func frameMagnitudes(frame, window []float64) []float64 {
+	values := make([]complex128, len(frame))
+	for i, sample := range frame {
+		values[i] = complex(sample*window[i], 0)
+	}
+	fft(values)
+	magnitudes := make([]float64, len(values)/2)
+	for k := range magnitudes {
+		magnitudes[k] = cmplx.Abs(values[k])
+	}
+	return magnitudes
+}
+
+// fft es la transformada rápida de Fourier radix-2, en el lugar
+func fft(values []complex128) {
+	n := len(values)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			values[i], values[j] = values[j], values[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				even, odd := values[start+k], values[start+k+size/2]*w
+				values[start+k], values[start+k+size/2] = even+odd, even-odd
+				w *= step
+			}
+		}
+	}
+}
+
+// keyName es la tonalidad en notación musical, p. ej. "A minor"
+func (analysis *musicAnalysis) keyName() string {
+	if analysis.Minor {
+		return pitchClassNames[analysis.Tonic] + " minor"
+	}
+	return pitchClassNames[analysis.Tonic] + " major"
+}
+
+// camelot es la tonalidad en la rueda Camelot (8B = C mayor, 8A = A menor):
+// las tonalidades vecinas se mezclan sin choques armónicos
+func (analysis *musicAnalysis) camelot() string {
+	tonic, letter := analysis.Tonic, "B"
+	if analysis.Minor {
+		// Una tonalidad menor comparte número con su relativa mayor
+		tonic, letter = (tonic+3)%12, "A"
+	}
+	return strconv.Itoa((tonic*7%12+7)%12+1) + letter
+}
+
+// processAnalyzeMusic atiende POST /analyze-music: el tempo (BPM) y la
+// tonalidad estimados de la entrada, para herramientas de DJ y catálogos
+func processAnalyzeMusic(c *gin.Context) {
+	if !validateAPIKey(c) {
+		return
+	}
+
+	inputData, err := getInputData(c)
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+
+	minBPM, maxBPM, err := parseBPMRange(c.PostForm("min_bpm"), c.PostForm("max_bpm"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	analysis, err := analyzeMusic(c.Request.Context(), inputData, minBPM, maxBPM)
+	if err != nil {
+		respondError(c, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	scale := "major"
+	if analysis.Minor {
+		scale = "minor"
+	}
+	c.JSON(http.StatusOK, attachDebug(c.Request.Context(), gin.H{
+		"bpm":               analysis.BPM,
+		"bpm_confidence":    analysis.BPMConfidence,
+		"key":               analysis.keyName(),
+		"tonic":             pitchClassNames[analysis.Tonic],
+		"scale":             scale,
+		"camelot":           analysis.camelot(),
+		"key_confidence":    analysis.KeyConfidence,
+		"analyzed_duration": roundMillis(analysis.Seconds),
+	}))
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// animationPreset agrupa los ajustes de un video convertido a GIF/WebP
+type animationPreset struct {
+	FPS      int
+	MaxWidth int
+	// DropDuplicates elimina con mpdecimate los frames sin cambios: en una
+	// grabación de pantalla la mayoría lo son
+	DropDuplicates bool
+	// StatsMode es el modo de palettegen: "full" (una paleta global) o
+	// "single" (una paleta por frame emitido, que con DropDuplicates equivale
+	// a una por cambio de escena)
+	StatsMode string
+	Dither    string
+	// WebPPreset es el preset de libwebp (picture para video, text para UI)
+	WebPPreset  string
+	WebPQuality int
+}
+
+var animationPresets = map[string]animationPreset{
+	"default": {
+		FPS: 15, MaxWidth: 480, StatsMode: "full", Dither: "sierra2_4a",
+		WebPPreset: "picture", WebPQuality: 75,
+	},
+	// Pocos fps, sin frames repetidos, paleta por escena y sin dither en
+	// las áreas planas de la interfaz
+	"screen_recording": {
+		FPS: 8, MaxWidth: 960, DropDuplicates: true, StatsMode: "single", Dither: "bayer:bayer_scale=5",
+		WebPPreset: "text", WebPQuality: 70,
+	},
+}
+
+// animationOptions son los parámetros de /video-to-gif
+type animationOptions struct {
+	Format string
+	Preset animationPreset
+	// Area recorta la región de interés "x:y:w:h" antes de escalar
+	Area string
+}
+
+// parseCropArea valida area=x:y:w:h
+func parseCropArea(area string) (string, error) {
+	if area == "" {
+		return "", nil
+	}
+	parts := strings.Split(area, ":")
+	if len(parts) != 4 {
+		return "", invalidParam("area", "area inválida %q (x:y:w:h)", area)
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || (i >= 2 && n == 0) {
+			return "", invalidParam("area", "area inválida %q (x:y:w:h)", area)
+		}
+	}
+	return fmt.Sprintf("crop=%s:%s:%s:%s", parts[2], parts[3], parts[0], parts[1]), nil
+}
+
+// animationFilterGraph arma el filtro del video: recorte, frames, escala y,
+// para GIF, la paleta en el mismo proceso
+func animationFilterGraph(opts animationOptions, crop string) string {
+	var chain []string
+	if crop != "" {
+		chain = append(chain, crop)
+	}
+	chain = append(chain, fmt.Sprintf("fps=%d", opts.Preset.FPS))
+	if opts.Preset.DropDuplicates {
+		chain = append(chain, "mpdecimate")
+	}
+	chain = append(chain, fmt.Sprintf("scale='min(%d,iw)':-2:flags=lanczos", opts.Preset.MaxWidth))
+
+	if opts.Format == "webp" {
+		return strings.Join(chain, ",")
+	}
+
+	paletteUse := fmt.Sprintf("paletteuse=dither=%s:diff_mode=rectangle", opts.Preset.Dither)
+	if opts.Preset.StatsMode == "single" {
+		paletteUse += ":new=1"
+	}
+	return fmt.Sprintf("[0:v]%s,split[frames][stats];[stats]palettegen=stats_mode=%s[palette];[frames][palette]%s",
+		strings.Join(chain, ","), opts.Preset.StatsMode, paletteUse)
+}
+
+// convertToAnimation convierte un video en GIF o WebP animado
+func convertToAnimation(ctx context.Context, inputData []byte, opts animationOptions) ([]byte, error) {
+	crop, err := parseCropArea(opts.Area)
+	if err != nil {
+		return nil, err
+	}
+
+	inputPath, cleanup, err := writeTempInput(inputData, "animation-input-*")
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	outputPath, cleanupOutput, err := createTempOutput("animation-output-*." + opts.Format)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanupOutput()
+
+	graph := animationFilterGraph(opts, crop)
+	args := []string{"-i", inputPath, "-an"}
+	if opts.Format == "webp" {
+		args = append(args, "-vf", graph,
+			"-c:v", "libwebp_anim", "-lossless", "0",
+			"-quality", strconv.Itoa(opts.Preset.WebPQuality),
+			"-preset", opts.Preset.WebPPreset,
+			"-loop", "0")
+	} else {
+		args = append(args, "-filter_complex", graph, "-loop", "0")
+	}
+	// mpdecimate deja frames con duración variable que GIF/WebP conservan
+	if opts.Preset.DropDuplicates {
+		args = append(args, "-fps_mode", "vfr")
+	}
+	args = append(args, classThreadArgs(ctx, classBatch)...)
+	args = append(args, "-f", opts.Format, "-y", outputPath)
+
+	cmd := ffmpegCommand(ctx, classBatch, args...)
+	var errBuffer bytes.Buffer
+	cmd.Stderr = &errBuffer
+
+	fmt.Printf("[convertToAnimation] %d bytes -> %s (%d fps, ancho máx. %d)\n", len(inputData), opts.Format, opts.Preset.FPS, opts.Preset.MaxWidth)
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error en conversión a %s: %v, detalles: %s", opts.Format, err, errBuffer.String())
+	}
+
+	outputData, err := os.ReadFile(outputPath)
+	if err != nil {
+		return nil, fmt.Errorf("error al leer archivo de salida: %v", err)
+	}
+	if len(outputData) == 0 {
+		return nil, fmt.Errorf("la conversión produjo un archivo vacío")
+	}
+	return outputData, nil
+}
+
+// processVideoToGif atiende /video-to-gif
+func processVideoToGif(c *gin.Context) {
+	if !validateAPIKey(c) {
+		return
+	}
+
+	inputData, err := getInputData(c)
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+
+	opts := animationOptions{
+		Format: negotiateFormat(c, []string{"gif", "webp"}, "gif"),
+		Area:   c.PostForm("area"),
+	}
+	if opts.Format != "gif" && opts.Format != "webp" {
+		respondError(c, http.StatusBadRequest, invalidParam("output_format", "output_format inválido %q (gif o webp)", opts.Format))
+		return
+	}
+	presetName := c.DefaultPostForm("preset", "default")
+	preset, ok := animationPresets[presetName]
+	if !ok {
+		respondError(c, http.StatusBadRequest, invalidParam("preset", "preset desconocido %q (default o screen_recording)", presetName))
+		return
+	}
+	// fps y width ajustan el preset
+	if value := c.PostForm("fps"); value != "" {
+		fps, err := strconv.Atoi(value)
+		if err != nil || fps < 1 || fps > 50 {
+			respondError(c, http.StatusBadRequest, invalidParam("fps", "fps debe estar entre 1 y 50"))
+			return
+		}
+		preset.FPS = fps
+	}
+	if value := c.PostForm("width"); value != "" {
+		width, err := strconv.Atoi(value)
+		if err != nil || width < 16 || width > 3840 {
+			respondError(c, http.StatusBadRequest, invalidParam("width", "width debe estar entre 16 y 3840"))
+			return
+		}
+		preset.MaxWidth = width
+	}
+	opts.Preset = preset
+	if _, err := parseCropArea(opts.Area); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	outputData, err := convertToAnimation(c.Request.Context(), inputData, opts)
+	if err == nil {
+		outputData, err = interceptOutput(c.Request.Context(), opts.Format, outputData)
+	}
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusInternalServerError), err)
+		return
+	}
+
+	if wantsBinaryResponse(c, "") {
+		writeBinaryResponse(c, outputData, "animation."+opts.Format, contentTypeForFormat(opts.Format), map[string]string{
+			"X-Format": opts.Format,
+			"X-Preset": presetName,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, attachDebug(c.Request.Context(), gin.H{
+		"format": opts.Format,
+		"preset": presetName,
+		"size":   len(outputData),
+		"image":  base64.StdEncoding.EncodeToString(outputData),
+	}))
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// atRestMagic encabeza los archivos cifrados; los que no lo tienen se
+// escribieron antes de habilitar el cifrado y se leen tal cual
+var atRestMagic = []byte("EACENC1")
+
+// atRestAEAD cifra con AES-256-GCM los archivos que el servicio guarda en
+// disco (descargas firmadas, capturas de depuración y muestras en
+// cuarentena); nil si el cifrado está deshabilitado
+var atRestAEAD cipher.AEAD
+
+// loadAtRestConfig lee la clave de ENCRYPTION_KEY o de ENCRYPTION_KEY_FILE,
+// p. ej. un archivo que escribe el agente del KMS. La clave son 32 bytes en
+// base64. Una clave inválida detiene el servicio: seguir sin cifrar dejaría
+// grabaciones en claro sin aviso.
+func loadAtRestConfig() {
+	atRestAEAD = nil
+	encoded := os.Getenv("ENCRYPTION_KEY")
+	if path := os.Getenv("ENCRYPTION_KEY_FILE"); encoded == "" && path != "" {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Printf("No se pudo leer ENCRYPTION_KEY_FILE: %v\n", err)
+			os.Exit(1)
+		}
+		encoded = string(raw)
+	}
+	if encoded = strings.TrimSpace(encoded); encoded == "" {
+		return
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != 32 {
+		fmt.Println("La clave de cifrado debe ser de 32 bytes en base64 (p. ej. openssl rand -base64 32)")
+		os.Exit(1)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		fmt.Printf("Clave de cifrado inválida: %v\n", err)
+		os.Exit(1)
+	}
+	if atRestAEAD, err = cipher.NewGCM(block); err != nil {
+		fmt.Printf("Clave de cifrado inválida: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("Cifrado en reposo habilitado (AES-256-GCM)")
+}
+
+// sealAtRest cifra data si hay clave: cabecera, nonce y texto cifrado
+func sealAtRest(data []byte) ([]byte, error) {
+	if atRestAEAD == nil {
+		return data, nil
+	}
+	nonce := make([]byte, atRestAEAD.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("error al generar el nonce: %v", err)
+	}
+	sealed := append(append([]byte{}, atRestMagic...), nonce...)
+	return atRestAEAD.Seal(sealed, nonce, data, nil), nil
+}
+
+// openAtRest descifra lo escrito por sealAtRest
+func openAtRest(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, atRestMagic) {
+		return data, nil
+	}
+	if atRestAEAD == nil {
+		return nil, errors.New("el archivo está cifrado y no hay clave de cifrado configurada")
+	}
+	data = data[len(atRestMagic):]
+	if len(data) < atRestAEAD.NonceSize() {
+		return nil, errors.New("archivo cifrado truncado")
+	}
+	nonce, ciphertext := data[:atRestAEAD.NonceSize()], data[atRestAEAD.NonceSize():]
+	plain, err := atRestAEAD.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo descifrar el archivo (¿otra clave?): %v", err)
+	}
+	return plain, nil
+}
+
+// writeAtRest guarda data en path, cifrado si hay clave
+func writeAtRest(path string, data []byte) error {
+	sealed, err := sealAtRest(data)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, sealed, 0o600)
+}
+
+// readAtRest lee un archivo escrito con writeAtRest
+func readAtRest(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return openAtRest(data)
+}
+
+// serveAtRestFile responde el archivo descifrado como adjunto
+func serveAtRestFile(c *gin.Context, path, filename, contentType string) {
+	data, err := readAtRest(path)
+	if err != nil {
+		fmt.Printf("Error al leer %s: %v\n", path, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudo leer el archivo guardado"})
+		return
+	}
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// runDecrypt atiende el subcomando decrypt: escribe en stdout el contenido
+// descifrado de un archivo guardado por el servicio, p. ej. una muestra en
+// cuarentena. Devuelve el código de salida del proceso.
+func runDecrypt(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "uso: evolution-audio-converter decrypt <archivo>")
+		return 2
+	}
+	data, err := readAtRest(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if _, err := os.Stdout.Write(data); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// audioParams son los parámetros bitrate, sample_rate, channels y
+// sample_fmt de la petición; los valores cero mantienen el default del
+// formato
+type audioParams struct {
+	// Bitrate en bits por segundo
+	Bitrate    int
+	SampleRate int
+	Channels   int
+	// SampleFormat es s16, s24 o f32; solo se aplica a wav
+	SampleFormat string
+}
+
+// sampleFormatCodecs es el codec PCM de cada sample_fmt
+var sampleFormatCodecs = map[string]string{
+	"s16": "pcm_s16le",
+	"s24": "pcm_s24le",
+	"f32": "pcm_f32le",
+}
+
+// formatAudioLimit describe qué admite el codificador de cada formato
+type formatAudioLimit struct {
+	sampleRates []int
+	maxChannels int
+	// minBitrate == 0 indica un formato sin bitrate configurable (PCM)
+	minBitrate int
+	maxBitrate int
+	// bitrates restringe el bitrate a una lista de modos (AMR)
+	bitrates []int
+}
+
+var aacSampleRates = []int{8000, 11025, 12000, 16000, 22050, 24000, 32000, 44100, 48000, 64000, 88200, 96000}
+
+var formatAudioLimits = map[string]formatAudioLimit{
+	"ogg":    {sampleRates: []int{8000, 12000, 16000, 24000, 48000}, maxChannels: 2, minBitrate: 6000, maxBitrate: 510000},
+	"mp3":    {sampleRates: []int{8000, 11025, 12000, 16000, 22050, 24000, 32000, 44100, 48000}, maxChannels: 2, minBitrate: 8000, maxBitrate: 320000},
+	"aac":    {sampleRates: aacSampleRates, maxChannels: 8, minBitrate: 8000, maxBitrate: 512000},
+	"hls":    {sampleRates: aacSampleRates, maxChannels: 8, minBitrate: 8000, maxBitrate: 512000},
+	"mp4":    {sampleRates: aacSampleRates, maxChannels: 8, minBitrate: 8000, maxBitrate: 512000},
+	"m4a":    {sampleRates: aacSampleRates, maxChannels: 8, minBitrate: 8000, maxBitrate: 512000},
+	"wav":    {sampleRates: []int{8000, 11025, 16000, 22050, 32000, 44100, 48000, 88200, 96000, 176400, 192000}, maxChannels: 8},
+	"amr-wb": {sampleRates: []int{16000}, maxChannels: 1, bitrates: []int{6600, 8850, 12650, 14250, 15850, 18250, 19850, 23050, 23850}},
+	"ulaw":   {sampleRates: []int{8000}, maxChannels: 1},
+	"alaw":   {sampleRates: []int{8000}, maxChannels: 1},
+	"alac":   {sampleRates: []int{8000, 16000, 22050, 24000, 32000, 44100, 48000, 88200, 96000, 176400, 192000}, maxChannels: 8},
+	"flac":   {sampleRates: []int{8000, 16000, 22050, 24000, 32000, 44100, 48000, 88200, 96000, 176400, 192000}, maxChannels: 8},
+	"amr":    {sampleRates: []int{8000}, maxChannels: 1, bitrates: []int{4750, 5150, 5900, 6700, 7400, 7950, 10200, 12200}},
+}
+
+var bitrateRe = regexp.MustCompile(`^(\d+(?:\.\d+)?)([kK]?)$`)
+
+// parseAudioParams valida el formato de los parámetros; los límites de cada
+// formato se revisan con validateFor
+func parseAudioParams(bitrate, sampleRate, channels string) (audioParams, error) {
+	var params audioParams
+
+	if bitrate != "" {
+		match := bitrateRe.FindStringSubmatch(bitrate)
+		if match == nil {
+			return params, invalidParam("bitrate", "bitrate inválido %q (p. ej. 96k o 96000)", bitrate)
+		}
+		value, _ := strconv.ParseFloat(match[1], 64)
+		if match[2] != "" {
+			value *= 1000
+		}
+		params.Bitrate = int(value)
+	}
+
+	if sampleRate != "" {
+		value, err := strconv.Atoi(sampleRate)
+		if err != nil || value <= 0 {
+			return params, invalidParam("sample_rate", "sample_rate inválido %q", sampleRate)
+		}
+		params.SampleRate = value
+	}
+
+	if channels != "" {
+		value, err := strconv.Atoi(channels)
+		if err != nil || value <= 0 {
+			return params, invalidParam("channels", "channels inválido %q", channels)
+		}
+		params.Channels = value
+	}
+
+	return params, nil
+}
+
+// parseSampleFormat valida sample_fmt: s16 (PCM de 16 bits, el que esperan
+// los IVR antiguos), s24 o f32 (coma flotante, para DAWs)
+func parseSampleFormat(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	if _, ok := sampleFormatCodecs[value]; !ok {
+		return "", invalidParam("sample_fmt", "sample_fmt inválido %q (s16, s24 o f32)", value)
+	}
+	return value, nil
+}
+
+func (params audioParams) isSet() bool {
+	return params.Bitrate != 0 || params.SampleRate != 0 || params.Channels != 0 || params.SampleFormat != ""
+}
+
+// validateFor comprueba que el codificador del formato admita los valores
+func (params audioParams) validateFor(format string) error {
+	limit, ok := formatAudioLimits[format]
+	if !ok {
+		limit = formatAudioLimits["ogg"]
+	}
+
+	if params.Bitrate != 0 {
+		switch {
+		case limit.bitrates != nil:
+			if !containsInt(limit.bitrates, params.Bitrate) {
+				return fmt.Errorf("bitrate %d no admitido por %s (modos: %v)", params.Bitrate, format, limit.bitrates)
+			}
+		case limit.minBitrate == 0:
+			return conflictingParams("bitrate", "%s no admite bitrate", format)
+		case params.Bitrate < limit.minBitrate || params.Bitrate > limit.maxBitrate:
+			return invalidParam("bitrate", "bitrate para %s debe estar entre %d y %d", format, limit.minBitrate, limit.maxBitrate)
+		}
+	}
+	if params.SampleRate != 0 && !containsInt(limit.sampleRates, params.SampleRate) {
+		return fmt.Errorf("sample_rate %d no admitido por %s (valores: %v)", params.SampleRate, format, limit.sampleRates)
+	}
+	if params.Channels > limit.maxChannels {
+		return fmt.Errorf("%s admite como máximo %d canales", format, limit.maxChannels)
+	}
+	if params.SampleFormat != "" && format != "wav" {
+		return conflictingParams("sample_fmt", "sample_fmt solo se aplica a wav, no a %s", format)
+	}
+	return nil
+}
+
+// validateAudioParams revisa los parámetros contra el formato de salida (o
+// cada uno de output_formats) y contra las opciones de codificador que fijan
+// su propio bitrate o diseño de canales
+func validateAudioParams(opts audioOptions, formatsParam, mp3VBR, aacProfile string) error {
+	if !opts.Params.isSet() {
+		return nil
+	}
+
+	formats := []string{opts.Format}
+	if formatsParam != "" {
+		formats = parseOutputFormats(formatsParam)
+	}
+	for _, format := range formats {
+		if err := opts.Params.validateFor(format); err != nil {
+			return err
+		}
+	}
+
+	if opts.Params.Bitrate != 0 && mp3VBR != "" {
+		return conflictingParams("bitrate", "bitrate no se combina con mp3_vbr")
+	}
+	if opts.Params.Channels == 1 && aacProfile == "he_v2" {
+		return fmt.Errorf("el perfil he_v2 requiere audio estéreo")
+	}
+	return nil
+}
+
+// parseVideoAudioOptions valida las opciones de la pista AAC de un video
+// (audio_bitrate, audio_sample_rate, audio_channels, aac_encoder y
+// aac_profile) con las mismas reglas que /process-audio aplica a m4a
+func parseVideoAudioOptions(bitrate, sampleRate, channels, aacEncoder, aacProfile string) (audioParams, []string, error) {
+	params, err := parseAudioParams(bitrate, sampleRate, channels)
+	if err != nil {
+		return params, nil, err
+	}
+	if err := params.validateFor("mp4"); err != nil {
+		return params, nil, err
+	}
+	if params.Channels == 1 && aacProfile == "he_v2" {
+		return params, nil, fmt.Errorf("el perfil he_v2 requiere audio estéreo")
+	}
+
+	var aacArgs []string
+	if aacEncoder != "" || aacProfile != "" {
+		if aacArgs, err = aacEncoderArgs(aacEncoder, aacProfile); err != nil {
+			return params, nil, err
+		}
+	}
+	return params, aacArgs, nil
+}
+
+// apply reemplaza -b:a, -ar, -ac y el codec PCM en las opciones del
+// formato, o las agrega
+func (params audioParams) apply(args []string) []string {
+	if params.Bitrate != 0 {
+		args = setOutputOption(args, "-b:a", strconv.Itoa(params.Bitrate))
+	}
+	if params.SampleRate != 0 {
+		args = setOutputOption(args, "-ar", strconv.Itoa(params.SampleRate))
+	}
+	if params.Channels != 0 {
+		args = setOutputOption(args, "-ac", strconv.Itoa(params.Channels))
+	}
+	if params.SampleFormat != "" {
+		args = setOutputOption(args, "-c:a", sampleFormatCodecs[params.SampleFormat])
+	}
+	return args
+}
+
+// setOutputOption cambia el valor de una opción ya presente o la agrega al final
+func setOutputOption(args []string, option, value string) []string {
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == option {
+			updated := append([]string{}, args...)
+			updated[i+1] = value
+			return updated
+		}
+	}
+	return append(args, option, value)
+}
+
+// removeOutputOption quita una opción y su valor
+func removeOutputOption(args []string, option string) []string {
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == option {
+			return append(append([]string{}, args[:i]...), args[i+2:]...)
+		}
+	}
+	return args
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonScalar convierte un número o texto de un cuerpo JSON al valor que
+// tendría como campo de formulario
+func jsonScalar(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
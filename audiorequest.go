@@ -0,0 +1,377 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// audioRequest es una solicitud de /process-audio ya leída: las opciones de
+// la conversión y cómo se reparten y entregan las salidas
+type audioRequest struct {
+	opts audioOptions
+	// preset es el preset pedido o el que eligió target
+	preset string
+	// outputFormat es el output_format enviado en el formulario, "" si el
+	// formato salió de la negociación o del target
+	outputFormat string
+	formatsParam string
+	// opusTuning indica que se envió application, vbr o frame_duration
+	opusTuning     bool
+	batch          bool
+	splitChannels  bool
+	segmentSeconds float64
+	hls            *hlsOptions
+	emailTo        string
+	s3Dest         *s3Destination
+	callbackURL    string
+	// async encola la conversión sin callback_url; el resultado se consulta
+	// en /jobs/:id
+	async     bool
+	fastStart bool
+	binary    bool
+}
+
+// audioConflict es una combinación de opciones que /process-audio rechaza.
+// En message, {format} se reemplaza por el formato de salida.
+type audioConflict struct {
+	param   string
+	applies func(req *audioRequest) bool
+	message string
+	// missing indica que falta un parámetro, no que sobra
+	missing bool
+}
+
+// audioConflicts se revisan en orden; se informa la primera que aplica
+var audioConflicts = []audioConflict{
+	{"target", func(req *audioRequest) bool {
+		return req.opts.Target != nil && (req.outputFormat != "" || req.formatsParam != "")
+	}, "target elige el formato; no se puede combinar con output_format ni output_formats", false},
+	{"preset", func(req *audioRequest) bool {
+		return req.opts.WhatsAppVoice && ((req.outputFormat != "" && req.outputFormat != "ogg") || req.formatsParam != "")
+	}, "el preset whatsapp_voice solo produce ogg", false},
+	{"preset", func(req *audioRequest) bool {
+		return req.opts.WhatsAppVoice && req.opusTuning
+	}, "el preset whatsapp_voice fija application, vbr y frame_duration", false},
+	{"preset", func(req *audioRequest) bool {
+		return req.opts.MusicOpus && ((req.outputFormat != "" && req.outputFormat != "ogg") || req.formatsParam != "")
+	}, "el preset music-opus solo produce ogg", false},
+	{"preset", func(req *audioRequest) bool {
+		return req.opts.MusicOpus && req.opusTuning
+	}, "el preset music-opus fija application, vbr y frame_duration", false},
+	{"preset", func(req *audioRequest) bool {
+		return req.opts.WhatsAppVoice && req.opts.Params.isSet()
+	}, "el preset whatsapp_voice fija bitrate, sample_rate y channels; use opus_bitrate (16k a 24k)", false},
+	{"preset", func(req *audioRequest) bool {
+		return req.opts.MusicOpus && req.opts.Params.isSet()
+	}, "el preset music-opus fija bitrate, sample_rate y channels; use opus_bitrate (96k a 128k)", false},
+	{"split_channels", func(req *audioRequest) bool {
+		return req.splitChannels && (req.opts.ChannelLayout != nil || req.formatsParam != "" || req.batch)
+	}, "split_channels no se combina con channel_layout, output_formats ni varios archivos", false},
+	{"preset", func(req *audioRequest) bool {
+		return req.splitChannels && req.opts.MusicOpus
+	}, "el preset music-opus es estéreo: no se combina con split_channels", false},
+	{"auto_profile", func(req *audioRequest) bool {
+		return req.opts.AutoProfile && (req.preset != "" || req.formatsParam != "" || req.opts.Format != "ogg" ||
+			req.opts.opusArgs != nil || req.opts.Params.isSet() || req.splitChannels)
+	}, "auto_profile elige el perfil de la salida ogg: no se combina con preset, output_formats, otro output_format, opciones de opus, bitrate/sample_rate/channels ni split_channels", false},
+	{"normalize", func(req *audioRequest) bool {
+		return req.opts.Normalize && req.opts.ReplayGain
+	}, "normalize y replaygain son excluyentes", false},
+	{"gain_db", func(req *audioRequest) bool {
+		return req.opts.GainDB != 0 && (req.opts.Normalize || req.opts.ReplayGain)
+	}, "gain_db no se combina con normalize ni replaygain", false},
+	{"cover", func(req *audioRequest) bool {
+		return req.opts.Cover != nil && req.formatsParam == "" && !coverArtFormats[req.opts.Format]
+	}, "el formato {format} no admite carátula (mp3, m4a, alac o flac)", false},
+	{"chapters", func(req *audioRequest) bool {
+		return req.opts.Chapters != nil && req.formatsParam == "" && req.opts.Format != "mp3"
+	}, "chapters solo se escriben en mp3, no en {format}", false},
+	{"target_duration", func(req *audioRequest) bool {
+		return req.opts.TargetDuration > 0 && (req.batch || req.opts.Speed != 1 || req.opts.Trim.isSet() || req.opts.SilenceRemoval != nil)
+	}, "target_duration no se combina con varios archivos, speed, start/duration/end ni remove_silence", false},
+	{"pad_to_duration", func(req *audioRequest) bool {
+		return req.opts.Padding != nil && (req.batch || req.opts.Trim.isSet() || req.opts.SilenceRemoval != nil || req.opts.TargetDuration > 0)
+	}, "pad_to_duration no se combina con varios archivos, start/duration/end, remove_silence ni target_duration", false},
+	// replaygain mide el loudness de la entrada: las opciones que cambian el
+	// nivel o el contenido de la salida dejarían etiquetas incorrectas
+	{"replaygain", func(req *audioRequest) bool {
+		opts := req.opts
+		return opts.ReplayGain && (opts.Trim.isSet() || opts.Speed != 1 || opts.TargetDuration > 0 || opts.SilenceRemoval != nil ||
+			opts.Denoise != nil || opts.Compressor != nil || opts.Limiter != nil)
+	}, "replaygain no se combina con start/duration/end, speed, target_duration, remove_silence, denoise, compress_dynamics ni true_peak_limit", false},
+	{"s3_presigned_url", func(req *audioRequest) bool {
+		return req.s3Dest != nil && req.s3Dest.PresignedURL != "" && req.formatsParam != ""
+	}, "s3_presigned_url admite una sola salida; use s3_bucket/s3_key con output_formats", false},
+	{"s3_bucket", func(req *audioRequest) bool {
+		return req.batch && req.s3Dest != nil
+	}, "la subida a S3 admite un solo archivo de entrada", false},
+	{"split_channels", func(req *audioRequest) bool {
+		return req.splitChannels && (req.emailTo != "" || (req.s3Dest != nil && req.s3Dest.PresignedURL != ""))
+	}, "split_channels produce varias salidas: no admite email_to ni s3_presigned_url", false},
+	{"segment_seconds", func(req *audioRequest) bool {
+		return req.segmentSeconds > 0 && (req.splitChannels || req.formatsParam != "" || req.batch || req.emailTo != "" || req.s3Dest != nil)
+	}, "segment_seconds no se combina con split_channels, output_formats, varios archivos, email_to ni S3", false},
+	{"segment_seconds", func(req *audioRequest) bool {
+		return req.segmentSeconds > 0 && (req.opts.Cover != nil || req.opts.ReplayGain || req.opts.Chapters != nil)
+	}, "segment_seconds no admite carátula, replaygain ni chapters", false},
+	{"output_format", func(req *audioRequest) bool {
+		return req.hls != nil && (req.splitChannels || req.formatsParam != "" || req.batch || req.emailTo != "" || req.segmentSeconds > 0 || req.opts.ReplayGain)
+	}, "output_format=hls no se combina con split_channels, output_formats, varios archivos, email_to, segment_seconds ni replaygain", false},
+	{"output_format", func(req *audioRequest) bool {
+		return req.hls != nil && req.s3Dest != nil && req.s3Dest.PresignedURL != ""
+	}, "output_format=hls sube varios archivos: use s3_bucket/s3_key", false},
+	{"stream_hash", func(req *audioRequest) bool {
+		return req.opts.StreamHash != "" && (req.splitChannels || req.formatsParam != "" || req.segmentSeconds > 0 || req.hls != nil)
+	}, "stream_hash admite una sola salida: no se combina con split_channels, output_formats, segment_seconds ni output_format=hls", false},
+	{"output_format", func(req *audioRequest) bool {
+		return req.queued() && req.hls != nil && req.s3Dest == nil
+	}, "output_format=hls con callback_url o async=true requiere s3_bucket/s3_key", true},
+	{"fast_start", func(req *audioRequest) bool {
+		return req.fastStart && (!req.queued() || req.batch)
+	}, "fast_start requiere callback_url o async=true y un solo archivo de entrada", true},
+	// Los tramos y el HLS sin S3 tienen su propia respuesta binaria (ZIP o
+	// multipart), y en un trabajo la respuesta es el trabajo
+	{"response", func(req *audioRequest) bool {
+		return req.binary && !req.queued() && req.segmentSeconds == 0 && req.hls == nil && req.s3Dest == nil &&
+			(req.formatsParam != "" || req.batch || req.splitChannels)
+	}, "response=binary solo admite un archivo y un formato de salida", false},
+}
+
+// queued indica que la conversión se encola como trabajo en lugar de
+// responderse en la misma solicitud
+func (req *audioRequest) queued() bool {
+	return req.callbackURL != "" || req.async
+}
+
+// checkConflicts devuelve el error de la primera combinación rechazada
+func (req *audioRequest) checkConflicts() error {
+	for _, conflict := range audioConflicts {
+		if !conflict.applies(req) {
+			continue
+		}
+		message := strings.ReplaceAll(conflict.message, "{format}", req.opts.Format)
+		if conflict.missing {
+			return missingParam(conflict.param, "%s", message)
+		}
+		return conflictingParams(conflict.param, "%s", message)
+	}
+	return nil
+}
+
+// parseAudioRequest lee y valida las opciones de /process-audio. batch indica
+// que llegaron varios archivos. No mira la entrada: target_duration y
+// pad_to_duration se calculan después con su duración.
+func parseAudioRequest(c *gin.Context, batch bool) (*audioRequest, error) {
+	ctx := c.Request.Context()
+	req := &audioRequest{
+		// codec_copy=false obliga a recodificar aunque el codec de origen coincida
+		opts: audioOptions{
+			Format:           negotiateFormat(c, audioNegotiationFormats, "ogg"),
+			DisableCodecCopy: c.PostForm("codec_copy") == "false",
+			ReplayGain:       c.PostForm("replaygain") == "true",
+			Dither:           c.PostForm("dither"),
+			AnalyzeStereo:    c.PostForm("analyze_stereo") == "true",
+			MonoDownmixSafe:  c.PostForm("mono_downmix_safe") == "true",
+			// auto_profile=true analiza el ancho de banda y los canales de la
+			// entrada para elegir entre el ogg de voz y music-opus
+			AutoProfile: c.PostForm("auto_profile") == "true",
+		},
+		preset:       c.PostForm("preset"),
+		outputFormat: c.PostForm("output_format"),
+		formatsParam: c.PostForm("output_formats"),
+		opusTuning:   c.PostForm("application") != "" || c.PostForm("vbr") != "" || c.PostForm("frame_duration") != "",
+		batch:        batch,
+		// split_channels=true entrega cada canal en un archivo mono, p. ej. el
+		// agente y el cliente de una llamada grabada en estéreo
+		splitChannels: c.PostForm("split_channels") == "true",
+		emailTo:       c.PostForm("email_to"),
+		// async=true encola la conversión y devuelve un job_id para consultar en /jobs/:id
+		async: c.PostForm("async") == "true" || c.Query("async") == "true",
+		// fast_start devuelve una vista previa rápida mientras la conversión
+		// completa sigue en segundo plano
+		fastStart: c.PostForm("fast_start") == "true" || c.Query("fast_start") == "true",
+		binary:    wantsBinaryResponse(c, ""),
+	}
+	opts := &req.opts
+	var err error
+
+	if err := validateDither(opts.Dither); err != nil {
+		return nil, err
+	}
+	if c.PostForm("aac_encoder") != "" || c.PostForm("aac_profile") != "" {
+		if opts.aacArgs, err = aacEncoderArgs(c.PostForm("aac_encoder"), c.PostForm("aac_profile")); err != nil {
+			return nil, err
+		}
+	}
+	if c.PostForm("mp3_vbr") != "" || c.PostForm("mp3_joint_stereo") != "" {
+		if opts.mp3Args, err = mp3EncoderArgs(c.PostForm("mp3_vbr"), c.PostForm("mp3_joint_stereo")); err != nil {
+			return nil, err
+		}
+	}
+	if c.PostForm("flac_compression") != "" {
+		if opts.flacArgs, err = flacEncoderArgs(c.PostForm("flac_compression")); err != nil {
+			return nil, err
+		}
+	}
+	if c.PostForm("opus_bitrate") != "" || req.opusTuning {
+		if opts.opusArgs, err = opusEncoderArgs(c.PostForm("opus_bitrate"), c.PostForm("application"), c.PostForm("vbr"), c.PostForm("frame_duration")); err != nil {
+			return nil, err
+		}
+	}
+	// target elige el formato (y el preset) más compatible con la plataforma
+	if opts.Target, err = lookupPlatformTarget(c.PostForm("target")); err != nil {
+		return nil, err
+	}
+	if opts.Target != nil {
+		opts.Format = opts.Target.AudioFormat
+		if req.preset == "" {
+			req.preset = opts.Target.AudioPreset
+		}
+	}
+	// preset=whatsapp_voice produce una nota de voz (PTT) que WhatsApp acepta
+	switch req.preset {
+	case "":
+	case whatsappVoicePreset:
+		opts.Format = "ogg"
+		opts.WhatsAppVoice = true
+		if opts.opusArgs, err = whatsappVoiceOpusArgs(c.PostForm("opus_bitrate")); err != nil {
+			return nil, err
+		}
+	case musicOpusPreset:
+		opts.Format = "ogg"
+		opts.MusicOpus = true
+		if opts.opusArgs, err = musicOpusArgs(c.PostForm("opus_bitrate")); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, invalidParam("preset", "preset desconocido %q (whatsapp_voice o music-opus)", req.preset)
+	}
+
+	// bitrate, sample_rate y channels se validan contra cada formato pedido
+	if opts.Params, err = parseAudioParams(c.PostForm("bitrate"), c.PostForm("sample_rate"), c.PostForm("channels")); err != nil {
+		return nil, err
+	}
+	// sample_fmt fuerza la profundidad de las salidas wav
+	if opts.Params.SampleFormat, err = parseSampleFormat(c.PostForm("sample_fmt")); err != nil {
+		return nil, err
+	}
+	if err := validateAudioParams(*opts, req.formatsParam, c.PostForm("mp3_vbr"), c.PostForm("aac_profile")); err != nil {
+		return nil, err
+	}
+	// channel_layout reordena o extrae canales (left, right, swap, 1,0...)
+	if opts.ChannelLayout, err = parseChannelLayout(c.PostForm("channel_layout")); err != nil {
+		return nil, err
+	}
+	for _, format := range append(parseOutputFormats(req.formatsParam), opts.Format) {
+		if err := opts.ChannelLayout.validateFor(format, opts.Params); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Trim, err = parseAudioTrim(c.PostForm("start"), c.PostForm("duration"), c.PostForm("end")); err != nil {
+		return nil, err
+	}
+	// normalize=true iguala el loudness percibido (normalize_target, -16 LUFS por defecto)
+	if c.PostForm("normalize") == "true" {
+		opts.Normalize = true
+		if opts.NormalizeTarget, err = parseNormalizeTarget(c.PostForm("normalize_target")); err != nil {
+			return nil, err
+		}
+	}
+	// remove_silence=true quita las pausas largas antes de codificar
+	if c.PostForm("remove_silence") == "true" {
+		if opts.SilenceRemoval, err = parseSilenceRemoval(c.PostForm("silence_threshold"), c.PostForm("silence_min_duration")); err != nil {
+			return nil, err
+		}
+	}
+	// denoise limpia grabaciones ruidosas (p. ej. antes de transcribir)
+	if opts.Denoise, err = parseDenoise(c.PostForm("denoise"), c.PostForm("denoise_strength")); err != nil {
+		return nil, err
+	}
+	// compress_dynamics nivela la voz al estilo de una emisión de radio
+	if opts.Compressor, err = parseCompressor(c.PostForm("compress_dynamics"), c.PostForm("compress_threshold"),
+		c.PostForm("compress_ratio"), c.PostForm("compress_attack"), c.PostForm("compress_release")); err != nil {
+		return nil, err
+	}
+	// gain_db sube una cantidad fija las grabaciones bajas (o baja las
+	// fuertes); normalize y replaygain ya deciden la ganancia por su cuenta
+	if opts.GainDB, err = parseGain(c.PostForm("gain_db")); err != nil {
+		return nil, err
+	}
+	// true_peak_limit=true evita que la salida supere el techo de true peak
+	// (true_peak_ceiling, -1 dBTP por defecto) después de la ganancia
+	if opts.Limiter, err = parseTruePeakLimiter(c.PostForm("true_peak_limit"), c.PostForm("true_peak_ceiling")); err != nil {
+		return nil, err
+	}
+	// telephony_container=raw entrega ulaw/alaw sin cabecera, como los
+	// prompts .ulaw/.alaw de Asterisk
+	if opts.TelephonyRaw, err = parseTelephonyContainer(c.PostForm("telephony_container")); err != nil {
+		return nil, err
+	}
+	// metadata etiqueta la salida (ID3 en MP3, átomos en M4A)
+	if opts.Metadata, err = parseMetadataTags(c.PostForm("metadata")); err != nil {
+		return nil, err
+	}
+	// cover, cover_base64 o cover_url embeben una carátula (mp3, m4a, alac, flac)
+	if opts.Cover, err = getCoverData(c); err != nil {
+		return nil, err
+	}
+	// chapters agrega capítulos ID3 al MP3 para las apps de podcast
+	if opts.Chapters, err = parseChapters(c.PostForm("chapters")); err != nil {
+		return nil, err
+	}
+	// speed acelera o ralentiza la reproducción conservando el tono
+	if opts.Speed, err = parseSpeed(c.PostForm("speed")); err != nil {
+		return nil, err
+	}
+	// pitch_semitones cambia el tono sin alterar el tempo (anonimización de voz)
+	if opts.PitchSemitones, err = parsePitchSemitones(c.PostForm("pitch_semitones")); err != nil {
+		return nil, err
+	}
+	// target_duration estira o comprime la toma a una duración exacta (±20%),
+	// p. ej. para encajar una locución en un espacio publicitario fijo
+	if opts.TargetDuration, err = parseTargetDuration(c.PostForm("target_duration")); err != nil {
+		return nil, err
+	}
+	// pad_to_duration completa con silencio hasta una duración exacta, p. ej.
+	// para los prompts de longitud fija de un IVR
+	if opts.Padding, err = parseDurationPadding(c.PostForm("pad_to_duration"), c.PostForm("pad_position")); err != nil {
+		return nil, err
+	}
+	// stream_hash compara el audio decodificado de la entrada y la salida, p. ej.
+	// para verificar que un cambio de contenedor conservó el contenido
+	if opts.StreamHash, err = parseStreamHash(c.PostForm("stream_hash")); err != nil {
+		return nil, err
+	}
+
+	if req.emailTo != "" {
+		if err := checkTokenGrant(ctx, "email"); err != nil {
+			return nil, err
+		}
+	}
+	// s3_bucket/s3_key o s3_presigned_url suben el resultado en lugar de devolverlo
+	if req.s3Dest, err = parseS3Destination(c); err != nil {
+		return nil, err
+	}
+	// segment_seconds corta la salida en tramos de duración fija, p. ej. para
+	// pipelines de ingesta en streaming
+	if req.segmentSeconds, err = parseSegmentSeconds(c.PostForm("segment_seconds")); err != nil {
+		return nil, err
+	}
+	// output_format=hls empaqueta la salida en segmentos para streaming
+	// progresivo; se entrega como ZIP o se sube con s3_bucket/s3_key
+	if opts.Format == "hls" {
+		if req.hls, err = parseHLSOptions(c.PostForm("hls_segment_seconds"), c.PostForm("hls_segment_type")); err != nil {
+			return nil, err
+		}
+	}
+	// Con callback_url la conversión se encola y el resultado se envía por POST
+	if req.callbackURL, err = parseCallbackURL(ctx, c.PostForm("callback_url")); err != nil {
+		return nil, err
+	}
+
+	if err := req.checkConflicts(); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
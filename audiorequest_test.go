@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseAudioRequestConflicts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name      string
+		form      url.Values
+		batch     bool
+		wantCode  string
+		wantParam string
+	}{
+		{"sin conflictos", url.Values{"output_format": {"mp3"}, "normalize": {"true"}}, false, "", ""},
+		{"preset con otro formato", url.Values{"preset": {"whatsapp_voice"}, "output_format": {"mp3"}}, false, "conflicting_parameters", "preset"},
+		{"normalize y replaygain", url.Values{"normalize": {"true"}, "replaygain": {"true"}}, false, "conflicting_parameters", "normalize"},
+		{"carátula en ogg", url.Values{"cover_base64": {"iVBORw0KGgoAAAANSUhEUg=="}}, false, "conflicting_parameters", "cover"},
+		{"target_duration con varios archivos", url.Values{"target_duration": {"30"}}, true, "conflicting_parameters", "target_duration"},
+		{"fast_start sin callback", url.Values{"fast_start": {"true"}}, false, "missing_parameter", "fast_start"},
+		{"fast_start asíncrono", url.Values{"fast_start": {"true"}, "async": {"true"}}, false, "", ""},
+		{"fast_start asíncrono con varios archivos", url.Values{"fast_start": {"true"}, "async": {"true"}}, true, "missing_parameter", "fast_start"},
+		{"binario con varios formatos", url.Values{"output_formats": {"mp3,ogg"}, "response": {"binary"}}, false, "conflicting_parameters", "response"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/process-audio", strings.NewReader(tt.form.Encode()))
+			c.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			_, err := parseAudioRequest(c, tt.batch)
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Fatalf("parseAudioRequest() error = %v", err)
+				}
+				return
+			}
+			var reqErr *requestError
+			if !errors.As(err, &reqErr) {
+				t.Fatalf("parseAudioRequest() error = %v, se esperaba %s", err, tt.wantCode)
+			}
+			if reqErr.code != tt.wantCode || reqErr.param != tt.wantParam {
+				t.Errorf("error = %s/%s, want %s/%s", reqErr.code, reqErr.param, tt.wantCode, tt.wantParam)
+			}
+		})
+	}
+}
+
+func TestVideoToMp4Conflicts(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      videoToMp4Options
+		wantParam string
+	}{
+		{"sin conflictos", videoToMp4Options{TargetDuration: 30}, ""},
+		{"target_duration con timelapse", videoToMp4Options{TargetDuration: 30, Timelapse: &timelapseOptions{}}, "target_duration"},
+		{"parallel con relleno", videoToMp4Options{Parallel: true, Padding: &durationPadding{}}, "parallel"},
+		{"fast_start sincrónico", videoToMp4Options{FastStart: true}, "fast_start"},
+		{"fast_start asíncrono", videoToMp4Options{FastStart: true, Async: true}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.checkConflicts()
+			var reqErr *requestError
+			if tt.wantParam == "" {
+				if err != nil {
+					t.Fatalf("checkConflicts() error = %v", err)
+				}
+				return
+			}
+			if !errors.As(err, &reqErr) || reqErr.param != tt.wantParam {
+				t.Errorf("checkConflicts() error = %v, want param %q", err, tt.wantParam)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	// deletionAudit registra una constancia por solicitud cuando se liberan
+	// sus entradas; deletionAuditFile es el archivo JSON Lines de destino
+	// (vacío escribe en stdout)
+	deletionAudit     bool
+	deletionAuditFile string
+
+	deletionAuditMu sync.Mutex
+)
+
+func loadAuditConfig() {
+	deletionAudit = envBool("DELETION_AUDIT", false)
+	deletionAuditFile = os.Getenv("DELETION_AUDIT_FILE")
+}
+
+// retainedCopy es una copia de una entrada que sobrevive a la solicitud, con
+// la fecha en que se borra a más tardar
+type retainedCopy struct {
+	Store     string `json:"store"`
+	ID        string `json:"id,omitempty"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+// retain anota que una copia de las entradas se guardó en store hasta
+// expiresAt (captura de depuración, muestra en cuarentena, caché de URLs)
+func (info *requestInfo) retain(store, id string, expiresAt time.Time) {
+	info.Retained = append(info.Retained, retainedCopy{
+		Store:     store,
+		ID:        id,
+		ExpiresAt: expiresAt.UTC().Format(time.RFC3339),
+	})
+}
+
+// deletionRecord es la constancia de que las entradas de una solicitud se
+// liberaron: solo identifica las entradas por su SHA-256 y tamaño
+type deletionRecord struct {
+	Event     string         `json:"event"`
+	RequestID string         `json:"request_id"`
+	JobID     string         `json:"job_id,omitempty"`
+	Endpoint  string         `json:"endpoint"`
+	Inputs    []deletedInput `json:"inputs"`
+	Retained  []retainedCopy `json:"retained"`
+	DeletedAt string         `json:"deleted_at"`
+}
+
+type deletedInput struct {
+	SHA256 string `json:"sha256"`
+	Size   int    `json:"size"`
+}
+
+// releaseInputs suelta las entradas de la solicitud, con éxito o con error,
+// y registra la constancia. Los archivos temporales de ffmpeg ya se borraron
+// al terminar cada conversión.
+func releaseInputs(info *requestInfo) {
+	inputs := info.Inputs
+	info.Inputs = nil
+	if !deletionAudit || len(inputs) == 0 {
+		return
+	}
+
+	record := deletionRecord{
+		Event:     "inputs_deleted",
+		RequestID: info.ID,
+		JobID:     info.JobID,
+		Endpoint:  info.Endpoint,
+		Retained:  info.Retained,
+		DeletedAt: time.Now().UTC().Format(time.RFC3339Nano),
+	}
+	if record.Retained == nil {
+		record.Retained = []retainedCopy{}
+	}
+	for _, input := range inputs {
+		record.Inputs = append(record.Inputs, deletedInput{SHA256: input.Hash, Size: len(input.Data)})
+	}
+	writeDeletionRecord(record)
+}
+
+func writeDeletionRecord(record deletionRecord) {
+	line, err := json.Marshal(record)
+	if err != nil {
+		fmt.Printf("[audit] Error al serializar la constancia de %s: %v\n", record.RequestID, err)
+		return
+	}
+
+	deletionAuditMu.Lock()
+	defer deletionAuditMu.Unlock()
+	if deletionAuditFile == "" {
+		fmt.Printf("[audit] %s\n", line)
+		return
+	}
+	file, err := os.OpenFile(deletionAuditFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		fmt.Printf("[audit] No se pudo abrir %s: %v\n", deletionAuditFile, err)
+		return
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		fmt.Printf("[audit] No se pudo escribir la constancia de %s: %v\n", record.RequestID, err)
+	}
+}
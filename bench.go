@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// benchPipeline es una conversión que el modo bench ejecuta en bucle
+type benchPipeline struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// benchStats acumula las latencias de un pipeline
+type benchStats struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+	errors    int
+	lastError string
+}
+
+func (s *benchStats) record(latency time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.errors++
+		s.lastError = truncateErrorMessage(err.Error())
+		return
+	}
+	s.latencies = append(s.latencies, latency)
+}
+
+// benchResult es el resumen de un pipeline, en milisegundos
+type benchResult struct {
+	Pipeline   string  `json:"pipeline"`
+	Operations int     `json:"operations"`
+	Errors     int     `json:"errors"`
+	LastError  string  `json:"last_error,omitempty"`
+	Throughput float64 `json:"throughput_per_sec"`
+	P50        float64 `json:"p50_ms"`
+	P95        float64 `json:"p95_ms"`
+	P99        float64 `json:"p99_ms"`
+	Max        float64 `json:"max_ms"`
+}
+
+// benchReport es la salida completa del modo bench
+type benchReport struct {
+	FFmpeg      string        `json:"ffmpeg"`
+	GoVersion   string        `json:"go_version"`
+	CPUs        int           `json:"cpus"`
+	Concurrency int           `json:"concurrency"`
+	Duration    float64       `json:"duration_sec"`
+	Pipelines   []benchResult `json:"pipelines"`
+	// HeapPeak es el máximo de memoria del proceso Go observado durante la
+	// carga; FFmpegMaxRSS el máximo de un proceso ffmpeg (0 si no se conoce)
+	HeapPeak     uint64 `json:"heap_peak_bytes"`
+	SysMemory    uint64 `json:"sys_bytes"`
+	GCCycles     uint32 `json:"gc_cycles"`
+	FFmpegMaxRSS int64  `json:"ffmpeg_max_rss_bytes"`
+}
+
+// runBench atiende el subcomando bench: ejecuta carga sintética contra los
+// pipelines locales (sin HTTP) para comparar builds de ffmpeg y tipos de
+// instancia. Devuelve el código de salida del proceso.
+func runBench(args []string) int {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	pipelines := flags.String("pipelines", "ogg,mp3", "pipelines separados por coma: formatos de audio (ogg, mp3, ...), image (PNG) o video (GIF a MP4)")
+	concurrency := flags.Int("concurrency", runtime.NumCPU(), "conversiones simultáneas")
+	duration := flags.Duration("duration", 30*time.Second, "duración de la carga")
+	input := flags.String("input", "", "archivo de audio a usar en lugar del tono sintético")
+	seconds := flags.Float64("seconds", 10, "duración del tono sintético en segundos")
+	asJSON := flags.Bool("json", false, "imprime el resultado en JSON")
+	verbose := flags.Bool("verbose", false, "muestra los logs de cada conversión")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *concurrency < 1 || *duration <= 0 || *seconds <= 0 {
+		fmt.Fprintln(os.Stderr, "concurrency, duration y seconds deben ser positivos")
+		return 2
+	}
+
+	audio := syntheticWAV(*seconds, 48000)
+	if *input != "" {
+		data, err := os.ReadFile(*input)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "No se pudo leer %s: %v\n", *input, err)
+			return 1
+		}
+		audio = data
+	}
+
+	selected, err := benchPipelines(*pipelines, audio)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	// Los pipelines escriben sus logs en stdout; se descartan salvo con
+	// -verbose para que el reporte se pueda leer
+	out := os.Stdout
+	if !*verbose {
+		if devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0); err == nil {
+			os.Stdout = devNull
+			defer func() {
+				os.Stdout = out
+				devNull.Close()
+			}()
+		}
+	}
+	fmt.Fprintf(os.Stderr, "[bench] %d pipelines, concurrencia %d, %s\n", len(selected), *concurrency, *duration)
+
+	report := benchRun(selected, *concurrency, *duration)
+	os.Stdout = out
+	if *asJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+	} else {
+		printBenchReport(out, report)
+	}
+
+	for _, result := range report.Pipelines {
+		if result.Errors > 0 {
+			return 1
+		}
+	}
+	return 0
+}
+
+// benchPipelines arma los pipelines pedidos. Los formatos de audio usan la
+// misma conversión que /process-audio sin copia de códec, para medir siempre
+// el codificador; image y video son los mismos casos del self-test.
+func benchPipelines(list string, audio []byte) ([]benchPipeline, error) {
+	var selected []benchPipeline
+	for _, name := range parseOutputFormats(strings.ToLower(list)) {
+		switch name {
+		case "image":
+			image := syntheticPNG()
+			selected = append(selected, benchPipeline{name: name, run: func(ctx context.Context) error {
+				_, err := convertImageToPng(ctx, image)
+				return err
+			}})
+		case "video":
+			gif := syntheticGIF()
+			selected = append(selected, benchPipeline{name: name, run: func(ctx context.Context) error {
+				_, err := convertGifToMp4(ctx, gif)
+				return err
+			}})
+		default:
+			format := name
+			selected = append(selected, benchPipeline{name: format, run: func(ctx context.Context) error {
+				data, _, err := convertAudio(ctx, audio, audioOptions{Format: format, DisableCodecCopy: true})
+				if err == nil && len(data) == 0 {
+					err = fmt.Errorf("salida vacía")
+				}
+				return err
+			}})
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no se indicó ningún pipeline (formatos de audio, image o video)")
+	}
+	return selected, nil
+}
+
+// benchRun reparte los pipelines en turnos entre los workers hasta cumplir
+// la duración y muestrea la memoria mientras tanto
+func benchRun(pipelines []benchPipeline, concurrency int, duration time.Duration) benchReport {
+	stats := make([]*benchStats, len(pipelines))
+	for i := range stats {
+		stats[i] = &benchStats{}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	// heapPeak solo lo escribe el muestreo; se lee después de sampleDone
+	var heapPeak uint64
+	sampleDone := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(250 * time.Millisecond)
+		defer ticker.Stop()
+		var mem runtime.MemStats
+		for {
+			runtime.ReadMemStats(&mem)
+			if mem.HeapAlloc > heapPeak {
+				heapPeak = mem.HeapAlloc
+			}
+			select {
+			case <-ctx.Done():
+				close(sampleDone)
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	started := time.Now()
+	var wg sync.WaitGroup
+	for worker := 0; worker < concurrency; worker++ {
+		wg.Add(1)
+		go func(next int) {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				index := next % len(pipelines)
+				next++
+				opStart := time.Now()
+				err := pipelines[index].run(ctx)
+				// Las conversiones cortadas por el fin de la carga no cuentan
+				if ctx.Err() != nil {
+					return
+				}
+				stats[index].record(time.Since(opStart), err)
+			}
+		}(worker)
+	}
+	wg.Wait()
+	<-sampleDone
+	elapsed := time.Since(started)
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	report := benchReport{
+		FFmpeg:       ffmpegVersionLine(),
+		GoVersion:    runtime.Version(),
+		CPUs:         runtime.NumCPU(),
+		Concurrency:  concurrency,
+		Duration:     elapsed.Seconds(),
+		HeapPeak:     heapPeak,
+		SysMemory:    mem.Sys,
+		GCCycles:     mem.NumGC,
+		FFmpegMaxRSS: childMaxRSS(),
+	}
+	for i, pipeline := range pipelines {
+		report.Pipelines = append(report.Pipelines, stats[i].summary(pipeline.name, elapsed))
+	}
+	return report
+}
+
+func (s *benchStats) summary(name string, elapsed time.Duration) benchResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sort.Slice(s.latencies, func(i, j int) bool { return s.latencies[i] < s.latencies[j] })
+	result := benchResult{
+		Pipeline:   name,
+		Operations: len(s.latencies),
+		Errors:     s.errors,
+		LastError:  s.lastError,
+		Throughput: float64(len(s.latencies)) / elapsed.Seconds(),
+	}
+	if len(s.latencies) > 0 {
+		result.P50 = benchPercentile(s.latencies, 0.50)
+		result.P95 = benchPercentile(s.latencies, 0.95)
+		result.P99 = benchPercentile(s.latencies, 0.99)
+		result.Max = float64(s.latencies[len(s.latencies)-1].Microseconds()) / 1000
+	}
+	return result
+}
+
+// benchPercentile usa el método nearest-rank sobre latencias ordenadas
+func benchPercentile(sorted []time.Duration, p float64) float64 {
+	index := int(p*float64(len(sorted)) + 0.5)
+	if index < 1 {
+		index = 1
+	}
+	if index > len(sorted) {
+		index = len(sorted)
+	}
+	return float64(sorted[index-1].Microseconds()) / 1000
+}
+
+// ffmpegVersionLine es la primera línea de ffmpeg -version, para identificar
+// el build medido
+func ffmpegVersionLine() string {
+	output, err := exec.Command("ffmpeg", "-version").Output()
+	if err != nil {
+		return "desconocido"
+	}
+	line, _, _ := strings.Cut(string(output), "\n")
+	return strings.TrimSpace(line)
+}
+
+func printBenchReport(out *os.File, report benchReport) {
+	fmt.Fprintf(out, "ffmpeg:      %s\n", report.FFmpeg)
+	fmt.Fprintf(out, "go:          %s, %d CPUs\n", report.GoVersion, report.CPUs)
+	fmt.Fprintf(out, "carga:       concurrencia %d durante %.1fs\n\n", report.Concurrency, report.Duration)
+
+	table := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(table, "pipeline\tops\terrores\tops/s\tp50 ms\tp95 ms\tp99 ms\tmax ms\t")
+	for _, result := range report.Pipelines {
+		fmt.Fprintf(table, "%s\t%d\t%d\t%.2f\t%.1f\t%.1f\t%.1f\t%.1f\t\n",
+			result.Pipeline, result.Operations, result.Errors, result.Throughput,
+			result.P50, result.P95, result.P99, result.Max)
+	}
+	table.Flush()
+
+	fmt.Fprintf(out, "\nmemoria:     heap máximo %.1f MB, sys %.1f MB, %d ciclos de GC\n",
+		float64(report.HeapPeak)/(1<<20), float64(report.SysMemory)/(1<<20), report.GCCycles)
+	if report.FFmpegMaxRSS > 0 {
+		fmt.Fprintf(out, "ffmpeg:      RSS máximo %.1f MB\n", float64(report.FFmpegMaxRSS)/(1<<20))
+	}
+	for _, result := range report.Pipelines {
+		if result.LastError != "" {
+			fmt.Fprintf(out, "último error en %s: %s\n", result.Pipeline, result.LastError)
+		}
+	}
+}
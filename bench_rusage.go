@@ -0,0 +1,15 @@
+//go:build unix
+
+package main
+
+import "syscall"
+
+// childMaxRSS es el RSS máximo de los procesos hijos (ffmpeg) terminados
+func childMaxRSS() int64 {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_CHILDREN, &usage); err != nil {
+		return 0
+	}
+	// Linux informa Maxrss en KB
+	return int64(usage.Maxrss) * 1024
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// childMaxRSS no está disponible fuera de Unix
+func childMaxRSS() int64 {
+	return 0
+}
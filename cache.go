@@ -0,0 +1,276 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// inputCacheEntry es una versión de una descarga: la URL (con tenants, más el
+// tenant que la pidió; ver tenantCacheKey) y el ETag que la identifica
+type inputCacheEntry struct {
+	key          string
+	url          string
+	data         []byte
+	etag         string
+	lastModified string
+	storedAt     time.Time
+}
+
+// version identifica la entrada en la caché: la misma URL con otro ETag es
+// otro contenido
+func (entry *inputCacheEntry) version() string {
+	return entry.key + "\x00" + entry.etag
+}
+
+// inputCache es un LRU acotado por bytes totales (INPUT_CACHE_MAX_BYTES)
+type inputCache struct {
+	mu sync.Mutex
+	// entries guarda las entradas por versión; latest apunta, por URL, a la
+	// última versión descargada, que es la única que se sirve
+	entries  map[string]*list.Element
+	latest   map[string]string
+	order    *list.List
+	size     int64
+	maxSize  int64
+	maxEntry int64
+	ttl      time.Duration
+	// retention es el tiempo que una entrada vencida se conserva para
+	// revalidarla con If-None-Match/If-Modified-Since
+	retention time.Duration
+}
+
+var remoteInputCache = newInputCache(0, 0, 0, 0)
+
+func newInputCache(ttl time.Duration, retention time.Duration, maxSize int64, maxEntry int64) *inputCache {
+	return &inputCache{
+		entries:   map[string]*list.Element{},
+		latest:    map[string]string{},
+		order:     list.New(),
+		maxSize:   maxSize,
+		maxEntry:  maxEntry,
+		ttl:       ttl,
+		retention: retention,
+	}
+}
+
+func loadCacheConfig() {
+	ttl := envDuration("INPUT_CACHE_TTL", 0)
+	maxSize := envInt64("INPUT_CACHE_MAX_BYTES", 256*1024*1024)
+	maxEntry := envInt64("INPUT_CACHE_MAX_ENTRY_BYTES", 64*1024*1024)
+	retention := envDuration("INPUT_CACHE_REVALIDATE_WINDOW", 24*time.Hour)
+	remoteInputCache = newInputCache(ttl, retention, maxSize, maxEntry)
+
+	if ttl > 0 {
+		fmt.Printf("Caché de entradas remotas habilitada (TTL %s, máximo %d bytes)\n", ttl, maxSize)
+	}
+}
+
+func (ic *inputCache) enabled() bool {
+	return ic.ttl > 0 && ic.maxSize > 0
+}
+
+// get devuelve la entrada y si sigue dentro del TTL. Las entradas vencidas se
+// devuelven mientras estén dentro de la ventana de revalidación. Devuelve una
+// copia tomada bajo ic.mu, porque refresh modifica storedAt en la original.
+func (ic *inputCache) get(key string) (*inputCacheEntry, bool) {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	element, ok := ic.entries[ic.latest[key]]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*inputCacheEntry)
+	age := time.Since(entry.storedAt)
+	if age > ic.ttl+ic.retention {
+		ic.removeElement(element)
+		return nil, false
+	}
+
+	ic.order.MoveToFront(element)
+	copied := *entry
+	return &copied, age <= ic.ttl
+}
+
+// refresh marca la versión como recién validada tras un 304 Not Modified, si
+// sigue en la caché
+func (ic *inputCache) refresh(version string) {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	if element, ok := ic.entries[version]; ok {
+		element.Value.(*inputCacheEntry).storedAt = time.Now()
+	}
+}
+
+// removeElement quita un elemento del LRU. Requiere ic.mu.
+func (ic *inputCache) removeElement(element *list.Element) {
+	entry := element.Value.(*inputCacheEntry)
+	ic.order.Remove(element)
+	delete(ic.entries, entry.version())
+	if ic.latest[entry.key] == entry.version() {
+		delete(ic.latest, entry.key)
+	}
+	ic.size -= int64(len(entry.data))
+}
+
+// put guarda la entrada y devuelve si cupo en la caché
+func (ic *inputCache) put(entry *inputCacheEntry) bool {
+	size := int64(len(entry.data))
+	if size > ic.maxEntry || size > ic.maxSize {
+		return false
+	}
+
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	// Una versión anterior de la URL ya no se sirve
+	if element, ok := ic.entries[ic.latest[entry.key]]; ok {
+		ic.removeElement(element)
+	}
+	if element, ok := ic.entries[entry.version()]; ok {
+		ic.removeElement(element)
+	}
+
+	ic.entries[entry.version()] = ic.order.PushFront(entry)
+	ic.latest[entry.key] = entry.version()
+	ic.size += size
+
+	for ic.size > ic.maxSize {
+		oldest := ic.order.Back()
+		evicted := oldest.Value.(*inputCacheEntry)
+		ic.removeElement(oldest)
+		fmt.Printf("Caché de entradas: expulsada %s (%d bytes)\n", evicted.url, len(evicted.data))
+	}
+	return true
+}
+
+// retainedUntil es el momento en que una entrada guardada ahora se borra a
+// más tardar: el TTL más la ventana de revalidación
+func (ic *inputCache) retainedUntil(storedAt time.Time) time.Time {
+	return storedAt.Add(ic.ttl + ic.retention)
+}
+
+// sweep borra las entradas fuera de la ventana de revalidación aunque nadie
+// vuelva a pedirlas
+func (ic *inputCache) sweep(now time.Time) {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+	for element := ic.order.Back(); element != nil; {
+		previous := element.Prev()
+		if entry := element.Value.(*inputCacheEntry); now.After(ic.retainedUntil(entry.storedAt)) {
+			ic.removeElement(element)
+		}
+		element = previous
+	}
+}
+
+// cleanupInputCache aplica periódicamente la retención de la caché de entradas
+func cleanupInputCache() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if remoteInputCache.enabled() {
+			remoteInputCache.sweep(time.Now())
+		}
+	}
+}
+
+// doCachedRequest ejecuta req usando la caché de entradas remotas. Devuelve el
+// código de estado y el cuerpo; solo las respuestas 200 se guardan en caché,
+// bajo la URL y su ETag. La caché es compartida: dentro del TTL, quien pida
+// la misma URL (con tenants, dentro del mismo tenant) recibe la copia sin que
+// el origen lo autorice de nuevo.
+func doCachedRequest(client *http.Client, req *http.Request) (int, []byte, error) {
+	url := req.URL.String()
+	ctx := req.Context()
+
+	if !remoteInputCache.enabled() {
+		return doRequest(client, req)
+	}
+
+	key := tenantCacheKey(ctx, url)
+	entry, fresh := remoteInputCache.get(key)
+	if fresh {
+		fmt.Printf("Caché de entradas: hit para %s (%d bytes)\n", url, len(entry.data))
+		requestInfoFrom(ctx).retain("input_cache", "", remoteInputCache.retainedUntil(entry.storedAt))
+		appendDebug(ctx, "input_cache", map[string]interface{}{
+			"url":         url,
+			"hit":         true,
+			"age_seconds": int(time.Since(entry.storedAt).Seconds()),
+			"etag":        entry.etag,
+		})
+		return http.StatusOK, entry.data, nil
+	}
+
+	// Entrada vencida: pedir al origen solo si cambió
+	if entry != nil {
+		if entry.etag != "" {
+			req.Header.Set("If-None-Match", entry.etag)
+		}
+		if entry.lastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.lastModified)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && entry != nil {
+		remoteInputCache.refresh(entry.version())
+		requestInfoFrom(ctx).retain("input_cache", "", remoteInputCache.retainedUntil(time.Now()))
+		fmt.Printf("Caché de entradas: %s sin cambios (304), reutilizando %d bytes\n", url, len(entry.data))
+		appendDebug(ctx, "input_cache", map[string]interface{}{
+			"url":         url,
+			"hit":         true,
+			"revalidated": true,
+			"etag":        entry.etag,
+		})
+		return http.StatusOK, entry.data, nil
+	}
+
+	data, err := readInputBody(ctx, resp)
+	if err != nil {
+		return resp.StatusCode, nil, err
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		stored := remoteInputCache.put(&inputCacheEntry{
+			key:          key,
+			url:          url,
+			data:         data,
+			etag:         resp.Header.Get("ETag"),
+			lastModified: resp.Header.Get("Last-Modified"),
+			storedAt:     time.Now(),
+		})
+		if stored {
+			requestInfoFrom(ctx).retain("input_cache", "", remoteInputCache.retainedUntil(time.Now()))
+		}
+	}
+
+	appendDebug(ctx, "input_cache", map[string]interface{}{
+		"url":  url,
+		"hit":  false,
+		"etag": resp.Header.Get("ETag"),
+	})
+	return resp.StatusCode, data, nil
+}
+
+func doRequest(client *http.Client, req *http.Request) (int, []byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := readInputBody(req.Context(), resp)
+	return resp.StatusCode, data, err
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInputCacheVersions(t *testing.T) {
+	ic := newInputCache(time.Minute, time.Hour, 1024, 1024)
+	ic.put(&inputCacheEntry{key: "https://example.com/a.mp3", data: []byte("v1"), etag: `"1"`, storedAt: time.Now()})
+	ic.put(&inputCacheEntry{key: "https://example.com/a.mp3", data: []byte("v2"), etag: `"2"`, storedAt: time.Now()})
+
+	entry, fresh := ic.get("https://example.com/a.mp3")
+	if entry == nil || !fresh || string(entry.data) != "v2" {
+		t.Fatalf("get() = %v, %v; se esperaba la versión 2 vigente", entry, fresh)
+	}
+	if len(ic.entries) != 1 || ic.size != 2 {
+		t.Errorf("la versión anterior sigue en la caché: %d entradas, %d bytes", len(ic.entries), ic.size)
+	}
+}
+
+func TestInputCacheRefreshConcurrent(t *testing.T) {
+	ic := newInputCache(time.Minute, time.Hour, 1024, 1024)
+	stored := &inputCacheEntry{key: "https://example.com/a.mp3", data: []byte("audio"), etag: `"1"`, storedAt: time.Now()}
+	ic.put(stored)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if entry, _ := ic.get(stored.key); entry != nil {
+					_ = time.Since(entry.storedAt)
+					ic.refresh(entry.version())
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
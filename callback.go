@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+type callbackConfig struct {
+	callbackSigningKey  string
+	callbackMaxAttempts int
+	callbackTimeout     time.Duration
+	// callbackAllowedHosts limita los hosts de callback_url; vacío admite
+	// cualquier host con dirección pública
+	callbackAllowedHosts map[string]bool
+}
+
+// callbackClient no sigue redirecciones ni usa el proxy del entorno: cada
+// conexión pasa por dialCallback
+var callbackClient = &http.Client{
+	Transport: &http.Transport{
+		DialContext:         dialCallback,
+		ForceAttemptHTTP2:   true,
+		MaxIdleConns:        10,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// sharedAddressSpace es 100.64.0.0/10 (CGNAT), que netip no considera privado
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// isPublicAddress indica si una dirección es alcanzable en Internet: descarta
+// loopback, redes privadas, link-local (p. ej. el servicio de metadatos de la
+// nube en 169.254.169.254), multicast y la dirección sin especificar
+func isPublicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() && addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
+
+// publicDialer rechaza la conexión después de resolver el host y antes de
+// conectar, así un DNS que cambia entre la validación y el envío no alcanza
+// la red interna. Lo usan los callbacks y las descargas con token.
+var publicDialer = &net.Dialer{
+	Timeout:   30 * time.Second,
+	KeepAlive: 30 * time.Second,
+	Control: func(network, address string, _ syscall.RawConn) error {
+		addrPort, err := netip.ParseAddrPort(address)
+		if err != nil {
+			return err
+		}
+		if !isPublicAddress(addrPort.Addr()) {
+			return fmt.Errorf("el host resuelve a una dirección no pública (%s)", addrPort.Addr())
+		}
+		return nil
+	},
+}
+
+// dialCallback conecta con el host de un callback. Los hosts de
+// CALLBACK_ALLOWED_HOSTS los eligió el operador y pueden estar en la red
+// interna; el resto solo puede resolver a direcciones públicas.
+func dialCallback(ctx context.Context, network, address string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if config().callbackAllowedHosts[strings.ToLower(host)] {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, network, address)
+	}
+	return publicDialer.DialContext(ctx, network, address)
+}
+
+func loadCallbackConfig(cfg *reloadableConfig) {
+	cfg.callbackSigningKey = os.Getenv("CALLBACK_SIGNING_KEY")
+	if cfg.callbackSigningKey == "" {
+		cfg.callbackSigningKey = cfg.apiKey
+	}
+	cfg.callbackMaxAttempts = envInt("CALLBACK_MAX_ATTEMPTS", 3)
+	cfg.callbackTimeout = envDuration("CALLBACK_TIMEOUT", 30*time.Second)
+
+	cfg.callbackAllowedHosts = map[string]bool{}
+	for _, host := range strings.Split(os.Getenv("CALLBACK_ALLOWED_HOSTS"), ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			cfg.callbackAllowedHosts[host] = true
+		}
+	}
+}
+
+// parseCallbackURL valida el callback_url recibido; "" significa sin callback
+func parseCallbackURL(ctx context.Context, raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+	if err := checkTokenGrant(ctx, "callback"); err != nil {
+		return "", err
+	}
+
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return "", errors.New("callback_url debe ser una URL http(s) absoluta")
+	}
+	// La dirección se vuelve a revisar al conectar (ver dialCallback); aquí
+	// se rechaza antes de encolar lo que ya se sabe que no se va a enviar
+	host := strings.ToLower(parsed.Hostname())
+	if allowed := config().callbackAllowedHosts; len(allowed) > 0 {
+		if !allowed[host] {
+			return "", fmt.Errorf("el host %s de callback_url no está en CALLBACK_ALLOWED_HOSTS", host)
+		}
+	} else if addr, err := netip.ParseAddr(host); err == nil && !isPublicAddress(addr) {
+		return "", fmt.Errorf("callback_url no puede apuntar a una dirección no pública (%s)", host)
+	} else if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return "", errors.New("callback_url no puede apuntar a localhost")
+	}
+	return parsed.String(), nil
+}
+
+// deliverCallback envía el estado final del trabajo al callback_url. Se
+// reintenta con espera exponencial si el servidor no responde 2xx.
+func deliverCallback(j *job) {
+	payload := j.view()
+	payload["request_id"] = j.info.ID
+	if len(j.info.Labels) > 0 {
+		payload["labels"] = j.info.Labels
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		fmt.Printf("[callback] Error al serializar el trabajo %s: %v\n", j.ID, err)
+		return
+	}
+
+	cfg := config()
+	mac := hmac.New(sha256.New, []byte(cfg.callbackSigningKey))
+	mac.Write(body)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	backoff := time.Second
+	for attempt := 1; attempt <= cfg.callbackMaxAttempts; attempt++ {
+		err = postCallback(j.CallbackURL, body, signature, j.info.ID, cfg.callbackTimeout)
+		if err == nil {
+			fmt.Printf("[callback] Trabajo %s entregado a %s\n", j.ID, j.CallbackURL)
+			return
+		}
+
+		fmt.Printf("[callback] Intento %d/%d para el trabajo %s falló: %v\n", attempt, cfg.callbackMaxAttempts, j.ID, err)
+		if attempt < cfg.callbackMaxAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+}
+
+func postCallback(target string, body []byte, signature string, requestID string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Signature", signature)
+	req.Header.Set("X-Request-ID", requestID)
+
+	resp, err := callbackClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
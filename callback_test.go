@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseCallbackURLRejectsInternalAddresses(t *testing.T) {
+	withTestConfig(t, func(cfg *reloadableConfig) { cfg.callbackAllowedHosts = map[string]bool{} })
+
+	tests := []struct {
+		url     string
+		wantErr bool
+	}{
+		{"https://hooks.example.com/done", false},
+		{"http://203.0.113.10:8080/done", false},
+		{"http://127.0.0.1/done", true},
+		{"http://[::1]/done", true},
+		{"http://10.0.0.5/done", true},
+		{"http://192.168.1.1/done", true},
+		{"http://169.254.169.254/latest/meta-data", true},
+		{"http://100.64.0.1/done", true},
+		{"http://[::ffff:127.0.0.1]/done", true},
+		{"http://0.0.0.0/done", true},
+		{"http://localhost:8080/done", true},
+		{"ftp://hooks.example.com/done", true},
+	}
+	for _, tt := range tests {
+		_, err := parseCallbackURL(context.Background(), tt.url)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseCallbackURL(%q) = %v, wantErr %v", tt.url, err, tt.wantErr)
+		}
+	}
+}
+
+func TestParseCallbackURLAllowedHosts(t *testing.T) {
+	withTestConfig(t, func(cfg *reloadableConfig) {
+		cfg.callbackAllowedHosts = map[string]bool{"hooks.internal": true}
+	})
+
+	if _, err := parseCallbackURL(context.Background(), "http://HOOKS.internal/done"); err != nil {
+		t.Errorf("host permitido rechazado: %v", err)
+	}
+	if _, err := parseCallbackURL(context.Background(), "https://hooks.example.com/done"); err == nil {
+		t.Error("host fuera de CALLBACK_ALLOWED_HOSTS aceptado")
+	}
+}
+
+func TestDialCallbackRejectsLoopback(t *testing.T) {
+	withTestConfig(t, func(cfg *reloadableConfig) { cfg.callbackAllowedHosts = map[string]bool{} })
+
+	conn, err := dialCallback(context.Background(), "tcp", "127.0.0.1:1")
+	if err == nil {
+		conn.Close()
+		t.Fatal("dialCallback conectó con loopback")
+	}
+	if !strings.Contains(err.Error(), "no pública") {
+		t.Errorf("dialCallback = %v, se esperaba el rechazo de la dirección", err)
+	}
+}
+
+func TestFetchAudioFromURLTokenGuard(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("audio"))
+	}))
+	defer server.Close()
+
+	if data, err := fetchAudioFromURL(context.Background(), server.URL); err != nil || string(data) != "audio" {
+		t.Fatalf("con la API key: %q, %v", data, err)
+	}
+
+	info := &requestInfo{Token: &conversionToken{ID: "t"}}
+	ctx := withRequestInfo(context.Background(), info)
+	var notGranted *tokenGrantError
+	if _, err := fetchAudioFromURL(ctx, server.URL); !errors.As(err, &notGranted) || notGranted.Grant != "url_input" {
+		t.Errorf("token sin url_input = %v, se esperaba el rechazo del grant", err)
+	}
+
+	info.Token.Grants = []string{"url_input"}
+	if _, err := fetchAudioFromURL(ctx, server.URL); err == nil || !strings.Contains(err.Error(), "no pública") {
+		t.Errorf("token con url_input = %v, se esperaba el rechazo de loopback", err)
+	}
+}
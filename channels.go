@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxMappedChannels limita channel_layout y split_channels a 8 canales, el
+// máximo de los formatos de salida
+const maxMappedChannels = 8
+
+// channelLayout es el diseño de canales pedido con channel_layout: Filter
+// reordena o extrae canales (vacío si basta con -ac) y Channels es la
+// cantidad de canales de la salida
+type channelLayout struct {
+	Name     string
+	Filter   string
+	Channels int
+}
+
+// panFilter arma un pan que toma cada canal de salida del canal de origen
+// indicado (desde 0)
+func panFilter(sources []int) string {
+	layout := strconv.Itoa(len(sources)) + "c"
+	switch len(sources) {
+	case 1:
+		layout = "mono"
+	case 2:
+		layout = "stereo"
+	}
+	parts := []string{layout}
+	for output, source := range sources {
+		parts = append(parts, fmt.Sprintf("c%d=c%d", output, source))
+	}
+	return "pan=" + strings.Join(parts, "|")
+}
+
+// parseChannelLayout acepta mono y stereo (mezcla con -ac), left y right
+// (un canal como mono), swap (intercambia izquierdo y derecho) o una lista de
+// canales de origen desde 0, p. ej. "1,0" o "0,0"
+func parseChannelLayout(value string) (*channelLayout, error) {
+	switch value {
+	case "":
+		return nil, nil
+	case "mono":
+		return &channelLayout{Name: value, Channels: 1}, nil
+	case "stereo":
+		return &channelLayout{Name: value, Channels: 2}, nil
+	case "left":
+		return &channelLayout{Name: value, Filter: panFilter([]int{0}), Channels: 1}, nil
+	case "right":
+		return &channelLayout{Name: value, Filter: panFilter([]int{1}), Channels: 1}, nil
+	case "swap":
+		return &channelLayout{Name: value, Filter: panFilter([]int{1, 0}), Channels: 2}, nil
+	}
+
+	fields := strings.Split(value, ",")
+	if len(fields) > maxMappedChannels {
+		return nil, fmt.Errorf("channel_layout admite como máximo %d canales", maxMappedChannels)
+	}
+	sources := make([]int, 0, len(fields))
+	for _, field := range fields {
+		source, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || source < 0 || source >= maxMappedChannels {
+			return nil, invalidParam("channel_layout", "channel_layout inválido %q (mono, stereo, left, right, swap o canales de origen como 1,0)", value)
+		}
+		sources = append(sources, source)
+	}
+	return &channelLayout{Name: value, Filter: panFilter(sources), Channels: len(sources)}, nil
+}
+
+// validateFor comprueba que el formato admita los canales del diseño y que no
+// contradiga channels
+func (layout *channelLayout) validateFor(format string, params audioParams) error {
+	if layout == nil {
+		return nil
+	}
+	if params.Channels != 0 && params.Channels != layout.Channels {
+		return fmt.Errorf("channels (%d) no coincide con channel_layout %s (%d canales)", params.Channels, layout.Name, layout.Channels)
+	}
+	return audioParams{Channels: layout.Channels}.validateFor(format)
+}
+
+// apply fija la cantidad de canales de la salida, que en ogg es mono por
+// defecto
+func (layout *channelLayout) apply(args []string) []string {
+	if layout == nil {
+		return args
+	}
+	return setOutputOption(args, "-ac", strconv.Itoa(layout.Channels))
+}
+
+// channelName nombra los canales de una entrada estéreo; con más canales se
+// usa c0, c1, ...
+func channelName(index, channels int) string {
+	if channels == 2 {
+		return []string{"left", "right"}[index]
+	}
+	return "c" + strconv.Itoa(index)
+}
+
+// runChannelSplit convierte cada canal de la entrada en un archivo mono, p. ej.
+// el agente y el cliente de una grabación de call center
+func runChannelSplit(ctx context.Context, inputData []byte, opts audioOptions, s3Dest *s3Destination) (gin.H, error) {
+	stream, err := probeAudioStream(ctx, inputData)
+	if err != nil {
+		return nil, err
+	}
+	if stream.Channels < 2 {
+		return nil, errors.New("split_channels requiere una entrada con al menos dos canales")
+	}
+	if stream.Channels > maxMappedChannels {
+		return nil, fmt.Errorf("split_channels admite como máximo %d canales; la entrada tiene %d", maxMappedChannels, stream.Channels)
+	}
+
+	results := make([]gin.H, 0, stream.Channels)
+	for index := 0; index < stream.Channels; index++ {
+		name := channelName(index, stream.Channels)
+		channelOpts := opts
+		channelOpts.ChannelLayout = &channelLayout{Name: name, Filter: panFilter([]int{index}), Channels: 1}
+
+		var dest *s3Destination
+		if s3Dest != nil {
+			dest = s3Dest.forOutput(name)
+		}
+		result, err := runProcessAudio(ctx, inputData, channelOpts, "", dest)
+		if err != nil {
+			return nil, fmt.Errorf("canal %s: %w", name, err)
+		}
+		result["channel"] = name
+		result["index"] = index
+		results = append(results, result)
+	}
+	return gin.H{
+		"channels": results,
+		"count":    len(results),
+		"format":   opts.Format,
+	}, nil
+}
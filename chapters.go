@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// maxChapters es el máximo de entradas de un CTOC (el contador ocupa un byte)
+const maxChapters = 255
+
+// podcastChapter es un capítulo de la salida MP3. Los tiempos están en
+// segundos sobre el audio ya convertido (después de start/end y speed).
+type podcastChapter struct {
+	Start float64  `json:"start"`
+	End   *float64 `json:"end"`
+	Title string   `json:"title"`
+	URL   string   `json:"url"`
+}
+
+// parseChapters lee el arreglo JSON de chapters: start y title obligatorios,
+// end y url opcionales. Los capítulos deben venir en orden y sin superponerse.
+func parseChapters(raw string) ([]podcastChapter, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+
+	var chapters []podcastChapter
+	if err := json.Unmarshal([]byte(raw), &chapters); err != nil {
+		return nil, fmt.Errorf("chapters debe ser un arreglo JSON de {start, end, title, url}: %v", err)
+	}
+	if len(chapters) == 0 {
+		return nil, nil
+	}
+	if len(chapters) > maxChapters {
+		return nil, fmt.Errorf("chapters admite hasta %d capítulos", maxChapters)
+	}
+
+	for i := range chapters {
+		chapter := &chapters[i]
+		chapter.Title = strings.TrimSpace(chapter.Title)
+		if chapter.Title == "" || len(chapter.Title) > maxMetadataValueBytes || !utf8.ValidString(chapter.Title) {
+			return nil, fmt.Errorf("capítulo %d: title es obligatorio (texto UTF-8 de hasta %d bytes)", i+1, maxMetadataValueBytes)
+		}
+		if chapter.Start < 0 {
+			return nil, fmt.Errorf("capítulo %d: start no puede ser negativo", i+1)
+		}
+		if i > 0 && chapter.Start <= chapters[i-1].Start {
+			return nil, fmt.Errorf("capítulo %d: start debe ser mayor que el del capítulo anterior", i+1)
+		}
+		if chapter.End != nil && *chapter.End <= chapter.Start {
+			return nil, fmt.Errorf("capítulo %d: end debe ser mayor que start", i+1)
+		}
+		if i > 0 && chapters[i-1].End != nil && *chapters[i-1].End > chapter.Start {
+			return nil, fmt.Errorf("capítulo %d: empieza antes del final del capítulo anterior", i+1)
+		}
+		if chapter.URL != "" {
+			parsed, err := url.Parse(chapter.URL)
+			if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+				return nil, fmt.Errorf("capítulo %d: url inválida %q (http o https)", i+1, chapter.URL)
+			}
+		}
+	}
+	return chapters, nil
+}
+
+// addMP3Chapters escribe los capítulos en la etiqueta ID3v2 de la salida. El
+// muxer mp3 de ffmpeg solo copia los capítulos que ya trae la entrada, así
+// que los frames CHAP y CTOC se arman acá. El final del último capítulo sin
+// end es la duración del archivo.
+func addMP3Chapters(ctx context.Context, data []byte, chapters []podcastChapter) ([]byte, error) {
+	_, probe, err := probeMedia(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	duration, _ := strconv.ParseFloat(probe.Format.Duration, 64)
+	if duration <= 0 {
+		return nil, errors.New("no se pudo determinar la duración de la salida para los capítulos")
+	}
+	if last := chapters[len(chapters)-1]; last.Start >= duration {
+		return nil, fmt.Errorf("el capítulo %d empieza después del final del audio (%s s)", len(chapters), formatSeconds(duration))
+	}
+
+	result, err := insertID3Chapters(data, chapters, duration)
+	if err != nil {
+		return nil, err
+	}
+	recordDebug(ctx, "id3_chapters", len(chapters))
+	fmt.Printf("[chapters] %d capítulos escritos en la etiqueta ID3\n", len(chapters))
+	return result, nil
+}
+
+// insertID3Chapters reemplaza los CHAP/CTOC de la etiqueta ID3v2 inicial (o
+// crea una ID3v2.3 si no hay) por los capítulos pedidos. Agrandar la etiqueta
+// es seguro: la cabecera Xing/LAME y los frames de audio no usan offsets
+// absolutos. Se conserva el relleno que dejó ffmpeg.
+func insertID3Chapters(data []byte, chapters []podcastChapter, duration float64) ([]byte, error) {
+	version := byte(3)
+	var frames, padding, audio []byte
+	audio = data
+
+	if len(data) >= 10 && string(data[:3]) == "ID3" {
+		version = data[3]
+		flags := data[5]
+		if version != 3 && version != 4 {
+			return nil, fmt.Errorf("etiqueta ID3v2.%d no admitida para capítulos", version)
+		}
+		// Desincronización, cabecera extendida y pie cambian la estructura
+		// de la etiqueta; ffmpeg no los escribe
+		if flags&0xD0 != 0 {
+			return nil, errors.New("etiqueta ID3 con desincronización, cabecera extendida o pie no admitida para capítulos")
+		}
+		size := int(syncsafeUint32(data[6:10]))
+		if 10+size > len(data) {
+			return nil, errors.New("etiqueta ID3 truncada")
+		}
+		tag := data[10 : 10+size]
+		audio = data[10+size:]
+
+		offset := 0
+		for offset+10 <= len(tag) && tag[offset] != 0 {
+			frameSize := int(binary.BigEndian.Uint32(tag[offset+4:]))
+			if version == 4 {
+				frameSize = int(syncsafeUint32(tag[offset+4 : offset+8]))
+			}
+			end := offset + 10 + frameSize
+			if end > len(tag) {
+				return nil, fmt.Errorf("frame ID3 %q truncado", tag[offset:offset+4])
+			}
+			// Los capítulos que ffmpeg copió de la entrada se reemplazan
+			if id := string(tag[offset : offset+4]); id != "CHAP" && id != "CTOC" {
+				frames = append(frames, tag[offset:end]...)
+			}
+			offset = end
+		}
+		padding = tag[offset:]
+	}
+
+	childIDs := make([]string, len(chapters))
+	var chapterFrames []byte
+	for i, chapter := range chapters {
+		childIDs[i] = fmt.Sprintf("chp%d", i)
+		end := duration
+		if chapter.End != nil {
+			end = math.Min(*chapter.End, duration)
+		} else if i+1 < len(chapters) {
+			end = chapters[i+1].Start
+		}
+
+		var body bytes.Buffer
+		body.WriteString(childIDs[i] + "\x00")
+		binary.Write(&body, binary.BigEndian, uint32(math.Round(chapter.Start*1000)))
+		binary.Write(&body, binary.BigEndian, uint32(math.Round(end*1000)))
+		// Sin offsets en bytes: los reproductores usan los tiempos
+		binary.Write(&body, binary.BigEndian, uint32(0xFFFFFFFF))
+		binary.Write(&body, binary.BigEndian, uint32(0xFFFFFFFF))
+		body.Write(id3Frame(version, "TIT2", id3Text(chapter.Title)))
+		if chapter.URL != "" {
+			// WXXX: codificación ISO-8859-1, descripción vacía y la URL
+			body.Write(id3Frame(version, "WXXX", append([]byte{0, 0}, chapter.URL...)))
+		}
+		chapterFrames = append(chapterFrames, id3Frame(version, "CHAP", body.Bytes())...)
+	}
+
+	// CTOC de nivel superior (0x02) con los capítulos en orden (0x01)
+	toc := []byte("toc\x00")
+	toc = append(toc, 0x03, byte(len(chapters)))
+	for _, id := range childIDs {
+		toc = append(toc, id+"\x00"...)
+	}
+	frames = append(frames, id3Frame(version, "CTOC", toc)...)
+	frames = append(frames, chapterFrames...)
+
+	size := len(frames) + len(padding)
+	result := make([]byte, 0, 10+size+len(audio))
+	result = append(result, 'I', 'D', '3', version, 0, 0)
+	result = append(result, syncsafeBytes(uint32(size))...)
+	result = append(result, frames...)
+	result = append(result, padding...)
+	return append(result, audio...), nil
+}
+
+// id3Frame arma un frame ID3v2: el tamaño es syncsafe en la versión 2.4 y
+// un entero común en la 2.3
+func id3Frame(version byte, id string, body []byte) []byte {
+	frame := append([]byte(id), 0, 0, 0, 0, 0, 0)
+	if version == 4 {
+		copy(frame[4:8], syncsafeBytes(uint32(len(body))))
+	} else {
+		binary.BigEndian.PutUint32(frame[4:8], uint32(len(body)))
+	}
+	return append(frame, body...)
+}
+
+// id3Text codifica un frame de texto en UTF-16 con BOM, que leen tanto
+// ID3v2.3 como ID3v2.4
+func id3Text(text string) []byte {
+	body := []byte{1, 0xFF, 0xFE}
+	for _, unit := range utf16.Encode([]rune(text)) {
+		body = append(body, byte(unit), byte(unit>>8))
+	}
+	return body
+}
+
+func syncsafeUint32(b []byte) uint32 {
+	return uint32(b[0]&0x7F)<<21 | uint32(b[1]&0x7F)<<14 | uint32(b[2]&0x7F)<<7 | uint32(b[3]&0x7F)
+}
+
+func syncsafeBytes(value uint32) []byte {
+	return []byte{byte(value >> 21 & 0x7F), byte(value >> 14 & 0x7F), byte(value >> 7 & 0x7F), byte(value & 0x7F)}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseSegmentSeconds valida segment_seconds (1 a 3600); "" no divide la
+// salida
+func parseSegmentSeconds(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil || seconds < 1 || seconds > 3600 {
+		return 0, invalidParam("segment_seconds", "segment_seconds inválido %q (entre 1 y 3600)", value)
+	}
+	return seconds, nil
+}
+
+// segmentMuxerArgs envuelve el muxer de la salida en el muxer segment: cada
+// tramo de seconds segundos es un archivo completo con su propia cabecera y
+// tiempos desde cero. segment_list informa dónde empieza y termina cada uno.
+func segmentMuxerArgs(args []string, seconds float64, listPath string) ([]string, error) {
+	format := ""
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == "-f" {
+			format = args[i+1]
+		}
+	}
+	if format == "" {
+		return nil, errors.New("no se encontró el muxer de la salida")
+	}
+	args = setOutputOption(args, "-f", "segment")
+	return append(args,
+		"-segment_format", format,
+		"-segment_time", strconv.FormatFloat(seconds, 'f', -1, 64),
+		"-reset_timestamps", "1",
+		"-segment_list", listPath,
+		"-segment_list_type", "csv",
+	), nil
+}
+
+// convertAudioChunks convierte la entrada con las opciones habituales y
+// corta la salida en tramos de seconds segundos con un único proceso ffmpeg
+func convertAudioChunks(ctx context.Context, inputData []byte, opts audioOptions, seconds float64) ([]mediaSegment, error) {
+	cleanupCover, err := opts.prepare(ctx, inputData)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanupCover()
+
+	workDir, err := os.MkdirTemp("", "chunks-*")
+	if err != nil {
+		return nil, fmt.Errorf("error al crear la carpeta temporal: %v", err)
+	}
+	defer os.RemoveAll(workDir)
+	inputPath := filepath.Join(workDir, "input")
+	if err := os.WriteFile(inputPath, inputData, 0o600); err != nil {
+		return nil, fmt.Errorf("error al escribir la entrada: %v", err)
+	}
+
+	listPath := filepath.Join(workDir, "segments.csv")
+	outputArgs, err := segmentMuxerArgs(audioOutputArgs(ctx, inputData, opts), seconds, listPath)
+	if err != nil {
+		return nil, err
+	}
+	args := append([]string{"-i", inputPath}, outputArgs...)
+	args = append(args, filepath.Join(workDir, "chunk-%05d"+filepath.Ext(opts.outputFilename())))
+
+	cmd := ffmpegCommand(ctx, classBatch, args...)
+	var errBuffer bytes.Buffer
+	cmd.Stderr = &errBuffer
+
+	fmt.Printf("[chunks] Cortando la salida %s en tramos de %s s\n", opts.Format, strconv.FormatFloat(seconds, 'f', -1, 64))
+	if err := cmd.Run(); err != nil {
+		return nil, explainAudioError(fmt.Errorf("error during conversion: %v, details: %s", err, errBuffer.String()))
+	}
+
+	list, err := os.ReadFile(listPath)
+	if err != nil {
+		return nil, fmt.Errorf("error al leer la lista de tramos: %v", err)
+	}
+	records, err := csv.NewReader(bytes.NewReader(list)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("lista de tramos inválida: %v", err)
+	}
+
+	segments := make([]mediaSegment, 0, len(records))
+	for _, record := range records {
+		if len(record) < 3 {
+			continue
+		}
+		start, _ := strconv.ParseFloat(record[1], 64)
+		end, _ := strconv.ParseFloat(record[2], 64)
+		data, err := os.ReadFile(filepath.Join(workDir, filepath.Base(record[0])))
+		if err != nil {
+			return nil, fmt.Errorf("error al leer el tramo %s: %v", record[0], err)
+		}
+		if data, err = interceptOutput(ctx, opts.Format, data); err != nil {
+			return nil, err
+		}
+		segments = append(segments, mediaSegment{Start: start, End: end, Data: data})
+	}
+	if len(segments) == 0 {
+		return nil, errors.New("conversion produced empty output")
+	}
+	return segments, nil
+}
+
+// runAudioChunks es el cuerpo JSON de segment_seconds, el mismo de
+// /split-audio
+func runAudioChunks(ctx context.Context, inputData []byte, opts audioOptions, seconds float64) (gin.H, error) {
+	segments, err := convertAudioChunks(ctx, inputData, opts, seconds)
+	if err != nil {
+		return nil, err
+	}
+	response := splitAudioView(segments, opts.Format)
+	response["segment_seconds"] = seconds
+	return response, nil
+}
+
+// wantsMultipartResponse indica si se pidió response=multipart o Accept:
+// multipart/mixed
+func wantsMultipartResponse(c *gin.Context) bool {
+	for _, value := range []string{c.PostForm("response"), c.Query("response")} {
+		if value != "" {
+			return strings.EqualFold(value, "multipart")
+		}
+	}
+	for _, accepted := range parseAccept(c.GetHeader("Accept")) {
+		if accepted.mediaType == "multipart/mixed" {
+			return true
+		}
+	}
+	return false
+}
+
+// writeMultipartSegments responde los tramos como multipart/mixed, una parte
+// por tramo con su nombre y sus tiempos, para consumirlos a medida que llegan
+func writeMultipartSegments(c *gin.Context, segments []mediaSegment, opts audioOptions) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for i, segment := range segments {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", opts.outputContentType())
+		header.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, segmentFilename(i, opts.Format)))
+		header.Set("X-Segment-Start", formatSeconds(segment.Start))
+		header.Set("X-Segment-End", formatSeconds(segment.End))
+		part, err := writer.CreatePart(header)
+		if err == nil {
+			_, err = part.Write(segment.Data)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error al armar la respuesta multipart: " + err.Error()})
+			return
+		}
+	}
+	writer.Close()
+
+	c.Header("X-Format", opts.Format)
+	c.Header("X-Segments", strconv.Itoa(len(segments)))
+	c.Data(http.StatusOK, "multipart/mixed; boundary="+writer.Boundary(), body.Bytes())
+}
+
+// respondAudioChunks atiende segment_seconds con response=zip, binary o
+// multipart. Devuelve false si se pidió JSON.
+func respondAudioChunks(c *gin.Context, inputData []byte, opts audioOptions, seconds float64) bool {
+	multipartResponse := wantsMultipartResponse(c)
+	if !multipartResponse && !wantsZipResponse(c) {
+		return false
+	}
+
+	segments, err := convertAudioChunks(c.Request.Context(), inputData, opts, seconds)
+	if err != nil {
+		if mediaMismatchResponse(c, explainMediaMismatch(c.Request.Context(), inputData, err)) {
+			return true
+		}
+		respondError(c, mediaErrorStatus(err, http.StatusInternalServerError), err)
+		return true
+	}
+	if multipartResponse {
+		writeMultipartSegments(c, segments, opts)
+		return true
+	}
+
+	archive, err := zipSegments(segments, opts.Format)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error al crear el ZIP: " + err.Error()})
+		return true
+	}
+	writeBinaryResponse(c, archive, "segments.zip", "application/zip", map[string]string{
+		"X-Format":   opts.Format,
+		"X-Segments": strconv.Itoa(len(segments)),
+	})
+	return true
+}
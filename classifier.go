@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// classifierSampleRate deja medir el contenido por encima de 8 kHz
+	classifierSampleRate = 32000
+	// classifierWindow son los segundos iniciales que se analizan
+	classifierWindow = 60
+	// classifierFrame es la trama de análisis (20 ms)
+	classifierFrame = classifierSampleRate / 50
+)
+
+// audioFeatures son las características que describen la entrada. Se
+// calculan sobre los primeros classifierWindow segundos en mono.
+type audioFeatures struct {
+	Channels   int
+	SampleRate int
+	// HighBandDB es el nivel por encima de 8 kHz relativo al total
+	HighBandDB float64
+	// LowEnergyRatio es la fracción de tramas por debajo de la mitad del
+	// RMS medio: las pausas de la voz la suben
+	LowEnergyRatio float64
+	// ZCRVariation es el coeficiente de variación de la tasa de cruces por
+	// cero: la voz alterna sonidos sonoros y sordos
+	ZCRVariation float64
+	// Correlation es la correlación media entre canales (1 en mono)
+	Correlation float64
+	// pcm es la ventana analizada (s16le mono), para los clasificadores externos
+	pcm []byte
+}
+
+// audioClassification es la etiqueta de la entrada: "speech" o "music"
+type audioClassification struct {
+	Label      string  `json:"label"`
+	Confidence float64 `json:"confidence"`
+}
+
+// AudioClassifier etiqueta una entrada como voz o música a partir de sus
+// características. Los plugins lo reemplazan con RegisterAudioClassifier.
+type AudioClassifier interface {
+	Name() string
+	Classify(ctx context.Context, features *audioFeatures) (*audioClassification, error)
+}
+
+var (
+	classifierMu     sync.RWMutex
+	activeClassifier AudioClassifier = spectralClassifier{}
+)
+
+// RegisterAudioClassifier reemplaza al clasificador espectral. Si el nuevo
+// falla, se vuelve a usar el espectral para esa entrada.
+func RegisterAudioClassifier(classifier AudioClassifier) {
+	classifierMu.Lock()
+	defer classifierMu.Unlock()
+	activeClassifier = classifier
+}
+
+var classifierTimeout time.Duration
+
+// loadClassifierConfig registra AUDIO_CLASSIFIER_URL, un modelo externo que
+// recibe la ventana analizada como WAV
+func loadClassifierConfig() {
+	classifierTimeout = envDuration("AUDIO_CLASSIFIER_TIMEOUT", 10*time.Second)
+	if url := strings.TrimSpace(os.Getenv("AUDIO_CLASSIFIER_URL")); url != "" {
+		RegisterAudioClassifier(&httpClassifier{url: url})
+		fmt.Printf("Clasificador de audio: %s\n", url)
+	}
+}
+
+// classifyAudio extrae las características de la entrada y la etiqueta con
+// el clasificador activo. Devuelve también el nombre del clasificador usado.
+func classifyAudio(ctx context.Context, inputData []byte) (*audioClassification, *audioFeatures, string, error) {
+	features, err := extractAudioFeatures(ctx, inputData)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	classifierMu.RLock()
+	classifier := activeClassifier
+	classifierMu.RUnlock()
+
+	classification, err := classifier.Classify(ctx, features)
+	if err != nil {
+		fmt.Printf("[classifier] %s falló, se usa el espectral: %v\n", classifier.Name(), err)
+		classifier = spectralClassifier{}
+		classification, _ = classifier.Classify(ctx, features)
+	}
+	return classification, features, classifier.Name(), nil
+}
+
+// extractAudioFeatures decodifica la ventana de análisis a PCM mono y
+// calcula las características en una sola pasada
+func extractAudioFeatures(ctx context.Context, inputData []byte) (*audioFeatures, error) {
+	stream, err := probeAudioStream(ctx, inputData)
+	if err != nil {
+		return nil, err
+	}
+	features := &audioFeatures{Channels: stream.Channels, Correlation: 1}
+	features.SampleRate, _ = strconv.Atoi(stream.SampleRate)
+
+	if features.pcm, err = decodeMonoPCM(ctx, inputData, classifierSampleRate, classifierWindow); err != nil {
+		return nil, err
+	}
+	features.measure(pcmSamples(features.pcm))
+
+	if features.Channels >= 2 {
+		stereo, err := analyzeStereo(ctx, inputData)
+		if err != nil {
+			return nil, err
+		}
+		features.Correlation = stereo.MeanCorrelation
+	}
+	return features, nil
+}
+
+// decodeMonoPCM decodifica los primeros seconds segundos de la entrada a PCM
+// s16le mono a sampleRate
+func decodeMonoPCM(ctx context.Context, inputData []byte, sampleRate, seconds int) ([]byte, error) {
+	inputSource, stdin, cleanup, err := ffmpegInput(inputData, "pcm-input-*")
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	cmd := ffmpegCommand(ctx, classInteractive,
+		"-t", strconv.Itoa(seconds),
+		"-i", inputSource,
+		"-vn",
+		"-ac", "1",
+		"-ar", strconv.Itoa(sampleRate),
+		"-f", "s16le",
+		"pipe:1",
+	)
+	cmd.Stdin = stdin
+	var output, errBuffer bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &errBuffer
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error al decodificar el audio: %v, detalles: %s", err, errBuffer.String())
+	}
+	return output.Bytes(), nil
+}
+
+// pcmSamples convierte PCM s16le en muestras entre -1 y 1
+func pcmSamples(pcm []byte) []float64 {
+	samples := make([]float64, len(pcm)/2)
+	for i := range samples {
+		samples[i] = float64(int16(binary.LittleEndian.Uint16(pcm[i*2:]))) / 32768
+	}
+	return samples
+}
+
+// measure calcula el nivel de la banda alta con dos pasa-altos biquad de
+// 8 kHz y, por trama, el RMS y la tasa de cruces por cero
+func (features *audioFeatures) measure(samples []float64) {
+	high := highPass8k(highPass8k(samples))
+	total, highTotal := 0.0, 0.0
+	for i, sample := range samples {
+		total += sample * sample
+		highTotal += high[i] * high[i]
+	}
+	features.HighBandDB = math.Inf(-1)
+	if total > 0 && highTotal > 0 {
+		features.HighBandDB = 10 * math.Log10(highTotal/total)
+	}
+
+	var rms, zcr []float64
+	for start := 0; start+classifierFrame <= len(samples); start += classifierFrame {
+		frame := samples[start : start+classifierFrame]
+		energy, crossings := 0.0, 0
+		for i, sample := range frame {
+			energy += sample * sample
+			if i > 0 && (sample >= 0) != (frame[i-1] >= 0) {
+				crossings++
+			}
+		}
+		rms = append(rms, math.Sqrt(energy/float64(len(frame))))
+		zcr = append(zcr, float64(crossings)/float64(len(frame)))
+	}
+	if len(rms) == 0 {
+		return
+	}
+
+	meanRMS, _ := meanAndDeviation(rms)
+	low := 0
+	for _, value := range rms {
+		if value < meanRMS/2 {
+			low++
+		}
+	}
+	features.LowEnergyRatio = float64(low) / float64(len(rms))
+	if meanZCR, deviation := meanAndDeviation(zcr); meanZCR > 0 {
+		features.ZCRVariation = deviation / meanZCR
+	}
+}
+
+// highPass8k es un pasa-altos biquad Butterworth (12 dB/octava) a 8 kHz
+func highPass8k(samples []float64) []float64 {
+	w0 := 2 * math.Pi * 8000 / classifierSampleRate
+	// Q = 1/√2
+	alpha := math.Sin(w0) / math.Sqrt2
+	cos := math.Cos(w0)
+	a0 := 1 + alpha
+	b0, b1, b2 := (1+cos)/2/a0, -(1+cos)/a0, (1+cos)/2/a0
+	a1, a2 := -2*cos/a0, (1-alpha)/a0
+
+	output := make([]float64, len(samples))
+	var x1, x2, y1, y2 float64
+	for i, x := range samples {
+		y := b0*x + b1*x1 + b2*x2 - a1*y1 - a2*y2
+		x2, x1 = x1, x
+		y2, y1 = y1, y
+		output[i] = y
+	}
+	return output
+}
+
+func meanAndDeviation(values []float64) (float64, float64) {
+	mean := 0.0
+	for _, value := range values {
+		mean += value
+	}
+	mean /= float64(len(values))
+	variance := 0.0
+	for _, value := range values {
+		variance += (value - mean) * (value - mean)
+	}
+	return mean, math.Sqrt(variance / float64(len(values)))
+}
+
+// Umbrales del clasificador espectral
+const (
+	// La voz, incluso la de banda ancha, casi no tiene energía por encima
+	// de 8 kHz; la música suele quedar entre -15 y -30 dB
+	musicHighBandThreshold = -30.0
+	// La voz tiene pausas: más de un 30% de tramas de baja energía
+	speechLowEnergyRatio = 0.3
+	// La alternancia de sonidos sonoros y sordos varía mucho la tasa de
+	// cruces por cero
+	speechZCRVariation = 0.7
+	// musicStereoCorrelation separa el estéreo real del mono duplicado
+	musicStereoCorrelation = 0.95
+)
+
+// spectralClassifier vota con las características: cada una que se parece a
+// la música suma un voto y la mayoría decide. La confianza es la fracción de
+// votos a favor de la etiqueta.
+type spectralClassifier struct{}
+
+func (spectralClassifier) Name() string {
+	return "spectral"
+}
+
+func (spectralClassifier) Classify(ctx context.Context, features *audioFeatures) (*audioClassification, error) {
+	votes := []bool{
+		features.HighBandDB >= musicHighBandThreshold,
+		features.LowEnergyRatio < speechLowEnergyRatio,
+		features.ZCRVariation < speechZCRVariation,
+	}
+	if features.Channels >= 2 {
+		votes = append(votes, features.Correlation < musicStereoCorrelation)
+	}
+	music := 0
+	for _, vote := range votes {
+		if vote {
+			music++
+		}
+	}
+
+	classification := &audioClassification{Label: "speech"}
+	ratio := float64(music) / float64(len(votes))
+	if ratio > 0.5 {
+		classification.Label = "music"
+	} else {
+		ratio = 1 - ratio
+	}
+	classification.Confidence = math.Round(ratio*100) / 100
+	return classification, nil
+}
+
+// httpClassifier envía la ventana analizada como WAV (16 bits, mono,
+// 32 kHz) por POST a un modelo externo, con las características en la
+// cabecera X-Audio-Features. Espera {"label": "speech"|"music",
+// "confidence": 0.0-1.0}.
+type httpClassifier struct {
+	url string
+}
+
+func (h *httpClassifier) Name() string {
+	return h.url
+}
+
+func (h *httpClassifier) Classify(ctx context.Context, features *audioFeatures) (*audioClassification, error) {
+	ctx, cancel := context.WithTimeout(ctx, classifierTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(wavFromPCM(features.pcm, classifierSampleRate)))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "audio/wav")
+	if encoded, err := json.Marshal(features.report()); err == nil {
+		req.Header.Set("X-Audio-Features", string(encoded))
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("estado inesperado %d", resp.StatusCode)
+	}
+
+	var classification audioClassification
+	if err := json.Unmarshal(body, &classification); err != nil {
+		return nil, fmt.Errorf("respuesta inválida: %v", err)
+	}
+	if classification.Label != "speech" && classification.Label != "music" {
+		return nil, fmt.Errorf("etiqueta desconocida %q", classification.Label)
+	}
+	return &classification, nil
+}
+
+// report es la representación de las características en la respuesta, sin
+// infinitos (que encoding/json no admite)
+func (features *audioFeatures) report() map[string]interface{} {
+	report := map[string]interface{}{
+		"channels":         features.Channels,
+		"sample_rate":      features.SampleRate,
+		"low_energy_ratio": math.Round(features.LowEnergyRatio*1000) / 1000,
+		"zcr_variation":    math.Round(features.ZCRVariation*1000) / 1000,
+		"correlation":      math.Round(features.Correlation*1000) / 1000,
+	}
+	if !math.IsInf(features.HighBandDB, 0) {
+		report["high_band_db"] = math.Round(features.HighBandDB*10) / 10
+	}
+	return report
+}
+
+// wavFromPCM envuelve PCM s16le mono en una cabecera WAV
+func wavFromPCM(pcm []byte, sampleRate int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+len(pcm)))
+	buf.WriteString("WAVEfmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(16))
+	binary.Write(&buf, binary.LittleEndian, uint16(1)) // PCM
+	binary.Write(&buf, binary.LittleEndian, uint16(1)) // mono
+	binary.Write(&buf, binary.LittleEndian, uint32(sampleRate))
+	binary.Write(&buf, binary.LittleEndian, uint32(sampleRate*2))
+	binary.Write(&buf, binary.LittleEndian, uint16(2))
+	binary.Write(&buf, binary.LittleEndian, uint16(16))
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(len(pcm)))
+	buf.Write(pcm)
+	return buf.Bytes()
+}
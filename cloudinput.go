@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type cloudInputConfig struct {
+	gcsCredentialsFile string
+	gcsHMACAccessKey   string
+	gcsHMACSecret      string
+	gcsAllowedBuckets  map[string]bool
+	// gcsToken es nuevo en cada carga: el token cacheado puede ser de otras
+	// credenciales
+	gcsToken *gcsTokenCache
+}
+
+// gcsTokenCache guarda el token OAuth de la cuenta de servicio
+type gcsTokenCache struct {
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+var cloudInputClient = &http.Client{Timeout: 5 * time.Minute}
+
+func loadCloudInputConfig(cfg *reloadableConfig) {
+	cfg.gcsCredentialsFile = os.Getenv("GCS_CREDENTIALS_FILE")
+	if cfg.gcsCredentialsFile == "" {
+		cfg.gcsCredentialsFile = os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	}
+	cfg.gcsHMACAccessKey = os.Getenv("GCS_HMAC_ACCESS_KEY")
+	cfg.gcsHMACSecret = os.Getenv("GCS_HMAC_SECRET")
+
+	cfg.gcsAllowedBuckets = map[string]bool{}
+	for _, bucket := range strings.Split(os.Getenv("GCS_ALLOWED_BUCKETS"), ",") {
+		if bucket = strings.TrimSpace(bucket); bucket != "" {
+			cfg.gcsAllowedBuckets[bucket] = true
+		}
+	}
+	cfg.gcsToken = &gcsTokenCache{}
+}
+
+// isCloudURI indica si la URL apunta a un bucket (s3:// o gs://)
+func isCloudURI(uri string) bool {
+	return strings.HasPrefix(uri, "s3://") || strings.HasPrefix(uri, "gs://")
+}
+
+// parseBucketURI separa s3://bucket/clave en bucket y clave
+func parseBucketURI(uri string) (string, string, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return "", "", fmt.Errorf("URI inválida: %v", err)
+	}
+	key := strings.TrimPrefix(parsed.Path, "/")
+	if parsed.Host == "" || key == "" {
+		return "", "", fmt.Errorf("la URI %s debe tener la forma %s://bucket/objeto", uri, parsed.Scheme)
+	}
+	return parsed.Host, key, nil
+}
+
+// fetchCloudInput descarga un objeto de S3 o GCS con las credenciales del
+// servidor. Las descargas pasan por la caché de entradas remotas.
+func fetchCloudInput(ctx context.Context, uri string) ([]byte, error) {
+	if err := checkTokenGrant(ctx, "cloud_input"); err != nil {
+		return nil, err
+	}
+	bucket, key, err := parseBucketURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTenantRead(ctx, key); err != nil {
+		return nil, fmt.Errorf("no se puede leer %s: %v", uri, err)
+	}
+
+	var req *http.Request
+	if strings.HasPrefix(uri, "s3://") {
+		req, err = newS3GetRequest(ctx, bucket, key)
+	} else {
+		req, err = newGCSGetRequest(ctx, bucket, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Descargando %s\n", uri)
+	statusCode, data, err := doCachedRequest(cloudInputClient, req)
+	if err != nil {
+		return nil, fmt.Errorf("error al descargar %s: %w", uri, err)
+	}
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("error al descargar %s: HTTP %d", uri, statusCode)
+	}
+	return data, nil
+}
+
+// newS3GetRequest arma un GET firmado con SigV4 usando la configuración S3_*
+func newS3GetRequest(ctx context.Context, bucket, key string) (*http.Request, error) {
+	cfg := config()
+	if cfg.s3AccessKeyID == "" || cfg.s3SecretAccessKey == "" {
+		return nil, notConfigured("no hay credenciales S3 configuradas en el servidor")
+	}
+	// Sin lista de buckets permitidos no se lee nada: las credenciales del
+	// servidor suelen alcanzar más buckets que los de las entradas
+	if len(cfg.s3AllowedBuckets) == 0 {
+		return nil, errors.New("las entradas s3:// están deshabilitadas: configure S3_ALLOWED_BUCKETS")
+	}
+	if !cfg.s3AllowedBuckets[bucket] {
+		return nil, fmt.Errorf("el bucket %s no está permitido", bucket)
+	}
+
+	source := &s3Destination{
+		Bucket:          bucket,
+		Key:             key,
+		Region:          cfg.s3DefaultRegion,
+		Endpoint:        cfg.s3DefaultEndpoint,
+		AccessKeyID:     cfg.s3AccessKeyID,
+		SecretAccessKey: cfg.s3SecretAccessKey,
+		SessionToken:    cfg.s3SessionToken,
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source.objectURL(), nil)
+	if err != nil {
+		return nil, err
+	}
+	signS3Request(req, source, nil, time.Now().UTC())
+	return req, nil
+}
+
+// newGCSGetRequest arma el GET del objeto. Con una cuenta de servicio se usa
+// la API JSON con un token OAuth; con claves HMAC, la API XML compatible con
+// S3 firmada con SigV4.
+func newGCSGetRequest(ctx context.Context, bucket, key string) (*http.Request, error) {
+	cfg := config()
+	if len(cfg.gcsAllowedBuckets) == 0 {
+		return nil, errors.New("las entradas gs:// están deshabilitadas: configure GCS_ALLOWED_BUCKETS")
+	}
+	if !cfg.gcsAllowedBuckets[bucket] {
+		return nil, fmt.Errorf("el bucket %s no está permitido", bucket)
+	}
+
+	switch {
+	case cfg.gcsCredentialsFile != "":
+		token, err := cfg.gcsToken.get(ctx, cfg.gcsCredentialsFile)
+		if err != nil {
+			return nil, err
+		}
+		objectURL := fmt.Sprintf("https://storage.googleapis.com/storage/v1/b/%s/o/%s?alt=media",
+			url.PathEscape(bucket), url.PathEscape(key))
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, objectURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		return req, nil
+
+	case cfg.gcsHMACAccessKey != "" && cfg.gcsHMACSecret != "":
+		source := &s3Destination{
+			Bucket:          bucket,
+			Key:             key,
+			Region:          "auto",
+			Endpoint:        "https://storage.googleapis.com",
+			AccessKeyID:     cfg.gcsHMACAccessKey,
+			SecretAccessKey: cfg.gcsHMACSecret,
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, source.objectURL(), nil)
+		if err != nil {
+			return nil, err
+		}
+		signS3Request(req, source, nil, time.Now().UTC())
+		return req, nil
+	}
+
+	return nil, notConfigured("no hay credenciales GCS configuradas en el servidor")
+}
+
+// gcsServiceAccount es el subconjunto usado del JSON de la cuenta de servicio
+type gcsServiceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// get devuelve un token OAuth de solo lectura para la cuenta de servicio de
+// credentialsFile, renovándolo un minuto antes de que venza
+func (cache *gcsTokenCache) get(ctx context.Context, credentialsFile string) (string, error) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if cache.token != "" && time.Now().Before(cache.expiry.Add(-time.Minute)) {
+		return cache.token, nil
+	}
+
+	raw, err := os.ReadFile(credentialsFile)
+	if err != nil {
+		return "", fmt.Errorf("error al leer las credenciales GCS: %v", err)
+	}
+	var account gcsServiceAccount
+	if err := json.Unmarshal(raw, &account); err != nil {
+		return "", fmt.Errorf("credenciales GCS inválidas: %v", err)
+	}
+	if account.TokenURI == "" {
+		account.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+
+	assertion, err := signServiceAccountJWT(account, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, account.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := cloudInputClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error al obtener token GCS: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+		Error       string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("respuesta de token GCS inválida: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || result.AccessToken == "" {
+		return "", fmt.Errorf("error al obtener token GCS: HTTP %d %s", resp.StatusCode, result.Error)
+	}
+
+	cache.token = result.AccessToken
+	cache.expiry = time.Now().Add(time.Duration(result.ExpiresIn) * time.Second)
+	return cache.token, nil
+}
+
+// signServiceAccountJWT firma la aserción RS256 del flujo jwt-bearer
+func signServiceAccountJWT(account gcsServiceAccount, now time.Time) (string, error) {
+	block, _ := pem.Decode([]byte(account.PrivateKey))
+	if block == nil {
+		return "", errors.New("clave privada GCS inválida")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return "", fmt.Errorf("clave privada GCS inválida: %v", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", errors.New("la clave privada GCS no es RSA")
+	}
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   account.ClientEmail,
+		"scope": "https://www.googleapis.com/auth/devstorage.read_only",
+		"aud":   account.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+
+	encoding := base64.RawURLEncoding
+	unsigned := encoding.EncodeToString(header) + "." + encoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(nil, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("error al firmar el JWT de GCS: %v", err)
+	}
+	return unsigned + "." + encoding.EncodeToString(signature), nil
+}
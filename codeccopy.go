@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+)
+
+// audioStreamInfo describe la primera pista de audio de la entrada
+type audioStreamInfo struct {
+	Codec      string
+	SampleRate string
+	Channels   int
+}
+
+// codecCopyTarget indica qué codecs de origen pueden remuxarse sin recodificar
+// a un formato de salida, y con qué opciones
+type codecCopyTarget struct {
+	codecs []string
+	args   []string
+}
+
+var codecCopyTargets = map[string]codecCopyTarget{
+	"mp3":    {codecs: []string{"mp3"}, args: []string{"-vn", "-c:a", "copy", "-f", "mp3"}},
+	"aac":    {codecs: []string{"aac"}, args: []string{"-vn", "-c:a", "copy", "-f", "adts"}},
+	"mp4":    {codecs: []string{"aac"}, args: []string{"-vn", "-c:a", "copy", "-f", "adts"}},
+	"m4a":    {codecs: []string{"aac", "alac"}, args: []string{"-vn", "-c:a", "copy", "-f", "ipod", "-movie_timescale", gaplessMovieTimescale, "-use_editlist", "1"}},
+	"wav":    {codecs: []string{"pcm_s16le"}, args: []string{"-vn", "-c:a", "copy", "-f", "wav"}},
+	"amr":    {codecs: []string{"amr_nb"}, args: []string{"-vn", "-c:a", "copy", "-f", "amr"}},
+	"amr-wb": {codecs: []string{"amr_wb"}, args: []string{"-vn", "-c:a", "copy", "-f", "amr"}},
+	"ulaw":   {codecs: []string{"pcm_mulaw"}, args: []string{"-vn", "-c:a", "copy", "-f", "wav"}},
+	"alaw":   {codecs: []string{"pcm_alaw"}, args: []string{"-vn", "-c:a", "copy", "-f", "wav"}},
+	"alac":   {codecs: []string{"alac"}, args: []string{"-vn", "-c:a", "copy", "-f", "ipod"}},
+	"flac":   {codecs: []string{"flac"}, args: []string{"-vn", "-c:a", "copy", "-f", "flac"}},
+	"ogg":    {codecs: []string{"opus"}, args: []string{"-vn", "-c:a", "copy", "-f", "ogg", "-map_metadata", "-1", "-map_chapters", "-1"}},
+}
+
+// probeAudioStream obtiene el codec de la primera pista de audio con ffprobe
+func probeAudioStream(ctx context.Context, inputData []byte) (*audioStreamInfo, error) {
+	// Se usa archivo temporal porque MP4/M4A necesita seek para encontrar el moov
+	inputPath, cleanup, err := writeTempInput(inputData, "probe-audio-*")
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	cmd := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-select_streams", "a:0",
+		"-show_entries", "stream=codec_name,sample_rate,channels",
+		"-of", "json",
+		inputPath)
+
+	var outBuffer bytes.Buffer
+	cmd.Stdout = &outBuffer
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error al ejecutar ffprobe: %v", err)
+	}
+
+	var result struct {
+		Streams []struct {
+			CodecName  string `json:"codec_name"`
+			SampleRate string `json:"sample_rate"`
+			Channels   int    `json:"channels"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(outBuffer.Bytes(), &result); err != nil {
+		return nil, fmt.Errorf("error al leer la salida de ffprobe: %v", err)
+	}
+	if len(result.Streams) == 0 {
+		return nil, fmt.Errorf("la entrada no contiene pistas de audio")
+	}
+
+	stream := result.Streams[0]
+	return &audioStreamInfo{
+		Codec:      stream.CodecName,
+		SampleRate: stream.SampleRate,
+		Channels:   stream.Channels,
+	}, nil
+}
+
+// copyArgsFor devuelve las opciones de remux si la pista puede copiarse al
+// formato de salida, o nil si hace falta recodificar
+func copyArgsFor(stream *audioStreamInfo, format string) []string {
+	if stream == nil {
+		return nil
+	}
+
+	target, ok := codecCopyTargets[format]
+	if !ok {
+		return nil
+	}
+
+	// Las notas de voz ogg se entregan siempre en mono; un Opus estéreo
+	// debe recodificarse para respetar ese formato
+	if format == "ogg" && stream.Channels != 1 {
+		return nil
+	}
+
+	for _, codec := range target.codecs {
+		if codec == stream.Codec {
+			return target.args
+		}
+	}
+	return nil
+}
+
+// codecCopyArgs analiza la entrada y devuelve las opciones de copia de codec
+// para el formato, o nil si debe recodificarse
+func codecCopyArgs(ctx context.Context, inputData []byte, format string) []string {
+	if _, ok := codecCopyTargets[format]; !ok {
+		return nil
+	}
+
+	stream, err := probeAudioStream(ctx, inputData)
+	if err != nil {
+		fmt.Printf("[codecCopy] No se pudo analizar la entrada, se recodificará: %v\n", err)
+		return nil
+	}
+
+	args := copyArgsFor(stream, format)
+	recordDebug(ctx, "codec_copy", map[string]interface{}{
+		"source_codec": stream.Codec,
+		"format":       format,
+		"copied":       args != nil,
+	})
+	if args != nil {
+		fmt.Printf("[codecCopy] Codec %s compatible con %s, remux sin recodificar\n", stream.Codec, format)
+	}
+	return args
+}
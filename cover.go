@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// coverArtFormats son las salidas que pueden llevar carátula embebida
+var coverArtFormats = map[string]bool{
+	"mp3":  true,
+	"m4a":  true,
+	"alac": true,
+	"flac": true,
+}
+
+// maxCoverBytes limita el tamaño de la carátula
+const maxCoverBytes = 10 << 20
+
+// getCoverData lee la carátula de cover (archivo), cover_base64 o cover_url.
+// Devuelve nil si la petición no trae carátula.
+func getCoverData(c *gin.Context) ([]byte, error) {
+	var (
+		data []byte
+		err  error
+	)
+	if file, _, fileErr := c.Request.FormFile("cover"); fileErr == nil {
+		data, err = io.ReadAll(file)
+	} else if value := c.PostForm("cover_base64"); value != "" {
+		data, err = base64.StdEncoding.DecodeString(value)
+	} else if url := c.PostForm("cover_url"); url != "" {
+		data, err = fetchAudioFromURL(c.Request.Context(), url)
+	} else {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo leer la carátula: %w", err)
+	}
+	if len(data) > maxCoverBytes {
+		return nil, inputOutOfRange("la carátula supera el máximo de %d bytes", maxCoverBytes)
+	}
+	if sniffImageClass(data) != mediaImage {
+		return nil, errors.New("cover debe ser una imagen (JPEG, PNG, BMP, TIFF, WebP, HEIC o AVIF)")
+	}
+	return data, nil
+}
+
+// coverCodec copia JPEG y PNG, que todos los contenedores admiten, y
+// convierte el resto a PNG
+func coverCodec(data []byte) string {
+	if bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}) || bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")) {
+		return "copy"
+	}
+	return "png"
+}
+
+// applyCoverArt agrega la carátula como segunda entrada y la marca como
+// attached_pic. -vn se quita porque también impide mapear el video.
+func applyCoverArt(args []string, coverPath, codec, format string) []string {
+	if coverPath == "" || !coverArtFormats[format] {
+		return args
+	}
+
+	withCover := []string{"-i", coverPath, "-map", "0:a", "-map", "1:v"}
+	for _, arg := range args {
+		if arg != "-vn" {
+			withCover = append(withCover, arg)
+		}
+	}
+	withCover = append(withCover, "-c:v", codec, "-disposition:v", "attached_pic")
+	if format == "mp3" {
+		withCover = setOutputOption(withCover, "-id3v2_version", "3")
+		withCover = append(withCover, "-metadata:s:v", "title=Album cover", "-metadata:s:v", "comment=Cover (front)")
+	}
+	return withCover
+}
+
+// prepareCover escribe la carátula en un archivo temporal para la conversión
+func (opts *audioOptions) prepareCover() (func(), error) {
+	if opts.Cover == nil || !coverArtFormats[opts.Format] {
+		return func() {}, nil
+	}
+	path, cleanup, err := writeTempInput(opts.Cover, "cover-*")
+	if err != nil {
+		return nil, err
+	}
+	opts.coverPath = path
+	return cleanup, nil
+}
+
+// extractCoverArt devuelve la primera carátula embebida de la entrada y su
+// formato (jpeg o png)
+func extractCoverArt(ctx context.Context, inputData []byte) ([]byte, string, int, int, error) {
+	_, probe, err := probeMedia(ctx, inputData)
+	if err != nil {
+		return nil, "", 0, 0, err
+	}
+
+	index := -1
+	var codec string
+	var width, height int
+	for _, stream := range probe.Streams {
+		if stream.CodecType == "video" && stream.Disposition.AttachedPic == 1 {
+			index, codec, width, height = stream.Index, stream.CodecName, stream.Width, stream.Height
+			break
+		}
+	}
+	if index < 0 {
+		return nil, "", 0, 0, errors.New("la entrada no tiene carátula embebida")
+	}
+
+	inputPath, cleanup, err := writeTempInput(inputData, "cover-input-*")
+	if err != nil {
+		return nil, "", 0, 0, err
+	}
+	defer cleanup()
+
+	// JPEG y PNG se copian tal cual; otros códecs se convierten a PNG
+	format, outputCodec := "png", "png"
+	switch codec {
+	case "mjpeg":
+		format, outputCodec = "jpeg", "copy"
+	case "png":
+		outputCodec = "copy"
+	}
+
+	cmd := ffmpegCommand(ctx, classInteractive,
+		"-i", inputPath,
+		"-map", "0:"+strconv.Itoa(index),
+		"-c:v", outputCodec,
+		"-frames:v", "1",
+		"-f", "image2pipe",
+		"pipe:1",
+	)
+	var output, errBuffer bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &errBuffer
+	if err := cmd.Run(); err != nil {
+		return nil, "", 0, 0, fmt.Errorf("error al extraer la carátula: %v, detalles: %s", err, errBuffer.String())
+	}
+	if output.Len() == 0 {
+		return nil, "", 0, 0, errors.New("la carátula extraída está vacía")
+	}
+	return output.Bytes(), format, width, height, nil
+}
+
+// processExtractCover atiende POST /extract-cover
+func processExtractCover(c *gin.Context) {
+	if !validateAPIKey(c) {
+		return
+	}
+
+	inputData, err := getInputData(c)
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+
+	image, format, width, height, err := extractCoverArt(c.Request.Context(), inputData)
+	if err == nil {
+		image, err = interceptOutput(c.Request.Context(), format, image)
+	}
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusUnprocessableEntity), err)
+		return
+	}
+
+	if wantsBinaryResponse(c, "") {
+		writeBinaryResponse(c, image, "cover."+format, "image/"+format, map[string]string{
+			"X-Format": format,
+			"X-Width":  strconv.Itoa(width),
+			"X-Height": strconv.Itoa(height),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, attachDebug(c.Request.Context(), gin.H{
+		"format": format,
+		"width":  width,
+		"height": height,
+		"size":   len(image),
+		"image":  base64.StdEncoding.EncodeToString(image),
+	}))
+}
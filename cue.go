@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// cueSheet es el contenido relevante de una hoja CUE
+type cueSheet struct {
+	Title     string
+	Performer string
+	Date      string
+	Genre     string
+	Tracks    []cueTrack
+}
+
+type cueTrack struct {
+	Number    int
+	Title     string
+	Performer string
+	// Start es el INDEX 01 de la pista, en segundos
+	Start float64
+}
+
+// parseCueSheet interpreta una hoja CUE de un único archivo de audio.
+// Los tiempos INDEX usan mm:ss:ff con 75 frames por segundo.
+func parseCueSheet(text string) (*cueSheet, error) {
+	sheet := &cueSheet{}
+	var current *cueTrack
+
+	scanner := bufio.NewScanner(strings.NewReader(strings.TrimPrefix(text, "\ufeff")))
+	for scanner.Scan() {
+		fields := splitCueLine(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch strings.ToUpper(fields[0]) {
+		case "TITLE":
+			if len(fields) > 1 {
+				if current != nil {
+					current.Title = fields[1]
+				} else {
+					sheet.Title = fields[1]
+				}
+			}
+		case "PERFORMER":
+			if len(fields) > 1 {
+				if current != nil {
+					current.Performer = fields[1]
+				} else {
+					sheet.Performer = fields[1]
+				}
+			}
+		case "REM":
+			if len(fields) > 2 && current == nil {
+				switch strings.ToUpper(fields[1]) {
+				case "DATE":
+					sheet.Date = fields[2]
+				case "GENRE":
+					sheet.Genre = fields[2]
+				}
+			}
+		case "TRACK":
+			if len(fields) < 2 {
+				return nil, errors.New("línea TRACK sin número")
+			}
+			number, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("número de pista inválido %q", fields[1])
+			}
+			sheet.Tracks = append(sheet.Tracks, cueTrack{Number: number, Start: -1})
+			current = &sheet.Tracks[len(sheet.Tracks)-1]
+		case "INDEX":
+			if current == nil || len(fields) < 3 || fields[1] != "01" {
+				continue
+			}
+			start, err := parseCueTime(fields[2])
+			if err != nil {
+				return nil, fmt.Errorf("pista %d: %v", current.Number, err)
+			}
+			current.Start = start
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(sheet.Tracks) == 0 {
+		return nil, errors.New("la hoja CUE no contiene pistas")
+	}
+	for i, track := range sheet.Tracks {
+		if track.Start < 0 {
+			return nil, fmt.Errorf("la pista %d no tiene INDEX 01", track.Number)
+		}
+		if i > 0 && track.Start <= sheet.Tracks[i-1].Start {
+			return nil, fmt.Errorf("la pista %d empieza antes que la anterior", track.Number)
+		}
+	}
+	return sheet, nil
+}
+
+// splitCueLine separa una línea en palabras respetando las comillas
+func splitCueLine(line string) []string {
+	var fields []string
+	var current strings.Builder
+	inQuotes := false
+	hasField := false
+
+	for _, r := range strings.TrimSpace(line) {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			hasField = true
+		case (r == ' ' || r == '\t') && !inQuotes:
+			if hasField {
+				fields = append(fields, current.String())
+				current.Reset()
+				hasField = false
+			}
+		default:
+			current.WriteRune(r)
+			hasField = true
+		}
+	}
+	if hasField {
+		fields = append(fields, current.String())
+	}
+	return fields
+}
+
+func parseCueTime(value string) (float64, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("tiempo INDEX inválido %q", value)
+	}
+
+	var numbers [3]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("tiempo INDEX inválido %q", value)
+		}
+		numbers[i] = n
+	}
+	if numbers[1] >= 60 || numbers[2] >= 75 {
+		return 0, fmt.Errorf("tiempo INDEX inválido %q", value)
+	}
+
+	return float64(numbers[0]*60+numbers[1]) + float64(numbers[2])/75, nil
+}
+
+// trackMetadata devuelve las etiquetas de la pista para -metadata
+func (sheet *cueSheet) trackMetadata(index int) map[string]string {
+	track := sheet.Tracks[index]
+	metadata := map[string]string{
+		"track": fmt.Sprintf("%d/%d", track.Number, len(sheet.Tracks)),
+	}
+
+	performer := track.Performer
+	if performer == "" {
+		performer = sheet.Performer
+	}
+	for key, value := range map[string]string{
+		"title":        track.Title,
+		"artist":       performer,
+		"album":        sheet.Title,
+		"album_artist": sheet.Performer,
+		"date":         sheet.Date,
+		"genre":        sheet.Genre,
+	} {
+		if value != "" {
+			metadata[key] = value
+		}
+	}
+	return metadata
+}
+
+// cueTrackOutput es una pista cortada
+type cueTrackOutput struct {
+	Track    cueTrack
+	End      float64 // 0 para la última pista (hasta el final)
+	Data     []byte
+	Metadata map[string]string
+}
+
+// splitByCue corta la entrada en pistas con un único proceso ffmpeg: la
+// entrada se decodifica una vez y cada salida aplica su propio -ss/-to
+func splitByCue(ctx context.Context, inputData []byte, sheet *cueSheet, format string) ([]cueTrackOutput, error) {
+	inputSource, stdin, cleanup, err := ffmpegInput(inputData, "cue-input-*")
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	outputs := make([]cueTrackOutput, len(sheet.Tracks))
+	outputPaths := make([]string, len(sheet.Tracks))
+	args := []string{"-i", inputSource}
+
+	for i, track := range sheet.Tracks {
+		outputPath, cleanupOutput, err := createTempOutput(fmt.Sprintf("cue-track-%02d-*.%s", track.Number, format))
+		if err != nil {
+			return nil, err
+		}
+		defer cleanupOutput()
+		outputPaths[i] = outputPath
+
+		outputs[i] = cueTrackOutput{Track: track, Metadata: sheet.trackMetadata(i)}
+
+		args = append(args, "-map", "0:a:0", "-ss", formatSeconds(track.Start))
+		if i+1 < len(sheet.Tracks) {
+			outputs[i].End = sheet.Tracks[i+1].Start
+			args = append(args, "-to", formatSeconds(outputs[i].End))
+		}
+		args = append(args, getFFmpegOutputArgs(format)...)
+		for _, key := range sortedKeys(outputs[i].Metadata) {
+			args = append(args, "-metadata", key+"="+outputs[i].Metadata[key])
+		}
+		args = append(args, classThreadArgs(ctx, classBatch)...)
+		args = append(args, "-y", outputPath)
+	}
+
+	cmd := ffmpegCommand(ctx, classBatch, args...)
+	cmd.Stdin = stdin
+	var errBuffer bytes.Buffer
+	cmd.Stderr = &errBuffer
+
+	fmt.Printf("[splitByCue] Cortando %d pistas a %s\n", len(sheet.Tracks), format)
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error during split: %v, details: %s", err, errBuffer.String())
+	}
+
+	for i := range outputs {
+		data, err := os.ReadFile(outputPaths[i])
+		if err != nil {
+			return nil, fmt.Errorf("error reading track %d: %v", outputs[i].Track.Number, err)
+		}
+		if len(data) == 0 {
+			return nil, fmt.Errorf("la pista %d quedó vacía (¿INDEX fuera del audio?)", outputs[i].Track.Number)
+		}
+		if format == "m4a" {
+			data = addGaplessInfo(data)
+		}
+		outputs[i].Data = data
+	}
+
+	return outputs, nil
+}
+
+// formatSeconds formatea segundos para -ss/-to con precisión de milisegundos
+func formatSeconds(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', 3, 64)
+}
+
+// readCueSheet obtiene la hoja CUE del campo "cue" o del archivo "cue_file"
+func readCueSheet(c *gin.Context) (string, error) {
+	if text := c.PostForm("cue"); text != "" {
+		return text, nil
+	}
+	if file, _, err := c.Request.FormFile("cue_file"); err == nil {
+		defer file.Close()
+		data, err := io.ReadAll(io.LimitReader(file, 1<<20))
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+	return "", errors.New("falta la hoja CUE (campo cue o cue_file)")
+}
+
+// runSplitCue corta la entrada y devuelve el cuerpo de la respuesta
+func runSplitCue(ctx context.Context, inputData []byte, sheet *cueSheet, format string) (gin.H, error) {
+	outputs, err := splitByCue(ctx, inputData, sheet, format)
+	if err != nil {
+		return nil, err
+	}
+
+	tracks := make([]gin.H, 0, len(outputs))
+	manifest := newArtifactManifest()
+	for _, output := range outputs {
+		if output.Data, err = interceptOutput(ctx, format, output.Data); err != nil {
+			return nil, err
+		}
+		track := gin.H{
+			"number":   output.Track.Number,
+			"title":    output.Track.Title,
+			"start":    output.Track.Start,
+			"metadata": output.Metadata,
+			"format":   format,
+			"audio":    base64.StdEncoding.EncodeToString(output.Data),
+		}
+		if output.End > 0 {
+			track["duration"] = output.End - output.Track.Start
+		}
+		manifest.add(track, fmt.Sprintf("track-%02d.%s", output.Track.Number, format), format, output.Data)
+		tracks = append(tracks, track)
+	}
+
+	return gin.H{
+		"album":     sheet.Title,
+		"performer": sheet.Performer,
+		"tracks":    tracks,
+		"manifest":  manifest,
+	}, nil
+}
+
+// processSplitCue atiende /split-cue: un audio largo más su hoja CUE
+func processSplitCue(c *gin.Context) {
+	if !validateAPIKey(c) {
+		return
+	}
+
+	inputData, err := getInputData(c)
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+
+	cueText, err := readCueSheet(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	sheet, err := parseCueSheet(cueText)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Hoja CUE inválida: " + err.Error()})
+		return
+	}
+
+	format := c.DefaultPostForm("output_format", "mp3")
+	run := func(ctx context.Context) (gin.H, error) {
+		return runSplitCue(ctx, inputData, sheet, format)
+	}
+
+	// Las grabaciones largas pueden procesarse en segundo plano con callback_url
+	callbackURL, err := parseCallbackURL(c.Request.Context(), c.PostForm("callback_url"))
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+	if callbackURL != "" {
+		job, err := submitJob(c.Request.Context(), "split-cue", callbackURL, inputData, run)
+		if err != nil {
+			respondError(c, http.StatusServiceUnavailable, err)
+			return
+		}
+		c.JSON(http.StatusAccepted, job.view())
+		return
+	}
+
+	response, err := run(c.Request.Context())
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusInternalServerError), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, attachDebug(c.Request.Context(), response))
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxCapturedLogBytes limita el log de ffmpeg guardado por captura
+const maxCapturedLogBytes = 256 << 10
+
+var (
+	// debugCaptureEnabled guarda las entradas y el log de las conversiones
+	// que fallan, para reproducir los reportes sin pedir el archivo de nuevo
+	debugCaptureEnabled  bool
+	debugCaptureDir      string
+	debugCaptureMaxCount int
+	// debugCaptureMaxBytes es el total en disco; debugCaptureMaxInput limita
+	// cada entrada (las más grandes se registran sin guardar el archivo)
+	debugCaptureMaxBytes int64
+	debugCaptureMaxInput int64
+	debugCaptureTTL      time.Duration
+	// debugCapturePerHour limita las capturas nuevas por hora
+	debugCapturePerHour int
+
+	debugCapturesMu sync.Mutex
+	debugCaptures   = map[string]*debugCapture{}
+	// debugCaptureTimes son los momentos de las capturas de la última hora
+	debugCaptureTimes []time.Time
+)
+
+func loadDebugCaptureConfig() {
+	debugCaptureEnabled = envBool("DEBUG_CAPTURE", false)
+	debugCaptureDir = os.Getenv("DEBUG_CAPTURE_DIR")
+	if debugCaptureDir == "" {
+		debugCaptureDir = filepath.Join(os.TempDir(), "audio-converter-debug")
+	}
+	debugCaptureMaxCount = envInt("DEBUG_CAPTURE_MAX_COUNT", 20)
+	debugCaptureMaxBytes = envInt64("DEBUG_CAPTURE_MAX_BYTES", 500<<20)
+	debugCaptureMaxInput = envInt64("DEBUG_CAPTURE_MAX_INPUT_BYTES", 50<<20)
+	debugCaptureTTL = envDuration("DEBUG_CAPTURE_TTL", 72*time.Hour)
+	debugCapturePerHour = envInt("DEBUG_CAPTURE_PER_HOUR", 30)
+	if debugCaptureEnabled {
+		fmt.Printf("Captura de depuración activa en %s (máximo %d)\n", debugCaptureDir, debugCaptureMaxCount)
+	}
+}
+
+// debugCapture es una conversión fallida guardada para depurar
+type debugCapture struct {
+	ID        string
+	RequestID string
+	Endpoint  string
+	Status    int
+	Error     string
+	Params    map[string]string
+	Labels    map[string]string
+	CreatedAt time.Time
+	Inputs    []debugCaptureInput
+	dir       string
+	size      int64
+}
+
+type debugCaptureInput struct {
+	SHA256 string
+	Size   int
+	// Stored es false si la entrada superaba DEBUG_CAPTURE_MAX_INPUT_BYTES
+	Stored bool
+	path   string
+}
+
+// sensitiveParamPattern identifica campos que no se guardan en la captura
+var sensitiveParamPattern = regexp.MustCompile(`(?i)(key|secret|token|password|signature|presigned|email)`)
+
+// captureParams conserva los campos de formulario útiles para reproducir la
+// conversión; los datos de la entrada y los campos sensibles se omiten
+func captureParams(c *gin.Context) map[string]string {
+	if c.Request.PostForm == nil && c.Request.MultipartForm == nil {
+		return nil
+	}
+	params := map[string]string{}
+	for name, values := range c.Request.PostForm {
+		if len(values) == 0 || name == "base64" || name == "cover_base64" || sensitiveParamPattern.MatchString(name) {
+			continue
+		}
+		value := values[0]
+		if len(value) > 1024 {
+			value = value[:1024] + "..."
+		}
+		params[name] = value
+	}
+	return params
+}
+
+// debugCaptureMiddleware guarda las conversiones síncronas que terminan en 5xx
+func debugCaptureMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !debugCaptureEnabled {
+			c.Next()
+			return
+		}
+
+		writer := &errorCaptureWriter{ResponseWriter: c.Writer, limit: maxCapturedLogBytes}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		status := c.Writer.Status()
+		if status < http.StatusInternalServerError {
+			return
+		}
+		var errorBody struct {
+			Error string `json:"error"`
+		}
+		message := writer.body.String()
+		if err := json.Unmarshal(writer.body.Bytes(), &errorBody); err == nil {
+			message = errorBody.Error
+		}
+		storeDebugCapture(requestInfoFrom(c.Request.Context()), status, message, captureParams(c))
+	}
+}
+
+// storeDebugCapture guarda las entradas y el log respetando el límite por
+// hora, la cantidad y el tamaño total
+func storeDebugCapture(info *requestInfo, status int, message string, params map[string]string) {
+	if !debugCaptureEnabled || len(info.Inputs) == 0 {
+		return
+	}
+
+	debugCapturesMu.Lock()
+	defer debugCapturesMu.Unlock()
+
+	now := time.Now()
+	pruneDebugCaptures(now)
+
+	recent := debugCaptureTimes[:0]
+	for _, at := range debugCaptureTimes {
+		if now.Sub(at) < time.Hour {
+			recent = append(recent, at)
+		}
+	}
+	debugCaptureTimes = recent
+	if len(debugCaptureTimes) >= debugCapturePerHour {
+		fmt.Printf("[debugCapture] Límite de %d capturas por hora alcanzado, no se guarda %s\n", debugCapturePerHour, info.ID)
+		return
+	}
+
+	capture := &debugCapture{
+		ID:        newRandomID(),
+		RequestID: info.ID,
+		Endpoint:  info.Endpoint,
+		Status:    status,
+		Error:     message,
+		Params:    params,
+		Labels:    info.Labels,
+		CreatedAt: now,
+	}
+	capture.dir = filepath.Join(debugCaptureDir, capture.ID)
+	if err := os.MkdirAll(capture.dir, 0o700); err != nil {
+		fmt.Printf("[debugCapture] No se pudo crear %s: %v\n", capture.dir, err)
+		return
+	}
+
+	for i, input := range info.Inputs {
+		entry := debugCaptureInput{SHA256: input.Hash, Size: len(input.Data)}
+		if int64(len(input.Data)) <= debugCaptureMaxInput {
+			entry.path = filepath.Join(capture.dir, "input-"+strconv.Itoa(i))
+			if err := writeAtRest(entry.path, input.Data); err == nil {
+				entry.Stored = true
+				capture.size += int64(len(input.Data))
+			}
+		}
+		capture.Inputs = append(capture.Inputs, entry)
+	}
+	if err := writeAtRest(filepath.Join(capture.dir, "ffmpeg.log"), []byte(message)); err == nil {
+		capture.size += int64(len(message))
+	}
+
+	debugCaptures[capture.ID] = capture
+	info.retain("debug_capture", capture.ID, now.Add(debugCaptureTTL))
+	debugCaptureTimes = append(debugCaptureTimes, now)
+	evictDebugCaptures()
+	fmt.Printf("[debugCapture] Captura %s guardada (solicitud %s, %s, %d bytes)\n", capture.ID, info.ID, info.Endpoint, capture.size)
+}
+
+// pruneDebugCaptures borra las capturas vencidas. Se llama con
+// debugCapturesMu tomado.
+func pruneDebugCaptures(now time.Time) {
+	for id, capture := range debugCaptures {
+		if now.Sub(capture.CreatedAt) > debugCaptureTTL {
+			removeDebugCapture(id)
+		}
+	}
+}
+
+// evictDebugCaptures borra las más antiguas hasta respetar la cantidad y el
+// tamaño máximos. Se llama con debugCapturesMu tomado.
+func evictDebugCaptures() {
+	for {
+		var total int64
+		var oldest *debugCapture
+		for _, capture := range debugCaptures {
+			total += capture.size
+			if oldest == nil || capture.CreatedAt.Before(oldest.CreatedAt) {
+				oldest = capture
+			}
+		}
+		if oldest == nil || (len(debugCaptures) <= debugCaptureMaxCount && total <= debugCaptureMaxBytes) {
+			return
+		}
+		removeDebugCapture(oldest.ID)
+	}
+}
+
+func removeDebugCapture(id string) {
+	if capture, ok := debugCaptures[id]; ok {
+		os.RemoveAll(capture.dir)
+		delete(debugCaptures, id)
+	}
+}
+
+func (capture *debugCapture) view(includeLog bool) gin.H {
+	inputs := make([]gin.H, 0, len(capture.Inputs))
+	for i, input := range capture.Inputs {
+		entry := gin.H{"index": i, "sha256": input.SHA256, "size": input.Size, "stored": input.Stored}
+		if input.Stored {
+			entry["download"] = "/admin/debug-captures/" + capture.ID + "/inputs/" + strconv.Itoa(i)
+		}
+		inputs = append(inputs, entry)
+	}
+	view := gin.H{
+		"id":         capture.ID,
+		"request_id": capture.RequestID,
+		"endpoint":   capture.Endpoint,
+		"status":     capture.Status,
+		"created_at": capture.CreatedAt.UTC().Format(time.RFC3339),
+		"params":     capture.Params,
+		"labels":     capture.Labels,
+		"inputs":     inputs,
+		"size":       capture.size,
+	}
+	if includeLog {
+		view["log"] = capture.Error
+	}
+	return view
+}
+
+// listDebugCaptures atiende GET /admin/debug-captures
+func listDebugCaptures(c *gin.Context) {
+	if !validateAPIKey(c) {
+		return
+	}
+
+	debugCapturesMu.Lock()
+	pruneDebugCaptures(time.Now())
+	list := make([]*debugCapture, 0, len(debugCaptures))
+	for _, capture := range debugCaptures {
+		list = append(list, capture)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	views := make([]gin.H, 0, len(list))
+	for _, capture := range list {
+		views = append(views, capture.view(false))
+	}
+	debugCapturesMu.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{"enabled": debugCaptureEnabled, "captures": views})
+}
+
+func lookupDebugCapture(c *gin.Context) (*debugCapture, bool) {
+	debugCapturesMu.Lock()
+	defer debugCapturesMu.Unlock()
+	capture, ok := debugCaptures[c.Param("id")]
+	if !ok || time.Since(capture.CreatedAt) > debugCaptureTTL {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Captura no encontrada"})
+		return nil, false
+	}
+	return capture, true
+}
+
+// getDebugCapture atiende GET /admin/debug-captures/:id con el log completo
+func getDebugCapture(c *gin.Context) {
+	if !validateAPIKey(c) {
+		return
+	}
+	if capture, ok := lookupDebugCapture(c); ok {
+		c.JSON(http.StatusOK, capture.view(true))
+	}
+}
+
+// downloadDebugCaptureInput atiende GET /admin/debug-captures/:id/inputs/:index
+func downloadDebugCaptureInput(c *gin.Context) {
+	if !validateAPIKey(c) {
+		return
+	}
+	capture, ok := lookupDebugCapture(c)
+	if !ok {
+		return
+	}
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil || index < 0 || index >= len(capture.Inputs) || !capture.Inputs[index].Stored {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Entrada no guardada en la captura"})
+		return
+	}
+	input := capture.Inputs[index]
+	serveAtRestFile(c, input.path, capture.ID+"-input-"+strconv.Itoa(index), "application/octet-stream")
+}
+
+// deleteDebugCapture atiende DELETE /admin/debug-captures/:id
+func deleteDebugCapture(c *gin.Context) {
+	if !validateAPIKey(c) {
+		return
+	}
+	if _, ok := lookupDebugCapture(c); !ok {
+		return
+	}
+	debugCapturesMu.Lock()
+	removeDebugCapture(c.Param("id"))
+	debugCapturesMu.Unlock()
+	c.JSON(http.StatusOK, gin.H{"id": c.Param("id"), "deleted": true})
+}
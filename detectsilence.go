@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	silenceStartRe  = regexp.MustCompile(`silence_start: (-?[\d.]+)`)
+	silenceEndRe    = regexp.MustCompile(`silence_end: (-?[\d.]+)`)
+	inputDurationRe = regexp.MustCompile(`Duration: (\d+):(\d+):(\d+(?:\.\d+)?)`)
+)
+
+// silentRegion es un tramo en silencio, en segundos desde el inicio
+type silentRegion struct {
+	Start    float64 `json:"start"`
+	End      float64 `json:"end"`
+	Duration float64 `json:"duration"`
+}
+
+// silenceReport es el resultado de silencedetect sobre la entrada completa
+type silenceReport struct {
+	Regions  []silentRegion
+	Duration float64
+}
+
+// detectSilence ejecuta silencedetect con los mismos umbrales que
+// remove_silence y devuelve los tramos detectados
+func detectSilence(ctx context.Context, inputData []byte, params *silenceRemoval) (*silenceReport, error) {
+	inputSource, stdin, cleanup, err := ffmpegInput(inputData, "silence-input-*")
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	threshold := strconv.FormatFloat(params.ThresholdDB, 'f', -1, 64) + "dB"
+	duration := strconv.FormatFloat(params.MinDuration, 'f', -1, 64)
+	cmd := ffmpegCommand(ctx, classInteractive,
+		"-nostats",
+		"-i", inputSource,
+		"-vn",
+		"-af", fmt.Sprintf("silencedetect=noise=%s:d=%s", threshold, duration),
+		"-f", "null",
+		"-",
+	)
+	cmd.Stdin = stdin
+	var errBuffer bytes.Buffer
+	cmd.Stderr = &errBuffer
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error al detectar silencios: %v, detalles: %s", err, errBuffer.String())
+	}
+	return parseSilenceDetect(errBuffer.String()), nil
+}
+
+// parseSilenceDetect empareja las líneas silence_start y silence_end. Un
+// silencio que llega hasta el final sin silence_end (versiones de ffmpeg
+// anteriores a 5.0) se cierra con la duración de la entrada.
+func parseSilenceDetect(stderrOutput string) *silenceReport {
+	report := &silenceReport{Regions: []silentRegion{}}
+	if matches := inputDurationRe.FindStringSubmatch(stderrOutput); matches != nil {
+		hours, _ := strconv.ParseFloat(matches[1], 64)
+		minutes, _ := strconv.ParseFloat(matches[2], 64)
+		seconds, _ := strconv.ParseFloat(matches[3], 64)
+		report.Duration = hours*3600 + minutes*60 + seconds
+	}
+
+	starts := silenceStartRe.FindAllStringSubmatchIndex(stderrOutput, -1)
+	ends := silenceEndRe.FindAllStringSubmatchIndex(stderrOutput, -1)
+	for i, start := range starts {
+		startValue, _ := strconv.ParseFloat(stderrOutput[start[2]:start[3]], 64)
+		end := report.Duration
+		if i < len(ends) {
+			end, _ = strconv.ParseFloat(stderrOutput[ends[i][2]:ends[i][3]], 64)
+		}
+		// silence_start puede ser negativo por el retardo del filtro
+		startValue = math.Max(startValue, 0)
+		if end <= startValue {
+			continue
+		}
+		report.Regions = append(report.Regions, silentRegion{
+			Start:    roundMillis(startValue),
+			End:      roundMillis(end),
+			Duration: roundMillis(end - startValue),
+		})
+	}
+	return report
+}
+
+func roundMillis(seconds float64) float64 {
+	return math.Round(seconds*1000) / 1000
+}
+
+// processDetectSilence atiende POST /detect-silence: los tramos en silencio
+// de la entrada, p. ej. para encontrar tiempo muerto en llamadas grabadas
+func processDetectSilence(c *gin.Context) {
+	if !validateAPIKey(c) {
+		return
+	}
+
+	inputData, err := getInputData(c)
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+
+	params, err := parseSilenceRemoval(c.PostForm("silence_threshold"), c.PostForm("silence_min_duration"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	report, err := detectSilence(c.Request.Context(), inputData, params)
+	if err != nil {
+		respondError(c, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	total := 0.0
+	for _, region := range report.Regions {
+		total += region.Duration
+	}
+	response := gin.H{
+		"silences":          report.Regions,
+		"count":             len(report.Regions),
+		"total_silence":     roundMillis(total),
+		"duration":          roundMillis(report.Duration),
+		"silence_threshold": params.ThresholdDB,
+		"min_duration":      params.MinDuration,
+	}
+	if report.Duration > 0 {
+		response["silence_ratio"] = math.Round(total/report.Duration*1000) / 1000
+	}
+	c.JSON(http.StatusOK, attachDebug(c.Request.Context(), response))
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// segmentWorkerURLs son otras instancias del servicio que codifican
+	// segmentos de los trabajos con parallel=true (POST /admin/encode-segment)
+	segmentWorkerURLs []string
+	// segmentWorkerKey es la key dedicada que envía este nodo y que acepta
+	// /admin/encode-segment (SEGMENT_WORKER_API_KEY). Sin ella no se reparten
+	// ni se reciben segmentos.
+	segmentWorkerKey string
+	// segmentWorkerConcurrency son los segmentos que se envían a la vez a
+	// cada instancia
+	segmentWorkerConcurrency int
+	// segmentWorkerMinDuration es la duración mínima de la entrada para
+	// repartirla: en videos cortos subir los segmentos no compensa
+	segmentWorkerMinDuration float64
+	segmentWorkerClient      *http.Client
+)
+
+// segmentFilters son los filtros que acepta /admin/encode-segment: los del
+// ajuste a un preset (ver planVideoFit)
+var segmentFilters = map[string]bool{"crop": true, "pad": true, "scale": true}
+
+// loadSegmentWorkerConfig lee los nodos de SEGMENT_WORKER_URLS. Los
+// segmentos viajan con la key y el video del cliente, así que se exige https
+// salvo que SEGMENT_WORKER_ALLOW_HTTP=true (p. ej. en una red privada).
+func loadSegmentWorkerConfig() {
+	allowHTTP := os.Getenv("SEGMENT_WORKER_ALLOW_HTTP") == "true"
+	segmentWorkerURLs = nil
+	for _, raw := range strings.Split(os.Getenv("SEGMENT_WORKER_URLS"), ",") {
+		raw = strings.TrimRight(strings.TrimSpace(raw), "/")
+		if raw == "" {
+			continue
+		}
+		parsed, err := url.Parse(raw)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			fmt.Printf("SEGMENT_WORKER_URLS: URL inválida %q, se ignora\n", raw)
+			continue
+		}
+		if parsed.Scheme == "http" && !allowHTTP {
+			fmt.Printf("SEGMENT_WORKER_URLS: %s no usa https (SEGMENT_WORKER_ALLOW_HTTP=true lo permite), se ignora\n", raw)
+			continue
+		}
+		segmentWorkerURLs = append(segmentWorkerURLs, raw)
+	}
+	segmentWorkerKey = os.Getenv("SEGMENT_WORKER_API_KEY")
+	if segmentWorkerKey == "" && len(segmentWorkerURLs) > 0 {
+		fmt.Println("SEGMENT_WORKER_URLS requiere SEGMENT_WORKER_API_KEY, los segmentos se codifican solo en este nodo")
+		segmentWorkerURLs = nil
+	}
+	segmentWorkerConcurrency = envInt("SEGMENT_WORKER_CONCURRENCY", 2)
+	if segmentWorkerConcurrency < 1 {
+		segmentWorkerConcurrency = 1
+	}
+	segmentWorkerMinDuration = envDuration("SEGMENT_WORKER_MIN_DURATION", 20*time.Minute).Seconds()
+	segmentWorkerClient = &http.Client{Timeout: envDuration("SEGMENT_WORKER_TIMEOUT", 30*time.Minute)}
+
+	if len(segmentWorkerURLs) > 0 {
+		fmt.Printf("Nodos para segmentos de video: %d (%d segmentos a la vez en cada uno)\n", len(segmentWorkerURLs), segmentWorkerConcurrency)
+	}
+}
+
+// segmentWorkersFor devuelve los nodos que reciben segmentos de esta
+// entrada. Las entradas rotadas se codifican solo aquí: el recorte sin
+// recodificar no conserva la rotación del contenedor.
+func segmentWorkersFor(index *videoPacketIndex, opts videoToMp4Options) []string {
+	if opts.rotation != 0 || index.Duration < segmentWorkerMinDuration {
+		return nil
+	}
+	return segmentWorkerURLs
+}
+
+// encodeRemoteSegment recorta el segmento sin recodificar (los cortes caen en
+// keyframes), lo envía a otro nodo para codificarlo y guarda el MPEG-TS que
+// devuelve en segment.Path
+func encodeRemoteSegment(ctx context.Context, node, inputPath, chunkPath string, segment videoSegment, opts videoToMp4Options) error {
+	var args []string
+	if segment.Start > 0 {
+		args = append(args, "-ss", keyframeTime(segment.Start))
+	}
+	if segment.End > 0 {
+		args = append(args, "-to", keyframeTime(segment.End))
+	}
+	args = append(args, "-i", inputPath, "-map", "0:v:0", "-c", "copy", "-f", "matroska", "-y", chunkPath)
+	cmd := ffmpegCommand(ctx, classBatch, args...)
+	var errBuffer bytes.Buffer
+	cmd.Stderr = &errBuffer
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error al recortar el segmento desde %s s: %v, detalles: %s", keyframeTime(segment.Start), err, errBuffer.String())
+	}
+
+	// El segmento se sube a medida que se lee del disco
+	body, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	go func() {
+		writer.CloseWithError(func() error {
+			if len(opts.fitFilters) > 0 {
+				if err := form.WriteField("vf", strings.Join(opts.fitFilters, ",")); err != nil {
+					return err
+				}
+			}
+			part, err := form.CreateFormFile("file", "segment.mkv")
+			if err != nil {
+				return err
+			}
+			chunk, err := os.Open(chunkPath)
+			if err != nil {
+				return err
+			}
+			defer chunk.Close()
+			if _, err := io.Copy(part, chunk); err != nil {
+				return err
+			}
+			return form.Close()
+		}())
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, node+"/admin/encode-segment", body)
+	if err != nil {
+		body.Close()
+		return err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("apikey", segmentWorkerKey)
+	if id := requestInfoFrom(ctx).ID; id != "" {
+		req.Header.Set("X-Request-ID", id)
+	}
+
+	resp, err := segmentWorkerClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("estado inesperado %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+
+	output, err := os.Create(segment.Path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(output, resp.Body); err != nil {
+		output.Close()
+		return fmt.Errorf("error al recibir el segmento: %v", err)
+	}
+	return output.Close()
+}
+
+// parseSegmentFilters valida vf de /admin/encode-segment: solo recorte,
+// relleno y escala
+func parseSegmentFilters(vf string) ([]string, error) {
+	if vf == "" {
+		return nil, nil
+	}
+	filters, err := splitFilterGraph(vf)
+	if err != nil {
+		return nil, fmt.Errorf("vf inválido: %v", err)
+	}
+	for _, filter := range filters {
+		if !segmentFilters[filterName(filter)] {
+			return nil, fmt.Errorf("vf inválido: el filtro %q no se admite en segmentos (crop, pad o scale)", filterName(filter))
+		}
+	}
+	return filters, nil
+}
+
+// authorizeSegmentWorker acepta solo la key dedicada de los nodos, no la
+// API_KEY: quien reparte segmentos no necesita la key principal de este nodo
+func authorizeSegmentWorker(c *gin.Context) bool {
+	if segmentWorkerKey == "" {
+		respondError(c, http.StatusForbidden, notConfigured("SEGMENT_WORKER_API_KEY no configurado: este nodo no recibe segmentos"))
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(c.GetHeader("apikey")), []byte(segmentWorkerKey)) != 1 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid SEGMENT_WORKER_API_KEY"})
+		return false
+	}
+	return true
+}
+
+// processEncodeSegment atiende POST /admin/encode-segment: codifica un
+// segmento de video que envía otro nodo con los mismos ajustes que la
+// conversión local y devuelve el MPEG-TS. Comparte los cupos de
+// PARALLEL_WORKERS con los segmentos locales.
+func processEncodeSegment(c *gin.Context) {
+	if !authorizeSegmentWorker(c) {
+		return
+	}
+
+	filters, err := parseSegmentFilters(c.PostForm("vf"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file es obligatorio"})
+		return
+	}
+
+	inputFile, err := os.CreateTemp("", "segment-input-*.mkv")
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+	inputPath := inputFile.Name()
+	inputFile.Close()
+	defer os.Remove(inputPath)
+	if err := c.SaveUploadedFile(file, inputPath); err != nil {
+		respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	outputFile, err := os.CreateTemp("", "segment-output-*.ts")
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+	outputPath := outputFile.Name()
+	outputFile.Close()
+	defer os.Remove(outputPath)
+
+	fmt.Printf("[parallel] Segmento recibido de otro nodo (solicitud %s, %d bytes)\n", c.GetHeader("X-Request-ID"), file.Size)
+
+	ctx := c.Request.Context()
+	select {
+	case parallelSlots <- struct{}{}:
+	case <-ctx.Done():
+		return
+	}
+	err = encodeVideoSegment(ctx, inputPath, outputPath, 0, 0, videoToMp4Options{fitFilters: filters})
+	<-parallelSlots
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+	writeBinaryResponse(c, data, "segment.ts", "video/mp2t", nil)
+}
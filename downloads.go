@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// downloadEntry es un archivo convertido disponible temporalmente vía enlace firmado
+type downloadEntry struct {
+	path        string
+	filename    string
+	contentType string
+	expiresAt   time.Time
+}
+
+type downloadConfig struct {
+	publicBaseURL      string
+	downloadSigningKey string
+	downloadLinkTTL    time.Duration
+}
+
+var (
+	downloadDir = filepath.Join(os.TempDir(), "evolution-downloads")
+
+	downloadsMu sync.Mutex
+	downloads   = map[string]*downloadEntry{}
+)
+
+func loadDownloadConfig(cfg *reloadableConfig) {
+	cfg.publicBaseURL = strings.TrimRight(os.Getenv("PUBLIC_BASE_URL"), "/")
+	cfg.downloadSigningKey = os.Getenv("DOWNLOAD_SIGNING_KEY")
+	if cfg.downloadSigningKey == "" {
+		cfg.downloadSigningKey = cfg.apiKey
+	}
+	cfg.downloadLinkTTL = envDuration("DOWNLOAD_LINK_TTL", 24*time.Hour)
+}
+
+func newRandomID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(buf)
+}
+
+func signDownload(key string, id string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(id + "." + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// createSignedDownload guarda los datos en disco y devuelve un enlace firmado
+// que expira después de DOWNLOAD_LINK_TTL
+func createSignedDownload(data []byte, filename string, contentType string) (string, time.Time, error) {
+	cfg := config()
+	if cfg.publicBaseURL == "" {
+		return "", time.Time{}, notConfigured("PUBLIC_BASE_URL no configurado, no se pueden generar enlaces de descarga")
+	}
+	if cfg.downloadSigningKey == "" {
+		return "", time.Time{}, errors.New("no hay clave para firmar enlaces de descarga")
+	}
+
+	if err := os.MkdirAll(downloadDir, 0o700); err != nil {
+		return "", time.Time{}, fmt.Errorf("error al crear directorio de descargas: %v", err)
+	}
+
+	id := newRandomID()
+	path := filepath.Join(downloadDir, id)
+	if err := writeAtRest(path, data); err != nil {
+		return "", time.Time{}, fmt.Errorf("error al guardar archivo de descarga: %v", err)
+	}
+
+	expiresAt := time.Now().Add(cfg.downloadLinkTTL)
+	downloadsMu.Lock()
+	downloads[id] = &downloadEntry{
+		path:        path,
+		filename:    filename,
+		contentType: contentType,
+		expiresAt:   expiresAt,
+	}
+	downloadsMu.Unlock()
+
+	expires := expiresAt.Unix()
+	link := fmt.Sprintf("%s/downloads/%s?expires=%d&signature=%s",
+		cfg.publicBaseURL, id, expires, signDownload(cfg.downloadSigningKey, id, expires))
+	return link, expiresAt, nil
+}
+
+// cleanupExpiredDownloads elimina periódicamente los archivos vencidos
+func cleanupExpiredDownloads() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now()
+		downloadsMu.Lock()
+		for id, entry := range downloads {
+			if now.After(entry.expiresAt) {
+				os.Remove(entry.path)
+				delete(downloads, id)
+				fmt.Printf("Descarga expirada eliminada: %s\n", id)
+			}
+		}
+		downloadsMu.Unlock()
+	}
+}
+
+// removeDownload borra una descarga antes de que venza
+func removeDownload(id string) bool {
+	downloadsMu.Lock()
+	defer downloadsMu.Unlock()
+	entry, ok := downloads[id]
+	if !ok {
+		return false
+	}
+	os.Remove(entry.path)
+	delete(downloads, id)
+	return true
+}
+
+func serveDownload(c *gin.Context) {
+	id := c.Param("id")
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Enlace de descarga inválido"})
+		return
+	}
+
+	expected := signDownload(config().downloadSigningKey, id, expires)
+	if !hmac.Equal([]byte(expected), []byte(c.Query("signature"))) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Firma de descarga inválida"})
+		return
+	}
+
+	if time.Now().Unix() > expires {
+		c.JSON(http.StatusGone, gin.H{"error": "El enlace de descarga expiró"})
+		return
+	}
+
+	downloadsMu.Lock()
+	entry, ok := downloads[id]
+	downloadsMu.Unlock()
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Descarga no encontrada"})
+		return
+	}
+
+	serveAtRestFile(c, entry.path, entry.filename, entry.contentType)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	smtpHost               string
+	smtpPort               string
+	smtpUsername           string
+	smtpPassword           string
+	smtpFrom               string
+	emailSubject           string
+	emailMaxAttachmentSize int64
+)
+
+func loadEmailConfig() {
+	smtpHost = os.Getenv("SMTP_HOST")
+	smtpPort = os.Getenv("SMTP_PORT")
+	if smtpPort == "" {
+		smtpPort = "587"
+	}
+	smtpUsername = os.Getenv("SMTP_USERNAME")
+	smtpPassword = os.Getenv("SMTP_PASSWORD")
+	smtpFrom = os.Getenv("SMTP_FROM")
+	emailSubject = os.Getenv("EMAIL_SUBJECT")
+	if emailSubject == "" {
+		emailSubject = "Your converted file"
+	}
+	emailMaxAttachmentSize = envInt64("EMAIL_MAX_ATTACHMENT_BYTES", 10*1024*1024)
+
+	if smtpHost != "" {
+		fmt.Printf("Entrega por email habilitada vía %s:%s\n", smtpHost, smtpPort)
+	}
+}
+
+// deliverByEmail envía el archivo convertido como adjunto, o un enlace firmado
+// de descarga si supera EMAIL_MAX_ATTACHMENT_BYTES. Devuelve el resumen
+// que se incluye en la respuesta JSON.
+func deliverByEmail(to string, data []byte, filename string, contentType string) map[string]interface{} {
+	result := map[string]interface{}{"to": to}
+
+	if err := sendConversionEmail(to, data, filename, contentType, result); err != nil {
+		fmt.Printf("Error al enviar email a %s: %v\n", to, err)
+		result["status"] = "failed"
+		result["error"] = err.Error()
+		return result
+	}
+
+	fmt.Printf("Email enviado a %s (%s)\n", to, result["delivery"])
+	result["status"] = "sent"
+	return result
+}
+
+// resultLink devuelve el enlace de descarga incluido en una respuesta, si lo hay
+func resultLink(response gin.H) string {
+	if email, ok := response["email"].(map[string]interface{}); ok {
+		if link, ok := email["link"].(string); ok {
+			return link
+		}
+	}
+	return ""
+}
+
+func sendConversionEmail(to string, data []byte, filename string, contentType string, result map[string]interface{}) error {
+	if smtpHost == "" || smtpFrom == "" {
+		return notConfigured("SMTP no configurado (SMTP_HOST y SMTP_FROM son obligatorios)")
+	}
+
+	recipient, err := mail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("dirección de email inválida: %v", err)
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	headers := []string{
+		"From: " + smtpFrom,
+		"To: " + recipient.String(),
+		"Subject: " + mime.QEncoding.Encode("utf-8", emailSubject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/mixed; boundary=" + writer.Boundary(),
+	}
+
+	textPart, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"text/plain; charset=utf-8"},
+	})
+	if err != nil {
+		return err
+	}
+
+	if int64(len(data)) > emailMaxAttachmentSize {
+		link, expiresAt, err := createSignedDownload(data, filename, contentType)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(textPart, "Your file %s is ready (%d bytes).\r\n\r\nDownload it here: %s\r\n\r\nThe link expires on %s.\r\n",
+			filename, len(data), link, expiresAt.UTC().Format(time.RFC1123))
+		result["delivery"] = "link"
+		result["link"] = link
+		result["expires_at"] = expiresAt.UTC().Format(time.RFC3339)
+	} else {
+		fmt.Fprintf(textPart, "Your file %s is attached (%d bytes).\r\n", filename, len(data))
+
+		attachment, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": filename})},
+		})
+		if err != nil {
+			return err
+		}
+		if err := writeBase64Lines(attachment, data); err != nil {
+			return err
+		}
+		result["delivery"] = "attachment"
+	}
+
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	message := strings.Join(headers, "\r\n") + "\r\n\r\n" + body.String()
+
+	var auth smtp.Auth
+	if smtpUsername != "" {
+		auth = smtp.PlainAuth("", smtpUsername, smtpPassword, smtpHost)
+	}
+
+	return smtp.SendMail(net.JoinHostPort(smtpHost, smtpPort), auth, smtpFrom, []string{recipient.Address}, []byte(message))
+}
+
+// writeBase64Lines codifica en base64 con líneas de 76 caracteres (RFC 2045)
+func writeBase64Lines(w io.Writer, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		if _, err := w.Write([]byte(encoded[:76] + "\r\n")); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err := w.Write([]byte(encoded + "\r\n"))
+	return err
+}
+
+// fileExtensionForFormat devuelve la extensión de archivo de un formato de
+// salida: ALAC se entrega como .m4a y AMR-WB como .awb
+func fileExtensionForFormat(format string) string {
+	switch format {
+	case "alac":
+		return "m4a"
+	case "amr-wb":
+		return "awb"
+	case "ulaw", "alaw":
+		return "wav"
+	}
+	return format
+}
+
+// contentTypeForFormat devuelve el MIME type de un formato de salida
+func contentTypeForFormat(format string) string {
+	switch format {
+	case "mp3":
+		return "audio/mpeg"
+	case "wav", "ulaw", "alaw":
+		return "audio/wav"
+	case "aac", "mp4":
+		return "audio/aac"
+	case "amr":
+		return "audio/amr"
+	case "amr-wb":
+		return "audio/amr-wb"
+	case "flac":
+		return "audio/flac"
+	case "m4a", "alac":
+		return "audio/mp4"
+	case "ogg":
+		return "audio/ogg"
+	case "webm":
+		return "video/webm"
+	case "mov":
+		return "video/quicktime"
+	case "gif":
+		return "image/gif"
+	case "webp":
+		return "image/webp"
+	case "png":
+		return "image/png"
+	case "jpeg":
+		return "image/jpeg"
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envInt lee una variable de entorno entera, usando def si no existe o es inválida
+func envInt(name string, def int) int {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return def
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		fmt.Printf("Valor inválido para %s (%s), usando %d\n", name, value, def)
+		return def
+	}
+	return parsed
+}
+
+// envInt64 es como envInt pero para tamaños en bytes
+func envInt64(name string, def int64) int64 {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return def
+	}
+
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		fmt.Printf("Valor inválido para %s (%s), usando %d\n", name, value, def)
+		return def
+	}
+	return parsed
+}
+
+// envDuration lee una duración en formato Go ("30s", "24h")
+func envDuration(name string, def time.Duration) time.Duration {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return def
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		fmt.Printf("Valor inválido para %s (%s), usando %s\n", name, value, def)
+		return def
+	}
+	return parsed
+}
+
+// envBool acepta los valores habituales de strconv.ParseBool
+func envBool(name string, def bool) bool {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return def
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		fmt.Printf("Valor inválido para %s (%s), usando %t\n", name, value, def)
+		return def
+	}
+	return parsed
+}
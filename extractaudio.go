@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// processExtractAudio atiende /extract-audio: devuelve solo una pista de
+// audio de un video, con los mismos formatos que /process-audio
+func processExtractAudio(c *gin.Context) {
+	if !validateAPIKey(c) {
+		return
+	}
+
+	inputData, err := getInputData(c)
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	_, probe, err := probeMedia(ctx, inputData)
+	if err != nil {
+		respondError(c, http.StatusUnprocessableEntity, err)
+		return
+	}
+	audioTracks := 0
+	for _, stream := range probe.Streams {
+		if stream.CodecType == "audio" {
+			audioTracks++
+		}
+	}
+	if audioTracks == 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "la entrada no tiene pistas de audio"})
+		return
+	}
+
+	opts := audioOptions{
+		Format:           negotiateFormat(c, audioNegotiationFormats, "ogg"),
+		DisableCodecCopy: c.PostForm("codec_copy") == "false",
+	}
+	// audio_track elige la pista (desde 1) en videos con varios idiomas o
+	// comentarios; sin él ffmpeg toma la pista de audio principal
+	if value := c.PostForm("audio_track"); value != "" {
+		track, err := strconv.Atoi(value)
+		if err != nil || track < 1 || track > audioTracks {
+			respondError(c, http.StatusBadRequest, invalidParam("audio_track", "audio_track debe estar entre 1 y %d", audioTracks))
+			return
+		}
+		opts.AudioTrack = track
+	}
+
+	if wantsBinaryResponse(c, "") {
+		audioData, duration, err := convertAudio(ctx, inputData, opts)
+		if err == nil {
+			audioData, err = interceptOutput(ctx, opts.Format, audioData)
+		}
+		if err != nil {
+			respondError(c, mediaErrorStatus(err, http.StatusInternalServerError), err)
+			return
+		}
+		writeBinaryResponse(c, audioData, opts.outputFilename(), opts.outputContentType(), map[string]string{
+			"X-Duration":     strconv.Itoa(duration),
+			"X-Format":       opts.Format,
+			"X-Audio-Tracks": strconv.Itoa(audioTracks),
+		})
+		return
+	}
+
+	response, err := runProcessAudio(ctx, inputData, opts, "", nil)
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusInternalServerError), err)
+		return
+	}
+	response["audio_tracks"] = audioTracks
+	if opts.AudioTrack > 0 {
+		response["audio_track"] = opts.AudioTrack
+	}
+	c.JSON(http.StatusOK, attachDebug(ctx, response))
+}
+
+// audioTrackArgs selecciona la pista de audio pedida
+func (opts audioOptions) audioTrackArgs(args []string) []string {
+	if opts.AudioTrack == 0 {
+		return args
+	}
+	return append([]string{"-map", "0:a:" + strconv.Itoa(opts.AudioTrack-1)}, args...)
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// filterGraphOptions son las opciones de filtro de ffmpeg que se registran
+// en debug.filtergraphs
+var filterGraphOptions = map[string]bool{"-af": true, "-vf": true, "-filter_complex": true, "-lavfi": true}
+
+// filterOptionNames relaciona los filtros que faltan en algunos builds de
+// ffmpeg con el parámetro que los pide, para que el error lo nombre
+var filterOptionNames = map[string]string{
+	"afftdn":        "denoise",
+	"anlmdn":        "denoise",
+	"arnndn":        "denoise",
+	"silenceremove": "remove_silence",
+	"acompressor":   "compress_dynamics",
+	"rubberband":    "pitch_semitones",
+	"atempo":        "speed / target_duration",
+	"loudnorm":      "normalize",
+	"alimiter":      "true_peak_limit",
+	"pan":           "channel_layout / mono_downmix_safe",
+	"adelay":        "pad_to_duration",
+	"apad":          "pad_to_duration / target_duration",
+	"tpad":          "pad_to_duration",
+}
+
+var (
+	ffmpegFiltersOnce sync.Once
+	ffmpegFilters     map[string]bool
+)
+
+// availableFilters lista los filtros del ffmpeg instalado (ffmpeg -filters)
+// una sola vez. Devuelve nil si no se pudo consultar: entonces no se revisa
+// la disponibilidad.
+func availableFilters() map[string]bool {
+	ffmpegFiltersOnce.Do(func() {
+		output, err := exec.Command("ffmpeg", "-hide_banner", "-filters").Output()
+		if err != nil {
+			fmt.Printf("No se pudo listar los filtros de ffmpeg: %v\n", err)
+			return
+		}
+		filters := map[string]bool{}
+		scanner := bufio.NewScanner(bytes.NewReader(output))
+		for scanner.Scan() {
+			// " T.. acompressor  A->A  Audio compressor."
+			fields := strings.Fields(scanner.Text())
+			if len(fields) >= 3 && strings.Contains(fields[2], "->") {
+				filters[fields[1]] = true
+			}
+		}
+		ffmpegFilters = filters
+	})
+	return ffmpegFilters
+}
+
+// filterGraphError es un filtergraph que ffmpeg no podría ejecutar
+type filterGraphError struct {
+	Graph string
+	// Missing son los filtros que no están en el build de ffmpeg
+	Missing []string
+	// Reason describe un filtergraph mal armado
+	Reason string
+}
+
+func (e *filterGraphError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("filtergraph mal armado (%s): %s", e.Reason, e.Graph)
+	}
+	described := make([]string, len(e.Missing))
+	for i, name := range e.Missing {
+		described[i] = name
+		if option, ok := filterOptionNames[name]; ok {
+			described[i] += " (" + option + ")"
+		}
+	}
+	return fmt.Sprintf("este ffmpeg no incluye los filtros %s: %s", strings.Join(described, ", "), e.Graph)
+}
+
+// status es 501 si falta un filtro del build y 500 si el filtergraph se armó
+// mal, que es un error del servicio
+func (e *filterGraphError) status() int {
+	if len(e.Missing) > 0 {
+		return http.StatusNotImplemented
+	}
+	return http.StatusInternalServerError
+}
+
+// splitFilterGraph devuelve los filtros de un filtergraph en orden. Respeta
+// las comillas simples y los caracteres escapados con \ y quita las
+// etiquetas [in]/[out]. Falla con comillas o corchetes sin cerrar.
+func splitFilterGraph(graph string) ([]string, error) {
+	var filters []string
+	var current strings.Builder
+	quoted, label := false, false
+	for i := 0; i < len(graph); i++ {
+		ch := graph[i]
+		switch {
+		case ch == '\\' && i+1 < len(graph):
+			current.WriteByte(ch)
+			current.WriteByte(graph[i+1])
+			i++
+		case ch == '\'':
+			quoted = !quoted
+			current.WriteByte(ch)
+		case quoted:
+			current.WriteByte(ch)
+		case ch == '[' && !label:
+			label = true
+		case ch == ']' && label:
+			label = false
+		case label:
+		case ch == ',' || ch == ';':
+			filters = append(filters, strings.TrimSpace(current.String()))
+			current.Reset()
+		default:
+			current.WriteByte(ch)
+		}
+	}
+	if quoted {
+		return nil, errors.New("comilla sin cerrar")
+	}
+	if label {
+		return nil, errors.New("etiqueta sin cerrar")
+	}
+	return append(filters, strings.TrimSpace(current.String())), nil
+}
+
+// filterName es el nombre de un filtro sin sus opciones ni la instancia
+// (volume@gain=2 es volume)
+func filterName(filter string) string {
+	if i := strings.IndexAny(filter, "=@"); i >= 0 {
+		return filter[:i]
+	}
+	return filter
+}
+
+// checkFilterGraph revisa que el filtergraph esté bien armado (sin filtros
+// vacíos por una coma de más al combinar opciones) y que todos sus filtros
+// existan en el ffmpeg instalado
+func checkFilterGraph(graph string, extra ...string) error {
+	if graph == "" && len(extra) == 0 {
+		return nil
+	}
+	var names []string
+	if graph != "" {
+		filters, err := splitFilterGraph(graph)
+		if err != nil {
+			return &filterGraphError{Graph: graph, Reason: err.Error()}
+		}
+		for _, filter := range filters {
+			if filter == "" {
+				return &filterGraphError{Graph: graph, Reason: "filtro vacío"}
+			}
+			names = append(names, filterName(filter))
+		}
+	}
+
+	available := availableFilters()
+	if available == nil {
+		return nil
+	}
+	seen := map[string]bool{}
+	var missing []string
+	for _, name := range append(names, extra...) {
+		if !available[name] && !seen[name] {
+			seen[name] = true
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return &filterGraphError{Graph: graph, Missing: missing}
+	}
+	return nil
+}
+
+// checkAudioFilters revisa la cadena de /process-audio antes de convertir.
+// Los filtros que dependen de una medición (loudnorm, el limitador y la
+// corrección de mono_downmix_safe) todavía no están en la cadena, así que
+// se revisan por nombre.
+func checkAudioFilters(opts audioOptions) error {
+	var deferred []string
+	if opts.Normalize && opts.loudnorm == nil {
+		deferred = append(deferred, "loudnorm", "aresample")
+	}
+	if opts.Limiter != nil && opts.truePeak == nil {
+		deferred = append(deferred, "alimiter", "aresample")
+	}
+	if opts.MonoDownmixSafe && opts.stereo == nil {
+		deferred = append(deferred, "pan")
+	}
+	return checkFilterGraph(audioFilterChain(opts), deferred...)
+}
+
+// checkFilterArgs revisa los filtergraphs de una línea de ffmpeg
+func checkFilterArgs(args []string) error {
+	for i := 0; i+1 < len(args); i++ {
+		if filterGraphOptions[args[i]] {
+			if err := checkFilterGraph(args[i+1]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// traceFilterGraphs agrega a debug.filtergraphs cada filtergraph que recibe
+// ffmpeg, tal como se ejecuta, incluidos los de las pasadas de medición
+func traceFilterGraphs(ctx context.Context, args []string) {
+	if requestInfoFrom(ctx).Debug == nil {
+		return
+	}
+	for i := 0; i+1 < len(args); i++ {
+		if filterGraphOptions[args[i]] {
+			appendDebug(ctx, "filtergraphs", map[string]interface{}{
+				"option": args[i],
+				"graph":  args[i+1],
+			})
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ditherMethods son los valores de dither_method que acepta aresample. Los
+// métodos con noise shaping (lipshitz, shibata, ...) solo están definidos
+// para 44.1 y 48 kHz; en otras frecuencias ffmpeg usa triangular.
+var ditherMethods = map[string]bool{
+	"rectangular":         true,
+	"triangular":          true,
+	"triangular_hp":       true,
+	"lipshitz":            true,
+	"shibata":             true,
+	"low_shibata":         true,
+	"high_shibata":        true,
+	"f_weighted":          true,
+	"e_weighted":          true,
+	"modified_e_weighted": true,
+}
+
+// validateDither verifica el parámetro dither; "" y "none" lo desactivan
+func validateDither(method string) error {
+	if method == "" || method == "none" || ditherMethods[method] {
+		return nil
+	}
+	return invalidParam("dither", "dither inválido %q", method)
+}
+
+// silenceRemoval son los parámetros de remove_silence: se eliminan los
+// tramos por debajo de ThresholdDB que duren al menos MinDuration segundos
+type silenceRemoval struct {
+	ThresholdDB float64
+	MinDuration float64
+}
+
+// parseSilenceRemoval valida silence_threshold (dB, -50 por defecto) y
+// silence_min_duration (segundos, 1 por defecto)
+func parseSilenceRemoval(threshold, minDuration string) (*silenceRemoval, error) {
+	removal := &silenceRemoval{ThresholdDB: -50, MinDuration: 1}
+
+	if threshold != "" {
+		value, err := strconv.ParseFloat(strings.TrimSuffix(threshold, "dB"), 64)
+		if err != nil || value < -90 || value > -10 {
+			return nil, invalidParam("silence_threshold", "silence_threshold inválido %q (entre -90 y -10 dB)", threshold)
+		}
+		removal.ThresholdDB = value
+	}
+	if minDuration != "" {
+		value, err := strconv.ParseFloat(minDuration, 64)
+		if err != nil || value < 0.1 || value > 60 {
+			return nil, invalidParam("silence_min_duration", "silence_min_duration inválido %q (entre 0.1 y 60 segundos)", minDuration)
+		}
+		removal.MinDuration = value
+	}
+	return removal, nil
+}
+
+// filter arma silenceremove: quita el silencio inicial y, con
+// stop_periods=-1, cada pausa intermedia más larga que MinDuration
+func (removal *silenceRemoval) filter() string {
+	threshold := strconv.FormatFloat(removal.ThresholdDB, 'f', -1, 64) + "dB"
+	duration := strconv.FormatFloat(removal.MinDuration, 'f', -1, 64)
+	return fmt.Sprintf("silenceremove=start_periods=1:start_threshold=%s:stop_periods=-1:stop_duration=%s:stop_threshold=%s",
+		threshold, duration, threshold)
+}
+
+// denoiseStrengths son los niveles de denoise_strength: la reducción en dB
+// de afftdn y la fuerza de anlmdn
+var denoiseStrengths = map[string]struct {
+	fftReduction float64
+	nlmStrength  float64
+}{
+	"light":  {fftReduction: 6, nlmStrength: 0.0001},
+	"medium": {fftReduction: 12, nlmStrength: 0.001},
+	"strong": {fftReduction: 20, nlmStrength: 0.01},
+}
+
+// denoiseFilter es la reducción de ruido de denoise: fft (afftdn, rápido,
+// para ruido estable como el de un ventilador) o nlm (anlmdn, más lento, para
+// ruido de banda ancha variable)
+type denoiseFilter struct {
+	Method   string
+	Strength string
+}
+
+// parseDenoise valida denoise (true o fft, nlm) y denoise_strength (light,
+// medium por defecto o strong); "" y "false" no aplican reducción
+func parseDenoise(method, strength string) (*denoiseFilter, error) {
+	switch method {
+	case "", "false":
+		return nil, nil
+	case "true":
+		method = "fft"
+	case "fft", "nlm":
+	default:
+		return nil, invalidParam("denoise", "denoise inválido %q (true, fft o nlm)", method)
+	}
+	if strength == "" {
+		strength = "medium"
+	}
+	if _, ok := denoiseStrengths[strength]; !ok {
+		return nil, invalidParam("denoise_strength", "denoise_strength inválido %q (light, medium o strong)", strength)
+	}
+	return &denoiseFilter{Method: method, Strength: strength}, nil
+}
+
+// filter arma afftdn con seguimiento del piso de ruido, o anlmdn
+func (denoise *denoiseFilter) filter() string {
+	level := denoiseStrengths[denoise.Strength]
+	if denoise.Method == "nlm" {
+		return "anlmdn=s=" + strconv.FormatFloat(level.nlmStrength, 'f', -1, 64)
+	}
+	return "afftdn=nr=" + strconv.FormatFloat(level.fftReduction, 'f', -1, 64) + ":tn=1"
+}
+
+// dynamicsCompressor son los parámetros de compress_dynamics para acompressor:
+// umbral en dB, relación, y ataque y liberación en milisegundos
+type dynamicsCompressor struct {
+	ThresholdDB float64
+	Ratio       float64
+	AttackMS    float64
+	ReleaseMS   float64
+}
+
+// parseCompressor valida compress_dynamics (true o false) y sus parámetros
+// compress_threshold (dB, -18 por defecto), compress_ratio (3), compress_attack
+// (ms, 20) y compress_release (ms, 250). Los valores por defecto nivelan voz
+// como en radio sin aplastar la dinámica.
+func parseCompressor(enabled, threshold, ratio, attack, release string) (*dynamicsCompressor, error) {
+	switch enabled {
+	case "", "false":
+		return nil, nil
+	case "true":
+	default:
+		return nil, invalidParam("compress_dynamics", "compress_dynamics inválido %q (true o false)", enabled)
+	}
+	compressor := &dynamicsCompressor{ThresholdDB: -18, Ratio: 3, AttackMS: 20, ReleaseMS: 250}
+
+	parameters := []struct {
+		name     string
+		value    string
+		min, max float64
+		target   *float64
+	}{
+		{"compress_threshold", strings.TrimSuffix(threshold, "dB"), -60, 0, &compressor.ThresholdDB},
+		{"compress_ratio", ratio, 1, 20, &compressor.Ratio},
+		{"compress_attack", attack, 0.01, 2000, &compressor.AttackMS},
+		{"compress_release", release, 0.01, 9000, &compressor.ReleaseMS},
+	}
+	for _, parameter := range parameters {
+		if parameter.value == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(parameter.value, 64)
+		if err != nil || value < parameter.min || value > parameter.max {
+			return nil, invalidParam(parameter.name, "%s inválido %q (entre %s y %s)", parameter.name, parameter.value,
+				strconv.FormatFloat(parameter.min, 'f', -1, 64), strconv.FormatFloat(parameter.max, 'f', -1, 64))
+		}
+		*parameter.target = value
+	}
+	return compressor, nil
+}
+
+// filter arma acompressor; el umbral se pasa como amplitud lineal, que es lo
+// que aceptan todas las versiones de ffmpeg
+func (compressor *dynamicsCompressor) filter() string {
+	threshold := math.Pow(10, compressor.ThresholdDB/20)
+	return fmt.Sprintf("acompressor=threshold=%s:ratio=%s:attack=%s:release=%s",
+		strconv.FormatFloat(threshold, 'f', 6, 64),
+		strconv.FormatFloat(compressor.Ratio, 'f', -1, 64),
+		strconv.FormatFloat(compressor.AttackMS, 'f', -1, 64),
+		strconv.FormatFloat(compressor.ReleaseMS, 'f', -1, 64))
+}
+
+// parseGain valida gain_db (entre -30 y 30 dB, con o sin el sufijo dB); 0 o
+// "" no cambian el volumen
+func parseGain(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	gain, err := strconv.ParseFloat(strings.TrimSuffix(value, "dB"), 64)
+	if err != nil || gain < -30 || gain > 30 {
+		return 0, invalidParam("gain_db", "gain_db inválido %q (entre -30 y 30 dB)", value)
+	}
+	return gain, nil
+}
+
+// parseSpeed valida speed (factor de reproducción, entre 0.5 y 2.0); 1 o ""
+// dejan la velocidad original
+func parseSpeed(value string) (float64, error) {
+	if value == "" {
+		return 1, nil
+	}
+	speed, err := strconv.ParseFloat(value, 64)
+	if err != nil || speed < 0.5 || speed > 2.0 {
+		return 0, invalidParam("speed", "speed inválido %q (entre 0.5 y 2.0)", value)
+	}
+	return speed, nil
+}
+
+// atempoFilter encadena atempo para cambiar la velocidad sin alterar el tono.
+// Cada etapa queda dentro del rango 0.5-2.0 que acepta atempo en todas las
+// versiones de ffmpeg.
+func atempoFilter(speed float64) string {
+	var stages []string
+	for speed > 2.0 {
+		stages = append(stages, "atempo=2.0")
+		speed /= 2.0
+	}
+	for speed < 0.5 {
+		stages = append(stages, "atempo=0.5")
+		speed /= 0.5
+	}
+	stages = append(stages, "atempo="+strconv.FormatFloat(speed, 'f', -1, 64))
+	return strings.Join(stages, ",")
+}
+
+// outputSampleFormat devuelve el formato de muestra entero de la salida, o ""
+// si el encoder trabaja en coma flotante y no hay truncado que tratar
+func outputSampleFormat(format string) string {
+	switch format {
+	case "wav", "amr", "amr-wb", "ulaw", "alaw":
+		return "s16"
+	}
+	return ""
+}
+
+// audioFilterChain arma el filtro -af de la salida según las opciones, o ""
+// si no hace falta ninguno
+func audioFilterChain(opts audioOptions) string {
+	var filters []string
+
+	// La corrección de mono_downmix_safe va primero: el resto de la cadena
+	// ya trabaja sobre la señal compatible
+	if opts.MonoDownmixSafe && opts.stereo != nil {
+		if filter := monoDownmixFilter(opts.stereo.Downmix); filter != "" {
+			filters = append(filters, filter)
+		}
+	}
+
+	// La selección de canales va antes del resto de la cadena
+	if opts.ChannelLayout != nil && opts.ChannelLayout.Filter != "" {
+		filters = append(filters, opts.ChannelLayout.Filter)
+	}
+
+	// La reducción de ruido va antes de silenceremove para que el umbral de
+	// silencio se compare con el ruido ya atenuado
+	if opts.Denoise != nil {
+		filters = append(filters, opts.Denoise.filter())
+	}
+
+	if opts.SilenceRemoval != nil {
+		filters = append(filters, opts.SilenceRemoval.filter())
+	}
+
+	// La compresión va después de quitar silencios y antes de loudnorm, que
+	// fija el nivel final sobre la señal ya nivelada
+	if opts.Compressor != nil {
+		filters = append(filters, opts.Compressor.filter())
+	}
+
+	// La ganancia fija va después de la compresión y antes del limitador, que
+	// contiene los picos que pueda generar
+	if opts.GainDB != 0 {
+		filters = append(filters, "volume="+strconv.FormatFloat(opts.GainDB, 'f', -1, 64)+"dB")
+	}
+
+	// atempo va después de silenceremove para que silence_min_duration se
+	// mida en el tiempo original
+	if opts.PitchSemitones != 0 {
+		filters = append(filters, pitchFilter(opts.PitchSemitones, opts.pitchSampleRate))
+	}
+	if opts.Speed != 0 && opts.Speed != 1 {
+		filters = append(filters, atempoFilter(opts.Speed))
+	}
+	if opts.TargetDuration > 0 {
+		filters = append(filters, exactDurationFilter(opts.TargetDuration))
+	}
+
+	if opts.Normalize && opts.loudnorm != nil {
+		filters = append(filters, loudnormFilter(opts.NormalizeTarget, opts.loudnorm))
+	}
+
+	// El limitador va al final para que ninguna ganancia anterior lo supere
+	if opts.Limiter != nil && opts.truePeak != nil {
+		filters = append(filters, opts.Limiter.filter(opts.truePeak.sampleRate))
+	}
+
+	// El relleno va al final: el silencio no cambia el nivel ni los picos
+	if opts.Padding != nil {
+		filters = append(filters, opts.Padding.audioFilter())
+	}
+
+	// El dither se aplica en la reducción a 16 bits; en salidas de coma
+	// flotante (opus, mp3, aac) o wav de 24 bits y f32 no tiene efecto y se
+	// omite
+	if opts.Dither != "" && opts.Dither != "none" && (opts.Params.SampleFormat == "" || opts.Params.SampleFormat == "s16") {
+		if sampleFormat := outputSampleFormat(opts.Format); sampleFormat != "" {
+			filters = append(filters, fmt.Sprintf("aresample=osf=%s:dither_method=%s", sampleFormat, opts.Dither))
+		}
+	}
+
+	return strings.Join(filters, ",")
+}
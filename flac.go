@@ -0,0 +1,20 @@
+package main
+
+import (
+	"strconv"
+)
+
+// defaultFLACCompression es el nivel por defecto de ffmpeg: buen equilibrio
+// entre tamaño y tiempo de codificación
+const defaultFLACCompression = 5
+
+// flacEncoderArgs arma las opciones de flac_compression (0 a 12; los niveles
+// altos reducen el archivo a costa de tiempo de CPU, la decodificación no
+// cambia)
+func flacEncoderArgs(level string) ([]string, error) {
+	compression, err := strconv.Atoi(level)
+	if err != nil || compression < 0 || compression > 12 {
+		return nil, invalidParam("flac_compression", "flac_compression inválido %q (0 a 12)", level)
+	}
+	return []string{"-compression_level", strconv.Itoa(compression)}, nil
+}
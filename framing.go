@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// focalPoint es el centro de interés del cuadro, normalizado a 0-1
+type focalPoint struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+var centerFocus = focalPoint{X: 0.5, Y: 0.5}
+
+// socialAspects son los valores aceptados en aspect
+var socialAspects = map[string]bool{
+	"1:1":  true,
+	"9:16": true,
+	"4:5":  true,
+	"16:9": true,
+}
+
+// Estrategias de recorte para aspect
+const (
+	cropCenter = "center"
+	cropFocal  = "focal"
+	cropSmart  = "smart"
+)
+
+var (
+	// framingBackendURL recibe un JPEG del video y devuelve {"x":..,"y":..}
+	// con el punto de interés (rostros, saliencia)
+	framingBackendURL   string
+	framingBackendToken string
+	framingClient       *http.Client
+)
+
+func loadFramingConfig() {
+	framingBackendURL = os.Getenv("FRAMING_BACKEND_URL")
+	framingBackendToken = os.Getenv("FRAMING_BACKEND_TOKEN")
+	framingClient = &http.Client{Timeout: envDuration("FRAMING_BACKEND_TIMEOUT", 10*time.Second)}
+}
+
+// validateFraming revisa aspect, crop y el punto focal de la petición
+func validateFraming(aspect, crop, focalX, focalY string) (focalPoint, error) {
+	if aspect != "" && !socialAspects[aspect] {
+		return centerFocus, invalidParam("aspect", "aspect inválido %q (1:1, 9:16, 4:5 o 16:9)", aspect)
+	}
+
+	switch crop {
+	case "", cropCenter:
+		return centerFocus, nil
+	case cropFocal:
+		x, errX := strconv.ParseFloat(focalX, 64)
+		y, errY := strconv.ParseFloat(focalY, 64)
+		if errX != nil || errY != nil || x < 0 || x > 1 || y < 0 || y > 1 {
+			return centerFocus, missingParam("crop", "crop=focal requiere focal_x y focal_y entre 0 y 1")
+		}
+		return focalPoint{X: x, Y: y}, nil
+	case cropSmart:
+		if framingBackendURL == "" {
+			return centerFocus, notConfigured("crop=smart requiere FRAMING_BACKEND_URL")
+		}
+		return centerFocus, nil
+	}
+	return centerFocus, invalidParam("crop", "crop inválido %q (center, focal o smart)", crop)
+}
+
+// detectFocalPoint envía un frame al backend de encuadre y devuelve el punto
+// de interés que reporta
+func detectFocalPoint(ctx context.Context, inputData []byte) (focalPoint, error) {
+	frame, err := extractVideoFrame(ctx, inputData)
+	if err != nil {
+		return centerFocus, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, framingBackendURL, bytes.NewReader(frame))
+	if err != nil {
+		return centerFocus, err
+	}
+	req.Header.Set("Content-Type", "image/jpeg")
+	if framingBackendToken != "" {
+		req.Header.Set("Authorization", "Bearer "+framingBackendToken)
+	}
+
+	resp, err := framingClient.Do(req)
+	if err != nil {
+		return centerFocus, fmt.Errorf("error al consultar el backend de encuadre: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode != http.StatusOK {
+		return centerFocus, fmt.Errorf("backend de encuadre: HTTP %d", resp.StatusCode)
+	}
+
+	var focus focalPoint
+	if err := json.Unmarshal(body, &focus); err != nil {
+		return centerFocus, fmt.Errorf("respuesta del backend de encuadre inválida: %v", err)
+	}
+	if focus.X < 0 || focus.X > 1 || focus.Y < 0 || focus.Y > 1 {
+		return centerFocus, fmt.Errorf("el backend de encuadre devolvió un punto fuera del cuadro")
+	}
+	return focus, nil
+}
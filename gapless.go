@@ -0,0 +1,433 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// gaplessMovieTimescale es divisible por todas las frecuencias de muestreo
+// habituales (8k-96k), así la lista de ediciones del M4A expresa la duración
+// exacta en muestras en lugar de redondearla a milisegundos
+const gaplessMovieTimescale = "705600000"
+
+// needsSeekableOutput indica los formatos cuyo muxer escribe la información
+// de retardo/relleno del encoder al final, reescribiendo la cabecera: la
+// cabecera Xing/LAME en MP3 y la lista de ediciones y el índice en M4A. Con pipe:1 esa
+// información se pierde y los segmentos concatenados tienen huecos. FLAC
+// completa igual el bloque STREAMINFO (muestras totales y MD5) al terminar,
+// y los WAV G.711 el tamaño de datos que leen las centrales telefónicas.
+func needsSeekableOutput(format string) bool {
+	if _, ok := telephonyFormats[format]; ok {
+		return true
+	}
+	return format == "mp3" || isMP4AudioFormat(format) || format == "flac"
+}
+
+// isMP4AudioFormat indica las salidas en contenedor M4A (AAC o ALAC)
+func isMP4AudioFormat(format string) bool {
+	return format == "m4a" || format == "alac"
+}
+
+// convertAudioToSeekableOutput convierte escribiendo la salida en un archivo
+// temporal en lugar de pipe:1
+func convertAudioToSeekableOutput(ctx context.Context, inputData []byte, outputArgs []string, format string) ([]byte, int, error) {
+	fmt.Printf("[convertAudio] Usando archivo temporal de salida para metadatos gapless (%s)\n", format)
+
+	inputSource := "pipe:0"
+	if isMP4orM4A(inputData) {
+		inputPath, cleanup, err := writeTempInput(inputData, "audio-input-*.m4a")
+		if err != nil {
+			return nil, 0, err
+		}
+		defer cleanup()
+		inputSource = inputPath
+	}
+
+	outputPath, cleanup, err := createTempOutput("audio-output-*." + format)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cleanup()
+
+	args := append([]string{"-i", inputSource}, outputArgs...)
+	args = append(args, "-y", outputPath)
+	cmd := ffmpegCommand(ctx, classInteractive, args...)
+	if inputSource == "pipe:0" {
+		cmd.Stdin = bytes.NewReader(inputData)
+	}
+
+	var errBuffer bytes.Buffer
+	cmd.Stderr = &errBuffer
+
+	fmt.Printf("[convertAudio] Ejecutando: ffmpeg %v\n", args)
+	if err := cmd.Run(); err != nil {
+		fmt.Printf("[convertAudio] Stderr: %s\n", errBuffer.String())
+		return nil, 0, fmt.Errorf("error during conversion: %v, details: %s", err, errBuffer.String())
+	}
+
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error reading output file: %v", err)
+	}
+	if len(data) == 0 {
+		return nil, 0, errors.New("conversion produced empty output")
+	}
+
+	duration, err := extractDuration(errBuffer.String())
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if format == "m4a" {
+		data = addGaplessInfo(data)
+	}
+
+	fmt.Printf("[convertAudio] Conversión exitosa: %d bytes, duración %d segundos\n", len(data), duration)
+	return data, duration, nil
+}
+
+// addGaplessInfo agrega el átomo iTunSMPB que usan los reproductores de Apple
+// y muchos de podcasts, calculado a partir de la lista de ediciones que
+// escribe ffmpeg. Si el archivo no tiene la forma esperada se devuelve sin
+// cambios: la lista de ediciones sigue describiendo el retardo.
+func addGaplessInfo(data []byte) []byte {
+	result, err := insertITunSMPB(data)
+	if err != nil {
+		fmt.Printf("[gapless] No se agregó iTunSMPB: %v\n", err)
+		return data
+	}
+	return result
+}
+
+// mp4Box es un átomo MP4 dentro de data: [start, end) incluye la cabecera
+type mp4Box struct {
+	typ       string
+	start     int
+	headerLen int
+	end       int
+}
+
+func (b mp4Box) body() int { return b.start + b.headerLen }
+
+// readMP4Boxes lista los átomos contenidos entre start y end
+func readMP4Boxes(data []byte, start, end int) ([]mp4Box, error) {
+	var boxes []mp4Box
+	for offset := start; offset < end; {
+		if end-offset < 8 {
+			return nil, errors.New("átomo truncado")
+		}
+		size := int(binary.BigEndian.Uint32(data[offset:]))
+		headerLen := 8
+		switch size {
+		case 0:
+			size = end - offset
+		case 1:
+			if end-offset < 16 {
+				return nil, errors.New("átomo truncado")
+			}
+			size = int(binary.BigEndian.Uint64(data[offset+8:]))
+			headerLen = 16
+		}
+		if size < headerLen || offset+size > end {
+			return nil, fmt.Errorf("tamaño de átomo inválido en %d", offset)
+		}
+		boxes = append(boxes, mp4Box{
+			typ:       string(data[offset+4 : offset+8]),
+			start:     offset,
+			headerLen: headerLen,
+			end:       offset + size,
+		})
+		offset += size
+	}
+	return boxes, nil
+}
+
+func findMP4Box(boxes []mp4Box, typ string) (mp4Box, bool) {
+	for _, box := range boxes {
+		if box.typ == typ {
+			return box, true
+		}
+	}
+	return mp4Box{}, false
+}
+
+// findMP4Path recorre una ruta de átomos contenedores (p. ej. mdia/hdlr)
+func findMP4Path(data []byte, parent mp4Box, path ...string) (mp4Box, bool) {
+	current := parent
+	for _, typ := range path {
+		children, err := readMP4Boxes(data, current.body(), current.end)
+		if err != nil {
+			return mp4Box{}, false
+		}
+		next, ok := findMP4Box(children, typ)
+		if !ok {
+			return mp4Box{}, false
+		}
+		current = next
+	}
+	return current, true
+}
+
+// readTimescaleAndDuration lee timescale y duración de un mvhd o mdhd
+func readTimescaleAndDuration(data []byte, box mp4Box) (uint64, uint64, error) {
+	body := data[box.body():box.end]
+	if len(body) < 4 {
+		return 0, 0, fmt.Errorf("%s truncado", box.typ)
+	}
+	if body[0] == 1 {
+		if len(body) < 32 {
+			return 0, 0, fmt.Errorf("%s truncado", box.typ)
+		}
+		return uint64(binary.BigEndian.Uint32(body[20:])), binary.BigEndian.Uint64(body[24:]), nil
+	}
+	if len(body) < 20 {
+		return 0, 0, fmt.Errorf("%s truncado", box.typ)
+	}
+	return uint64(binary.BigEndian.Uint32(body[12:])), uint64(binary.BigEndian.Uint32(body[16:])), nil
+}
+
+// readFirstEdit devuelve segment_duration y media_time de la primera edición
+// con media_time válido (ffmpeg puede anteponer una edición vacía)
+func readFirstEdit(data []byte, box mp4Box) (uint64, int64, error) {
+	body := data[box.body():box.end]
+	if len(body) < 8 {
+		return 0, 0, errors.New("elst truncado")
+	}
+	version := body[0]
+	count := int(binary.BigEndian.Uint32(body[4:]))
+	entrySize := 12
+	if version == 1 {
+		entrySize = 20
+	}
+
+	for i := 0; i < count; i++ {
+		entry := body[8+i*entrySize:]
+		if len(entry) < entrySize {
+			return 0, 0, errors.New("elst truncado")
+		}
+		var segmentDuration uint64
+		var mediaTime int64
+		if version == 1 {
+			segmentDuration = binary.BigEndian.Uint64(entry)
+			mediaTime = int64(binary.BigEndian.Uint64(entry[8:]))
+		} else {
+			segmentDuration = uint64(binary.BigEndian.Uint32(entry))
+			mediaTime = int64(int32(binary.BigEndian.Uint32(entry[4:])))
+		}
+		if mediaTime >= 0 {
+			return segmentDuration, mediaTime, nil
+		}
+	}
+	return 0, 0, errors.New("elst sin ediciones de medios")
+}
+
+// insertITunSMPB calcula retardo, relleno y muestras válidas de la pista de
+// audio y los escribe en moov/udta/meta/ilst/----:com.apple.iTunes:iTunSMPB
+func insertITunSMPB(data []byte) ([]byte, error) {
+	moov, children, err := trailingMoov(data)
+	if err != nil {
+		return nil, err
+	}
+
+	mvhd, ok := findMP4Path(data, moov, "mvhd")
+	if !ok {
+		return nil, errors.New("sin mvhd")
+	}
+	movieTimescale, _, err := readTimescaleAndDuration(data, mvhd)
+	if err != nil {
+		return nil, err
+	}
+
+	var delay, valid, total uint64
+	found := false
+	for _, trak := range children {
+		if trak.typ != "trak" {
+			continue
+		}
+		hdlr, ok := findMP4Path(data, trak, "mdia", "hdlr")
+		if !ok || hdlr.end-hdlr.body() < 12 || string(data[hdlr.body()+8:hdlr.body()+12]) != "soun" {
+			continue
+		}
+		mdhd, ok := findMP4Path(data, trak, "mdia", "mdhd")
+		if !ok {
+			return nil, errors.New("pista de audio sin mdhd")
+		}
+		elst, ok := findMP4Path(data, trak, "edts", "elst")
+		if !ok {
+			return nil, errors.New("pista de audio sin lista de ediciones")
+		}
+
+		mediaTimescale, mediaDuration, err := readTimescaleAndDuration(data, mdhd)
+		if err != nil {
+			return nil, err
+		}
+		segmentDuration, mediaTime, err := readFirstEdit(data, elst)
+		if err != nil {
+			return nil, err
+		}
+		if movieTimescale == 0 {
+			return nil, errors.New("timescale de película inválido")
+		}
+
+		delay = uint64(mediaTime)
+		valid = (segmentDuration*mediaTimescale + movieTimescale/2) / movieTimescale
+		total = mediaDuration
+		found = true
+		break
+	}
+	if !found {
+		return nil, errors.New("sin pista de audio")
+	}
+	if delay+valid > total {
+		return nil, fmt.Errorf("lista de ediciones inconsistente (retardo %d, válidas %d, total %d)", delay, valid, total)
+	}
+	padding := total - delay - valid
+
+	fields := []string{
+		"00000000",
+		fmt.Sprintf("%08X", delay),
+		fmt.Sprintf("%08X", padding),
+		fmt.Sprintf("%016X", valid),
+	}
+	for i := 0; i < 8; i++ {
+		fields = append(fields, "00000000")
+	}
+	value := " " + strings.Join(fields, " ")
+
+	result, err := appendITunesAtoms(data, freeformAtom("com.apple.iTunes", "iTunSMPB", value))
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("[gapless] iTunSMPB agregado: retardo %d, relleno %d, muestras %d\n", delay, padding, valid)
+	return result, nil
+}
+
+// trailingMoov devuelve el moov y sus hijos. Insertar dentro de moov solo es
+// seguro si va después de mdat: así no cambian los offsets de los chunks
+// (stco/co64). ffmpeg lo escribe al final salvo con +faststart.
+func trailingMoov(data []byte) (mp4Box, []mp4Box, error) {
+	top, err := readMP4Boxes(data, 0, len(data))
+	if err != nil {
+		return mp4Box{}, nil, err
+	}
+	moov, ok := findMP4Box(top, "moov")
+	if !ok {
+		return mp4Box{}, nil, errors.New("sin átomo moov")
+	}
+	if moov.end != len(data) {
+		return mp4Box{}, nil, errors.New("moov no está al final del archivo")
+	}
+	if moov.headerLen != 8 {
+		return mp4Box{}, nil, errors.New("moov con tamaño de 64 bits")
+	}
+
+	children, err := readMP4Boxes(data, moov.body(), moov.end)
+	if err != nil {
+		return mp4Box{}, nil, err
+	}
+	return moov, children, nil
+}
+
+// appendITunesAtoms agrega átomos a moov/udta/meta/ilst, creando los
+// contenedores que falten
+func appendITunesAtoms(data []byte, atoms ...[]byte) ([]byte, error) {
+	moov, children, err := trailingMoov(data)
+	if err != nil {
+		return nil, err
+	}
+
+	atom := bytes.Join(atoms, nil)
+
+	// Crear los contenedores que falten (udta, meta, ilst) alrededor del átomo
+	ancestors := []mp4Box{moov}
+	insertAt := moov.end
+	payload := atom
+
+	udta, hasUdta := findMP4Box(children, "udta")
+	switch {
+	case !hasUdta:
+		payload = mp4Container("udta", metaBox(mp4Container("ilst", atom)))
+	default:
+		ancestors = append(ancestors, udta)
+		insertAt = udta.end
+		meta, hasMeta := findMP4Path(data, udta, "meta")
+		if !hasMeta {
+			payload = metaBox(mp4Container("ilst", atom))
+			break
+		}
+		// meta es un full box: sus hijos empiezan tras version/flags
+		metaChildren, err := readMP4Boxes(data, meta.body()+4, meta.end)
+		if err != nil {
+			return nil, err
+		}
+		ancestors = append(ancestors, meta)
+		insertAt = meta.end
+		ilst, hasIlst := findMP4Box(metaChildren, "ilst")
+		if !hasIlst {
+			payload = mp4Container("ilst", atom)
+			break
+		}
+		ancestors = append(ancestors, ilst)
+		insertAt = ilst.end
+	}
+
+	for _, box := range ancestors[1:] {
+		if box.headerLen != 8 {
+			return nil, fmt.Errorf("%s con tamaño de 64 bits", box.typ)
+		}
+	}
+
+	result := make([]byte, 0, len(data)+len(payload))
+	result = append(result, data[:insertAt]...)
+	result = append(result, payload...)
+	result = append(result, data[insertAt:]...)
+
+	for _, box := range ancestors {
+		size := binary.BigEndian.Uint32(result[box.start:])
+		binary.BigEndian.PutUint32(result[box.start:], size+uint32(len(payload)))
+	}
+
+	return result, nil
+}
+
+func mp4Container(typ string, children ...[]byte) []byte {
+	size := 8
+	for _, child := range children {
+		size += len(child)
+	}
+	box := make([]byte, 8, size)
+	binary.BigEndian.PutUint32(box, uint32(size))
+	copy(box[4:], typ)
+	for _, child := range children {
+		box = append(box, child...)
+	}
+	return box
+}
+
+// metaBox arma un meta (full box) con el hdlr "mdir" que exige iTunes
+func metaBox(ilst []byte) []byte {
+	hdlr := make([]byte, 0, 25)
+	hdlr = append(hdlr, 0, 0, 0, 0) // version/flags
+	hdlr = append(hdlr, 0, 0, 0, 0) // pre_defined
+	hdlr = append(hdlr, "mdir"...)
+	hdlr = append(hdlr, "appl"...)
+	hdlr = append(hdlr, make([]byte, 8)...)
+	hdlr = append(hdlr, 0) // nombre vacío
+
+	return mp4Container("meta", []byte{0, 0, 0, 0}, mp4Container("hdlr", hdlr), ilst)
+}
+
+// freeformAtom arma un átomo "----" con mean, name y data UTF-8
+func freeformAtom(mean, name, value string) []byte {
+	fullBox := func(typ string, payload []byte) []byte {
+		return mp4Container(typ, []byte{0, 0, 0, 0}, payload)
+	}
+	data := mp4Container("data", []byte{0, 0, 0, 1, 0, 0, 0, 0}, []byte(value))
+	return mp4Container("----", fullBox("mean", []byte(mean)), fullBox("name", []byte(name)), data)
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// hlsPlaylistName es la lista de reproducción que referencia los segmentos
+// con rutas relativas, así funciona igual dentro del ZIP y en el bucket
+const hlsPlaylistName = "playlist.m3u8"
+
+// hlsContentTypes son los tipos de cada archivo del paquete por extensión
+var hlsContentTypes = map[string]string{
+	".m3u8": "application/vnd.apple.mpegurl",
+	".ts":   "video/mp2t",
+	".m4s":  "video/iso.segment",
+	".mp4":  "audio/mp4",
+}
+
+var hlsExtinfRe = regexp.MustCompile(`#EXTINF:([\d.]+)`)
+
+// hlsOptions son los parámetros de output_format=hls
+type hlsOptions struct {
+	SegmentSeconds float64
+	// SegmentType es mpegts (AAC en .ts) o fmp4 (.m4s con init.mp4)
+	SegmentType string
+}
+
+// hlsFile es un archivo del paquete HLS
+type hlsFile struct {
+	Name string
+	Data []byte
+}
+
+// parseHLSOptions valida hls_segment_seconds (1 a 60, 6 por defecto) y
+// hls_segment_type (mpegts o fmp4)
+func parseHLSOptions(segmentSeconds, segmentType string) (*hlsOptions, error) {
+	opts := &hlsOptions{SegmentSeconds: 6, SegmentType: "mpegts"}
+	if segmentSeconds != "" {
+		seconds, err := strconv.ParseFloat(segmentSeconds, 64)
+		if err != nil || seconds < 1 || seconds > 60 {
+			return nil, invalidParam("hls_segment_seconds", "hls_segment_seconds inválido %q (entre 1 y 60)", segmentSeconds)
+		}
+		opts.SegmentSeconds = seconds
+	}
+	switch segmentType {
+	case "", "mpegts":
+	case "fmp4":
+		opts.SegmentType = segmentType
+	default:
+		return nil, invalidParam("hls_segment_type", "hls_segment_type inválido %q (mpegts o fmp4)", segmentType)
+	}
+	return opts, nil
+}
+
+// segmentExtension es la extensión de los segmentos según el tipo
+func (hls *hlsOptions) segmentExtension() string {
+	if hls.SegmentType == "fmp4" {
+		return ".m4s"
+	}
+	return ".ts"
+}
+
+// convertAudioHLS codifica la entrada en AAC con las opciones habituales y la
+// empaqueta con el muxer hls de ffmpeg como lista VOD. Devuelve la lista, el
+// segmento de inicialización (fmp4) y los segmentos, en ese orden.
+func convertAudioHLS(ctx context.Context, inputData []byte, opts audioOptions, hls *hlsOptions) ([]hlsFile, float64, error) {
+	// El paquete lleva AAC: se arma como la salida aac y se cambia el muxer
+	opts.Format = "aac"
+	cleanupCover, err := opts.prepare(ctx, inputData)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cleanupCover()
+
+	workDir, err := os.MkdirTemp("", "hls-*")
+	if err != nil {
+		return nil, 0, fmt.Errorf("error al crear la carpeta temporal: %v", err)
+	}
+	defer os.RemoveAll(workDir)
+	inputPath := filepath.Join(workDir, "input")
+	if err := os.WriteFile(inputPath, inputData, 0o600); err != nil {
+		return nil, 0, fmt.Errorf("error al escribir la entrada: %v", err)
+	}
+	outputDir := filepath.Join(workDir, "out")
+	if err := os.Mkdir(outputDir, 0o700); err != nil {
+		return nil, 0, fmt.Errorf("error al crear la carpeta temporal: %v", err)
+	}
+
+	outputArgs := setOutputOption(audioOutputArgs(ctx, inputData, opts), "-f", "hls")
+	outputArgs = append(outputArgs,
+		"-hls_time", strconv.FormatFloat(hls.SegmentSeconds, 'f', -1, 64),
+		"-hls_playlist_type", "vod",
+		"-hls_segment_type", hls.SegmentType,
+		"-hls_segment_filename", filepath.Join(outputDir, "segment-%03d"+hls.segmentExtension()),
+	)
+	if hls.SegmentType == "fmp4" {
+		outputArgs = append(outputArgs, "-hls_fmp4_init_filename", "init.mp4")
+	}
+	args := append([]string{"-i", inputPath}, outputArgs...)
+	args = append(args, filepath.Join(outputDir, hlsPlaylistName))
+
+	cmd := ffmpegCommand(ctx, classBatch, args...)
+	var errBuffer bytes.Buffer
+	cmd.Stderr = &errBuffer
+
+	fmt.Printf("[hls] Empaquetando en segmentos %s de %s s\n", hls.SegmentType, strconv.FormatFloat(hls.SegmentSeconds, 'f', -1, 64))
+	if err := cmd.Run(); err != nil {
+		return nil, 0, explainAudioError(fmt.Errorf("error during conversion: %v, details: %s", err, errBuffer.String()))
+	}
+
+	entries, err := os.ReadDir(outputDir)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error al leer los segmentos: %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.Name() != hlsPlaylistName {
+			names = append(names, entry.Name())
+		}
+	}
+	// init.mp4 queda antes que segment-000... por orden alfabético
+	sort.Strings(names)
+
+	files := make([]hlsFile, 0, len(names)+1)
+	for _, name := range append([]string{hlsPlaylistName}, names...) {
+		data, err := os.ReadFile(filepath.Join(outputDir, name))
+		if err != nil {
+			return nil, 0, fmt.Errorf("error al leer %s: %v", name, err)
+		}
+		if data, err = interceptOutput(ctx, strings.TrimPrefix(filepath.Ext(name), "."), data); err != nil {
+			return nil, 0, err
+		}
+		files = append(files, hlsFile{Name: name, Data: data})
+	}
+	if len(files) < 2 {
+		return nil, 0, errors.New("conversion produced empty output")
+	}
+
+	duration := 0.0
+	for _, match := range hlsExtinfRe.FindAllStringSubmatch(string(files[0].Data), -1) {
+		seconds, _ := strconv.ParseFloat(match[1], 64)
+		duration += seconds
+	}
+	return files, duration, nil
+}
+
+// segmentCount cuenta los segmentos de audio (sin la lista ni init.mp4)
+func (hls *hlsOptions) segmentCount(files []hlsFile) int {
+	count := 0
+	for _, file := range files {
+		if filepath.Ext(file.Name) == hls.segmentExtension() {
+			count++
+		}
+	}
+	return count
+}
+
+// forFile devuelve el destino de un archivo del paquete: s3_key es el
+// prefijo (la "carpeta") donde quedan la lista y los segmentos
+func (dest *s3Destination) forFile(name string) *s3Destination {
+	copied := *dest
+	copied.Key = strings.TrimSuffix(copied.Key, "/") + "/" + name
+	return &copied
+}
+
+// runAudioHLS empaqueta la entrada y sube el paquete a S3. La lista se sube
+// al final para que nunca apunte a segmentos que todavía no existen.
+func runAudioHLS(ctx context.Context, inputData []byte, opts audioOptions, hls *hlsOptions, dest *s3Destination) (gin.H, error) {
+	files, duration, err := convertAudioHLS(ctx, inputData, opts, hls)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := newArtifactManifest()
+	uploaded := make([]gin.H, len(files))
+	// Primero los segmentos (índices 1 en adelante) y por último la lista
+	for i := 1; i <= len(files); i++ {
+		index := i % len(files)
+		file := files[index]
+		extension := filepath.Ext(file.Name)
+		result := gin.H{"name": file.Name}
+		if err := storeOutput(ctx, result, file.Data, hlsContentTypes[extension], dest.forFile(file.Name)); err != nil {
+			return nil, err
+		}
+		manifest.add(result, file.Name, strings.TrimPrefix(extension, "."), file.Data)
+		uploaded[index] = result
+	}
+
+	return gin.H{
+		"format":          "hls",
+		"duration":        roundMillis(duration),
+		"segment_type":    hls.SegmentType,
+		"segment_seconds": hls.SegmentSeconds,
+		"segments":        hls.segmentCount(files),
+		"playlist_url":    uploaded[0]["url"],
+		"files":           uploaded,
+		"manifest":        manifest,
+	}, nil
+}
+
+// zipHLS empaqueta la lista y los segmentos sin recomprimir
+func zipHLS(files []hlsFile) ([]byte, error) {
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	for _, file := range files {
+		entry, err := archive.CreateHeader(&zip.FileHeader{Name: file.Name, Method: zip.Store})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := entry.Write(file.Data); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// respondAudioHLS entrega el paquete HLS como ZIP cuando no hay destino S3
+func respondAudioHLS(c *gin.Context, inputData []byte, opts audioOptions, hls *hlsOptions) {
+	files, duration, err := convertAudioHLS(c.Request.Context(), inputData, opts, hls)
+	if err != nil {
+		if mediaMismatchResponse(c, explainMediaMismatch(c.Request.Context(), inputData, err)) {
+			return
+		}
+		respondError(c, mediaErrorStatus(err, http.StatusInternalServerError), err)
+		return
+	}
+
+	archive, err := zipHLS(files)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error al crear el ZIP: " + err.Error()})
+		return
+	}
+	writeBinaryResponse(c, archive, "hls.zip", "application/zip", map[string]string{
+		"X-Format":   "hls",
+		"X-Duration": formatSeconds(duration),
+		"X-Segments": strconv.Itoa(hls.segmentCount(files)),
+	})
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+)
+
+// inputConfig limita los archivos de una petición con varias entradas
+// (maxInputFiles) y los cuadros de /frames-to-video y su tamaño
+// descomprimido (maxSequenceFrames, maxSequenceMB)
+type inputConfig struct {
+	maxInputFiles     int
+	maxSequenceFrames int
+	maxSequenceMB     int
+}
+
+func loadInputConfig(cfg *reloadableConfig) {
+	cfg.maxInputFiles = envInt("MAX_INPUT_FILES", 10)
+	cfg.maxSequenceFrames = envInt("MAX_SEQUENCE_FRAMES", 5000)
+	cfg.maxSequenceMB = envInt("MAX_SEQUENCE_MB", 2048)
+}
+
+// inputFile es una de las entradas de una petición con varios archivos
+type inputFile struct {
+	// Name es el nombre del archivo enviado, o "input-N" para base64/url
+	Name string
+	Data []byte
+}
+
+// multipartFiles devuelve los campos "file" repetidos en el orden en que
+// llegaron en el cuerpo
+func multipartFiles(c *gin.Context) []*multipart.FileHeader {
+	form, err := c.MultipartForm()
+	if err != nil || form == nil {
+		return nil
+	}
+	return form.File["file"]
+}
+
+// getInputFiles lee todas las entradas de la petición: campos "file",
+// "base64" o "url" repetidos, en el orden recibido. Con una sola entrada
+// equivale a getInputData.
+func getInputFiles(c *gin.Context) ([]inputFile, error) {
+	inputs, err := readInputFiles(c)
+	if err != nil {
+		return nil, err
+	}
+	// Los interceptores registrados pueden transformar o rechazar cada entrada,
+	// y las que hicieron caer a ffmpeg varias veces se rechazan sin convertir
+	for i := range inputs {
+		if inputs[i].Data, err = interceptInput(c.Request.Context(), inputs[i].Name, inputs[i].Data); err != nil {
+			return nil, err
+		}
+		info := requestInfoFrom(c.Request.Context())
+		hash := info.addInput(inputs[i].Data)
+		if err := checkTokenInputLimit(c, info); err != nil {
+			return nil, err
+		}
+		if err := checkQuarantine(info.Endpoint, hash); err != nil {
+			return nil, err
+		}
+		if err := checkEncodeMarker(c, info, inputs[i].Data); err != nil {
+			return nil, err
+		}
+	}
+	return inputs, nil
+}
+
+func readInputFiles(c *gin.Context) ([]inputFile, error) {
+	var inputs []inputFile
+	maxInputFiles := config().maxInputFiles
+
+	if headers := multipartFiles(c); len(headers) > 0 {
+		if len(headers) > maxInputFiles {
+			return nil, fmt.Errorf("se recibieron %d archivos; el máximo es %d", len(headers), maxInputFiles)
+		}
+		for _, header := range headers {
+			data, err := readMultipartFile(header)
+			if err != nil {
+				return nil, err
+			}
+			inputs = append(inputs, inputFile{Name: filepath.Base(header.Filename), Data: data})
+		}
+		return inputs, nil
+	}
+
+	if values := c.PostFormArray("base64"); len(values) > 0 {
+		if len(values) > maxInputFiles {
+			return nil, fmt.Errorf("se recibieron %d entradas; el máximo es %d", len(values), maxInputFiles)
+		}
+		for i, value := range values {
+			data, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				return nil, invalidParam("base64", "base64 inválido en la entrada %d: %v", i+1, err)
+			}
+			inputs = append(inputs, inputFile{Name: fmt.Sprintf("input-%d", i+1), Data: data})
+		}
+		return inputs, nil
+	}
+
+	if urls := c.PostFormArray("url"); len(urls) > 0 {
+		if len(urls) > maxInputFiles {
+			return nil, fmt.Errorf("se recibieron %d URLs; el máximo es %d", len(urls), maxInputFiles)
+		}
+		for i, url := range urls {
+			data, err := fetchAudioFromURL(c.Request.Context(), url)
+			if err != nil {
+				return nil, fmt.Errorf("entrada %d: %w", i+1, err)
+			}
+			inputs = append(inputs, inputFile{Name: filepath.Base(url), Data: data})
+		}
+		return inputs, nil
+	}
+
+	return nil, errors.New("nenhum arquivo, base64 ou URL fornecido")
+}
+
+func readMultipartFile(header *multipart.FileHeader) ([]byte, error) {
+	file, err := header.Open()
+	if err != nil {
+		return nil, fmt.Errorf("error al leer %s: %v", header.Filename, err)
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// InterceptedMedia es el medio que recibe cada interceptor. Data puede
+// reemplazarse para transformar el contenido.
+type InterceptedMedia struct {
+	// Stage es "input" o "output"
+	Stage     string
+	Endpoint  string
+	RequestID string
+	// Name es el nombre del archivo recibido (solo en entradas)
+	Name string
+	// Format es el formato producido (solo en salidas)
+	Format string
+	Data   []byte
+}
+
+// InputInterceptor inspecciona, transforma o rechaza una entrada antes de
+// convertirla. Devolver un *MediaRejectedError rechaza la petición.
+type InputInterceptor interface {
+	Name() string
+	InterceptInput(ctx context.Context, media *InterceptedMedia) error
+}
+
+// OutputInterceptor hace lo mismo con el resultado antes de entregarlo
+// (JSON, binario, S3 o email)
+type OutputInterceptor interface {
+	Name() string
+	InterceptOutput(ctx context.Context, media *InterceptedMedia) error
+}
+
+// MediaRejectedError indica que un interceptor rechazó el medio
+type MediaRejectedError struct {
+	Interceptor string
+	Reason      string
+}
+
+func (e *MediaRejectedError) Error() string {
+	return fmt.Sprintf("medio rechazado por %s: %s", e.Interceptor, e.Reason)
+}
+
+var (
+	interceptorsMu     sync.RWMutex
+	inputInterceptors  []InputInterceptor
+	outputInterceptors []OutputInterceptor
+)
+
+// RegisterInputInterceptor agrega un interceptor de entradas. Los plugins lo
+// llaman desde su init(); se ejecutan en orden de registro.
+func RegisterInputInterceptor(interceptor InputInterceptor) {
+	interceptorsMu.Lock()
+	defer interceptorsMu.Unlock()
+	inputInterceptors = append(inputInterceptors, interceptor)
+}
+
+// RegisterOutputInterceptor agrega un interceptor de salidas
+func RegisterOutputInterceptor(interceptor OutputInterceptor) {
+	interceptorsMu.Lock()
+	defer interceptorsMu.Unlock()
+	outputInterceptors = append(outputInterceptors, interceptor)
+}
+
+// interceptInput pasa una entrada por la cadena y devuelve los datos,
+// posiblemente transformados
+func interceptInput(ctx context.Context, name string, data []byte) ([]byte, error) {
+	interceptorsMu.RLock()
+	chain := inputInterceptors
+	interceptorsMu.RUnlock()
+	if len(chain) == 0 {
+		return data, nil
+	}
+
+	media := newInterceptedMedia(ctx, "input", data)
+	media.Name = name
+	for _, interceptor := range chain {
+		if err := interceptor.InterceptInput(ctx, media); err != nil {
+			return nil, interceptorError(interceptor.Name(), err)
+		}
+	}
+	return media.Data, nil
+}
+
+// interceptOutput pasa un resultado por la cadena antes de entregarlo
+func interceptOutput(ctx context.Context, format string, data []byte) ([]byte, error) {
+	interceptorsMu.RLock()
+	chain := outputInterceptors
+	interceptorsMu.RUnlock()
+	if len(chain) == 0 {
+		return data, nil
+	}
+
+	media := newInterceptedMedia(ctx, "output", data)
+	media.Format = format
+	for _, interceptor := range chain {
+		if err := interceptor.InterceptOutput(ctx, media); err != nil {
+			return nil, interceptorError(interceptor.Name(), err)
+		}
+	}
+	return media.Data, nil
+}
+
+func newInterceptedMedia(ctx context.Context, stage string, data []byte) *InterceptedMedia {
+	info := requestInfoFrom(ctx)
+	return &InterceptedMedia{Stage: stage, Endpoint: info.Endpoint, RequestID: info.ID, Data: data}
+}
+
+func interceptorError(name string, err error) error {
+	var rejected *MediaRejectedError
+	if errors.As(err, &rejected) {
+		fmt.Printf("[interceptors] %s rechazó el medio: %s\n", name, rejected.Reason)
+		return err
+	}
+	return fmt.Errorf("error en el interceptor %s: %v", name, err)
+}
+
+// mediaErrorStatus es el código HTTP para un error al leer o entregar un
+// medio: 422 si un interceptor lo rechazó, 423 si la entrada está en
+// cuarentena (ver quarantine.go), 413 si supera el token de conversión,
+// fallback en otro caso
+func mediaErrorStatus(err error, fallback int) int {
+	var rejected *MediaRejectedError
+	if errors.As(err, &rejected) {
+		return http.StatusUnprocessableEntity
+	}
+	var quarantined *quarantinedInputError
+	if errors.As(err, &quarantined) {
+		return http.StatusLocked
+	}
+	var tooLarge *tokenLimitError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	var notGranted *tokenGrantError
+	if errors.As(err, &notGranted) {
+		return http.StatusForbidden
+	}
+	var processed *alreadyProcessedError
+	if errors.As(err, &processed) {
+		return http.StatusConflict
+	}
+	var graph *filterGraphError
+	if errors.As(err, &graph) {
+		return graph.status()
+	}
+	return fallback
+}
+
+var (
+	interceptorTimeout  time.Duration
+	interceptorFailOpen bool
+)
+
+// loadInterceptorConfig registra los servicios externos de INPUT_INTERCEPTOR_URLS
+// y OUTPUT_INTERCEPTOR_URLS (p. ej. un antivirus con API HTTP)
+func loadInterceptorConfig() {
+	interceptorTimeout = envDuration("INTERCEPTOR_TIMEOUT", 30*time.Second)
+	interceptorFailOpen = envBool("INTERCEPTOR_FAIL_OPEN", false)
+
+	for _, url := range splitInterceptorURLs(os.Getenv("INPUT_INTERCEPTOR_URLS")) {
+		RegisterInputInterceptor(&httpInterceptor{url: url})
+		fmt.Printf("Interceptor de entradas: %s\n", url)
+	}
+	for _, url := range splitInterceptorURLs(os.Getenv("OUTPUT_INTERCEPTOR_URLS")) {
+		RegisterOutputInterceptor(&httpInterceptor{url: url})
+		fmt.Printf("Interceptor de salidas: %s\n", url)
+	}
+}
+
+func splitInterceptorURLs(value string) []string {
+	var urls []string
+	for _, url := range strings.Split(value, ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
+
+// httpInterceptor envía el medio por POST a un servicio externo:
+//   - 204: se acepta sin cambios
+//   - 200 con cuerpo: el cuerpo reemplaza al medio
+//   - 403, 406 o 422: se rechaza; el motivo es el campo "reason" del JSON o el texto
+//
+// Cualquier otra respuesta o un error de red rechaza el medio, salvo con
+// INTERCEPTOR_FAIL_OPEN=true.
+type httpInterceptor struct {
+	url string
+}
+
+func (h *httpInterceptor) Name() string {
+	return h.url
+}
+
+func (h *httpInterceptor) InterceptInput(ctx context.Context, media *InterceptedMedia) error {
+	return h.intercept(ctx, media)
+}
+
+func (h *httpInterceptor) InterceptOutput(ctx context.Context, media *InterceptedMedia) error {
+	return h.intercept(ctx, media)
+}
+
+func (h *httpInterceptor) intercept(ctx context.Context, media *InterceptedMedia) error {
+	ctx, cancel := context.WithTimeout(ctx, interceptorTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(media.Data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("X-Intercept-Stage", media.Stage)
+	req.Header.Set("X-Endpoint", media.Endpoint)
+	req.Header.Set("X-Request-ID", media.RequestID)
+	if media.Name != "" {
+		req.Header.Set("X-Filename", media.Name)
+	}
+	if media.Format != "" {
+		req.Header.Set("X-Format", media.Format)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return h.unavailable(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return h.unavailable(err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+		return nil
+	case http.StatusOK:
+		if len(body) > 0 {
+			media.Data = body
+		}
+		return nil
+	case http.StatusForbidden, http.StatusNotAcceptable, http.StatusUnprocessableEntity:
+		return &MediaRejectedError{Interceptor: h.url, Reason: rejectionReason(body)}
+	}
+	return h.unavailable(fmt.Errorf("estado inesperado %d", resp.StatusCode))
+}
+
+// unavailable decide qué hacer si el servicio no respondió como se esperaba
+func (h *httpInterceptor) unavailable(err error) error {
+	if interceptorFailOpen {
+		fmt.Printf("[interceptors] %s no disponible, se continúa: %v\n", h.url, err)
+		return nil
+	}
+	return err
+}
+
+func rejectionReason(body []byte) string {
+	var payload struct {
+		Reason string `json:"reason"`
+	}
+	if json.Unmarshal(body, &payload) == nil && payload.Reason != "" {
+		return payload.Reason
+	}
+	if reason := strings.TrimSpace(string(body)); reason != "" {
+		if len(reason) > 200 {
+			reason = reason[:200]
+		}
+		return reason
+	}
+	return "sin motivo"
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type jobStatus string
+
+const (
+	jobQueued    jobStatus = "queued"
+	jobRunning   jobStatus = "running"
+	jobSucceeded jobStatus = "succeeded"
+	jobFailed    jobStatus = "failed"
+)
+
+// jobRunner ejecuta la conversión y devuelve el mismo cuerpo que tendría la
+// respuesta síncrona
+type jobRunner func(ctx context.Context) (gin.H, error)
+
+// job es una conversión asíncrona consultable vía GET /jobs/:id
+type job struct {
+	mu         sync.Mutex
+	ID         string
+	Kind       string
+	Status     jobStatus
+	CreatedAt  time.Time
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Result     gin.H
+	Error      string
+	// ResultDeletedAt indica cuándo se borró el resultado (DELETE
+	// /jobs/:id/result o /admin/purge)
+	ResultDeletedAt time.Time
+	// CallbackURL recibe el estado final del trabajo por POST, si se indicó
+	CallbackURL string
+
+	info *requestInfo
+	run  jobRunner
+	// inputData se sondea al iniciar el trabajo para calcular el avance
+	inputData []byte
+	progress  *jobProgress
+}
+
+var (
+	jobWorkers   int
+	jobQueueSize int
+	jobResultTTL time.Duration
+
+	jobsMu   sync.Mutex
+	jobs     = map[string]*job{}
+	jobQueue chan *job
+)
+
+func loadJobsConfig() {
+	jobWorkers = envInt("JOB_WORKERS", 2)
+	jobQueueSize = envInt("JOB_QUEUE_SIZE", 100)
+	jobResultTTL = envDuration("JOB_RESULT_TTL", time.Hour)
+}
+
+// startJobWorkers inicia los workers que consumen la cola de trabajos
+func startJobWorkers() {
+	jobQueue = make(chan *job, jobQueueSize)
+	for i := 0; i < jobWorkers; i++ {
+		go jobWorker(i)
+	}
+	go cleanupExpiredJobs()
+	fmt.Printf("Cola de trabajos iniciada con %d workers\n", jobWorkers)
+}
+
+// submitJob registra y encola un trabajo. La información de la solicitud
+// (ID, etiquetas) se copia para que siga disponible tras responder.
+// callbackURL es opcional. inputData da la duración de referencia para el
+// porcentaje de avance y puede ser nil.
+func submitJob(ctx context.Context, kind string, callbackURL string, inputData []byte, run jobRunner) (*job, error) {
+	// Los trabajos en cola siempre corren con la prioridad de lote
+	info := *requestInfoFrom(ctx)
+	info.Class = classBatch
+
+	j := &job{
+		ID:          newRandomID(),
+		Kind:        kind,
+		Status:      jobQueued,
+		CreatedAt:   time.Now(),
+		CallbackURL: callbackURL,
+		info:        &info,
+		run:         run,
+		inputData:   inputData,
+	}
+
+	jobsMu.Lock()
+	jobs[j.ID] = j
+	jobsMu.Unlock()
+
+	info.JobID = j.ID
+
+	select {
+	case jobQueue <- j:
+		requestInfoFrom(ctx).JobID = j.ID
+		fmt.Printf("[jobs] Trabajo %s (%s) encolado\n", j.ID, kind)
+		return j, nil
+	default:
+		jobsMu.Lock()
+		delete(jobs, j.ID)
+		jobsMu.Unlock()
+		return nil, errors.New("la cola de trabajos está llena, intente más tarde")
+	}
+}
+
+func jobWorker(id int) {
+	for j := range jobQueue {
+		executeJob(j, id)
+	}
+}
+
+func executeJob(j *job, worker int) {
+	progress := newJobProgress()
+	defer progress.close()
+
+	j.mu.Lock()
+	j.Status = jobRunning
+	j.StartedAt = time.Now()
+	j.progress = progress
+	j.mu.Unlock()
+
+	fmt.Printf("[jobs] Worker %d ejecutando trabajo %s (%s)\n", worker, j.ID, j.Kind)
+
+	result, err := runJobSafely(j)
+	if err != nil {
+		recordCrash(j.info, err.Error())
+		storeDebugCapture(j.info, http.StatusInternalServerError, err.Error(), nil)
+	}
+	releaseInputs(j.info)
+
+	j.mu.Lock()
+	j.FinishedAt = time.Now()
+	if err != nil {
+		j.Status = jobFailed
+		j.Error = err.Error()
+	} else {
+		j.Status = jobSucceeded
+		j.Result = result
+	}
+	elapsed := j.FinishedAt.Sub(j.StartedAt)
+	j.run = nil
+	j.inputData = nil
+	j.progress = nil
+	j.mu.Unlock()
+
+	fmt.Printf("[jobs] Trabajo %s terminado con estado %s en %s\n", j.ID, j.Status, elapsed.Round(time.Millisecond))
+
+	summary := jobSummary{
+		Endpoint: "job " + j.ID + " (" + j.Kind + ")",
+		Success:  err == nil,
+		Duration: elapsed,
+		Labels:   j.info.Labels,
+		Link:     resultLink(result),
+	}
+	if err != nil {
+		summary.Status = http.StatusInternalServerError
+		summary.Error = err.Error()
+	}
+	notifyJob(summary)
+
+	if j.CallbackURL != "" {
+		go deliverCallback(j)
+	}
+}
+
+// runJobSafely ejecuta el trabajo convirtiendo un pánico en error
+func runJobSafely(j *job) (result gin.H, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Printf("[jobs] Recuperado de pánico en trabajo %s: %v\n", j.ID, r)
+			err = fmt.Errorf("Error interno durante la conversión: %v", r)
+		}
+	}()
+
+	ctx := withRequestInfo(context.Background(), j.info)
+	ctx = withJobProgress(ctx, j.progress)
+	j.progress.probeDuration(ctx, j.inputData)
+	return j.run(ctx)
+}
+
+// view devuelve la representación pública del trabajo
+func (j *job) view() gin.H {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	view := gin.H{
+		"job_id":     j.ID,
+		"kind":       j.Kind,
+		"status":     j.Status,
+		"created_at": j.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	if !j.StartedAt.IsZero() {
+		view["started_at"] = j.StartedAt.UTC().Format(time.RFC3339)
+	}
+	if !j.FinishedAt.IsZero() {
+		view["finished_at"] = j.FinishedAt.UTC().Format(time.RFC3339)
+	}
+	if j.progress != nil {
+		if progress := j.progress.view(); progress != nil {
+			view["progress"] = progress
+		}
+	}
+	if j.Result != nil {
+		view["result"] = j.Result
+	}
+	if !j.ResultDeletedAt.IsZero() {
+		view["result_deleted_at"] = j.ResultDeletedAt.UTC().Format(time.RFC3339)
+	}
+	if j.Error != "" {
+		view["error"] = j.Error
+	}
+	return view
+}
+
+func lookupJob(id string) (*job, bool) {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	j, ok := jobs[id]
+	return j, ok
+}
+
+// lookupRequestJob busca el trabajo de :id y responde 404 si no existe o si
+// lo creó otro tenant: un tenant no ve ni borra trabajos ajenos, y la API key
+// principal solo los suyos
+func lookupRequestJob(c *gin.Context) (*job, bool) {
+	j, ok := lookupJob(c.Param("id"))
+	if !ok || j.info.Tenant != requestTenant(c) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Trabajo no encontrado"})
+		return nil, false
+	}
+	return j, true
+}
+
+func getJobStatus(c *gin.Context) {
+	if !validateAPIKey(c) {
+		return
+	}
+
+	j, ok := lookupRequestJob(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, j.view())
+}
+
+// cleanupExpiredJobs descarta los trabajos terminados hace más de JOB_RESULT_TTL
+func cleanupExpiredJobs() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now()
+		jobsMu.Lock()
+		for id, j := range jobs {
+			j.mu.Lock()
+			expired := !j.FinishedAt.IsZero() && now.Sub(j.FinishedAt) > jobResultTTL
+			j.mu.Unlock()
+			if expired {
+				delete(jobs, id)
+			}
+		}
+		jobsMu.Unlock()
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+const (
+	// defaultTruePeakCeiling es el techo habitual de las plataformas de
+	// streaming: deja margen para los picos que agrega el codec con pérdida
+	defaultTruePeakCeiling = -1.0
+	// limiterOversampleRate es la frecuencia a la que trabaja alimiter: al
+	// sobremuestrear, los picos entre muestras quedan como muestras y el
+	// limitador de picos de muestra actúa como limitador de true peak
+	limiterOversampleRate = 192000
+)
+
+// truePeakLimiter es true_peak_limit: alimiter al final de la cadena, después
+// de la ganancia, la compresión y loudnorm
+type truePeakLimiter struct {
+	CeilingDB float64
+}
+
+// truePeakMeasurement es el true peak de la señal justo antes del limitador
+type truePeakMeasurement struct {
+	InputPeakDB float64
+	// sampleRate es la frecuencia a la que se vuelve después del limitador
+	sampleRate string
+}
+
+// parseTruePeakLimiter valida true_peak_limit y true_peak_ceiling (dBTP,
+// entre -10 y -0.1, -1 por defecto). Devuelve nil si no se pidió.
+func parseTruePeakLimiter(enabled, ceiling string) (*truePeakLimiter, error) {
+	if enabled != "true" {
+		if ceiling != "" {
+			return nil, missingParam("true_peak_ceiling", "true_peak_ceiling requiere true_peak_limit=true")
+		}
+		return nil, nil
+	}
+	limiter := &truePeakLimiter{CeilingDB: defaultTruePeakCeiling}
+	if ceiling != "" {
+		value, err := strconv.ParseFloat(ceiling, 64)
+		if err != nil || value < -10 || value > -0.1 {
+			return nil, invalidParam("true_peak_ceiling", "true_peak_ceiling inválido %q (entre -10 y -0.1 dBTP)", ceiling)
+		}
+		limiter.CeilingDB = value
+	}
+	return limiter, nil
+}
+
+// filter arma el limitador: sobremuestreo, alimiter sin nivelado automático
+// (level=false, que volvería a subir la señal) y vuelta a la frecuencia original
+func (limiter *truePeakLimiter) filter(sampleRate string) string {
+	limit := math.Pow(10, limiter.CeilingDB/20)
+	return fmt.Sprintf("aresample=%d,alimiter=limit=%s:attack=5:release=50:level=false,aresample=%s",
+		limiterOversampleRate, strconv.FormatFloat(limit, 'f', 6, 64), sampleRate)
+}
+
+// measuredTruePeak mide el true peak de la cadena de filtros sin el
+// limitador, una sola vez por petición. Hace antes las mediciones de las que
+// depende la cadena (loudnorm, estéreo y pitch).
+func (opts *audioOptions) measuredTruePeak(ctx context.Context, inputData []byte) (*truePeakMeasurement, error) {
+	if opts.truePeak != nil {
+		return opts.truePeak, nil
+	}
+	if opts.MonoDownmixSafe {
+		if _, err := opts.analyzedStereo(ctx, inputData); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Normalize {
+		if _, err := opts.measuredLoudnorm(ctx, inputData); err != nil {
+			return nil, err
+		}
+	}
+	opts.preparePitch(ctx, inputData)
+
+	inputSource, stdin, cleanup, err := ffmpegInput(inputData, "limiter-input-*")
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	measureOpts := *opts
+	measureOpts.Limiter = nil
+	measureOpts.Dither = ""
+	filterChain := "ebur128=peak=true"
+	if chain := audioFilterChain(measureOpts); chain != "" {
+		filterChain = chain + "," + filterChain
+	}
+	args := []string{"-nostats", "-i", inputSource, "-vn"}
+	args = append(args, opts.Trim.outputArgs()...)
+	args = append(args, "-af", filterChain)
+	args = opts.audioTrackArgs(args)
+	args = append(args, "-f", "null", "-")
+
+	cmd := ffmpegCommand(ctx, classInteractive, args...)
+	cmd.Stdin = stdin
+	var errBuffer bytes.Buffer
+	cmd.Stderr = &errBuffer
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error al medir el true peak: %v, detalles: %s", err, errBuffer.String())
+	}
+	stats, err := parseEbur128Summary(errBuffer.String())
+	if err != nil {
+		return nil, err
+	}
+
+	measurement := &truePeakMeasurement{InputPeakDB: stats.TruePeak, sampleRate: "48000"}
+	if stream, err := probeAudioStream(ctx, inputData); err == nil && stream.SampleRate != "" {
+		measurement.sampleRate = stream.SampleRate
+	}
+	opts.truePeak = measurement
+	recordDebug(ctx, "true_peak_limiter", map[string]interface{}{
+		"ceiling_dbtp":         opts.Limiter.CeilingDB,
+		"input_true_peak_dbtp": finiteOrNil(stats.TruePeak),
+	})
+	return measurement, nil
+}
+
+// gainDB es la reducción máxima que aplica el limitador (0 si la señal ya
+// estaba por debajo del techo)
+func (measurement *truePeakMeasurement) gainDB(limiter *truePeakLimiter) float64 {
+	if math.IsInf(measurement.InputPeakDB, 0) || measurement.InputPeakDB <= limiter.CeilingDB {
+		return 0
+	}
+	return math.Round((limiter.CeilingDB-measurement.InputPeakDB)*100) / 100
+}
+
+// limiterReport es la representación de la respuesta
+func (opts audioOptions) limiterReport() map[string]interface{} {
+	return map[string]interface{}{
+		"ceiling_dbtp":         opts.Limiter.CeilingDB,
+		"input_true_peak_dbtp": finiteOrNil(opts.truePeak.InputPeakDB),
+		"gain_db":              opts.truePeak.gainDB(opts.Limiter),
+		"limited":              opts.truePeak.gainDB(opts.Limiter) < 0,
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// loudnessStats es el resumen EBU R128 de una entrada
+type loudnessStats struct {
+	Integrated float64 // LUFS
+	Range      float64 // LU
+	TruePeak   float64 // dBFS
+}
+
+var (
+	ebur128IntegratedRe = regexp.MustCompile(`I:\s+(-?[\d.]+|-inf) LUFS`)
+	ebur128RangeRe      = regexp.MustCompile(`LRA:\s+(-?[\d.]+) LU`)
+	ebur128PeakRe       = regexp.MustCompile(`Peak:\s+(-?[\d.]+|-inf) dBFS`)
+)
+
+// measureLoudness analiza la entrada con el filtro ebur128 de ffmpeg
+func measureLoudness(ctx context.Context, inputData []byte) (*loudnessStats, error) {
+	inputSource := "pipe:0"
+	if isMP4orM4A(inputData) {
+		inputPath, cleanup, err := writeTempInput(inputData, "loudness-input-*.m4a")
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+		inputSource = inputPath
+	}
+
+	args := []string{
+		"-nostats",
+		"-i", inputSource,
+		"-vn",
+		"-af", "ebur128=peak=true:framelog=verbose",
+		"-f", "null",
+		"-",
+	}
+	cmd := ffmpegCommand(ctx, classInteractive, args...)
+	if inputSource == "pipe:0" {
+		cmd.Stdin = bytes.NewReader(inputData)
+	}
+
+	var errBuffer bytes.Buffer
+	cmd.Stderr = &errBuffer
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error al medir loudness: %v, detalles: %s", err, errBuffer.String())
+	}
+
+	return parseEbur128Summary(errBuffer.String())
+}
+
+// parseEbur128Summary extrae el bloque "Summary:" que ebur128 imprime al final
+func parseEbur128Summary(stderrOutput string) (*loudnessStats, error) {
+	index := strings.LastIndex(stderrOutput, "Summary:")
+	if index < 0 {
+		return nil, errors.New("resumen de ebur128 no encontrado")
+	}
+	summary := stderrOutput[index:]
+
+	integrated, err := matchLoudnessValue(ebur128IntegratedRe, summary)
+	if err != nil {
+		return nil, fmt.Errorf("loudness integrado: %v", err)
+	}
+	loudnessRange, _ := matchLoudnessValue(ebur128RangeRe, summary)
+	truePeak, err := matchLoudnessValue(ebur128PeakRe, summary)
+	if err != nil {
+		return nil, fmt.Errorf("true peak: %v", err)
+	}
+
+	return &loudnessStats{
+		Integrated: integrated,
+		Range:      loudnessRange,
+		TruePeak:   truePeak,
+	}, nil
+}
+
+func matchLoudnessValue(re *regexp.Regexp, text string) (float64, error) {
+	matches := re.FindStringSubmatch(text)
+	if len(matches) != 2 {
+		return 0, errors.New("valor no encontrado")
+	}
+	if matches[1] == "-inf" {
+		return math.Inf(-1), nil
+	}
+	return strconv.ParseFloat(matches[1], 64)
+}
+
+// measuredLoudness mide la entrada la primera vez y reutiliza el resultado
+func (opts *audioOptions) measuredLoudness(ctx context.Context, inputData []byte) (*loudnessStats, error) {
+	if opts.loudness != nil {
+		return opts.loudness, nil
+	}
+
+	stats, err := measureLoudness(ctx, inputData)
+	if err != nil {
+		return nil, err
+	}
+	opts.loudness = stats
+
+	recordDebug(ctx, "loudness", map[string]interface{}{
+		"integrated_lufs": stats.Integrated,
+		"range_lu":        stats.Range,
+		"true_peak_dbfs":  stats.TruePeak,
+	})
+	return stats, nil
+}
+
+// Referencias de ganancia: ReplayGain 2.0 apunta a -18 LUFS y las etiquetas
+// R128_* de Opus (RFC 7845) a -23 LUFS
+const (
+	replayGainReference = -18.0
+	r128GainReference   = -23.0
+)
+
+// loudnessTags devuelve las etiquetas de ganancia para el formato de salida,
+// o nil si el contenedor no admite etiquetas (wav, aac/adts, amr)
+func loudnessTags(stats *loudnessStats, format string) map[string]string {
+	if math.IsInf(stats.Integrated, -1) {
+		// Entrada en silencio: no hay ganancia que sugerir
+		return nil
+	}
+
+	switch format {
+	case "ogg":
+		// Q7.8 en dB, relativo a -23 LUFS
+		gain := int(math.Round((r128GainReference - stats.Integrated) * 256))
+		return map[string]string{"R128_TRACK_GAIN": strconv.Itoa(clampQ78(gain))}
+	case "mp3", "m4a", "alac", "flac":
+		peak := 0.0
+		if !math.IsInf(stats.TruePeak, -1) {
+			peak = math.Pow(10, stats.TruePeak/20)
+		}
+		return map[string]string{
+			"REPLAYGAIN_TRACK_GAIN": fmt.Sprintf("%.2f dB", replayGainReference-stats.Integrated),
+			"REPLAYGAIN_TRACK_PEAK": fmt.Sprintf("%.6f", peak),
+		}
+	}
+	return nil
+}
+
+func clampQ78(value int) int {
+	if value > math.MaxInt16 {
+		return math.MaxInt16
+	}
+	if value < math.MinInt16 {
+		return math.MinInt16
+	}
+	return value
+}
+
+// replayGainOutputArgs agrega las etiquetas como -metadata. En m4a ffmpeg
+// descarta las claves que no conoce, así que se escriben después como átomos
+// freeform de iTunes (ver addReplayGainAtoms).
+func replayGainOutputArgs(tags map[string]string, format string) []string {
+	if isMP4AudioFormat(format) {
+		return nil
+	}
+
+	var args []string
+	for _, key := range sortedKeys(tags) {
+		args = append(args, "-metadata", key+"="+tags[key])
+	}
+	return args
+}
+
+// addReplayGainAtoms escribe las etiquetas como ----:com.apple.iTunes:<clave>
+func addReplayGainAtoms(data []byte, tags map[string]string) []byte {
+	var atoms [][]byte
+	for _, key := range sortedKeys(tags) {
+		atoms = append(atoms, freeformAtom("com.apple.iTunes", strings.ToLower(key), tags[key]))
+	}
+
+	result, err := appendITunesAtoms(data, atoms...)
+	if err != nil {
+		fmt.Printf("[replaygain] No se agregaron las etiquetas al m4a: %v\n", err)
+		return data
+	}
+	return result
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Parámetros de loudnorm: el objetivo integrado es configurable con
+// normalize_target; true peak y rango siguen las recomendaciones para podcasts
+const (
+	defaultLoudnormTarget = -16.0
+	loudnormTruePeak      = -1.5
+	loudnormRange         = 11.0
+)
+
+// loudnormMeasurement es la salida de la primera pasada de loudnorm
+type loudnormMeasurement struct {
+	InputI      string `json:"input_i"`
+	InputTP     string `json:"input_tp"`
+	InputLRA    string `json:"input_lra"`
+	InputThresh string `json:"input_thresh"`
+	Offset      string `json:"target_offset"`
+
+	// sampleRate es la frecuencia de la entrada: loudnorm trabaja a 192 kHz
+	// y la salida debe volver a la original
+	sampleRate string
+}
+
+// parseNormalizeTarget valida normalize_target (LUFS)
+func parseNormalizeTarget(value string) (float64, error) {
+	if value == "" {
+		return defaultLoudnormTarget, nil
+	}
+	target, err := strconv.ParseFloat(value, 64)
+	if err != nil || target < -70 || target > -5 {
+		return 0, invalidParam("normalize_target", "normalize_target inválido %q (entre -70 y -5 LUFS)", value)
+	}
+	return target, nil
+}
+
+// measureLoudnorm ejecuta la primera pasada de loudnorm sobre la entrada
+func measureLoudnorm(ctx context.Context, inputData []byte, target float64) (*loudnormMeasurement, error) {
+	inputSource := "pipe:0"
+	if isMP4orM4A(inputData) {
+		inputPath, cleanup, err := writeTempInput(inputData, "loudnorm-input-*.m4a")
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+		inputSource = inputPath
+	}
+
+	args := []string{
+		"-nostats",
+		"-i", inputSource,
+		"-vn",
+		"-af", fmt.Sprintf("loudnorm=I=%s:TP=%s:LRA=%s:print_format=json",
+			formatLoudness(target), formatLoudness(loudnormTruePeak), formatLoudness(loudnormRange)),
+		"-f", "null",
+		"-",
+	}
+	cmd := ffmpegCommand(ctx, classInteractive, args...)
+	if inputSource == "pipe:0" {
+		cmd.Stdin = bytes.NewReader(inputData)
+	}
+
+	var errBuffer bytes.Buffer
+	cmd.Stderr = &errBuffer
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error en la medición de loudnorm: %v, detalles: %s", err, errBuffer.String())
+	}
+
+	measurement, err := parseLoudnormOutput(errBuffer.String())
+	if err != nil {
+		return nil, err
+	}
+
+	measurement.sampleRate = "48000"
+	if stream, err := probeAudioStream(ctx, inputData); err == nil && stream.SampleRate != "" {
+		measurement.sampleRate = stream.SampleRate
+	}
+	return measurement, nil
+}
+
+// parseLoudnormOutput extrae el bloque JSON que loudnorm imprime al final
+func parseLoudnormOutput(stderrOutput string) (*loudnormMeasurement, error) {
+	start := strings.LastIndex(stderrOutput, "{")
+	end := strings.LastIndex(stderrOutput, "}")
+	if start < 0 || end < start {
+		return nil, errors.New("resultado de loudnorm no encontrado")
+	}
+
+	var measurement loudnormMeasurement
+	if err := json.Unmarshal([]byte(stderrOutput[start:end+1]), &measurement); err != nil {
+		return nil, fmt.Errorf("resultado de loudnorm inválido: %v", err)
+	}
+	// Una entrada en silencio da -inf y loudnorm no puede normalizarla
+	if _, err := strconv.ParseFloat(measurement.InputI, 64); err != nil {
+		return nil, errors.New("la entrada no tiene audio medible para normalizar")
+	}
+	return &measurement, nil
+}
+
+// measuredLoudnorm hace la primera pasada una sola vez por petición
+func (opts *audioOptions) measuredLoudnorm(ctx context.Context, inputData []byte) (*loudnormMeasurement, error) {
+	if opts.loudnorm != nil {
+		return opts.loudnorm, nil
+	}
+
+	measurement, err := measureLoudnorm(ctx, inputData, opts.NormalizeTarget)
+	if err != nil {
+		return nil, err
+	}
+	opts.loudnorm = measurement
+
+	recordDebug(ctx, "loudnorm", map[string]interface{}{
+		"target_lufs":     opts.NormalizeTarget,
+		"input_i":         measurement.InputI,
+		"input_tp":        measurement.InputTP,
+		"input_lra":       measurement.InputLRA,
+		"input_threshold": measurement.InputThresh,
+		"target_offset":   measurement.Offset,
+	})
+	return measurement, nil
+}
+
+// loudnormFilter arma la segunda pasada con los valores medidos. linear=true
+// aplica una ganancia constante cuando el rango lo permite, sin el
+// comportamiento de compresor dinámico de una sola pasada.
+func loudnormFilter(target float64, measurement *loudnormMeasurement) string {
+	return fmt.Sprintf("loudnorm=I=%s:TP=%s:LRA=%s:measured_I=%s:measured_TP=%s:measured_LRA=%s:measured_thresh=%s:offset=%s:linear=true,aresample=%s",
+		formatLoudness(target), formatLoudness(loudnormTruePeak), formatLoudness(loudnormRange),
+		measurement.InputI, measurement.InputTP, measurement.InputLRA, measurement.InputThresh, measurement.Offset,
+		measurement.sampleRate)
+}
+
+func formatLoudness(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
@@ -19,11 +20,9 @@ import (
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
 )
 
 var (
-	apiKey     string
 	httpClient = &http.Client{}
 	bufferPool = sync.Pool{
 		New: func() interface{} {
@@ -31,25 +30,27 @@ var (
 		},
 	}
 	allowedOrigins []string
-)
 
-func init() {
-	devMode := flag.Bool("dev", false, "Run in development mode")
-	flag.Parse()
+	devMode = flag.Bool("dev", false, "Run in development mode")
+)
 
-	if *devMode {
-		err := godotenv.Load()
-		if err != nil {
-			fmt.Println("Error loading .env file")
+// setup carga la configuración del entorno. main la llama después de leer
+// las banderas; los tests, desde TestMain.
+func setup() {
+	// CONFIG_FILE (o .env en modo -dev) se relee con POST /admin/reload y SIGHUP
+	configFile = os.Getenv("CONFIG_FILE")
+	if configFile == "" && *devMode {
+		configFile = ".env"
+	}
+	if configFile != "" {
+		if _, _, err := loadConfigFile(); err != nil {
+			fmt.Printf("Error loading %s file\n", configFile)
 		} else {
-			fmt.Println(".env file loaded successfully")
+			fmt.Printf("%s file loaded successfully\n", configFile)
 		}
 	}
 
-	apiKey = os.Getenv("API_KEY")
-	if apiKey == "" {
-		fmt.Println("API_KEY not configured in .env file")
-	}
+	loadReloadableConfig()
 
 	allowOriginsEnv := os.Getenv("CORS_ALLOW_ORIGINS")
 	if allowOriginsEnv != "" {
@@ -59,28 +60,88 @@ func init() {
 		allowedOrigins = []string{"*"}
 		fmt.Printf("No allowed origins configured, allowing all")
 	}
+
+	loadEmailConfig()
+	loadNotifyConfig()
+	loadMetricsConfig()
+	loadCacheConfig()
+	loadJobsConfig()
+	loadPriorityConfig()
+	loadAACConfig()
+	loadFramingConfig()
+	loadResponseCaseConfig()
+	loadPitchConfig()
+	loadSelfTestConfig()
+	loadInterceptorConfig()
+	loadOperationsConfig()
+	loadQuarantineConfig()
+	loadDebugCaptureConfig()
+	loadMarkerConfig()
+	loadAtRestConfig()
+	loadAuditConfig()
+	loadClassifierConfig()
+	loadTranscribeConfig()
+	loadVerbosityConfig()
+	loadParallelConfig()
+	loadSegmentWorkerConfig()
+}
+
+func loadAPIKeyConfig(cfg *reloadableConfig) {
+	cfg.apiKey = os.Getenv("API_KEY")
+	if cfg.apiKey == "" {
+		fmt.Println("API_KEY not configured in .env file")
+	}
 }
 
 func validateAPIKey(c *gin.Context) bool {
-	if apiKey == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error (no API_KEY configured)"})
+	cfg := config()
+	if cfg.apiKey == "" {
+		respondError(c, http.StatusInternalServerError, notConfigured("Internal server error (no API_KEY configured)"))
 		return false
 	}
 
 	requestApiKey := c.GetHeader("apikey")
+	// tokenMiddleware ya validó el token de conversión (ver tokens.go)
+	if token, ok := c.Get(conversionTokenKey); ok && requestApiKey == "" {
+		setRequestTenant(c, token.(*conversionToken).Tenant)
+		return true
+	}
 	if requestApiKey == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "API_KEY not provided"})
 		return false
 	}
 
-	if requestApiKey != apiKey {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API_KEY"})
-		return false
+	if requestApiKey != cfg.apiKey {
+		// Las keys de TENANT_KEYS autorizan todo menos /admin (ver tenant.go)
+		tenant, ok := cfg.tenantKeys[requestApiKey]
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API_KEY"})
+			return false
+		}
+		if strings.HasPrefix(c.FullPath(), "/admin/") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Tenant API keys cannot use admin endpoints"})
+			return false
+		}
+		setRequestTenant(c, tenant)
 	}
 
 	return true
 }
 
+// apiKeyMiddleware autentica las conversiones antes de que requestMiddleware
+// lea labels y debug del cuerpo: una solicitud sin key no llega a parsear el
+// formulario. Los handlers vuelven a llamar a validateAPIKey, que no cambia
+// el resultado.
+func apiKeyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !validateAPIKey(c) {
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
 // isMP4orM4A detecta si los datos de entrada son un archivo MP4/M4A
 // basándose en la firma "ftyp" en los bytes 4-7 del archivo
 func isMP4orM4A(data []byte) bool {
@@ -91,26 +152,53 @@ func isMP4orM4A(data []byte) bool {
 	return string(data[4:8]) == "ftyp"
 }
 
-// getFFmpegArgs retorna los argumentos de FFmpeg según el formato de salida
+// getFFmpegArgs retorna los argumentos de FFmpeg para las opciones de salida dadas
 // inputSource debe ser "pipe:0" para pipes o la ruta del archivo temporal
-func getFFmpegArgs(inputSource string, outputFormat string) []string {
-	baseArgs := []string{"-i", inputSource}
+func getFFmpegArgs(inputSource string, outputArgs []string) []string {
+	args := append([]string{"-i", inputSource}, outputArgs...)
+	return append(args, "pipe:1")
+}
+
+// getFFmpegOutputArgs retorna solo las opciones de salida de un formato, sin
+// la entrada ni el destino, para poder combinarlas en un mismo comando
+func getFFmpegOutputArgs(outputFormat string) []string {
+	return outputArgsWithAAC(outputFormat, nil)
+}
 
+// outputArgsWithAAC es getFFmpegOutputArgs con las opciones de codificador de
+// los formatos AAC; nil usa el codificador del servidor con AAC-LC a 128k
+func outputArgsWithAAC(outputFormat string, aacArgs []string) []string {
+	if aacArgs == nil {
+		aacArgs = []string{"-c:a", defaultAACEncoder, "-b:a", "128k"}
+	}
+
+	// Todas las salidas llevan -vn: un video enviado a /process-audio se
+	// convierte extrayendo su pista de audio
 	switch outputFormat {
 	case "mp4":
-		return append(baseArgs, "-vn", "-c:a", "aac", "-b:a", "128k", "-f", "adts", "pipe:1")
+		return append(append([]string{"-vn"}, aacArgs...), "-f", "adts")
 	case "mp3":
-		return append(baseArgs, "-f", "mp3", "pipe:1")
+		return []string{"-vn", "-f", "mp3"}
 	case "wav":
-		return append(baseArgs, "-f", "wav", "pipe:1")
+		return []string{"-vn", "-f", "wav"}
 	case "aac":
-		return append(baseArgs, "-c:a", "aac", "-b:a", "128k", "-f", "adts", "pipe:1")
+		return append(append([]string{"-vn"}, aacArgs...), "-f", "adts")
 	case "amr":
-		return append(baseArgs, "-c:a", "libopencore_amrnb", "-b:a", "12.2k", "-f", "amr", "pipe:1")
+		return []string{"-vn", "-c:a", "libopencore_amrnb", "-b:a", "12.2k", "-f", "amr"}
+	case "amr-wb":
+		// AMR-WB (G.722.2) solo admite 16 kHz mono
+		return []string{"-vn", "-c:a", "libvo_amrwbenc", "-ar", "16000", "-ac", "1", "-b:a", "23.85k", "-f", "amr"}
+	case "flac":
+		return []string{"-vn", "-c:a", "flac", "-compression_level", strconv.Itoa(defaultFLACCompression), "-f", "flac"}
+	case "ulaw", "alaw":
+		return telephonyOutputArgs(outputFormat)
+	case "alac":
+		// Apple Lossless en contenedor M4A; no tiene retardo de encoder
+		return []string{"-vn", "-c:a", "alac", "-f", "ipod"}
 	case "m4a":
-		return append(baseArgs, "-c:a", "aac", "-b:a", "128k", "-f", "ipod", "pipe:1")
+		return append(append([]string{"-vn"}, aacArgs...), "-f", "ipod", "-movie_timescale", gaplessMovieTimescale, "-use_editlist", "1")
 	default: // ogg
-		return append(baseArgs,
+		return []string{
 			"-f", "ogg",
 			"-vn",
 			"-c:a", "libopus",
@@ -127,8 +215,7 @@ func getFFmpegArgs(inputSource string, outputFormat string) []string {
 			"-map_metadata", "-1",
 			"-map_chapters", "-1",
 			"-write_bext", "0",
-			"pipe:1",
-		)
+		}
 	}
 }
 
@@ -161,7 +248,7 @@ func extractDuration(stderrOutput string) (int, error) {
 
 // convertAudioWithTempFile convierte audio usando archivo temporal para la entrada
 // Necesario para formatos MP4/M4A que tienen el "moov atom" al final
-func convertAudioWithTempFile(inputData []byte, outputFormat string) ([]byte, int, error) {
+func convertAudioWithTempFile(ctx context.Context, inputData []byte, outputArgs []string) ([]byte, int, error) {
 	fmt.Println("[convertAudio] Usando archivo temporal (formato MP4/M4A detectado)")
 
 	// Crear archivo temporal para entrada
@@ -185,8 +272,8 @@ func convertAudioWithTempFile(inputData []byte, outputFormat string) ([]byte, in
 	inputFile.Close()
 
 	// Construir comando FFmpeg con archivo temporal como entrada
-	args := getFFmpegArgs(inputPath, outputFormat)
-	cmd := exec.Command("ffmpeg", args...)
+	args := getFFmpegArgs(inputPath, outputArgs)
+	cmd := ffmpegCommand(ctx, classInteractive, args...)
 
 	outBuffer := bufferPool.Get().(*bytes.Buffer)
 	errBuffer := bufferPool.Get().(*bytes.Buffer)
@@ -228,11 +315,11 @@ func convertAudioWithTempFile(inputData []byte, outputFormat string) ([]byte, in
 
 // convertAudioWithPipe convierte audio usando pipes (método original)
 // Más eficiente para formatos que no requieren seek (wav, mp3, ogg, etc.)
-func convertAudioWithPipe(inputData []byte, outputFormat string) ([]byte, int, error) {
+func convertAudioWithPipe(ctx context.Context, inputData []byte, outputArgs []string) ([]byte, int, error) {
 	fmt.Println("[convertAudio] Usando pipes (formato estándar)")
 
-	args := getFFmpegArgs("pipe:0", outputFormat)
-	cmd := exec.Command("ffmpeg", args...)
+	args := getFFmpegArgs("pipe:0", outputArgs)
+	cmd := ffmpegCommand(ctx, classInteractive, args...)
 
 	outBuffer := bufferPool.Get().(*bytes.Buffer)
 	errBuffer := bufferPool.Get().(*bytes.Buffer)
@@ -273,47 +360,269 @@ func convertAudioWithPipe(inputData []byte, outputFormat string) ([]byte, int, e
 	return convertedData, duration, nil
 }
 
-func convertAudio(inputData []byte, outputFormat string) ([]byte, int, error) {
-	fmt.Printf("[convertAudio] Iniciando conversión. Tamaño entrada: %d bytes, Formato salida: %s\n", len(inputData), outputFormat)
+// audioOptions agrupa los parámetros de conversión de audio
+type audioOptions struct {
+	Format string
+	// DisableCodecCopy fuerza la recodificación aunque el codec ya coincida
+	DisableCodecCopy bool
+	// ReplayGain agrega etiquetas de ganancia (ReplayGain o R128 en Opus) en
+	// lugar de normalizar el audio
+	ReplayGain bool
+	// Dither es el método de dither de aresample al reducir a 16 bits
+	Dither string
+	// AnalyzeStereo agrega a la respuesta el análisis de fase/compatibilidad mono
+	AnalyzeStereo bool
+	// MonoDownmixSafe corrige polaridad o cancelaciones antes de codificar
+	MonoDownmixSafe bool
+	// Params son bitrate, sample_rate y channels explícitos
+	Params audioParams
+	// Trim recorta la salida con start/duration/end
+	Trim audioTrim
+	// SilenceRemoval elimina las pausas largas (remove_silence)
+	SilenceRemoval *silenceRemoval
+	// TelephonyRaw entrega ulaw/alaw sin cabecera WAV (telephony_container=raw)
+	TelephonyRaw bool
+	// Speed cambia la velocidad de reproducción con atempo (1 = original)
+	Speed float64
+	// TargetDuration fija la duración exacta de la salida; Speed es el
+	// factor que la alcanza (ver stretch.go)
+	TargetDuration float64
+	// Padding completa con silencio hasta una duración exacta (pad_to_duration)
+	Padding *durationPadding
+	// PitchSemitones sube o baja el tono sin cambiar el tempo
+	PitchSemitones float64
+	// WhatsAppVoice es preset=whatsapp_voice: Opus de nota de voz y forma de onda
+	WhatsAppVoice bool
+	// MusicOpus es preset=music-opus: Opus estéreo a 48 kHz para música
+	MusicOpus bool
+	// AutoProfile elige entre el ogg de voz y music-opus según la entrada
+	AutoProfile bool
+	// Metadata son las etiquetas title, artist, album, genre, year y comment
+	Metadata map[string]string
+	// Cover es la imagen que se embebe como carátula en mp3, m4a, alac y flac
+	Cover []byte
+	// Chapters se escriben como frames ID3v2 CHAP/CTOC en la salida mp3
+	Chapters []podcastChapter
+	// AudioTrack elige la pista de audio (desde 1, ver extractaudio.go); 0
+	// deja que ffmpeg elija
+	AudioTrack int
+	// Target es la plataforma de destino que eligió el formato (target=...)
+	Target *platformTarget
+	// ChannelLayout reordena o extrae canales (channel_layout, ver channels.go)
+	ChannelLayout *channelLayout
+	// Denoise reduce el ruido de fondo antes del resto de los filtros
+	Denoise *denoiseFilter
+	// Compressor nivela la dinámica con acompressor (compress_dynamics)
+	Compressor *dynamicsCompressor
+	// GainDB sube o baja el volumen una cantidad fija (gain_db)
+	GainDB float64
+	// Normalize aplica loudnorm en dos pasadas hacia NormalizeTarget (LUFS)
+	Normalize       bool
+	NormalizeTarget float64
+	// Limiter limita el true peak de la salida (true_peak_limit, ver limiter.go)
+	Limiter *truePeakLimiter
+	// StreamHash compara el hash del audio decodificado de la entrada y la
+	// salida (stream_hash, ver streamhash.go)
+	StreamHash string
+
+	// loudness y stereo se miden una sola vez aunque se generen varios formatos
+	loudness *loudnessStats
+	stereo   *stereoAnalysis
+	loudnorm *loudnormMeasurement
+	profile  *audioProfile
+	truePeak *truePeakMeasurement
+	// stretchSource es la duración medida de la entrada con target_duration
+	stretchSource float64
+	// aacArgs y mp3Args son las opciones de codificador ya validadas
+	// (aac_encoder/aac_profile, mp3_vbr/mp3_joint_stereo, flac_compression
+	// y opus_bitrate/application/vbr/frame_duration)
+	aacArgs  []string
+	mp3Args  []string
+	flacArgs []string
+	opusArgs []string
+	// pitchSampleRate es la frecuencia de la entrada para asetrate
+	pitchSampleRate string
+	// coverPath es el archivo temporal de Cover durante la conversión
+	coverPath string
+}
+
+// hasEncoderOptions indica si la petición ajusta el codificador
+func (opts audioOptions) hasEncoderOptions() bool {
+	return opts.aacArgs != nil || opts.mp3Args != nil || opts.flacArgs != nil || opts.opusArgs != nil || opts.Params.isSet()
+}
+
+// audioOutputArgs decide las opciones de salida: copia del codec cuando el
+// origen ya está en el codec de destino y no hay filtros, o la recodificación
+// del formato con su cadena de filtros
+func audioOutputArgs(ctx context.Context, inputData []byte, opts audioOptions) []string {
+	filterChain := audioFilterChain(opts)
+
+	// Con opciones explícitas de codificador se recodifica siempre, y al
+	// recortar también: la copia solo puede cortar en límites de paquete. La
+	// detección de copia mira la primera pista, así que elegir otra recodifica.
+	if !opts.DisableCodecCopy && filterChain == "" && !opts.hasEncoderOptions() && !opts.Trim.isSet() && opts.AudioTrack == 0 && opts.ChannelLayout == nil {
+		if args := codecCopyArgs(ctx, inputData, opts.Format); args != nil {
+			args = append(opts.applyTelephonyContainer(args), metadataArgs(opts.Metadata, opts.Format)...)
+			args = append(args, encodeMarkerArgs(ctx)...)
+			return applyCoverArt(args, opts.coverPath, coverCodec(opts.Cover), opts.Format)
+		}
+	}
+
+	args := outputArgsWithAAC(opts.Format, opts.aacArgs)
+	if opts.Format == "mp3" {
+		args = append(args, opts.mp3Args...)
+	}
+	if opts.Format == "flac" && opts.flacArgs != nil {
+		args = setOutputOption(args, opts.flacArgs[0], opts.flacArgs[1])
+	}
+	if opts.Format == "ogg" && opts.opusArgs != nil {
+		args = applyOpusArgs(args, opts.opusArgs)
+	}
+	args = opts.Params.apply(args)
+	args = opts.ChannelLayout.apply(args)
+	args = opts.applyTelephonyContainer(args)
+	args = append(args, metadataArgs(opts.Metadata, opts.Format)...)
+	args = append(args, encodeMarkerArgs(ctx)...)
+	args = append(args, opts.Trim.outputArgs()...)
+	if filterChain != "" {
+		recordDebug(ctx, "audio_filters", filterChain)
+		args = append(args, "-af", filterChain)
+	}
+	args = opts.audioTrackArgs(args)
+	return applyCoverArt(args, opts.coverPath, coverCodec(opts.Cover), opts.Format)
+}
+
+// prepare hace las mediciones que necesitan el codificador y la cadena de
+// filtros (perfil, estéreo, loudnorm, pitch y true peak) y escribe la carátula; la función devuelta la borra
+func (opts *audioOptions) prepare(ctx context.Context, inputData []byte) (func(), error) {
+	if opts.AutoProfile {
+		if _, err := opts.analyzedProfile(ctx, inputData); err != nil {
+			return nil, err
+		}
+	}
+	if opts.MonoDownmixSafe {
+		if _, err := opts.analyzedStereo(ctx, inputData); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Normalize {
+		if _, err := opts.measuredLoudnorm(ctx, inputData); err != nil {
+			return nil, err
+		}
+	}
+	opts.preparePitch(ctx, inputData)
+	if opts.Limiter != nil {
+		if _, err := opts.measuredTruePeak(ctx, inputData); err != nil {
+			return nil, err
+		}
+	}
+	return opts.prepareCover()
+}
+
+func convertAudio(ctx context.Context, inputData []byte, opts audioOptions) ([]byte, int, error) {
+	fmt.Printf("[convertAudio] Iniciando conversión. Tamaño entrada: %d bytes, Formato salida: %s\n", len(inputData), opts.Format)
 
 	if len(inputData) == 0 {
 		return nil, 0, errors.New("empty input data")
 	}
 
+	cleanupCover, err := opts.prepare(ctx, inputData)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cleanupCover()
+
+	outputArgs := audioOutputArgs(ctx, inputData, opts)
+	if err := checkFilterArgs(outputArgs); err != nil {
+		return nil, 0, err
+	}
+
+	var gainTags map[string]string
+	if opts.ReplayGain {
+		stats, err := opts.measuredLoudness(ctx, inputData)
+		if err != nil {
+			return nil, 0, err
+		}
+		gainTags = loudnessTags(stats, opts.Format)
+		outputArgs = append(outputArgs, replayGainOutputArgs(gainTags, opts.Format)...)
+	}
+
+	if needsSeekableOutput(opts.Format) {
+		data, duration, err := convertAudioToSeekableOutput(ctx, inputData, outputArgs, opts.Format)
+		if err == nil && isMP4AudioFormat(opts.Format) && len(gainTags) > 0 {
+			data = addReplayGainAtoms(data, gainTags)
+		}
+		if err == nil && opts.Format == "mp3" && len(opts.Chapters) > 0 {
+			data, err = addMP3Chapters(ctx, data, opts.Chapters)
+		}
+		return data, duration, explainAudioError(err)
+	}
+
 	// Detectar si es MP4/M4A - estos formatos tienen el "moov atom" al final
 	// y requieren seek, por lo que no pueden usar pipes
 	if isMP4orM4A(inputData) {
 		fmt.Println("[convertAudio] Formato MP4/M4A detectado (ftyp signature encontrada)")
-		return convertAudioWithTempFile(inputData, outputFormat)
+		data, duration, err := convertAudioWithTempFile(ctx, inputData, outputArgs)
+		return data, duration, explainAudioError(err)
 	}
 
 	fmt.Println("[convertAudio] Formato estándar detectado, usando pipes")
-	return convertAudioWithPipe(inputData, outputFormat)
+	data, duration, err := convertAudioWithPipe(ctx, inputData, outputArgs)
+	return data, duration, explainAudioError(err)
+}
+
+// explainAudioError reemplaza el error de ffmpeg cuando la entrada (p. ej.
+// un video sin sonido) no tiene ninguna pista de audio que convertir
+func explainAudioError(err error) error {
+	if err == nil {
+		return nil
+	}
+	message := err.Error()
+	if strings.Contains(message, "does not contain any stream") || strings.Contains(message, "matches no streams") {
+		return errors.New("la entrada no contiene una pista de audio")
+	}
+	return err
 }
 
-func fetchAudioFromURL(url string) ([]byte, error) {
-	resp, err := httpClient.Get(url)
+func fetchAudioFromURL(ctx context.Context, url string) ([]byte, error) {
+	// s3:// y gs:// se leen con las credenciales del servidor
+	if isCloudURI(url) {
+		return fetchCloudInput(ctx, url)
+	}
+
+	client, err := inputClient(ctx, httpClient)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	return io.ReadAll(resp.Body)
+	_, data, err := doCachedRequest(client, req)
+	return data, err
 }
 
-func fetchGifFromURL(url string) ([]byte, error) {
+func fetchGifFromURL(ctx context.Context, url string) ([]byte, error) {
 	if url == "" {
 		return nil, errors.New("URL vazia fornecida")
 	}
 
+	if isCloudURI(url) {
+		return fetchCloudInput(ctx, url)
+	}
+
 	fmt.Printf("Intentando descargar GIF desde: %s\n", url)
 
 	// Configurar un cliente HTTP con timeout más largo
-	client := &http.Client{
+	client, err := inputClient(ctx, &http.Client{
 		Timeout: 60 * time.Second, // Aumentar timeout a 60 segundos
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("error al crear solicitud: %v", err)
 	}
@@ -321,48 +630,62 @@ func fetchGifFromURL(url string) ([]byte, error) {
 	// Agregar User-Agent para evitar restricciones
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
 
-	resp, err := client.Do(req)
+	statusCode, data, err := doCachedRequest(client, req)
 	if err != nil {
-		return nil, fmt.Errorf("error al acceder URL: %v", err)
+		return nil, fmt.Errorf("error al acceder URL: %w", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("estado de respuesta inválido: %d", resp.StatusCode)
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("estado de respuesta inválido: %d", statusCode)
 	}
 
-	fmt.Printf("Descarga iniciada. Content-Length: %s\n", resp.Header.Get("Content-Length"))
-
-	// Leer con un buffer limitado para evitar problemas de memoria
-	var buffer bytes.Buffer
-	_, err = io.Copy(&buffer, resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("error al leer datos: %v", err)
-	}
-
-	data := buffer.Bytes()
 	fmt.Printf("Descarga completada. Tamaño: %d bytes\n", len(data))
 
 	return data, nil
 }
 
 func getInputData(c *gin.Context) ([]byte, error) {
-	if file, _, err := c.Request.FormFile("file"); err == nil {
-		return io.ReadAll(file)
+	// Los endpoints de una sola entrada no ignoran en silencio los archivos extra
+	if headers := multipartFiles(c); len(headers) > 1 {
+		return nil, fmt.Errorf("este endpoint acepta un solo archivo; se recibieron %d", len(headers))
 	}
 
-	if base64Data := c.PostForm("base64"); base64Data != "" {
-		return base64.StdEncoding.DecodeString(base64Data)
+	var (
+		data []byte
+		name string
+		err  error
+	)
+	if file, header, fileErr := c.Request.FormFile("file"); fileErr == nil {
+		data, err = io.ReadAll(file)
+		name = filepath.Base(header.Filename)
+	} else if base64Data := c.PostForm("base64"); base64Data != "" {
+		data, err = base64.StdEncoding.DecodeString(base64Data)
+	} else if url := c.PostForm("url"); url != "" {
+		data, err = fetchAudioFromURL(c.Request.Context(), url)
+		name = filepath.Base(url)
+	} else {
+		return nil, errors.New("nenhum arquivo, base64 ou URL fornecido")
 	}
-
-	if url := c.PostForm("url"); url != "" {
-		return fetchAudioFromURL(url)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil, errors.New("nenhum arquivo, base64 ou URL fornecido")
+	// Los interceptores registrados pueden transformar o rechazar la entrada
+	if data, err = interceptInput(c.Request.Context(), name, data); err != nil {
+		return nil, err
+	}
+	info := requestInfoFrom(c.Request.Context())
+	hash := info.addInput(data)
+	if err := checkTokenInputLimit(c, info); err != nil {
+		return nil, err
+	}
+	if err := checkQuarantine(info.Endpoint, hash); err != nil {
+		return nil, err
+	}
+	return data, checkEncodeMarker(c, info, data)
 }
 
-func convertGifToMp4(inputData []byte) ([]byte, error) {
+func convertGifToMp4(ctx context.Context, inputData []byte) ([]byte, error) {
 	// Log the size of the input data
 	fmt.Printf("Tamaño de datos GIF de entrada: %d bytes\n", len(inputData))
 
@@ -380,11 +703,11 @@ func convertGifToMp4(inputData []byte) ([]byte, error) {
 
 	// Siempre usar archivos temporales para MP4 porque el formato requiere seeking
 	// que no es posible con pipes
-	return convertGifToMp4UsingTempFiles(inputData)
+	return convertGifToMp4UsingTempFiles(ctx, inputData)
 }
 
 // Función para convertir GIF a MP4 usando archivos temporales
-func convertGifToMp4UsingTempFiles(inputData []byte) ([]byte, error) {
+func convertGifToMp4UsingTempFiles(ctx context.Context, inputData []byte) ([]byte, error) {
 	fmt.Println("Usando archivos temporales para la conversión de GIF a MP4")
 
 	// Crear archivo temporal para entrada
@@ -427,7 +750,7 @@ func convertGifToMp4UsingTempFiles(inputData []byte) ([]byte, error) {
 	fmt.Printf("Archivo de entrada verificado: %s (tamaño: %d bytes)\n", inputPath, inputInfo.Size())
 
 	// Ejecutar ffmpeg con archivos temporales
-	cmd := exec.Command("ffmpeg",
+	cmd := ffmpegCommand(ctx, classBatch,
 		"-i", inputPath,          // Archivo de entrada
 		"-movflags", "faststart", // Optimizar para streaming
 		"-pix_fmt", "yuv420p",    // Formato de pixel compatible
@@ -479,33 +802,329 @@ func processAudio(c *gin.Context) {
 		return
 	}
 
-	inputData, err := getInputData(c)
+	// Varios campos file (o base64/url) convierten cada entrada por separado
+	inputs, err := getInputFiles(c)
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+	// input_format/input_args describen entradas sin cabecera (PCM crudo, G.711)
+	hints, err := parseRawInputHints(c.PostForm("input_format"), c.PostForm("input_sample_rate"), c.PostForm("input_channels"), c.PostForm("input_args"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	if hints != nil {
+		for i := range inputs {
+			if inputs[i].Data, err = wrapRawInput(c.Request.Context(), inputs[i].Data, hints); err != nil {
+				respondError(c, http.StatusUnprocessableEntity, err)
+				return
+			}
+		}
+	}
+	inputData := inputs[0].Data
+	batch := len(inputs) > 1
+
+	// Una imagen enviada aquí se rechaza indicando el endpoint correcto, o
+	// con auto=true se procesa con ese pipeline
+	if hints == nil && !batch {
+		if err := checkAudioInput(inputData); err != nil {
+			var mismatch *mediaMismatchError
+			if c.PostForm("auto") == "true" && errors.As(err, &mismatch) {
+				response, err := processAsDetectedClass(c.Request.Context(), inputData, mismatch.Detected)
+				if err != nil {
+					respondError(c, mediaErrorStatus(err, http.StatusInternalServerError), err)
+					return
+				}
+				c.JSON(http.StatusOK, attachDebug(c.Request.Context(), response))
+				return
+			}
+			mediaMismatchResponse(c, err)
+			return
+		}
+	}
+
+	req, err := parseAudioRequest(c, batch)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondError(c, mediaErrorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+	opts := req.opts
+
+	// target_duration y pad_to_duration dependen de la duración de la entrada
+	if opts.TargetDuration > 0 {
+		if opts.stretchSource, opts.Speed, err = stretchSpeed(c.Request.Context(), inputData, opts.TargetDuration); err != nil {
+			respondError(c, http.StatusUnprocessableEntity, err)
+			return
+		}
+	}
+	if opts.Padding != nil {
+		if err := opts.Padding.plan(c.Request.Context(), inputData, opts.Speed); err != nil {
+			respondError(c, http.StatusUnprocessableEntity, err)
+			return
+		}
+	}
+	// Los filtros que piden las opciones deben poder combinarse y existir en
+	// este ffmpeg; se revisa antes de medir o encolar
+	if err := checkAudioFilters(opts); err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+
+	run := func(ctx context.Context) (gin.H, error) {
+		if batch {
+			return runAudioBatch(ctx, inputs, req.formatsParam, opts, req.emailTo), nil
+		}
+		var (
+			response gin.H
+			err      error
+		)
+		if req.splitChannels {
+			response, err = runChannelSplit(ctx, inputData, opts, req.s3Dest)
+		} else if req.segmentSeconds > 0 {
+			response, err = runAudioChunks(ctx, inputData, opts, req.segmentSeconds)
+		} else if req.hls != nil {
+			response, err = runAudioHLS(ctx, inputData, opts, req.hls, req.s3Dest)
+		} else if req.formatsParam != "" {
+			response, err = runAudioMulti(ctx, inputData, req.formatsParam, opts, req.s3Dest)
+		} else {
+			response, err = runProcessAudio(ctx, inputData, opts, req.emailTo, req.s3Dest)
+		}
+		return response, explainMediaMismatch(ctx, inputData, err)
+	}
+
+	// Con async=true o callback_url se responde de inmediato con el trabajo
+	if req.queued() {
+		job, err := submitJob(c.Request.Context(), "process-audio", req.callbackURL, inputData, run)
+		if err != nil {
+			respondError(c, http.StatusServiceUnavailable, err)
+			return
+		}
+		if req.fastStart {
+			respondWithProxy(c, job, "audio", inputData, req.binary)
+			return
+		}
+		c.JSON(http.StatusAccepted, job.view())
+		return
+	}
+
+	// Los tramos de segment_seconds se entregan en un ZIP o como multipart
+	if req.segmentSeconds > 0 && respondAudioChunks(c, inputData, opts, req.segmentSeconds) {
+		return
+	}
+
+	// Sin destino S3 el paquete HLS se entrega como ZIP
+	if req.hls != nil && req.s3Dest == nil {
+		respondAudioHLS(c, inputData, opts, req.hls)
 		return
 	}
 
-	outputFormat := c.DefaultPostForm("output_format", "ogg")
+	// response=binary devuelve el audio sin envolverlo en JSON/base64
+	if req.s3Dest == nil && req.binary {
+		if opts.AutoProfile {
+			if _, err := opts.analyzedProfile(c.Request.Context(), inputData); err != nil {
+				respondError(c, mediaErrorStatus(err, http.StatusUnprocessableEntity), err)
+				return
+			}
+		}
+		if opts.Limiter != nil {
+			if _, err := opts.measuredTruePeak(c.Request.Context(), inputData); err != nil {
+				respondError(c, mediaErrorStatus(err, http.StatusUnprocessableEntity), err)
+				return
+			}
+		}
+		convertedData, duration, err := convertAudio(c.Request.Context(), inputData, opts)
+		if err != nil {
+			if mediaMismatchResponse(c, explainMediaMismatch(c.Request.Context(), inputData, err)) {
+				return
+			}
+			respondError(c, http.StatusInternalServerError, err)
+			return
+		}
+		if convertedData, err = interceptOutput(c.Request.Context(), opts.Format, convertedData); err != nil {
+			respondError(c, mediaErrorStatus(err, http.StatusInternalServerError), err)
+			return
+		}
+
+		headers := map[string]string{
+			"X-Duration": strconv.Itoa(duration),
+			"X-Format":   opts.Format,
+		}
+		if opts.Target != nil {
+			headers["X-Target"] = opts.Target.Name
+			if warning := opts.Target.sizeWarning(len(convertedData)); warning != "" {
+				headers["X-Warnings"] = warning
+			}
+		}
+		if opts.profile != nil {
+			headers["X-Audio-Profile"] = opts.profile.Name
+		}
+		if opts.TargetDuration > 0 {
+			headers["X-Stretch-Speed"] = strconv.FormatFloat(opts.Speed, 'f', 4, 64)
+		}
+		if opts.truePeak != nil {
+			headers["X-Limiter-Gain"] = strconv.FormatFloat(opts.truePeak.gainDB(opts.Limiter), 'f', -1, 64)
+		}
+		if opts.StreamHash != "" {
+			report, err := compareStreamHashes(c.Request.Context(), opts.StreamHash, inputData, convertedData, false)
+			if err != nil {
+				respondError(c, http.StatusInternalServerError, err)
+				return
+			}
+			report.headers(headers)
+		}
+		if opts.WhatsAppVoice {
+			waveform, err := audioWaveform(c.Request.Context(), convertedData, whatsappWaveformSamples)
+			if err != nil {
+				respondError(c, http.StatusInternalServerError, err)
+				return
+			}
+			headers["X-Waveform"] = base64.StdEncoding.EncodeToString(waveform)
+		}
+		if req.emailTo != "" {
+			email := deliverByEmail(req.emailTo, convertedData, opts.outputFilename(), opts.outputContentType())
+			c.Set("result_link", resultLink(gin.H{"email": email}))
+			headers["X-Email-Status"] = emailStatusHeader(email)
+		}
+
+		writeBinaryResponse(c, convertedData, opts.outputFilename(), opts.outputContentType(), headers)
+		return
+	}
 
-	convertedData, duration, err := convertAudio(inputData, outputFormat)
+	response, err := run(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if mediaMismatchResponse(c, err) {
+			return
+		}
+		respondError(c, mediaErrorStatus(err, http.StatusInternalServerError), err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	c.Set("result_link", resultLink(response))
+	c.JSON(http.StatusOK, attachDebug(c.Request.Context(), response))
+}
+
+// runAudioBatch convierte cada entrada con las mismas opciones y devuelve los
+// resultados en el orden recibido. Un error en un archivo no detiene al resto.
+func runAudioBatch(ctx context.Context, inputs []inputFile, formatsParam string, opts audioOptions, emailTo string) gin.H {
+	results := make([]gin.H, 0, len(inputs))
+	failed := 0
+	for i, input := range inputs {
+		var (
+			result gin.H
+			err    error
+		)
+		// Cada entrada parte de opciones sin mediciones previas
+		inputOpts := opts
+		if formatsParam != "" {
+			result, err = runAudioMulti(ctx, input.Data, formatsParam, inputOpts, nil)
+		} else {
+			result, err = runProcessAudio(ctx, input.Data, inputOpts, emailTo, nil)
+		}
+		if err != nil {
+			failed++
+			fmt.Printf("[processAudio] Error en la entrada %d (%s): %v\n", i+1, input.Name, err)
+			result = gin.H{"error": err.Error()}
+		}
+		result["index"] = i
+		result["filename"] = input.Name
+		results = append(results, result)
+	}
+
+	return gin.H{
+		"results": results,
+		"count":   len(inputs),
+		"failed":  failed,
+	}
+}
+
+// runProcessAudio convierte a un único formato y devuelve el cuerpo de la
+// respuesta. Se usa tanto en modo síncrono como desde la cola de trabajos.
+func runProcessAudio(ctx context.Context, inputData []byte, opts audioOptions, emailTo string, s3Dest *s3Destination) (gin.H, error) {
+	if opts.AnalyzeStereo {
+		if _, err := opts.analyzedStereo(ctx, inputData); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.AutoProfile {
+		if _, err := opts.analyzedProfile(ctx, inputData); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Limiter != nil {
+		if _, err := opts.measuredTruePeak(ctx, inputData); err != nil {
+			return nil, err
+		}
+	}
+
+	convertedData, duration, err := convertAudio(ctx, inputData, opts)
+	if err != nil {
+		return nil, err
+	}
+	if convertedData, err = interceptOutput(ctx, opts.Format, convertedData); err != nil {
+		return nil, err
+	}
+
+	response := gin.H{
 		"duration": duration,
-		"audio":    base64.StdEncoding.EncodeToString(convertedData),
-		"format":   outputFormat,
-	})
+		"format":   opts.Format,
+	}
+	if opts.MusicOpus {
+		response["preset"] = musicOpusPreset
+	}
+	if opts.profile != nil {
+		response["audio_profile"] = opts.profile.report()
+	}
+	if opts.AnalyzeStereo {
+		response["stereo_analysis"] = opts.stereo.report()
+	}
+	if opts.truePeak != nil {
+		response["true_peak_limiter"] = opts.limiterReport()
+	}
+	if opts.TargetDuration > 0 {
+		response["time_stretch"] = stretchReport(opts.stretchSource, opts.TargetDuration, opts.Speed)
+	}
+	if opts.Padding != nil {
+		response["padding"] = opts.Padding.report()
+	}
+	if opts.Target != nil {
+		opts.Target.report(response, len(convertedData))
+	}
+	if opts.StreamHash != "" {
+		report, err := compareStreamHashes(ctx, opts.StreamHash, inputData, convertedData, false)
+		if err != nil {
+			return nil, err
+		}
+		response["stream_hash"] = report
+	}
+	if opts.WhatsAppVoice {
+		response["preset"] = whatsappVoicePreset
+		if err := addWhatsAppWaveform(ctx, response, convertedData); err != nil {
+			return nil, err
+		}
+	}
+
+	if s3Dest != nil {
+		if err := storeOutput(ctx, response, convertedData, opts.outputContentType(), s3Dest); err != nil {
+			return nil, err
+		}
+	} else {
+		response["audio"] = base64.StdEncoding.EncodeToString(convertedData)
+	}
+
+	if emailTo != "" {
+		response["email"] = deliverByEmail(emailTo, convertedData, opts.outputFilename(), opts.outputContentType())
+	}
+
+	return response, nil
 }
 
 func processGifToMp4(c *gin.Context) {
 	// Función para manejar errores y responder al cliente
 	handleError := func(statusCode int, err error, source string) {
-		errorMsg := err.Error()
 		fmt.Printf("Error en %s: %v\n", source, err)
-		c.JSON(statusCode, gin.H{"error": errorMsg})
+		respondError(c, statusCode, err)
 	}
 
 	// Función para procesar la conversión y responder al cliente
@@ -522,9 +1141,12 @@ func processGifToMp4(c *gin.Context) {
 			}
 		}()
 
-		convertedData, err := convertGifToMp4(inputData)
+		convertedData, err := convertGifToMp4(c.Request.Context(), inputData)
+		if err == nil {
+			convertedData, err = interceptOutput(c.Request.Context(), "mp4", convertedData)
+		}
 		if err != nil {
-			handleError(http.StatusInternalServerError, err, "conversión")
+			handleError(mediaErrorStatus(err, http.StatusInternalServerError), err, "conversión")
 			return
 		}
 
@@ -536,10 +1158,10 @@ func processGifToMp4(c *gin.Context) {
 		}
 
 		fmt.Printf("Conversión exitosa. Enviando respuesta (%d bytes)\n", len(convertedData))
-		c.JSON(http.StatusOK, gin.H{
+		c.JSON(http.StatusOK, attachDebug(c.Request.Context(), gin.H{
 			"video": base64.StdEncoding.EncodeToString(convertedData),
 			"format": "mp4",
-		})
+		}))
 	}
 
 	// Validar API Key
@@ -554,9 +1176,9 @@ func processGifToMp4(c *gin.Context) {
 	formUrl := c.PostForm("url")
 	if formUrl != "" {
 		fmt.Printf("URL encontrada en form-data: %s\n", formUrl)
-		inputData, err := fetchGifFromURL(formUrl)
+		inputData, err := fetchGifFromURL(c.Request.Context(), formUrl)
 		if err != nil {
-			handleError(http.StatusBadRequest, err, "obtención de GIF (form)")
+			handleError(mediaErrorStatus(err, http.StatusBadRequest), err, "obtención de GIF (form)")
 			return
 		}
 		processConversion(inputData, "form-data")
@@ -567,9 +1189,9 @@ func processGifToMp4(c *gin.Context) {
 	queryUrl := c.Query("url")
 	if queryUrl != "" {
 		fmt.Printf("URL encontrada en query params: %s\n", queryUrl)
-		inputData, err := fetchGifFromURL(queryUrl)
+		inputData, err := fetchGifFromURL(c.Request.Context(), queryUrl)
 		if err != nil {
-			handleError(http.StatusBadRequest, err, "obtención de GIF (query)")
+			handleError(mediaErrorStatus(err, http.StatusBadRequest), err, "obtención de GIF (query)")
 			return
 		}
 		processConversion(inputData, "query params")
@@ -582,9 +1204,9 @@ func processGifToMp4(c *gin.Context) {
 	}
 	if err := c.ShouldBindJSON(&jsonData); err == nil && jsonData.URL != "" {
 		fmt.Printf("URL encontrada en JSON: %s\n", jsonData.URL)
-		inputData, err := fetchGifFromURL(jsonData.URL)
+		inputData, err := fetchGifFromURL(c.Request.Context(), jsonData.URL)
 		if err != nil {
-			handleError(http.StatusBadRequest, err, "obtención de GIF (json)")
+			handleError(mediaErrorStatus(err, http.StatusBadRequest), err, "obtención de GIF (json)")
 			return
 		}
 		processConversion(inputData, "JSON")
@@ -595,7 +1217,7 @@ func processGifToMp4(c *gin.Context) {
 	fmt.Println("No se encontró URL, intentando otros métodos de entrada")
 	inputData, err := getInputData(c)
 	if err != nil {
-		handleError(http.StatusBadRequest, err, "obtención de datos de entrada")
+		handleError(mediaErrorStatus(err, http.StatusBadRequest), err, "obtención de datos de entrada")
 		return
 	}
 	processConversion(inputData, "otros métodos")
@@ -719,20 +1341,20 @@ func probeVideoFormat(inputData []byte) (string, error) {
 	return "other", nil
 }
 
-func convertVideoToMp4(inputData []byte, inputFormat string) ([]byte, error) {
-	fmt.Printf("Iniciando conversión de video %s a MP4 (%d bytes)\n", inputFormat, len(inputData))
+func convertVideoToMp4(ctx context.Context, inputData []byte, opts videoToMp4Options) ([]byte, error) {
+	fmt.Printf("Iniciando conversión de video %s a MP4 (%d bytes)\n", opts.InputFormat, len(inputData))
 
 	// Siempre usar archivos temporales para MP4 porque el formato requiere seeking
 	// que no es posible con pipes
-	return convertVideoToMp4UsingTempFiles(inputData, inputFormat)
+	return convertVideoToMp4UsingTempFiles(ctx, inputData, opts)
 }
 
 // Función para convertir video a MP4 usando archivos temporales
-func convertVideoToMp4UsingTempFiles(inputData []byte, inputFormat string) ([]byte, error) {
+func convertVideoToMp4UsingTempFiles(ctx context.Context, inputData []byte, opts videoToMp4Options) ([]byte, error) {
 	fmt.Println("Usando archivos temporales para la conversión de video a MP4")
 
 	// Crear archivo temporal para entrada
-	inputFile, err := os.CreateTemp("", fmt.Sprintf("input-*.%s", inputFormat))
+	inputFile, err := os.CreateTemp("", fmt.Sprintf("input-*.%s", opts.InputFormat))
 	if err != nil {
 		return nil, fmt.Errorf("error al crear archivo temporal de entrada: %v", err)
 	}
@@ -772,7 +1394,8 @@ func convertVideoToMp4UsingTempFiles(inputData []byte, inputFormat string) ([]by
 
 	// Ejecutar ffmpeg con archivos temporales y forzar la inclusión de una pista de audio
 	// Esto es crucial para solucionar el problema con WhatsApp que rechaza videos con "audioCodec=unknown"
-	cmd := exec.Command("ffmpeg",
+	args := rotationInputArgs(opts.rotation, opts.PreserveRotation)
+	args = append(args,
 		"-i", inputPath,          // Archivo de entrada
 		"-f", "lavfi",            // Formato para filtros
 		"-i", "anullsrc=r=48000:cl=stereo", // Generar una pista de audio silenciosa si no hay audio
@@ -781,11 +1404,32 @@ func convertVideoToMp4UsingTempFiles(inputData []byte, inputFormat string) ([]by
 		"-c:v", "libx264",        // Codec de video
 		"-preset", "ultrafast",   // Preset de codificación más rápido
 		"-crf", "23",             // Calidad de video
-		"-c:a", "aac",            // Codec de audio (importante para WhatsApp)
-		"-b:a", "128k",           // Bitrate de audio
 		"-shortest",              // Usar la duración del stream más corto
-		"-y",                     // Sobrescribir sin preguntar
-		outputPath)               // Archivo de salida
+	)
+	// El audio original no sigue al video acelerado: el timelapse usa la
+	// pista silenciosa
+	if opts.Timelapse != nil {
+		args = append(args, "-map", "0:v:0", "-map", "1:a:0")
+	}
+	// Codec de audio (importante para WhatsApp)
+	args = append(args, opts.audioArgs()...)
+	if opts.TargetDuration > 0 {
+		args = append(args, "-af", atempoFilter(opts.stretchSpeed)+","+exactDurationFilter(opts.TargetDuration),
+			"-t", formatSeconds(opts.TargetDuration))
+	}
+	if opts.Padding != nil {
+		args = append(args, "-af", opts.Padding.audioFilter(), "-t", formatSeconds(opts.Padding.Duration))
+	}
+	args = append(args, rotationOutputArgs(opts.rotation, opts.PreserveRotation)...)
+	args = append(args, encodeMarkerArgs(ctx)...)
+	if len(opts.fitFilters) > 0 {
+		args = append(args, "-vf", strings.Join(opts.fitFilters, ","))
+	}
+	args = append(args, "-y", outputPath)
+	if err := checkFilterArgs(args); err != nil {
+		return nil, err
+	}
+	cmd := ffmpegCommand(ctx, classBatch, args...)
 
 	// Capturar salida de error
 	var errBuffer bytes.Buffer
@@ -822,17 +1466,304 @@ func convertVideoToMp4UsingTempFiles(inputData []byte, inputFormat string) ([]by
 	return outputData, nil
 }
 
+// videoToMp4Options agrupa los parámetros opcionales de /video-to-mp4
+type videoToMp4Options struct {
+	InputFormat string
+	EmailTo     string
+	Async       bool
+	CallbackURL string
+	Binary      bool
+	S3          *s3Destination
+	// PreserveRotation conserva la metadata de rotación en lugar de rotar los píxeles
+	PreserveRotation bool
+	// Preset son las restricciones de resolución/aspecto a cumplir (nil si no hay)
+	PresetName string
+	Preset     *videoPreset
+	// TargetName elige el preset más compatible con una plataforma
+	TargetName string
+	Target     *platformTarget
+	// Aspect recorta a un formato social (1:1, 9:16, 4:5) con la estrategia
+	// Crop (center, focal o smart) y el punto Focus
+	Aspect string
+	Crop   string
+	Focus  focalPoint
+	// Timelapse acelera la grabación (speed_up o frame_step, ver timelapse.go)
+	Timelapse *timelapseOptions
+	// TargetDuration estira o comprime video y audio a una duración exacta
+	// (ver stretch.go)
+	TargetDuration float64
+	// Padding repite el primer o el último cuadro, con silencio en el audio,
+	// hasta una duración exacta (pad_to_duration)
+	Padding *durationPadding
+
+	// AudioParams y aacArgs ajustan la pista AAC de salida (audio_bitrate,
+	// audio_sample_rate, audio_channels, aac_encoder y aac_profile)
+	AudioParams audioParams
+	aacArgs     []string
+	// StreamHash compara el hash del video y el audio decodificados de la
+	// entrada y la salida (stream_hash, ver streamhash.go)
+	StreamHash string
+	// Parallel codifica los videos largos por segmentos a la vez (ver
+	// parallel.go)
+	Parallel bool
+	// FastStart devuelve una vista previa de baja calidad mientras la
+	// conversión completa sigue en segundo plano (ver proxy.go)
+	FastStart bool
+
+	// rotation es la rotación detectada en la entrada, en grados
+	rotation int
+	// fitFilters son los filtros de video que ajustan la entrada al preset
+	fitFilters []string
+	// stretchSource y stretchSpeed son la duración medida y el factor de
+	// velocidad de TargetDuration
+	stretchSource float64
+	stretchSpeed  float64
+}
+
+// hasAudioOptions indica si la petición ajusta la pista de audio
+func (opts videoToMp4Options) hasAudioOptions() bool {
+	return opts.aacArgs != nil || opts.AudioParams.isSet()
+}
+
+// audioArgs son las opciones de la pista AAC: 128k con el codificador del
+// servidor, salvo que la petición las ajuste
+func (opts videoToMp4Options) audioArgs() []string {
+	args := opts.aacArgs
+	if args == nil {
+		args = []string{"-c:a", defaultAACEncoder, "-b:a", "128k"}
+	}
+	return opts.AudioParams.apply(args)
+}
+
+// runVideoToMp4 ejecuta la conversión y devuelve el cuerpo de la respuesta.
+// Se usa tanto en modo síncrono como desde la cola de trabajos.
+func runVideoToMp4(ctx context.Context, inputData []byte, opts videoToMp4Options) (gin.H, error) {
+	result, err := produceVideoMp4(ctx, inputData, opts)
+	if err != nil {
+		return nil, err
+	}
+	outputData, err := interceptOutput(ctx, "mp4", result.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	response := gin.H{"format": "mp4"}
+	if opts.Preset != nil {
+		if opts.PresetName != "" {
+			response["preset"] = opts.PresetName
+		}
+		response["transformations"] = result.Transformations
+	}
+	if opts.Timelapse != nil {
+		response["timelapse"] = opts.Timelapse.describe()
+	}
+	if opts.TargetDuration > 0 {
+		response["time_stretch"] = stretchReport(opts.stretchSource, opts.TargetDuration, opts.stretchSpeed)
+	}
+	if opts.Padding != nil {
+		response["padding"] = opts.Padding.report()
+	}
+	if len(result.Warnings) > 0 {
+		response["warnings"] = result.Warnings
+	}
+	if result.Parallel != nil {
+		response["parallel"] = result.Parallel
+	}
+	if opts.Target != nil {
+		opts.Target.report(response, len(outputData))
+	}
+	if opts.StreamHash != "" {
+		report, err := compareStreamHashes(ctx, opts.StreamHash, inputData, outputData, true)
+		if err != nil {
+			return nil, err
+		}
+		response["stream_hash"] = report
+	}
+	if opts.S3 != nil {
+		if err := storeOutput(ctx, response, outputData, "video/mp4", opts.S3); err != nil {
+			return nil, err
+		}
+	} else {
+		response["video"] = base64.StdEncoding.EncodeToString(outputData)
+	}
+	if opts.EmailTo != "" {
+		response["email"] = deliverByEmail(opts.EmailTo, outputData, "video.mp4", "video/mp4")
+	}
+	return response, nil
+}
+
+// videoMp4Result es el MP4 producido junto con las transformaciones aplicadas
+// (rotación y ajuste al preset) y las advertencias (pérdida de alfa)
+type videoMp4Result struct {
+	Data            []byte
+	Transformations []string
+	Warnings        []string
+	// Parallel informa la conversión por segmentos con parallel=true
+	Parallel *parallelReport
+}
+
+// produceVideoMp4 devuelve el MP4 compatible: la entrada tal cual si ya es un
+// MP4 estándar, o el resultado de convertirla
+func produceVideoMp4(ctx context.Context, inputData []byte, opts videoToMp4Options) (*videoMp4Result, error) {
+	// Detectar el formato del video
+	videoFormat, err := probeVideoFormat(inputData)
+	if err != nil {
+		fmt.Printf("Error en análisis de formato: %v\n", err)
+		return nil, err
+	}
+
+	fmt.Printf("Formato detectado: %s\n", videoFormat)
+
+	// Un MP4 con rotación se recodifica para aplicarla a los píxeles
+	opts.rotation, err = probeRotation(ctx, inputData)
+	if err != nil {
+		fmt.Printf("No se pudo leer la rotación: %v\n", err)
+	}
+	appliedRotation := 0
+	if opts.rotation != 0 {
+		recordDebug(ctx, "rotation", gin.H{"degrees": opts.rotation, "preserved": opts.PreserveRotation})
+		if !opts.PreserveRotation {
+			appliedRotation = opts.rotation
+		}
+	}
+
+	transformations := []string{}
+	if appliedRotation != 0 {
+		transformations = append(transformations, fmt.Sprintf("rotate %d", appliedRotation))
+	}
+
+	// El ajuste al preset se calcula sobre las dimensiones ya rotadas
+	if opts.Preset != nil {
+		width, height, err := probeVideoDimensions(ctx, inputData, appliedRotation)
+		if err != nil {
+			return nil, err
+		}
+		focus := opts.Focus
+		if opts.Crop == cropSmart {
+			if focus, err = detectFocalPoint(ctx, inputData); err != nil {
+				fmt.Printf("Encuadre inteligente no disponible, se centra el recorte: %v\n", err)
+				transformations = append(transformations, "smart framing unavailable, centered")
+			}
+			recordDebug(ctx, "focal_point", focus)
+		}
+		plan := planVideoFit(width, height, *opts.Preset, focus)
+		opts.fitFilters = plan.Filters
+		transformations = append(transformations, plan.Transformations...)
+	}
+
+	// El timelapse va antes del ajuste al preset para escalar menos cuadros
+	if opts.Timelapse != nil {
+		opts.fitFilters = append(opts.Timelapse.filters(), opts.fitFilters...)
+		transformations = append(transformations, "timelapse "+opts.Timelapse.describe())
+	}
+
+	// target_duration reescribe los tiempos de los cuadros; el audio se
+	// ajusta con atempo en la conversión
+	if opts.TargetDuration > 0 {
+		opts.fitFilters = append([]string{"setpts=PTS/" + strconv.FormatFloat(opts.stretchSpeed, 'f', 6, 64)}, opts.fitFilters...)
+		transformations = append(transformations, "time-stretch to "+formatSeconds(opts.TargetDuration)+" s")
+	}
+
+	// pad_to_duration congela el primer o el último cuadro hasta la duración
+	if opts.Padding != nil {
+		opts.fitFilters = append(opts.fitFilters, opts.Padding.videoFilter())
+		transformations = append(transformations, fmt.Sprintf("pad to %s s (%s)", formatSeconds(opts.Padding.Duration), opts.Padding.Position))
+	}
+
+	// Si es un MP4 estándar que ya cumple todo, devolver los datos originales
+	if videoFormat == "video/mp4" && appliedRotation == 0 && len(opts.fitFilters) == 0 && !opts.hasAudioOptions() {
+		fmt.Println("El video ya es un MP4 estándar, devolviendo sin conversión")
+		return &videoMp4Result{Data: inputData, Transformations: transformations}, nil
+	}
+
+	// H.264 no admite alfa: se avisa en lugar de aplanar en silencio
+	var warnings []string
+	if alpha, err := probeVideoAlpha(ctx, inputData); err == nil && alpha.HasAlpha {
+		fmt.Printf("La entrada tiene canal alfa (%s), se aplanará en el MP4\n", alpha.PixFmt)
+		warnings = append(warnings, alphaMP4Warning)
+	}
+
+	// Si tiene el formato problemático o cualquier otro, convertir el video
+	fmt.Println("Convirtiendo video para asegurar compatibilidad con WhatsApp...")
+	var (
+		convertedData []byte
+		parallel      *parallelReport
+	)
+	if opts.Parallel {
+		convertedData, parallel, err = convertVideoToMp4Parallel(ctx, inputData, opts)
+	} else {
+		convertedData, err = convertVideoToMp4(ctx, inputData, opts)
+	}
+	if err != nil {
+		fmt.Printf("Error en conversión: %v\n", err)
+		return nil, err
+	}
+
+	// Verificar el formato después de la conversión
+	if videoFormat == "video/mp4, videoCodec=h264, audioCodec=unknown" {
+		fmt.Println("Verificando que el problema de audioCodec=unknown se haya resuelto...")
+		// Podríamos añadir aquí una verificación adicional si es necesario
+	}
+
+	// Verificar que los datos convertidos no estén vacíos
+	if len(convertedData) == 0 {
+		return nil, errors.New("la conversión produjo un archivo vacío")
+	}
+
+	fmt.Printf("Conversión exitosa (%d bytes)\n", len(convertedData))
+	return &videoMp4Result{Data: convertedData, Transformations: transformations, Warnings: warnings, Parallel: parallel}, nil
+}
+
 func processVideoToMp4(c *gin.Context) {
+	var opts videoToMp4Options
+
 	// Función para manejar errores y responder al cliente
 	handleError := func(statusCode int, err error, source string) {
-		errorMsg := err.Error()
 		fmt.Printf("Error en %s: %v\n", source, err)
-		c.JSON(statusCode, gin.H{"error": errorMsg})
+		respondError(c, statusCode, err)
 	}
 
 	// Función para procesar la conversión y responder al cliente
 	processConversion := func(inputData []byte, inputFormat string, source string) {
 		fmt.Printf("Procesando video %s desde %s (%d bytes)\n", inputFormat, source, len(inputData))
+		opts.InputFormat = inputFormat
+
+		if err := opts.resolve(c.Request.Context()); err != nil {
+			handleError(mediaErrorStatus(err, http.StatusBadRequest), err, "opciones")
+			return
+		}
+
+		// target_duration y pad_to_duration dependen de la duración de la entrada
+		if opts.TargetDuration > 0 {
+			var err error
+			if opts.stretchSource, opts.stretchSpeed, err = stretchSpeed(c.Request.Context(), inputData, opts.TargetDuration); err != nil {
+				handleError(http.StatusUnprocessableEntity, err, "target_duration")
+				return
+			}
+		}
+		if opts.Padding != nil {
+			if err := opts.Padding.plan(c.Request.Context(), inputData, 1); err != nil {
+				handleError(http.StatusUnprocessableEntity, err, "pad_to_duration")
+				return
+			}
+		}
+
+		// En modo asíncrono (o con callback_url) se responde de inmediato con el ID del trabajo
+		if opts.Async || opts.CallbackURL != "" {
+			job, err := submitJob(c.Request.Context(), "video-to-mp4", opts.CallbackURL, inputData, func(ctx context.Context) (gin.H, error) {
+				return runVideoToMp4(ctx, inputData, opts)
+			})
+			if err != nil {
+				handleError(http.StatusServiceUnavailable, err, "encolado")
+				return
+			}
+			if opts.FastStart {
+				respondWithProxy(c, job, "video", inputData, opts.Binary)
+				return
+			}
+			c.JSON(http.StatusAccepted, job.view())
+			return
+		}
 
 		// Implementar recuperación de pánico
 		defer func() {
@@ -844,51 +1775,68 @@ func processVideoToMp4(c *gin.Context) {
 			}
 		}()
 
-		// Detectar el formato del video
-		videoFormat, err := probeVideoFormat(inputData)
-		if err != nil {
-			handleError(http.StatusInternalServerError, err, "análisis de formato")
-			return
-		}
+		// response=binary devuelve el MP4 sin envolverlo en JSON/base64
+		if opts.Binary && opts.S3 == nil {
+			result, err := produceVideoMp4(c.Request.Context(), inputData, opts)
+			if err != nil {
+				handleError(http.StatusInternalServerError, err, "conversión")
+				return
+			}
+			outputData, err := interceptOutput(c.Request.Context(), "mp4", result.Data)
+			if err != nil {
+				handleError(mediaErrorStatus(err, http.StatusInternalServerError), err, "conversión")
+				return
+			}
 
-		fmt.Printf("Formato detectado: %s\n", videoFormat)
+			headers := map[string]string{"X-Format": "mp4"}
+			if opts.Preset != nil {
+				headers["X-Transformations"] = strings.Join(result.Transformations, "; ")
+			}
+			if opts.Timelapse != nil {
+				headers["X-Timelapse"] = opts.Timelapse.describe()
+			}
+			if opts.TargetDuration > 0 {
+				headers["X-Stretch-Speed"] = strconv.FormatFloat(opts.stretchSpeed, 'f', 4, 64)
+			}
+			warnings := result.Warnings
+			if opts.Target != nil {
+				headers["X-Target"] = opts.Target.Name
+				if warning := opts.Target.sizeWarning(len(outputData)); warning != "" {
+					warnings = append(warnings, warning)
+				}
+			}
+			if len(warnings) > 0 {
+				headers["X-Warnings"] = strings.Join(warnings, "; ")
+			}
+			if result.Parallel != nil {
+				headers["X-Parallel-Segments"] = strconv.Itoa(result.Parallel.Segments)
+			}
+			if opts.StreamHash != "" {
+				report, err := compareStreamHashes(c.Request.Context(), opts.StreamHash, inputData, outputData, true)
+				if err != nil {
+					handleError(http.StatusInternalServerError, err, "stream_hash")
+					return
+				}
+				report.headers(headers)
+			}
+			if opts.EmailTo != "" {
+				email := deliverByEmail(opts.EmailTo, outputData, "video.mp4", "video/mp4")
+				c.Set("result_link", resultLink(gin.H{"email": email}))
+				headers["X-Email-Status"] = emailStatusHeader(email)
+			}
 
-		// Si es un MP4 estándar, devolver los datos originales
-		if videoFormat == "video/mp4" {
-			fmt.Println("El video ya es un MP4 estándar, devolviendo sin conversión")
-			c.JSON(http.StatusOK, gin.H{
-				"video": base64.StdEncoding.EncodeToString(inputData),
-				"format": "mp4",
-			})
+			writeBinaryResponse(c, outputData, "video.mp4", "video/mp4", headers)
 			return
 		}
 
-		// Si tiene el formato problemático o cualquier otro, convertir el video
-		fmt.Println("Convirtiendo video para asegurar compatibilidad con WhatsApp...")
-		convertedData, err := convertVideoToMp4(inputData, inputFormat)
+		response, err := runVideoToMp4(c.Request.Context(), inputData, opts)
 		if err != nil {
-			handleError(http.StatusInternalServerError, err, "conversión")
-			return
-		}
-
-		// Verificar el formato después de la conversión
-		if videoFormat == "video/mp4, videoCodec=h264, audioCodec=unknown" {
-			fmt.Println("Verificando que el problema de audioCodec=unknown se haya resuelto...")
-			// Podríamos añadir aquí una verificación adicional si es necesario
-		}
-
-		// Verificar que los datos convertidos no estén vacíos
-		if len(convertedData) == 0 {
-			handleError(http.StatusInternalServerError,
-				errors.New("la conversión produjo un archivo vacío"), "validación de salida")
+			handleError(mediaErrorStatus(err, http.StatusInternalServerError), err, "conversión")
 			return
 		}
 
-		fmt.Printf("Conversión exitosa. Enviando respuesta (%d bytes)\n", len(convertedData))
-		c.JSON(http.StatusOK, gin.H{
-			"video": base64.StdEncoding.EncodeToString(convertedData),
-			"format": "mp4",
-		})
+		c.Set("result_link", resultLink(response))
+		c.JSON(http.StatusOK, attachDebug(c.Request.Context(), response))
 	}
 
 	// Validar API Key
@@ -902,13 +1850,19 @@ func processVideoToMp4(c *gin.Context) {
 	// Obtener formato de entrada
 	inputFormat := c.DefaultPostForm("input_format", "mp4")
 
+	var err error
+	if opts, err = parseVideoToMp4Form(c); err != nil {
+		handleError(mediaErrorStatus(err, http.StatusBadRequest), err, "opciones")
+		return
+	}
+
 	// Verificar si hay una URL en el formulario
 	formUrl := c.PostForm("url")
 	if formUrl != "" {
 		fmt.Printf("URL encontrada en form-data: %s\n", formUrl)
-		inputData, err := fetchAudioFromURL(formUrl) // Reutilizamos la función existente
+		inputData, err := fetchAudioFromURL(c.Request.Context(), formUrl) // Reutilizamos la función existente
 		if err != nil {
-			handleError(http.StatusBadRequest, err, "obtención de video (form)")
+			handleError(mediaErrorStatus(err, http.StatusBadRequest), err, "obtención de video (form)")
 			return
 		}
 		processConversion(inputData, inputFormat, "form-data")
@@ -919,9 +1873,9 @@ func processVideoToMp4(c *gin.Context) {
 	queryUrl := c.Query("url")
 	if queryUrl != "" {
 		fmt.Printf("URL encontrada en query params: %s\n", queryUrl)
-		inputData, err := fetchAudioFromURL(queryUrl)
+		inputData, err := fetchAudioFromURL(c.Request.Context(), queryUrl)
 		if err != nil {
-			handleError(http.StatusBadRequest, err, "obtención de video (query)")
+			handleError(mediaErrorStatus(err, http.StatusBadRequest), err, "obtención de video (query)")
 			return
 		}
 		processConversion(inputData, inputFormat, "query params")
@@ -930,14 +1884,41 @@ func processVideoToMp4(c *gin.Context) {
 
 	// Verificar si hay datos en JSON
 	var jsonData struct {
-		URL         string `json:"url"`
-		InputFormat string `json:"input_format"`
+		URL              string         `json:"url"`
+		InputFormat      string         `json:"input_format"`
+		EmailTo          string         `json:"email_to"`
+		Async            bool           `json:"async"`
+		CallbackURL      string         `json:"callback_url"`
+		Response         string         `json:"response"`
+		S3               *s3Destination `json:"s3"`
+		PreserveRotation bool           `json:"preserve_rotation"`
+		Preset           string         `json:"preset"`
+		Target           string         `json:"target"`
+		Aspect           string         `json:"aspect"`
+		Crop             string         `json:"crop"`
+		FocalX           *float64       `json:"focal_x"`
+		FocalY           *float64       `json:"focal_y"`
+		AudioBitrate     interface{}    `json:"audio_bitrate"`
+		AudioSampleRate  interface{}    `json:"audio_sample_rate"`
+		AudioChannels    interface{}    `json:"audio_channels"`
+		AACEncoder       string         `json:"aac_encoder"`
+		AACProfile       string         `json:"aac_profile"`
+		SpeedUp          interface{}    `json:"speed_up"`
+		FrameStep        interface{}    `json:"frame_step"`
+		TimelapseFPS     interface{}    `json:"timelapse_fps"`
+		Deflicker        bool           `json:"deflicker"`
+		TargetDuration   interface{}    `json:"target_duration"`
+		PadToDuration    interface{}    `json:"pad_to_duration"`
+		PadPosition      string         `json:"pad_position"`
+		StreamHash       string         `json:"stream_hash"`
+		Parallel         bool           `json:"parallel"`
+		FastStart        bool           `json:"fast_start"`
 	}
 	if err := c.ShouldBindJSON(&jsonData); err == nil && jsonData.URL != "" {
 		fmt.Printf("URL encontrada en JSON: %s\n", jsonData.URL)
-		inputData, err := fetchAudioFromURL(jsonData.URL)
+		inputData, err := fetchAudioFromURL(c.Request.Context(), jsonData.URL)
 		if err != nil {
-			handleError(http.StatusBadRequest, err, "obtención de video (json)")
+			handleError(mediaErrorStatus(err, http.StatusBadRequest), err, "obtención de video (json)")
 			return
 		}
 
@@ -945,6 +1926,92 @@ func processVideoToMp4(c *gin.Context) {
 		if jsonData.InputFormat != "" {
 			inputFormat = jsonData.InputFormat
 		}
+		if jsonData.EmailTo != "" {
+			opts.EmailTo = jsonData.EmailTo
+		}
+		opts.Async = opts.Async || jsonData.Async
+		opts.PreserveRotation = opts.PreserveRotation || jsonData.PreserveRotation
+		opts.Parallel = opts.Parallel || jsonData.Parallel
+		opts.FastStart = opts.FastStart || jsonData.FastStart
+		if jsonData.Preset != "" {
+			opts.PresetName = jsonData.Preset
+		}
+		if jsonData.Target != "" {
+			opts.TargetName = jsonData.Target
+		}
+		if jsonData.Aspect != "" || jsonData.Crop != "" {
+			if jsonData.Aspect != "" {
+				opts.Aspect = jsonData.Aspect
+			}
+			if jsonData.Crop != "" {
+				opts.Crop = jsonData.Crop
+			}
+			focalX, focalY := c.PostForm("focal_x"), c.PostForm("focal_y")
+			if jsonData.FocalX != nil && jsonData.FocalY != nil {
+				focalX = strconv.FormatFloat(*jsonData.FocalX, 'f', -1, 64)
+				focalY = strconv.FormatFloat(*jsonData.FocalY, 'f', -1, 64)
+			}
+			if opts.Focus, err = validateFraming(opts.Aspect, opts.Crop, focalX, focalY); err != nil {
+				handleError(http.StatusBadRequest, err, "aspect (json)")
+				return
+			}
+		}
+		if jsonData.AudioBitrate != nil || jsonData.AudioSampleRate != nil || jsonData.AudioChannels != nil ||
+			jsonData.AACEncoder != "" || jsonData.AACProfile != "" {
+			if opts.AudioParams, opts.aacArgs, err = parseVideoAudioOptions(jsonScalar(jsonData.AudioBitrate), jsonScalar(jsonData.AudioSampleRate),
+				jsonScalar(jsonData.AudioChannels), jsonData.AACEncoder, jsonData.AACProfile); err != nil {
+				handleError(http.StatusBadRequest, err, "audio (json)")
+				return
+			}
+		}
+		if jsonData.SpeedUp != nil || jsonData.FrameStep != nil {
+			if opts.Timelapse, err = parseTimelapse(jsonScalar(jsonData.SpeedUp), jsonScalar(jsonData.FrameStep),
+				jsonScalar(jsonData.TimelapseFPS), strconv.FormatBool(jsonData.Deflicker)); err != nil {
+				handleError(http.StatusBadRequest, err, "timelapse (json)")
+				return
+			}
+		}
+		if jsonData.TargetDuration != nil {
+			if opts.TargetDuration, err = parseTargetDuration(jsonScalar(jsonData.TargetDuration)); err != nil {
+				handleError(http.StatusBadRequest, err, "target_duration (json)")
+				return
+			}
+		}
+		if jsonData.PadToDuration != nil {
+			if opts.Padding, err = parseDurationPadding(jsonScalar(jsonData.PadToDuration), jsonData.PadPosition); err != nil {
+				handleError(http.StatusBadRequest, err, "pad_to_duration (json)")
+				return
+			}
+		}
+		if jsonData.StreamHash != "" {
+			if opts.StreamHash, err = parseStreamHash(jsonData.StreamHash); err != nil {
+				handleError(http.StatusBadRequest, err, "stream_hash (json)")
+				return
+			}
+		}
+		if jsonData.CallbackURL != "" {
+			opts.CallbackURL = jsonData.CallbackURL
+		}
+		if jsonData.Response != "" {
+			opts.Binary = wantsBinaryResponse(c, jsonData.Response)
+		}
+		if jsonData.S3 != nil {
+			dest, err := jsonData.S3.validate()
+			if err == nil {
+				err = checkStorageResidency(c, dest)
+			}
+			if err == nil {
+				err = checkTokenStorage(c.Request.Context(), dest)
+			}
+			if err == nil {
+				err = applyTenantNamespace(c, dest)
+			}
+			if err != nil {
+				handleError(mediaErrorStatus(err, http.StatusBadRequest), err, "s3 (json)")
+				return
+			}
+			opts.S3 = dest
+		}
 
 		processConversion(inputData, inputFormat, "JSON")
 		return
@@ -954,21 +2021,21 @@ func processVideoToMp4(c *gin.Context) {
 	fmt.Println("No se encontró URL, intentando otros métodos de entrada")
 	inputData, err := getInputData(c)
 	if err != nil {
-		handleError(http.StatusBadRequest, err, "obtención de datos de entrada")
+		handleError(mediaErrorStatus(err, http.StatusBadRequest), err, "obtención de datos de entrada")
 		return
 	}
 	processConversion(inputData, inputFormat, "otros métodos")
 }
 
-func convertImageToPng(inputData []byte) ([]byte, error) {
+func convertImageToPng(ctx context.Context, inputData []byte) ([]byte, error) {
 	fmt.Printf("Iniciando conversión de imagen a PNG (%d bytes)\n", len(inputData))
 
 	// Siempre usar archivos temporales para la conversión de imágenes
-	return convertImageToPngUsingTempFiles(inputData)
+	return convertImageToPngUsingTempFiles(ctx, inputData)
 }
 
 // Función para convertir imagen a PNG usando archivos temporales
-func convertImageToPngUsingTempFiles(inputData []byte) ([]byte, error) {
+func convertImageToPngUsingTempFiles(ctx context.Context, inputData []byte) ([]byte, error) {
 	fmt.Println("Usando archivos temporales para la conversión de imagen a PNG")
 
 	// Crear archivo temporal para entrada sin extensión específica
@@ -1012,7 +2079,7 @@ func convertImageToPngUsingTempFiles(inputData []byte) ([]byte, error) {
 	fmt.Printf("Archivo de entrada verificado: %s (tamaño: %d bytes)\n", inputPath, inputInfo.Size())
 
 	// Configurar comando ffmpeg para convertir a PNG
-	cmd := exec.Command("ffmpeg",
+	cmd := ffmpegCommand(ctx, classInteractive,
 		"-i", inputPath,          // Archivo de entrada
 		"-f", "image2",           // Formato de imagen
 		"-c:v", "png",            // Codec PNG
@@ -1054,19 +2121,26 @@ func convertImageToPngUsingTempFiles(inputData []byte) ([]byte, error) {
 	return outputData, nil
 }
 
-func fetchImageFromURL(url string) ([]byte, error) {
+func fetchImageFromURL(ctx context.Context, url string) ([]byte, error) {
 	if url == "" {
 		return nil, errors.New("URL vacía proporcionada")
 	}
 
+	if isCloudURI(url) {
+		return fetchCloudInput(ctx, url)
+	}
+
 	fmt.Printf("Intentando descargar imagen desde: %s\n", url)
 
 	// Configurar un cliente HTTP con timeout
-	client := &http.Client{
+	client, err := inputClient(ctx, &http.Client{
 		Timeout: 30 * time.Second,
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("error al crear solicitud: %v", err)
 	}
@@ -1074,26 +2148,15 @@ func fetchImageFromURL(url string) ([]byte, error) {
 	// Agregar User-Agent para evitar restricciones
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
 
-	resp, err := client.Do(req)
+	statusCode, data, err := doCachedRequest(client, req)
 	if err != nil {
-		return nil, fmt.Errorf("error al acceder URL: %v", err)
+		return nil, fmt.Errorf("error al acceder URL: %w", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("estado de respuesta inválido: %d", resp.StatusCode)
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("estado de respuesta inválido: %d", statusCode)
 	}
 
-	fmt.Printf("Descarga iniciada. Content-Length: %s\n", resp.Header.Get("Content-Length"))
-
-	// Leer con un buffer para evitar problemas de memoria
-	var buffer bytes.Buffer
-	_, err = io.Copy(&buffer, resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("error al leer datos: %v", err)
-	}
-
-	data := buffer.Bytes()
 	fmt.Printf("Descarga completada. Tamaño: %d bytes\n", len(data))
 
 	return data, nil
@@ -1102,9 +2165,8 @@ func fetchImageFromURL(url string) ([]byte, error) {
 func processImageToPng(c *gin.Context) {
 	// Función para manejar errores y responder al cliente
 	handleError := func(statusCode int, err error, source string) {
-		errorMsg := err.Error()
 		fmt.Printf("Error en %s: %v\n", source, err)
-		c.JSON(statusCode, gin.H{"error": errorMsg})
+		respondError(c, statusCode, err)
 	}
 
 	// Función para procesar la conversión y responder al cliente
@@ -1121,9 +2183,12 @@ func processImageToPng(c *gin.Context) {
 			}
 		}()
 
-		convertedData, err := convertImageToPng(inputData)
+		convertedData, err := convertImageToPng(c.Request.Context(), inputData)
+		if err == nil {
+			convertedData, err = interceptOutput(c.Request.Context(), "png", convertedData)
+		}
 		if err != nil {
-			handleError(http.StatusInternalServerError, err, "conversión")
+			handleError(mediaErrorStatus(err, http.StatusInternalServerError), err, "conversión")
 			return
 		}
 
@@ -1135,10 +2200,10 @@ func processImageToPng(c *gin.Context) {
 		}
 
 		fmt.Printf("Conversión exitosa. Enviando respuesta (%d bytes)\n", len(convertedData))
-		c.JSON(http.StatusOK, gin.H{
+		c.JSON(http.StatusOK, attachDebug(c.Request.Context(), gin.H{
 			"image":  base64.StdEncoding.EncodeToString(convertedData),
 			"format": "png",
-		})
+		}))
 	}
 
 	// Validar API Key
@@ -1153,9 +2218,9 @@ func processImageToPng(c *gin.Context) {
 	formUrl := c.PostForm("url")
 	if formUrl != "" {
 		fmt.Printf("URL encontrada en form-data: %s\n", formUrl)
-		inputData, err := fetchImageFromURL(formUrl)
+		inputData, err := fetchImageFromURL(c.Request.Context(), formUrl)
 		if err != nil {
-			handleError(http.StatusBadRequest, err, "obtención de imagen (form)")
+			handleError(mediaErrorStatus(err, http.StatusBadRequest), err, "obtención de imagen (form)")
 			return
 		}
 		processConversion(inputData, "form-data")
@@ -1166,9 +2231,9 @@ func processImageToPng(c *gin.Context) {
 	queryUrl := c.Query("url")
 	if queryUrl != "" {
 		fmt.Printf("URL encontrada en query params: %s\n", queryUrl)
-		inputData, err := fetchImageFromURL(queryUrl)
+		inputData, err := fetchImageFromURL(c.Request.Context(), queryUrl)
 		if err != nil {
-			handleError(http.StatusBadRequest, err, "obtención de imagen (query)")
+			handleError(mediaErrorStatus(err, http.StatusBadRequest), err, "obtención de imagen (query)")
 			return
 		}
 		processConversion(inputData, "query params")
@@ -1181,9 +2246,9 @@ func processImageToPng(c *gin.Context) {
 	}
 	if err := c.ShouldBindJSON(&jsonData); err == nil && jsonData.URL != "" {
 		fmt.Printf("URL encontrada en JSON: %s\n", jsonData.URL)
-		inputData, err := fetchImageFromURL(jsonData.URL)
+		inputData, err := fetchImageFromURL(c.Request.Context(), jsonData.URL)
 		if err != nil {
-			handleError(http.StatusBadRequest, err, "obtención de imagen (json)")
+			handleError(mediaErrorStatus(err, http.StatusBadRequest), err, "obtención de imagen (json)")
 			return
 		}
 		processConversion(inputData, "JSON")
@@ -1194,7 +2259,7 @@ func processImageToPng(c *gin.Context) {
 	fmt.Println("No se encontró URL, intentando otros métodos de entrada")
 	inputData, err := getInputData(c)
 	if err != nil {
-		handleError(http.StatusBadRequest, err, "obtención de datos de entrada")
+		handleError(mediaErrorStatus(err, http.StatusBadRequest), err, "obtención de datos de entrada")
 		return
 	}
 	processConversion(inputData, "otros métodos")
@@ -1209,26 +2274,26 @@ const (
 
 // extractVideoFrame extrae un único frame del video como JPEG.
 // Intenta primero en el segundo 1 y, si falla, reintenta en el segundo 0.5.
-func extractVideoFrame(inputData []byte) ([]byte, error) {
+func extractVideoFrame(ctx context.Context, inputData []byte) ([]byte, error) {
 	fmt.Printf("Iniciando extracción de frame de video (%d bytes)\n", len(inputData))
 
 	if len(inputData) == 0 {
 		return nil, errors.New("datos de entrada vacíos")
 	}
 
-	frame, err := extractVideoFrameAtOffset(inputData, frameOffsetPrimarySeconds)
+	frame, err := extractVideoFrameAtOffset(ctx, inputData, frameOffsetPrimarySeconds)
 	if err == nil {
 		return frame, nil
 	}
 
 	fmt.Printf("Fallo extracción en %ss, reintentando en %ss: %v\n",
 		frameOffsetPrimarySeconds, frameOffsetFallbackSeconds, err)
-	return extractVideoFrameAtOffset(inputData, frameOffsetFallbackSeconds)
+	return extractVideoFrameAtOffset(ctx, inputData, frameOffsetFallbackSeconds)
 }
 
 // extractVideoFrameAtOffset corre ffmpeg sobre un archivo temporal y devuelve
 // el frame ubicado en offsetSeconds. El seek va antes de -i para que sea rápido.
-func extractVideoFrameAtOffset(inputData []byte, offsetSeconds string) ([]byte, error) {
+func extractVideoFrameAtOffset(ctx context.Context, inputData []byte, offsetSeconds string) ([]byte, error) {
 	inputFile, err := os.CreateTemp("", "frame-input-*")
 	if err != nil {
 		return nil, fmt.Errorf("error al crear archivo temporal de entrada: %v", err)
@@ -1252,11 +2317,10 @@ func extractVideoFrameAtOffset(inputData []byte, offsetSeconds string) ([]byte,
 	outputFile.Close()
 	defer os.Remove(outputPath)
 
-	ctx, cancel := context.WithTimeout(context.Background(), frameExtractionTimeout)
+	ctx, cancel := context.WithTimeout(ctx, frameExtractionTimeout)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx,
-		"ffmpeg",
+	cmd := ffmpegCommand(ctx, classInteractive,
 		"-ss", offsetSeconds, // seek antes de -i: rápido, por keyframe
 		"-i", inputPath,
 		"-frames:v", "1", // un solo frame
@@ -1285,7 +2349,7 @@ func extractVideoFrameAtOffset(inputData []byte, offsetSeconds string) ([]byte,
 	}
 
 	if len(outputData) > maxFrameBytes {
-		return nil, fmt.Errorf("el frame supera el tamaño máximo permitido (%d bytes)", maxFrameBytes)
+		return nil, inputOutOfRange("el frame supera el tamaño máximo permitido (%d bytes)", maxFrameBytes)
 	}
 
 	return outputData, nil
@@ -1294,7 +2358,7 @@ func extractVideoFrameAtOffset(inputData []byte, offsetSeconds string) ([]byte,
 func processVideoToFrame(c *gin.Context) {
 	handleError := func(statusCode int, err error, source string) {
 		fmt.Printf("Error en %s: %v\n", source, err)
-		c.JSON(statusCode, gin.H{"error": err.Error()})
+		respondError(c, statusCode, err)
 	}
 
 	processExtraction := func(inputData []byte, source string) {
@@ -1309,17 +2373,20 @@ func processVideoToFrame(c *gin.Context) {
 			}
 		}()
 
-		frameData, err := extractVideoFrame(inputData)
+		frameData, err := extractVideoFrame(c.Request.Context(), inputData)
+		if err == nil {
+			frameData, err = interceptOutput(c.Request.Context(), "jpeg", frameData)
+		}
 		if err != nil {
-			handleError(http.StatusInternalServerError, err, "extracción")
+			handleError(mediaErrorStatus(err, http.StatusInternalServerError), err, "extracción")
 			return
 		}
 
 		fmt.Printf("Extracción exitosa. Enviando frame (%d bytes)\n", len(frameData))
-		c.JSON(http.StatusOK, gin.H{
+		c.JSON(http.StatusOK, attachDebug(c.Request.Context(), gin.H{
 			"image":  base64.StdEncoding.EncodeToString(frameData),
 			"format": "jpeg",
-		})
+		}))
 	}
 
 	if !validateAPIKey(c) {
@@ -1330,9 +2397,9 @@ func processVideoToFrame(c *gin.Context) {
 
 	formUrl := c.PostForm("url")
 	if formUrl != "" {
-		inputData, err := fetchAudioFromURL(formUrl)
+		inputData, err := fetchAudioFromURL(c.Request.Context(), formUrl)
 		if err != nil {
-			handleError(http.StatusBadRequest, err, "obtención de video (form)")
+			handleError(mediaErrorStatus(err, http.StatusBadRequest), err, "obtención de video (form)")
 			return
 		}
 		processExtraction(inputData, "form-data")
@@ -1341,9 +2408,9 @@ func processVideoToFrame(c *gin.Context) {
 
 	queryUrl := c.Query("url")
 	if queryUrl != "" {
-		inputData, err := fetchAudioFromURL(queryUrl)
+		inputData, err := fetchAudioFromURL(c.Request.Context(), queryUrl)
 		if err != nil {
-			handleError(http.StatusBadRequest, err, "obtención de video (query)")
+			handleError(mediaErrorStatus(err, http.StatusBadRequest), err, "obtención de video (query)")
 			return
 		}
 		processExtraction(inputData, "query params")
@@ -1354,9 +2421,9 @@ func processVideoToFrame(c *gin.Context) {
 		URL string `json:"url"`
 	}
 	if err := c.ShouldBindJSON(&jsonData); err == nil && jsonData.URL != "" {
-		inputData, err := fetchAudioFromURL(jsonData.URL)
+		inputData, err := fetchAudioFromURL(c.Request.Context(), jsonData.URL)
 		if err != nil {
-			handleError(http.StatusBadRequest, err, "obtención de video (json)")
+			handleError(mediaErrorStatus(err, http.StatusBadRequest), err, "obtención de video (json)")
 			return
 		}
 		processExtraction(inputData, "JSON")
@@ -1365,13 +2432,23 @@ func processVideoToFrame(c *gin.Context) {
 
 	inputData, err := getInputData(c)
 	if err != nil {
-		handleError(http.StatusBadRequest, err, "obtención de datos de entrada")
+		handleError(mediaErrorStatus(err, http.StatusBadRequest), err, "obtención de datos de entrada")
 		return
 	}
 	processExtraction(inputData, "otros métodos")
 }
 
 func main() {
+	flag.Parse()
+	setup()
+
+	if args := flag.Args(); len(args) > 0 && args[0] == "bench" {
+		os.Exit(runBench(args[1:]))
+	}
+	if args := flag.Args(); len(args) > 0 && args[0] == "decrypt" {
+		os.Exit(runDecrypt(args[1:]))
+	}
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
@@ -1382,17 +2459,69 @@ func main() {
 	config := cors.DefaultConfig()
 	config.AllowOrigins = allowedOrigins
 	config.AllowMethods = []string{"POST", "GET", "OPTIONS"}
-	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "apikey"}
+	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "apikey", "X-Response-Case"}
 	config.AllowCredentials = true
 
 	router.Use(cors.New(config))
 	router.Use(originMiddleware())
-
-	router.POST("/process-audio", processAudio)
-	router.POST("/gif-to-mp4", processGifToMp4)
-	router.POST("/video-to-mp4", processVideoToMp4)
-	router.POST("/convert-image-to-png", processImageToPng)
-	router.POST("/video-to-frame", processVideoToFrame)
+	router.Use(responseCaseMiddleware())
+	router.Use(verbosityMiddleware())
+
+	conversions := router.Group("/", tokenMiddleware(), apiKeyMiddleware(), requestMiddleware(), notifyMiddleware(), quarantineMiddleware(), debugCaptureMiddleware())
+	conversions.POST("/process-audio", processAudio)
+	conversions.POST("/gif-to-mp4", processGifToMp4)
+	conversions.POST("/video-to-mp4", processVideoToMp4)
+	conversions.POST("/convert-image-to-png", processImageToPng)
+	conversions.POST("/video-to-frame", processVideoToFrame)
+	conversions.POST("/split-cue", processSplitCue)
+	conversions.POST("/probe", processProbe)
+	conversions.POST("/transparent-video", processTransparentVideo)
+	conversions.POST("/video-to-gif", processVideoToGif)
+	conversions.POST("/ops/:name", processOperation)
+	conversions.POST("/extract-cover", processExtractCover)
+	conversions.POST("/waveform-image", processWaveformImage)
+	conversions.POST("/spectrogram", processSpectrogram)
+	conversions.POST("/extract-audio", processExtractAudio)
+	conversions.POST("/replace-audio", processReplaceAudio)
+	conversions.POST("/mix-audio", processMixAudio)
+	conversions.POST("/analyze-loudness", processAnalyzeLoudness)
+	conversions.POST("/stitch-video", processStitchVideo)
+	conversions.POST("/frames-to-video", processFramesToVideo)
+	conversions.POST("/detect-silence", processDetectSilence)
+	conversions.POST("/split-audio", processSplitAudio)
+	conversions.POST("/motion-clips", processMotionClips)
+	conversions.POST("/analyze-music", processAnalyzeMusic)
+	conversions.POST("/transcribe", processTranscribe)
+	conversions.POST("/generate-subtitles", processGenerateSubtitles)
+	conversions.POST("/vad", processVAD)
+	conversions.POST("/generate-tone", processGenerateTone)
+	conversions.POST("/storyboard", processStoryboard)
+
+	router.GET("/downloads/:id", serveDownload)
+	router.GET("/metrics", serveMetrics)
+	router.GET("/jobs/:id", getJobStatus)
+	router.GET("/jobs/:id/events", streamJobEvents)
+	router.DELETE("/jobs/:id/result", deleteJobResultHandler)
+	router.GET("/ready", serveReady)
+	router.GET("/ops", listOperations)
+	router.GET("/admin/quarantine", listQuarantine)
+	router.DELETE("/admin/quarantine/:sha256", releaseQuarantine)
+	router.GET("/admin/debug-captures", listDebugCaptures)
+	router.GET("/admin/debug-captures/:id", getDebugCapture)
+	router.GET("/admin/debug-captures/:id/inputs/:index", downloadDebugCaptureInput)
+	router.DELETE("/admin/debug-captures/:id", deleteDebugCapture)
+	router.POST("/admin/selftest", processSelfTest)
+	router.POST("/admin/purge", purgeResults)
+	router.POST("/admin/reload", processReload)
+	router.POST("/admin/encode-segment", processEncodeSegment)
+	router.POST("/tokens", createToken)
+
+	go cleanupExpiredDownloads()
+	go cleanupInputCache()
+	go cleanupQuarantine()
+	startJobWorkers()
+	startSelfTest()
+	watchReloadSignal()
 
 	router.Run(":" + port)
 }
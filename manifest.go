@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/gin-gonic/gin"
+)
+
+// artifactChecksum es el sha256 en hexadecimal de un artefacto
+func artifactChecksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// artifactManifest lista el tamaño y el sha256 de cada artefacto de una
+// respuesta con varias salidas, para verificarlos después de transferirlos
+type artifactManifest struct {
+	Algorithm string             `json:"algorithm"`
+	Artifacts []manifestArtifact `json:"artifacts"`
+}
+
+type manifestArtifact struct {
+	Name   string `json:"name"`
+	Format string `json:"format"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+	URL    string `json:"url,omitempty"`
+}
+
+func newArtifactManifest() *artifactManifest {
+	return &artifactManifest{Algorithm: "sha256", Artifacts: []manifestArtifact{}}
+}
+
+// add registra un artefacto y copia size y sha256 a su entrada en la respuesta
+func (m *artifactManifest) add(result gin.H, name, format string, data []byte) {
+	artifact := manifestArtifact{
+		Name:   name,
+		Format: format,
+		Size:   len(data),
+		SHA256: artifactChecksum(data),
+	}
+	if url, ok := result["url"].(string); ok {
+		artifact.URL = url
+	}
+	result["size"] = artifact.Size
+	result["sha256"] = artifact.SHA256
+	m.Artifacts = append(m.Artifacts, artifact)
+}
+
+// store sube el manifiesto junto a las salidas en S3, con {format} o la
+// extensión reemplazados por manifest.json, y agrega su URL
+func (m *artifactManifest) store(ctx context.Context, response gin.H, dest *s3Destination) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	manifestDest := dest.forOutput("manifest.json")
+	url, err := uploadToS3(ctx, manifestDest, data, "application/json")
+	if err != nil {
+		return err
+	}
+	response["manifest_url"] = url
+	return nil
+}
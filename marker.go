@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// encodeMarkerPrefix identifica las salidas del servicio en la etiqueta
+// encoder; le sigue la generación (1 para la primera conversión)
+const encodeMarkerPrefix = "evolution-audio-converter gen="
+
+var (
+	// encodeMarkerEnabled escribe la marca en las salidas y la busca en las
+	// entradas; encodeMarkerMode decide qué hacer al encontrarla (warn o reject)
+	encodeMarkerEnabled bool
+	encodeMarkerMode    string
+)
+
+func loadMarkerConfig() {
+	encodeMarkerEnabled = envBool("ENCODE_MARKER", false)
+	encodeMarkerMode = strings.ToLower(strings.TrimSpace(os.Getenv("ENCODE_MARKER_MODE")))
+	if encodeMarkerMode != "reject" {
+		encodeMarkerMode = "warn"
+	}
+}
+
+// alreadyProcessedError rechaza una entrada que ya es una salida del servicio
+type alreadyProcessedError struct {
+	Generation int
+}
+
+func (e *alreadyProcessedError) Error() string {
+	return fmt.Sprintf("la entrada ya fue convertida por este servicio (generación %d); envíe allow_reencode=true para convertirla de nuevo", e.Generation)
+}
+
+// readEncodeMarker devuelve la generación de la marca de la entrada, o 0 si
+// no la tiene. Se miran las etiquetas del contenedor y de cada pista: OGG
+// guarda los Vorbis comments en la pista.
+func readEncodeMarker(ctx context.Context, data []byte) int {
+	_, probe, err := probeMedia(ctx, data)
+	if err != nil {
+		return 0
+	}
+	tagSets := []map[string]string{probe.Format.Tags}
+	for _, stream := range probe.Streams {
+		tagSets = append(tagSets, stream.Tags)
+	}
+	for _, tags := range tagSets {
+		for key, value := range tags {
+			if !strings.EqualFold(key, "encoder") {
+				continue
+			}
+			if generation, ok := strings.CutPrefix(value, encodeMarkerPrefix); ok {
+				if parsed, err := strconv.Atoi(generation); err == nil && parsed > 0 {
+					return parsed
+				}
+			}
+		}
+	}
+	return 0
+}
+
+// checkEncodeMarker busca la marca en una entrada recién leída. En modo warn
+// solo se informa con X-Input-Generation; en modo reject se responde 409
+// salvo que la solicitud pida allow_reencode=true.
+func checkEncodeMarker(c *gin.Context, info *requestInfo, data []byte) error {
+	if !encodeMarkerEnabled {
+		return nil
+	}
+	generation := readEncodeMarker(c.Request.Context(), data)
+	if generation == 0 {
+		return nil
+	}
+	if generation > info.Generation {
+		info.Generation = generation
+	}
+	fmt.Printf("[marker] Entrada ya convertida por el servicio (generación %d) en %s\n", generation, info.Endpoint)
+	recordDebug(c.Request.Context(), "input_generation", generation)
+	c.Header("X-Input-Generation", strconv.Itoa(info.Generation))
+
+	if encodeMarkerMode == "reject" && c.PostForm("allow_reencode") != "true" {
+		return &alreadyProcessedError{Generation: generation}
+	}
+	return nil
+}
+
+// encodeMarkerArgs escriben la marca en la salida con la generación
+// siguiente a la de la entrada
+func encodeMarkerArgs(ctx context.Context) []string {
+	if !encodeMarkerEnabled {
+		return nil
+	}
+	generation := requestInfoFrom(ctx).Generation + 1
+	return []string{"-metadata", "encoder=" + encodeMarkerPrefix + strconv.Itoa(generation)}
+}
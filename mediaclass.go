@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Clases de medio que se distinguen para orientar al cliente
+const (
+	mediaAudio     = "audio"
+	mediaVideo     = "video"
+	mediaImage     = "image"
+	mediaAnimation = "animated_image"
+	mediaUnknown   = "unknown"
+)
+
+// mediaClassEndpoints es el endpoint que corresponde a cada clase
+var mediaClassEndpoints = map[string]string{
+	mediaAudio:     "/process-audio",
+	mediaVideo:     "/video-to-mp4",
+	mediaImage:     "/convert-image-to-png",
+	mediaAnimation: "/gif-to-mp4",
+}
+
+// mediaMismatchError indica que la entrada no es del tipo que espera el endpoint
+type mediaMismatchError struct {
+	Detected string
+	Endpoint string
+}
+
+func (e *mediaMismatchError) Error() string {
+	return fmt.Sprintf("la entrada es de tipo %s; use %s (o auto=true)", e.Detected, e.Endpoint)
+}
+
+// sniffImageClass reconoce las imágenes por su firma, sin lanzar ffprobe
+func sniffImageClass(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")),
+		bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}),
+		bytes.HasPrefix(data, []byte("BM")),
+		bytes.HasPrefix(data, []byte("II*\x00")),
+		bytes.HasPrefix(data, []byte("MM\x00*")):
+		return mediaImage
+	case bytes.HasPrefix(data, []byte("GIF8")):
+		return mediaAnimation
+	case len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return mediaImage
+	case len(data) >= 12 && string(data[4:8]) == "ftyp" && (string(data[8:12]) == "heic" || string(data[8:12]) == "mif1" || string(data[8:12]) == "avif"):
+		return mediaImage
+	}
+	return ""
+}
+
+// detectMediaClass clasifica la entrada por su firma o, si no es una imagen
+// conocida, con ffprobe. Una pista de video que es solo la carátula de un
+// audio no cuenta como video.
+func detectMediaClass(ctx context.Context, data []byte) string {
+	if class := sniffImageClass(data); class != "" {
+		return class
+	}
+
+	_, probe, err := probeMedia(ctx, data)
+	if err != nil {
+		return mediaUnknown
+	}
+	hasAudio, hasVideo := false, false
+	for _, stream := range probe.Streams {
+		switch {
+		case stream.CodecType == "audio":
+			hasAudio = true
+		case stream.CodecType == "video" && stream.Disposition.AttachedPic == 0:
+			hasVideo = true
+		}
+	}
+	switch {
+	case hasVideo:
+		return mediaVideo
+	case hasAudio:
+		return mediaAudio
+	}
+	return mediaUnknown
+}
+
+// checkAudioInput rechaza en /process-audio las imágenes, que se reconocen
+// por su firma sin costo. El resto de los desajustes se diagnostica con
+// explainMediaMismatch cuando la conversión falla.
+func checkAudioInput(data []byte) error {
+	if class := sniffImageClass(data); class != "" {
+		return &mediaMismatchError{Detected: class, Endpoint: mediaClassEndpoints[class]}
+	}
+	return nil
+}
+
+// explainMediaMismatch sondea la entrada tras un error de conversión y, si
+// no contiene audio, lo reemplaza por uno que nombra el tipo detectado
+func explainMediaMismatch(ctx context.Context, data []byte, err error) error {
+	if err == nil {
+		return nil
+	}
+	switch class := detectMediaClass(ctx, data); class {
+	case mediaImage, mediaAnimation:
+		return &mediaMismatchError{Detected: class, Endpoint: mediaClassEndpoints[class]}
+	}
+	return err
+}
+
+// mediaMismatchResponse responde 415 con el tipo detectado y el endpoint
+// correcto. Devuelve false si err no es un desajuste de tipo.
+func mediaMismatchResponse(c *gin.Context, err error) bool {
+	var mismatch *mediaMismatchError
+	if !errors.As(err, &mismatch) {
+		return false
+	}
+	c.JSON(http.StatusUnsupportedMediaType, gin.H{
+		"error":              mismatch.Error(),
+		"detected_type":      mismatch.Detected,
+		"suggested_endpoint": mismatch.Endpoint,
+	})
+	return true
+}
+
+// processAsDetectedClass convierte con el pipeline de la clase detectada
+// (auto=true) y devuelve el cuerpo que daría ese endpoint
+func processAsDetectedClass(ctx context.Context, data []byte, class string) (gin.H, error) {
+	var response gin.H
+	switch class {
+	case mediaImage:
+		converted, err := convertImageToPng(ctx, data)
+		if err == nil {
+			converted, err = interceptOutput(ctx, "png", converted)
+		}
+		if err != nil {
+			return nil, err
+		}
+		response = gin.H{"image": base64.StdEncoding.EncodeToString(converted), "format": "png"}
+	case mediaAnimation:
+		converted, err := convertGifToMp4(ctx, data)
+		if err == nil {
+			converted, err = interceptOutput(ctx, "mp4", converted)
+		}
+		if err != nil {
+			return nil, err
+		}
+		response = gin.H{"video": base64.StdEncoding.EncodeToString(converted), "format": "mp4"}
+	default:
+		return nil, fmt.Errorf("no hay un pipeline automático para %s", class)
+	}
+
+	response["detected_type"] = class
+	response["processed_as"] = mediaClassEndpoints[class]
+	return response, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// metadataTagKeys son los campos aceptados en metadata y la clave de
+// -metadata que ffmpeg traduce a cada contenedor (ID3 en MP3, átomos en M4A,
+// Vorbis comments en OGG/FLAC, INFO en WAV)
+var metadataTagKeys = map[string]string{
+	"title":   "title",
+	"artist":  "artist",
+	"album":   "album",
+	"genre":   "genre",
+	"year":    "date",
+	"comment": "comment",
+}
+
+const maxMetadataValueBytes = 1024
+
+var metadataYearPattern = regexp.MustCompile(`^\d{4}$`)
+
+// parseMetadataTags lee el objeto JSON de metadata. Los campos vacíos se
+// ignoran; los desconocidos se rechazan para no perder etiquetas en silencio.
+func parseMetadataTags(raw string) (map[string]string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &fields); err != nil {
+		return nil, invalidParam("metadata", "metadata debe ser un objeto JSON: %v", err)
+	}
+
+	tags := map[string]string{}
+	for key, value := range fields {
+		if _, ok := metadataTagKeys[key]; !ok {
+			return nil, invalidParam("metadata", "campo de metadata desconocido %q (title, artist, album, genre, year o comment)", key)
+		}
+		text := strings.TrimSpace(jsonScalar(value))
+		if text == "" {
+			continue
+		}
+		if len(text) > maxMetadataValueBytes || !utf8.ValidString(text) {
+			return nil, invalidParam("metadata", "metadata %s inválido (texto UTF-8 de hasta %d bytes)", key, maxMetadataValueBytes)
+		}
+		if key == "year" && !metadataYearPattern.MatchString(text) {
+			return nil, invalidParam("metadata", "metadata year inválido %q (p. ej. 2024)", text)
+		}
+		tags[key] = text
+	}
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	return tags, nil
+}
+
+// metadataArgs son las opciones -metadata de la salida. En MP3 se escribe
+// ID3v2.3, que leen más reproductores que la 2.4 por defecto de ffmpeg.
+func metadataArgs(tags map[string]string, format string) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var args []string
+	if format == "mp3" {
+		args = append(args, "-id3v2_version", "3")
+	}
+	for _, key := range keys {
+		args = append(args, "-metadata", metadataTagKeys[key]+"="+tags[key])
+	}
+	return args
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Solo las etiquetas listadas en METRIC_LABEL_KEYS se usan como dimensiones,
+// y cada una admite como máximo METRIC_LABEL_MAX_VALUES valores distintos;
+// el resto se agrupa en "other" para mantener acotada la cardinalidad.
+var (
+	metricLabelKeys      []string
+	metricLabelMaxValues int
+	// metricsToken autoriza /metrics con Authorization: Bearer, para que el
+	// scraper no necesite la API key; vacío exige la API key principal
+	metricsToken string
+
+	metricsMu         sync.Mutex
+	conversionCounts  = map[string]int64{}
+	conversionSeconds = map[string]float64{}
+	seenLabelValues   = map[string]map[string]bool{}
+)
+
+func loadMetricsConfig() {
+	metricLabelKeys = nil
+	for _, key := range strings.Split(os.Getenv("METRIC_LABEL_KEYS"), ",") {
+		key = strings.TrimSpace(key)
+		if key != "" {
+			metricLabelKeys = append(metricLabelKeys, key)
+		}
+	}
+	sort.Strings(metricLabelKeys)
+	metricLabelMaxValues = envInt("METRIC_LABEL_MAX_VALUES", 50)
+	metricsToken = os.Getenv("METRICS_TOKEN")
+}
+
+// boundedLabelValue devuelve el valor a usar como dimensión, o "other" si la
+// etiqueta ya alcanzó el máximo de valores distintos. Requiere metricsMu.
+func boundedLabelValue(key string, value string) string {
+	if value == "" {
+		return ""
+	}
+
+	values := seenLabelValues[key]
+	if values == nil {
+		values = map[string]bool{}
+		seenLabelValues[key] = values
+	}
+
+	if values[value] {
+		return value
+	}
+	if len(values) >= metricLabelMaxValues {
+		return "other"
+	}
+	values[value] = true
+	return value
+}
+
+func recordConversionMetric(endpoint string, status int, elapsed time.Duration, labels map[string]string) {
+	if endpoint == "" {
+		return
+	}
+
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	dimensions := []string{
+		metricLabelPair("endpoint", endpoint),
+		metricLabelPair("status", strconv.Itoa(status)),
+	}
+	for _, key := range metricLabelKeys {
+		value := boundedLabelValue(key, labels[key])
+		dimensions = append(dimensions, metricLabelPair(metricLabelName(key), value))
+	}
+
+	series := strings.Join(dimensions, ",")
+	conversionCounts[series]++
+	conversionSeconds[series] += elapsed.Seconds()
+}
+
+// metricLabelValueEscaper aplica los únicos escapes que define el formato de
+// texto de Prometheus; %q agregaría otros (\t, \x01) que el scraper rechaza
+var metricLabelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metricLabelPair arma name="value" con el valor escapado
+func metricLabelPair(name, value string) string {
+	return name + `="` + metricLabelValueEscaper.Replace(value) + `"`
+}
+
+// metricLabelName adapta la clave de la etiqueta al formato de Prometheus
+func metricLabelName(key string) string {
+	return "label_" + strings.NewReplacer(".", "_", "-", "_").Replace(key)
+}
+
+// authorizeMetrics acepta METRICS_TOKEN como bearer o la API key principal.
+// Las keys de tenant no: las métricas cruzan a todos los tenants.
+func authorizeMetrics(c *gin.Context) bool {
+	if bearer, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok && metricsToken != "" {
+		if subtle.ConstantTimeCompare([]byte(strings.TrimSpace(bearer)), []byte(metricsToken)) == 1 {
+			return true
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid metrics token"})
+		return false
+	}
+	if !validateAPIKey(c) {
+		return false
+	}
+	if requestTenant(c) != "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Tenant API keys cannot read metrics"})
+		return false
+	}
+	return true
+}
+
+// serveMetrics expone los contadores en formato de texto de Prometheus
+func serveMetrics(c *gin.Context) {
+	if !authorizeMetrics(c) {
+		return
+	}
+
+	metricsMu.Lock()
+	series := make([]string, 0, len(conversionCounts))
+	for key := range conversionCounts {
+		series = append(series, key)
+	}
+	sort.Strings(series)
+
+	var out strings.Builder
+	out.WriteString("# HELP conversions_total Conversion requests by endpoint and status.\n")
+	out.WriteString("# TYPE conversions_total counter\n")
+	for _, key := range series {
+		fmt.Fprintf(&out, "conversions_total{%s} %d\n", key, conversionCounts[key])
+	}
+	out.WriteString("# HELP conversion_seconds_total Time spent serving conversion requests.\n")
+	out.WriteString("# TYPE conversion_seconds_total counter\n")
+	for _, key := range series {
+		fmt.Fprintf(&out, "conversion_seconds_total{%s} %f\n", key, conversionSeconds[key])
+	}
+	metricsMu.Unlock()
+
+	c.Data(http.StatusOK, "text/plain; version=0.0.4", []byte(out.String()))
+}
@@ -0,0 +1,20 @@
+package main
+
+import "testing"
+
+func TestMetricLabelPair(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"acme", `label_customer="acme"`},
+		{`a"b\c`, `label_customer="a\"b\\c"`},
+		{"línea\nnueva", `label_customer="línea\nnueva"`},
+		{"tab\there\x01", "label_customer=\"tab\there\x01\""},
+	}
+	for _, tt := range tests {
+		if got := metricLabelPair("label_customer", tt.value); got != tt.want {
+			t.Errorf("metricLabelPair(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
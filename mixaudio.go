@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// mixAudioOptions son los parámetros de /mix-audio
+type mixAudioOptions struct {
+	// VoiceVolume y MusicVolume multiplican cada entrada (1 la deja igual)
+	VoiceVolume float64
+	MusicVolume float64
+	// Ducking baja la música mientras suena la voz (sidechaincompress)
+	Ducking bool
+	// LoopMusic repite la música hasta cubrir la voz
+	LoopMusic bool
+	// Duration es la duración de la mezcla: voice, longest o shortest
+	Duration string
+}
+
+// mixDurations traduce duration a la opción de amix
+var mixDurations = map[string]string{
+	"voice":    "first",
+	"longest":  "longest",
+	"shortest": "shortest",
+}
+
+// parseMixVolume lee un volumen entre 0 y 4
+func parseMixVolume(c *gin.Context, name string, fallback float64) (float64, error) {
+	value := c.PostForm(name)
+	if value == "" {
+		return fallback, nil
+	}
+	volume, err := strconv.ParseFloat(value, 64)
+	if err != nil || volume < 0 || volume > 4 {
+		return 0, fmt.Errorf("%s debe ser un número entre 0 y 4", name)
+	}
+	return volume, nil
+}
+
+// parseMixAudioOptions lee los campos del formulario: por defecto la voz a
+// volumen completo, la música al 30% y la duración de la voz
+func parseMixAudioOptions(c *gin.Context) (mixAudioOptions, error) {
+	opts := mixAudioOptions{
+		Ducking:   c.PostForm("ducking") == "true",
+		LoopMusic: c.PostForm("loop_music") == "true",
+		Duration:  c.DefaultPostForm("duration", "voice"),
+	}
+	var err error
+	if opts.VoiceVolume, err = parseMixVolume(c, "voice_volume", 1); err != nil {
+		return opts, err
+	}
+	if opts.MusicVolume, err = parseMixVolume(c, "music_volume", 0.3); err != nil {
+		return opts, err
+	}
+	if _, ok := mixDurations[opts.Duration]; !ok {
+		return opts, invalidParam("duration", "duration inválido %q (voice, longest o shortest)", opts.Duration)
+	}
+	if opts.LoopMusic && opts.Duration == "longest" {
+		return opts, conflictingParams("loop_music", "loop_music no se puede combinar con duration=longest")
+	}
+	return opts, nil
+}
+
+// mixGraph arma el filtro: cada entrada con su volumen y, con ducking, la voz
+// como señal de control del compresor de la música. amix no normaliza para
+// que los volúmenes pedidos se respeten.
+func mixGraph(opts mixAudioOptions) string {
+	voice := fmt.Sprintf("[0:a]aresample=48000,volume=%s", strconv.FormatFloat(opts.VoiceVolume, 'f', -1, 64))
+	music := fmt.Sprintf("[1:a]aresample=48000,volume=%s[music]", strconv.FormatFloat(opts.MusicVolume, 'f', -1, 64))
+	mix := fmt.Sprintf("amix=inputs=2:duration=%s:normalize=0", mixDurations[opts.Duration])
+	if !opts.Ducking {
+		return fmt.Sprintf("%s[voice];%s;[voice][music]%s", voice, music, mix)
+	}
+	return fmt.Sprintf("%s,asplit=2[voice][trigger];%s;[music][trigger]sidechaincompress=threshold=0.03:ratio=8:attack=20:release=400[ducked];[voice][ducked]%s",
+		voice, music, mix)
+}
+
+// mixAudio mezcla la voz sobre la música y devuelve la mezcla en WAV para
+// codificarla después como cualquier audio
+func mixAudio(ctx context.Context, voiceData, musicData []byte, opts mixAudioOptions) ([]byte, error) {
+	voicePath, cleanupVoice, err := writeTempInput(voiceData, "mix-voice-*")
+	if err != nil {
+		return nil, err
+	}
+	defer cleanupVoice()
+	musicPath, cleanupMusic, err := writeTempInput(musicData, "mix-music-*")
+	if err != nil {
+		return nil, err
+	}
+	defer cleanupMusic()
+	outputPath, cleanupOutput, err := createTempOutput("mix-output-*.wav")
+	if err != nil {
+		return nil, err
+	}
+	defer cleanupOutput()
+
+	args := []string{"-i", voicePath}
+	if opts.LoopMusic {
+		args = append(args, "-stream_loop", "-1")
+	}
+	args = append(args,
+		"-i", musicPath,
+		"-filter_complex", mixGraph(opts),
+		"-vn",
+		"-c:a", "pcm_s16le",
+		"-f", "wav",
+		"-y", outputPath,
+	)
+	cmd := ffmpegCommand(ctx, classInteractive, args...)
+	var errBuffer bytes.Buffer
+	cmd.Stderr = &errBuffer
+
+	fmt.Printf("[mixAudio] Voz (%d bytes) + música (%d bytes), ducking %t\n", len(voiceData), len(musicData), opts.Ducking)
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error al mezclar el audio: %v, detalles: %s", err, errBuffer.String())
+	}
+
+	mixed, err := os.ReadFile(outputPath)
+	if err != nil {
+		return nil, fmt.Errorf("error al leer archivo de salida: %v", err)
+	}
+	if len(mixed) == 0 {
+		return nil, errors.New("la mezcla produjo un archivo vacío")
+	}
+	return mixed, nil
+}
+
+// processMixAudio atiende /mix-audio: la voz (file, base64 o url) sobre la
+// música (music, music_base64 o music_url), en los formatos de /process-audio
+func processMixAudio(c *gin.Context) {
+	if !validateAPIKey(c) {
+		return
+	}
+
+	voiceData, err := getInputData(c)
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+	musicData, err := getNamedInput(c, "music", "la música")
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+
+	mixOpts, err := parseMixAudioOptions(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	opts := audioOptions{Format: negotiateFormat(c, audioNegotiationFormats, "ogg")}
+
+	ctx := c.Request.Context()
+	mixed, err := mixAudio(ctx, voiceData, musicData, mixOpts)
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusInternalServerError), err)
+		return
+	}
+
+	if wantsBinaryResponse(c, "") {
+		audioData, duration, err := convertAudio(ctx, mixed, opts)
+		if err == nil {
+			audioData, err = interceptOutput(ctx, opts.Format, audioData)
+		}
+		if err != nil {
+			respondError(c, mediaErrorStatus(err, http.StatusInternalServerError), err)
+			return
+		}
+		writeBinaryResponse(c, audioData, opts.outputFilename(), opts.outputContentType(), map[string]string{
+			"X-Duration": strconv.Itoa(duration),
+			"X-Format":   opts.Format,
+			"X-Ducking":  strconv.FormatBool(mixOpts.Ducking),
+		})
+		return
+	}
+
+	response, err := runProcessAudio(ctx, mixed, opts, "", nil)
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusInternalServerError), err)
+		return
+	}
+	response["ducking"] = mixOpts.Ducking
+	c.JSON(http.StatusOK, attachDebug(ctx, response))
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxMotionClips limita los clips que se extraen de una grabación
+const maxMotionClips = 200
+
+var (
+	freezeStartRe = regexp.MustCompile(`freeze_start: (-?[\d.]+)`)
+	freezeEndRe   = regexp.MustCompile(`freeze_end: (-?[\d.]+)`)
+)
+
+// motionOptions son los parámetros de /motion-clips
+type motionOptions struct {
+	// Threshold es la diferencia entre cuadros (0 a 1) que cuenta como
+	// movimiento; más bajo detecta cambios más pequeños
+	Threshold float64
+	// MinStill es la quietud mínima, en segundos, que separa dos clips
+	MinStill float64
+	// MinMotion descarta los movimientos más cortos (p. ej. ruido del sensor)
+	MinMotion float64
+	// Padding agrega contexto antes y después de cada movimiento
+	Padding float64
+	// AnalyzeOnly devuelve los tramos sin extraer los clips
+	AnalyzeOnly bool
+}
+
+func parseMotionOptions(c *gin.Context) (motionOptions, error) {
+	opts := motionOptions{Threshold: 0.003, MinStill: 2, MinMotion: 0.5, Padding: 1, AnalyzeOnly: c.PostForm("analyze_only") == "true"}
+	parameters := []struct {
+		name     string
+		min, max float64
+		target   *float64
+	}{
+		{"motion_threshold", 0.0001, 0.5, &opts.Threshold},
+		{"min_still_duration", 0.5, 600, &opts.MinStill},
+		{"min_motion_duration", 0, 600, &opts.MinMotion},
+		{"padding", 0, 60, &opts.Padding},
+	}
+	for _, parameter := range parameters {
+		value := c.PostForm(parameter.name)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < parameter.min || parsed > parameter.max {
+			return opts, invalidParam(parameter.name, "%s inválido %q (entre %s y %s)", parameter.name, value,
+				strconv.FormatFloat(parameter.min, 'f', -1, 64), strconv.FormatFloat(parameter.max, 'f', -1, 64))
+		}
+		*parameter.target = parsed
+	}
+	return opts, nil
+}
+
+// detectMotion busca los tramos quietos con freezedetect sobre una versión
+// reducida del video (5 fps, 320 px de ancho) y devuelve su complemento: los
+// tramos con movimiento, con el margen pedido y unidos si se superponen
+func detectMotion(ctx context.Context, inputPath string, opts motionOptions) ([]mediaSegment, float64, error) {
+	cmd := ffmpegCommand(ctx, classBatch,
+		"-nostats",
+		"-i", inputPath,
+		"-an",
+		"-vf", fmt.Sprintf("fps=5,scale=320:-2,freezedetect=n=%s:d=%s",
+			strconv.FormatFloat(opts.Threshold, 'f', -1, 64), strconv.FormatFloat(opts.MinStill, 'f', -1, 64)),
+		"-f", "null",
+		"-",
+	)
+	var errBuffer bytes.Buffer
+	cmd.Stderr = &errBuffer
+
+	if err := cmd.Run(); err != nil {
+		return nil, 0, fmt.Errorf("error al analizar el movimiento: %v, detalles: %s", err, errBuffer.String())
+	}
+	stderrOutput := errBuffer.String()
+
+	matches := inputDurationRe.FindStringSubmatch(stderrOutput)
+	if matches == nil {
+		return nil, 0, errors.New("no se pudo determinar la duración de la grabación")
+	}
+	hours, _ := strconv.ParseFloat(matches[1], 64)
+	minutes, _ := strconv.ParseFloat(matches[2], 64)
+	seconds, _ := strconv.ParseFloat(matches[3], 64)
+	duration := hours*3600 + minutes*60 + seconds
+
+	// Los tramos con movimiento quedan entre un freeze_end y el siguiente
+	// freeze_start
+	var segments []mediaSegment
+	cursor := 0.0
+	starts := freezeStartRe.FindAllStringSubmatch(stderrOutput, -1)
+	ends := freezeEndRe.FindAllStringSubmatch(stderrOutput, -1)
+	for i, start := range starts {
+		freezeStart, _ := strconv.ParseFloat(start[1], 64)
+		segments = append(segments, mediaSegment{Start: cursor, End: freezeStart})
+		cursor = duration
+		if i < len(ends) {
+			cursor, _ = strconv.ParseFloat(ends[i][1], 64)
+		}
+	}
+	segments = append(segments, mediaSegment{Start: cursor, End: duration})
+
+	var motion []mediaSegment
+	for _, segment := range segments {
+		if segment.End-segment.Start < math.Max(opts.MinMotion, 0.001) {
+			continue
+		}
+		segment.Start = math.Max(segment.Start-opts.Padding, 0)
+		segment.End = math.Min(segment.End+opts.Padding, duration)
+		if last := len(motion) - 1; last >= 0 && segment.Start <= motion[last].End {
+			motion[last].End = math.Max(motion[last].End, segment.End)
+			continue
+		}
+		motion = append(motion, segment)
+	}
+	return motion, duration, nil
+}
+
+// extractMotionClips corta cada tramo en un MP4 con un único proceso: cada
+// clip abre la grabación con su propio -ss/-to para buscar directamente el
+// inicio. El video se copia si su códec cabe en MP4, así que los cortes caen
+// en el keyframe anterior; si no, se codifica en H.264.
+func extractMotionClips(ctx context.Context, inputPath string, clips []mediaSegment, copyVideo bool) error {
+	var (
+		args        []string
+		outputPaths []string
+	)
+	for _, clip := range clips {
+		args = append(args, "-ss", formatSeconds(clip.Start), "-to", formatSeconds(clip.End), "-i", inputPath)
+	}
+	for i := range clips {
+		outputPath, cleanupOutput, err := createTempOutput(fmt.Sprintf("motion-clip-%03d-*.mp4", i+1))
+		if err != nil {
+			return err
+		}
+		defer cleanupOutput()
+		outputPaths = append(outputPaths, outputPath)
+
+		args = append(args, "-map", fmt.Sprintf("%d:v:0", i), "-map", fmt.Sprintf("%d:a:0?", i))
+		if copyVideo {
+			args = append(args, "-c:v", "copy")
+		} else {
+			args = append(args, "-c:v", "libx264", "-preset", "veryfast", "-crf", "23", "-pix_fmt", "yuv420p")
+		}
+		args = append(args, "-c:a", defaultAACEncoder, "-b:a", "96k", "-movflags", "+faststart", "-f", "mp4", "-y", outputPath)
+	}
+	args = append(classThreadArgs(ctx, classBatch), args...)
+
+	cmd := ffmpegCommand(ctx, classBatch, args...)
+	var errBuffer bytes.Buffer
+	cmd.Stderr = &errBuffer
+
+	fmt.Printf("[motion] Extrayendo %d clips (copia de video: %v)\n", len(clips), copyVideo)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error al extraer los clips: %v, detalles: %s", err, errBuffer.String())
+	}
+
+	for i := range clips {
+		data, err := os.ReadFile(outputPaths[i])
+		if err != nil {
+			return fmt.Errorf("error al leer el clip %d: %v", i+1, err)
+		}
+		if len(data) == 0 {
+			return fmt.Errorf("el clip %d quedó vacío", i+1)
+		}
+		clips[i].Data = data
+	}
+	return nil
+}
+
+// runMotionClips analiza la grabación y extrae los clips con movimiento
+func runMotionClips(ctx context.Context, inputData []byte, opts motionOptions) ([]mediaSegment, gin.H, error) {
+	_, probe, err := probeMedia(ctx, inputData)
+	if err != nil {
+		return nil, nil, err
+	}
+	videoCodec := ""
+	for _, stream := range probe.Streams {
+		if stream.CodecType == "video" && stream.Disposition.AttachedPic == 0 {
+			videoCodec = stream.CodecName
+			break
+		}
+	}
+	if videoCodec == "" {
+		return nil, nil, errors.New("la entrada no tiene pista de video")
+	}
+
+	inputPath, cleanup, err := writeTempInput(inputData, "motion-input-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cleanup()
+
+	clips, duration, err := detectMotion(ctx, inputPath, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(clips) > maxMotionClips {
+		return nil, nil, fmt.Errorf("se detectaron %d tramos con movimiento; el máximo es %d (suba motion_threshold o min_still_duration)", len(clips), maxMotionClips)
+	}
+
+	motionTime := 0.0
+	segments := make([]gin.H, 0, len(clips))
+	for i, clip := range clips {
+		motionTime += clip.End - clip.Start
+		segments = append(segments, gin.H{
+			"index":    i + 1,
+			"start":    roundMillis(clip.Start),
+			"end":      roundMillis(clip.End),
+			"duration": roundMillis(clip.End - clip.Start),
+		})
+	}
+	summary := gin.H{
+		"duration":        roundMillis(duration),
+		"motion_segments": segments,
+		"count":           len(clips),
+		"motion_time":     roundMillis(motionTime),
+	}
+	if duration > 0 {
+		summary["motion_ratio"] = math.Round(motionTime/duration*1000) / 1000
+	}
+	recordDebug(ctx, "motion_segments", len(clips))
+	if opts.AnalyzeOnly || len(clips) == 0 {
+		return clips, summary, nil
+	}
+
+	copyVideo := mp4VideoCodecs[videoCodec]
+	if err := extractMotionClips(ctx, inputPath, clips, copyVideo); err != nil {
+		return nil, nil, err
+	}
+	for i := range clips {
+		if clips[i].Data, err = interceptOutput(ctx, "mp4", clips[i].Data); err != nil {
+			return nil, nil, err
+		}
+	}
+	summary["video_copied"] = copyVideo
+	return clips, summary, nil
+}
+
+// motionClipsView agrega los clips en base64 y el manifiesto al resumen
+func motionClipsView(clips []mediaSegment, summary gin.H) gin.H {
+	if len(clips) == 0 || clips[0].Data == nil {
+		return summary
+	}
+	manifest := newArtifactManifest()
+	entries := make([]gin.H, 0, len(clips))
+	for i, clip := range clips {
+		entry := gin.H{
+			"index":    i + 1,
+			"start":    roundMillis(clip.Start),
+			"end":      roundMillis(clip.End),
+			"duration": roundMillis(clip.End - clip.Start),
+			"format":   "mp4",
+			"video":    base64.StdEncoding.EncodeToString(clip.Data),
+		}
+		manifest.add(entry, segmentFilename(i, "mp4"), "mp4", clip.Data)
+		entries = append(entries, entry)
+	}
+	summary["clips"] = entries
+	summary["manifest"] = manifest
+	return summary
+}
+
+// processMotionClips atiende POST /motion-clips: encuentra los tramos con
+// movimiento de una grabación de vigilancia y devuelve solo esos clips
+func processMotionClips(c *gin.Context) {
+	if !validateAPIKey(c) {
+		return
+	}
+
+	inputData, err := getInputData(c)
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+	opts, err := parseMotionOptions(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	// Las grabaciones largas pueden procesarse en segundo plano con callback_url
+	callbackURL, err := parseCallbackURL(c.Request.Context(), c.PostForm("callback_url"))
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+	if callbackURL != "" {
+		job, err := submitJob(c.Request.Context(), "motion-clips", callbackURL, inputData, func(ctx context.Context) (gin.H, error) {
+			clips, summary, err := runMotionClips(ctx, inputData, opts)
+			if err != nil {
+				return nil, err
+			}
+			return motionClipsView(clips, summary), nil
+		})
+		if err != nil {
+			respondError(c, http.StatusServiceUnavailable, err)
+			return
+		}
+		c.JSON(http.StatusAccepted, job.view())
+		return
+	}
+
+	ctx := c.Request.Context()
+	clips, summary, err := runMotionClips(ctx, inputData, opts)
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusUnprocessableEntity), err)
+		return
+	}
+
+	if !opts.AnalyzeOnly && len(clips) > 0 && wantsZipResponse(c) {
+		archive, err := zipSegments(clips, "mp4")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error al crear el ZIP: " + err.Error()})
+			return
+		}
+		writeBinaryResponse(c, archive, "motion-clips.zip", "application/zip", map[string]string{
+			"X-Clips":        strconv.Itoa(len(clips)),
+			"X-Motion-Ratio": fmt.Sprint(summary["motion_ratio"]),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, attachDebug(ctx, motionClipsView(clips, summary)))
+}
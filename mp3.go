@@ -0,0 +1,32 @@
+package main
+
+import (
+	"strconv"
+)
+
+// mp3EncoderArgs arma las opciones de LAME para mp3_vbr (calidad VBR 0-9,
+// 0 es la mejor) y mp3_joint_stereo. Sin mp3_vbr se mantiene el CBR por
+// defecto de libmp3lame.
+func mp3EncoderArgs(vbrQuality, jointStereo string) ([]string, error) {
+	args := []string{"-c:a", "libmp3lame"}
+
+	if vbrQuality != "" {
+		quality, err := strconv.Atoi(vbrQuality)
+		if err != nil || quality < 0 || quality > 9 {
+			return nil, invalidParam("mp3_vbr", "mp3_vbr inválido %q (0 a 9)", vbrQuality)
+		}
+		args = append(args, "-q:a", strconv.Itoa(quality))
+	}
+
+	switch jointStereo {
+	case "":
+	case "true":
+		args = append(args, "-joint_stereo", "1")
+	case "false":
+		args = append(args, "-joint_stereo", "0")
+	default:
+		return nil, invalidParam("mp3_joint_stereo", "mp3_joint_stereo inválido %q (true o false)", jointStereo)
+	}
+
+	return args, nil
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// audioOutput es uno de los resultados de una conversión con varios formatos
+type audioOutput struct {
+	Format string
+	Data   []byte
+}
+
+// convertAudioMulti convierte la entrada a varios formatos. Siempre que las
+// opciones lo permitan usa un único proceso ffmpeg (una decodificación
+// compartida con asplit); si no, o si ese proceso falla, convierte cada
+// formato por separado.
+func convertAudioMulti(ctx context.Context, inputData []byte, formats []string, opts audioOptions) ([]audioOutput, int, error) {
+	fmt.Printf("[convertAudioMulti] Iniciando conversión a %v (%d bytes)\n", formats, len(inputData))
+
+	if len(inputData) == 0 {
+		return nil, 0, errors.New("empty input data")
+	}
+	if len(formats) == 0 {
+		return nil, 0, errors.New("no output formats requested")
+	}
+
+	// Las mediciones se hacen una vez para todas las salidas
+	if opts.ReplayGain {
+		if _, err := opts.measuredLoudness(ctx, inputData); err != nil {
+			return nil, 0, err
+		}
+	}
+	if opts.MonoDownmixSafe {
+		if _, err := opts.analyzedStereo(ctx, inputData); err != nil {
+			return nil, 0, err
+		}
+	}
+	if opts.Normalize {
+		if _, err := opts.measuredLoudnorm(ctx, inputData); err != nil {
+			return nil, 0, err
+		}
+	}
+	opts.preparePitch(ctx, inputData)
+	if opts.Limiter != nil {
+		if _, err := opts.measuredTruePeak(ctx, inputData); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if reason := multiOutputConflict(ctx, inputData, formats, opts); reason != "" {
+		fmt.Printf("[convertAudioMulti] Usando procesos separados: %s\n", reason)
+		return convertAudioSeparately(ctx, inputData, formats, opts)
+	}
+
+	outputs, duration, err := convertAudioSingleProcess(ctx, inputData, formats)
+	if err != nil {
+		fmt.Printf("[convertAudioMulti] Falló el proceso combinado, reintentando por separado: %v\n", err)
+		return convertAudioSeparately(ctx, inputData, formats, opts)
+	}
+
+	return outputs, duration, nil
+}
+
+// multiOutputConflict indica por qué los formatos no pueden compartir un
+// proceso, o "" si pueden
+func multiOutputConflict(ctx context.Context, inputData []byte, formats []string, opts audioOptions) string {
+	if len(formats) < 2 {
+		return "single output"
+	}
+	if opts.ReplayGain {
+		return "replaygain tags are written per output"
+	}
+	if opts.hasEncoderOptions() {
+		return "encoder options are applied per output"
+	}
+	if opts.Trim.isSet() {
+		return "trimming is applied per output"
+	}
+	if opts.TelephonyRaw {
+		return "telephony_container is applied per output"
+	}
+	if len(opts.Metadata) > 0 {
+		return "metadata tags are written per output"
+	}
+	if opts.Cover != nil {
+		return "cover art is attached per output"
+	}
+	if opts.Chapters != nil {
+		return "chapters are written per output"
+	}
+	if opts.ChannelLayout != nil {
+		return "channel_layout is applied per output"
+	}
+
+	// Una salida que puede copiar el codec no debe pasar por asplit
+	var source *audioStreamInfo
+	if !opts.DisableCodecCopy {
+		source, _ = probeAudioStream(ctx, inputData)
+	}
+
+	seen := map[string]bool{}
+	for _, format := range formats {
+		if seen[format] {
+			return fmt.Sprintf("format %s requested twice", format)
+		}
+		seen[format] = true
+
+		// Los filtros dependen del formato de salida, así que cada salida
+		// necesita su propia cadena
+		formatOpts := opts
+		formatOpts.Format = format
+		if audioFilterChain(formatOpts) != "" {
+			return fmt.Sprintf("format %s needs its own audio filters", format)
+		}
+
+		if copyArgsFor(source, format) != nil {
+			return fmt.Sprintf("format %s can copy the source codec", format)
+		}
+
+		// Las salidas alimentadas desde -filter_complex no admiten -af propio
+		for _, arg := range getFFmpegOutputArgs(format) {
+			if arg == "-af" || arg == "-filter:a" {
+				return fmt.Sprintf("format %s uses its own audio filter", format)
+			}
+		}
+	}
+	return ""
+}
+
+func convertAudioSeparately(ctx context.Context, inputData []byte, formats []string, opts audioOptions) ([]audioOutput, int, error) {
+	outputs := make([]audioOutput, 0, len(formats))
+	duration := 0
+
+	for _, format := range formats {
+		opts.Format = format
+		data, formatDuration, err := convertAudio(ctx, inputData, opts)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %v", format, err)
+		}
+		outputs = append(outputs, audioOutput{Format: format, Data: data})
+		duration = formatDuration
+	}
+
+	return outputs, duration, nil
+}
+
+// buildMultiOutputArgs arma un comando con una especificación de salida por
+// formato, todas alimentadas desde un asplit de la pista de audio. Cada
+// salida lleva la marca de ENCODE_MARKER, como las de convertAudio.
+func buildMultiOutputArgs(ctx context.Context, inputSource string, formats []string, outputPaths []string, threadArgs []string) []string {
+	labels := make([]string, len(formats))
+	for i := range formats {
+		labels[i] = fmt.Sprintf("[a%d]", i)
+	}
+
+	args := []string{
+		"-i", inputSource,
+		"-filter_complex", fmt.Sprintf("[0:a]asplit=%d%s", len(formats), strings.Join(labels, "")),
+	}
+
+	for i, format := range formats {
+		args = append(args, "-map", labels[i])
+		args = append(args, getFFmpegOutputArgs(format)...)
+		args = append(args, threadArgs...)
+		args = append(args, encodeMarkerArgs(ctx)...)
+		args = append(args, "-y", outputPaths[i])
+	}
+
+	return args
+}
+
+func convertAudioSingleProcess(ctx context.Context, inputData []byte, formats []string) ([]audioOutput, int, error) {
+	inputSource := "pipe:0"
+	if isMP4orM4A(inputData) {
+		// MP4/M4A necesita seek, igual que en convertAudioWithTempFile
+		inputPath, cleanup, err := writeTempInput(inputData, "audio-input-*.m4a")
+		if err != nil {
+			return nil, 0, err
+		}
+		defer cleanup()
+		inputSource = inputPath
+	}
+
+	outputPaths := make([]string, len(formats))
+	for i, format := range formats {
+		outputPath, cleanup, err := createTempOutput("audio-output-*." + format)
+		if err != nil {
+			return nil, 0, err
+		}
+		defer cleanup()
+		outputPaths[i] = outputPath
+	}
+
+	// -threads se repite en cada salida porque ffmpeg lo aplica por archivo
+	args := buildMultiOutputArgs(ctx, inputSource, formats, outputPaths, classThreadArgs(ctx, classInteractive))
+	cmd := ffmpegCommand(ctx, classInteractive, args...)
+	if inputSource == "pipe:0" {
+		cmd.Stdin = bytes.NewReader(inputData)
+	}
+
+	var errBuffer bytes.Buffer
+	cmd.Stderr = &errBuffer
+
+	fmt.Printf("[convertAudioMulti] Ejecutando: ffmpeg %v\n", args)
+	if err := cmd.Run(); err != nil {
+		return nil, 0, fmt.Errorf("error during conversion: %v, details: %s", err, errBuffer.String())
+	}
+
+	duration, err := extractDuration(errBuffer.String())
+	if err != nil {
+		return nil, 0, err
+	}
+
+	outputs := make([]audioOutput, 0, len(formats))
+	for i, format := range formats {
+		data, err := os.ReadFile(outputPaths[i])
+		if err != nil {
+			return nil, 0, fmt.Errorf("error reading %s output: %v", format, err)
+		}
+		if len(data) == 0 {
+			return nil, 0, fmt.Errorf("conversion produced empty %s output", format)
+		}
+		if format == "m4a" {
+			data = addGaplessInfo(data)
+		}
+		outputs = append(outputs, audioOutput{Format: format, Data: data})
+	}
+
+	fmt.Printf("[convertAudioMulti] Conversión exitosa: %d salidas, duración %d segundos\n", len(outputs), duration)
+	return outputs, duration, nil
+}
+
+// parseOutputFormats separa la lista de output_formats
+func parseOutputFormats(formatsParam string) []string {
+	var formats []string
+	for _, format := range strings.Split(formatsParam, ",") {
+		if format = strings.TrimSpace(format); format != "" {
+			formats = append(formats, format)
+		}
+	}
+	return formats
+}
+
+// runAudioMulti atiende /process-audio cuando se piden varios formatos
+// mediante output_formats=mp3,ogg,... y devuelve el cuerpo de la respuesta
+func runAudioMulti(ctx context.Context, inputData []byte, formatsParam string, opts audioOptions, s3Dest *s3Destination) (gin.H, error) {
+	formats := parseOutputFormats(formatsParam)
+
+	if opts.AnalyzeStereo {
+		if _, err := opts.analyzedStereo(ctx, inputData); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Limiter != nil {
+		if _, err := opts.measuredTruePeak(ctx, inputData); err != nil {
+			return nil, err
+		}
+	}
+
+	outputs, duration, err := convertAudioMulti(ctx, inputData, formats, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]gin.H, 0, len(outputs))
+	manifest := newArtifactManifest()
+	for _, output := range outputs {
+		if output.Data, err = interceptOutput(ctx, output.Format, output.Data); err != nil {
+			return nil, err
+		}
+		result := gin.H{"format": output.Format}
+		name := "audio." + output.Format
+		if s3Dest != nil {
+			formatOpts := opts
+			formatOpts.Format = output.Format
+			formatDest := s3Dest.forOutput(output.Format)
+			if err := storeOutput(ctx, result, output.Data, formatOpts.outputContentType(), formatDest); err != nil {
+				return nil, err
+			}
+			name = formatDest.Key
+		} else {
+			result["audio"] = base64.StdEncoding.EncodeToString(output.Data)
+		}
+		manifest.add(result, name, output.Format, output.Data)
+		results = append(results, result)
+	}
+
+	response := gin.H{
+		"duration": duration,
+		"outputs":  results,
+		"manifest": manifest,
+	}
+	if s3Dest != nil {
+		if err := manifest.store(ctx, response, s3Dest); err != nil {
+			return nil, err
+		}
+	}
+	if opts.AnalyzeStereo {
+		response["stereo_analysis"] = opts.stereo.report()
+	}
+	if opts.truePeak != nil {
+		response["true_peak_limiter"] = opts.limiterReport()
+	}
+	if opts.TargetDuration > 0 {
+		response["time_stretch"] = stretchReport(opts.stretchSource, opts.TargetDuration, opts.Speed)
+	}
+	if opts.Padding != nil {
+		response["padding"] = opts.Padding.report()
+	}
+	return response, nil
+}
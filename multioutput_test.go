@@ -0,0 +1,18 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestBuildMultiOutputArgsEncodeMarker(t *testing.T) {
+	previous := encodeMarkerEnabled
+	encodeMarkerEnabled = true
+	t.Cleanup(func() { encodeMarkerEnabled = previous })
+
+	args := buildMultiOutputArgs(context.Background(), "pipe:0", []string{"mp3", "ogg"}, []string{"a.mp3", "b.ogg"}, nil)
+	if got := strings.Count(strings.Join(args, " "), "encoder="+encodeMarkerPrefix+"1"); got != 2 {
+		t.Errorf("la marca aparece %d veces, se esperaba una por salida: %v", got, args)
+	}
+}
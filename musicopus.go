@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// musicOpusPreset es el valor de preset para música: Opus estéreo a 48 kHz
+// con más bitrate que el ogg por defecto, pensado para voz
+const musicOpusPreset = "music-opus"
+
+const (
+	musicOpusMinBitrate     = 96000
+	musicOpusMaxBitrate     = 128000
+	musicOpusDefaultBitrate = 128000
+)
+
+// musicOpusArgs son las opciones de libopus del preset. opus_bitrate elige
+// el bitrate dentro del rango del preset.
+func musicOpusArgs(bitrate string) ([]string, error) {
+	value := musicOpusDefaultBitrate
+	if bitrate != "" {
+		params, err := parseAudioParams(bitrate, "", "")
+		if err != nil || params.Bitrate < musicOpusMinBitrate || params.Bitrate > musicOpusMaxBitrate {
+			return nil, invalidParam("opus_bitrate", "opus_bitrate inválido %q para %s (96k a 128k)", bitrate, musicOpusPreset)
+		}
+		value = params.Bitrate
+	}
+	return []string{
+		"-b:a", strconv.Itoa(value),
+		"-ar", "48000",
+		"-ac", "2",
+		"-application", "audio",
+		"-vbr", "on",
+		"-frame_duration", "20",
+	}, nil
+}
+
+// audioProfile es el resultado de auto_profile: el perfil elegido, la
+// etiqueta del clasificador y las características que la justifican
+type audioProfile struct {
+	Name           string
+	Classification *audioClassification
+	Classifier     string
+	Features       *audioFeatures
+}
+
+// analyzeAudioProfile clasifica la entrada (ver classifier.go): la música
+// usa music-opus y la voz el ogg por defecto
+func analyzeAudioProfile(ctx context.Context, inputData []byte) (*audioProfile, error) {
+	classification, features, classifier, err := classifyAudio(ctx, inputData)
+	if err != nil {
+		return nil, err
+	}
+	profile := &audioProfile{Name: "voice", Classification: classification, Classifier: classifier, Features: features}
+	if classification.Label == "music" {
+		profile.Name = musicOpusPreset
+	}
+	fmt.Printf("[autoProfile] %s (%s, confianza %.2f, clasificador %s)\n",
+		profile.Name, classification.Label, classification.Confidence, classifier)
+	return profile, nil
+}
+
+// analyzedProfile mide el perfil una sola vez y, si es música, usa las
+// opciones de libopus de music-opus
+func (opts *audioOptions) analyzedProfile(ctx context.Context, inputData []byte) (*audioProfile, error) {
+	if opts.profile != nil {
+		return opts.profile, nil
+	}
+
+	profile, err := analyzeAudioProfile(ctx, inputData)
+	if err != nil {
+		return nil, err
+	}
+	if profile.Name == musicOpusPreset {
+		opts.opusArgs, _ = musicOpusArgs("")
+	}
+	opts.profile = profile
+	recordDebug(ctx, "audio_profile", profile.Name)
+	return profile, nil
+}
+
+// report es la representación de la respuesta
+func (profile *audioProfile) report() map[string]interface{} {
+	return map[string]interface{}{
+		"profile":    profile.Name,
+		"label":      profile.Classification.Label,
+		"confidence": profile.Classification.Confidence,
+		"classifier": profile.Classifier,
+		"features":   profile.Features.report(),
+	}
+}
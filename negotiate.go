@@ -0,0 +1,90 @@
+package main
+
+import (
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// audioNegotiationFormats son los formatos de /process-audio que se pueden
+// elegir con Accept, en orden de preferencia cuando dos comparten tipo MIME
+var audioNegotiationFormats = []string{"ogg", "mp3", "m4a", "aac", "wav", "flac", "amr", "amr-wb"}
+
+// acceptAliases son otros nombres habituales de los tipos de
+// contentTypeForFormat
+var acceptAliases = map[string]string{
+	"audio/mp3":    "audio/mpeg",
+	"audio/x-wav":  "audio/wav",
+	"audio/wave":   "audio/wav",
+	"audio/x-flac": "audio/flac",
+	"audio/opus":   "audio/ogg",
+	"audio/x-m4a":  "audio/mp4",
+	"audio/aacp":   "audio/aac",
+	"image/svg":    "image/svg+xml",
+	"video/mov":    "video/quicktime",
+}
+
+// acceptedType es un tipo de Accept con su calidad
+type acceptedType struct {
+	mediaType string
+	quality   float64
+}
+
+// parseAccept devuelve los tipos concretos de Accept ordenados por calidad;
+// los comodines y los tipos con q=0 se descartan
+func parseAccept(header string) []acceptedType {
+	var types []acceptedType
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || strings.Contains(mediaType, "*") {
+			continue
+		}
+		quality := 1.0
+		if value, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				quality = parsed
+			}
+		}
+		if quality <= 0 {
+			continue
+		}
+		if alias, ok := acceptAliases[mediaType]; ok {
+			mediaType = alias
+		}
+		types = append(types, acceptedType{mediaType: mediaType, quality: quality})
+	}
+	sort.SliceStable(types, func(i, j int) bool { return types[i].quality > types[j].quality })
+	return types
+}
+
+// negotiateFormat elige el formato de salida: output_format manda; si falta,
+// el primer tipo de Accept que corresponda a uno de formats; si no, fallback.
+// Cuando Accept puede cambiar la respuesta se agrega Vary: Accept para que un
+// CDN la guarde por separado.
+func negotiateFormat(c *gin.Context, formats []string, fallback string) string {
+	if format := c.PostForm("output_format"); format != "" {
+		return format
+	}
+	c.Header("Vary", "Accept")
+
+	for _, accepted := range parseAccept(c.GetHeader("Accept")) {
+		for _, format := range formats {
+			if formatContentType(format) == accepted.mediaType {
+				return format
+			}
+		}
+	}
+	return fallback
+}
+
+// formatContentType es contentTypeForFormat con los formatos que no se
+// envían por email
+func formatContentType(format string) string {
+	if format == "svg" {
+		return "image/svg+xml"
+	}
+	return contentTypeForFormat(format)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	slackWebhookURL   string
+	discordWebhookURL string
+	notifyOnlyFailure bool
+	notifyClient      = &http.Client{Timeout: 10 * time.Second}
+)
+
+// jobSummary resume el resultado de una conversión para los notificadores
+type jobSummary struct {
+	Endpoint string
+	Status   int
+	Success  bool
+	Duration time.Duration
+	Error    string
+	Link     string
+	Labels   map[string]string
+}
+
+func loadNotifyConfig() {
+	slackWebhookURL = os.Getenv("SLACK_WEBHOOK_URL")
+	discordWebhookURL = os.Getenv("DISCORD_WEBHOOK_URL")
+	notifyOnlyFailure = strings.EqualFold(os.Getenv("NOTIFY_ON"), "failure")
+
+	if slackWebhookURL != "" || discordWebhookURL != "" {
+		fmt.Printf("Notificaciones habilitadas (solo fallos: %t)\n", notifyOnlyFailure)
+	}
+}
+
+func notificationsEnabled() bool {
+	return slackWebhookURL != "" || discordWebhookURL != ""
+}
+
+// notifyJob publica el resumen en Slack/Discord en segundo plano
+func notifyJob(summary jobSummary) {
+	if !notificationsEnabled() {
+		return
+	}
+	if notifyOnlyFailure && summary.Success {
+		return
+	}
+
+	text := formatJobSummary(summary)
+
+	if slackWebhookURL != "" {
+		go postWebhookJSON(slackWebhookURL, map[string]string{"text": text})
+	}
+	if discordWebhookURL != "" {
+		go postWebhookJSON(discordWebhookURL, map[string]string{"content": text})
+	}
+}
+
+func formatJobSummary(summary jobSummary) string {
+	var text string
+	if summary.Success {
+		text = fmt.Sprintf("✅ %s completed in %s", summary.Endpoint, summary.Duration.Round(time.Millisecond))
+	} else {
+		text = fmt.Sprintf("❌ %s failed after %s (HTTP %d)", summary.Endpoint, summary.Duration.Round(time.Millisecond), summary.Status)
+		if summary.Error != "" {
+			text += ": " + summary.Error
+		}
+	}
+
+	if len(summary.Labels) > 0 {
+		text += "\nlabels: " + formatLabels(summary.Labels)
+	}
+	if summary.Link != "" {
+		text += "\n" + summary.Link
+	}
+	return text
+}
+
+func postWebhookJSON(url string, payload interface{}) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		fmt.Printf("Error al serializar notificación: %v\n", err)
+		return
+	}
+
+	resp, err := notifyClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		fmt.Printf("Error al enviar notificación: %v\n", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		fmt.Printf("Notificación rechazada con estado %d\n", resp.StatusCode)
+	}
+}
+
+// errorCaptureWriter guarda el inicio del cuerpo de las respuestas de error
+// para poder incluir el mensaje en la notificación
+type errorCaptureWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+	// limit reemplaza a maxCapturedErrorBytes si es mayor que cero
+	limit int
+}
+
+const maxCapturedErrorBytes = 2048
+
+func (w *errorCaptureWriter) Write(data []byte) (int, error) {
+	limit := maxCapturedErrorBytes
+	if w.limit > 0 {
+		limit = w.limit
+	}
+	if w.Status() >= http.StatusBadRequest && w.body.Len() < limit {
+		remaining := limit - w.body.Len()
+		if len(data) < remaining {
+			remaining = len(data)
+		}
+		w.body.Write(data[:remaining])
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *errorCaptureWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// notifyMiddleware envía un resumen de cada conversión al terminar la solicitud
+func notifyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !notificationsEnabled() {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		writer := &errorCaptureWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+
+		c.Next()
+
+		status := c.Writer.Status()
+		if status == http.StatusAccepted {
+			// Trabajo asíncrono: se notifica cuando termine
+			return
+		}
+
+		summary := jobSummary{
+			Endpoint: c.FullPath(),
+			Status:   status,
+			Success:  status < http.StatusBadRequest,
+			Duration: time.Since(start),
+			Link:     c.GetString("result_link"),
+			Labels:   requestInfoFrom(c.Request.Context()).Labels,
+		}
+
+		if !summary.Success {
+			var errorBody struct {
+				Error string `json:"error"`
+			}
+			if err := json.Unmarshal(writer.body.Bytes(), &errorBody); err == nil {
+				summary.Error = errorBody.Error
+			}
+		}
+
+		notifyJob(summary)
+	}
+}
@@ -0,0 +1,469 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OperationParam declara un parámetro de una operación. Type es "string",
+// "int", "float" o "bool"; Enum y Pattern restringen los string.
+type OperationParam struct {
+	Type        string   `json:"type"`
+	Default     string   `json:"default,omitempty"`
+	Required    bool     `json:"required,omitempty"`
+	Min         *float64 `json:"min,omitempty"`
+	Max         *float64 `json:"max,omitempty"`
+	Enum        []string `json:"enum,omitempty"`
+	Pattern     string   `json:"pattern,omitempty"`
+	Description string   `json:"description,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// Operation es una transformación expuesta en POST /ops/:name. Run recibe
+// los parámetros ya validados (con sus valores por defecto).
+type Operation struct {
+	Name        string
+	Description string
+	Params      map[string]OperationParam
+	// Format y ContentType describen la salida
+	Format      string
+	ContentType string
+	Run         func(ctx context.Context, input []byte, params map[string]string) ([]byte, error)
+}
+
+var (
+	operationsMu sync.RWMutex
+	operations   = map[string]*Operation{}
+)
+
+var operationNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,62}$`)
+
+// RegisterOperation agrega una operación. Los handlers Go compilados en el
+// binario lo llaman desde su init(); las declaradas en OPERATIONS_FILE se
+// registran al arrancar.
+func RegisterOperation(op Operation) error {
+	if !operationNamePattern.MatchString(op.Name) {
+		return fmt.Errorf("nombre de operación inválido %q", op.Name)
+	}
+	if op.Run == nil {
+		return fmt.Errorf("la operación %s no tiene Run", op.Name)
+	}
+	for name, param := range op.Params {
+		if err := param.compile(); err != nil {
+			return fmt.Errorf("parámetro %s: %v", name, err)
+		}
+		op.Params[name] = param
+	}
+	if op.ContentType == "" {
+		op.ContentType = "application/octet-stream"
+	}
+
+	operationsMu.Lock()
+	defer operationsMu.Unlock()
+	operations[op.Name] = &op
+	return nil
+}
+
+func lookupOperation(name string) (*Operation, bool) {
+	operationsMu.RLock()
+	defer operationsMu.RUnlock()
+	op, ok := operations[name]
+	return op, ok
+}
+
+func (p *OperationParam) compile() error {
+	switch p.Type {
+	case "string", "int", "float", "bool":
+	case "":
+		p.Type = "string"
+	default:
+		return fmt.Errorf("tipo inválido %q (string, int, float o bool)", p.Type)
+	}
+	if p.Pattern != "" {
+		pattern, err := regexp.Compile("^(?:" + p.Pattern + ")$")
+		if err != nil {
+			return fmt.Errorf("pattern inválido: %v", err)
+		}
+		p.pattern = pattern
+	}
+	if p.Default != "" {
+		if _, err := p.validate(p.Default); err != nil {
+			return fmt.Errorf("default inválido: %v", err)
+		}
+	}
+	return nil
+}
+
+// validate comprueba un valor y lo devuelve normalizado
+func (p OperationParam) validate(value string) (string, error) {
+	switch p.Type {
+	case "int", "float":
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil || (p.Type == "int" && number != float64(int64(number))) {
+			return "", fmt.Errorf("se esperaba un %s, se recibió %q", p.Type, value)
+		}
+		if (p.Min != nil && number < *p.Min) || (p.Max != nil && number > *p.Max) {
+			return "", fmt.Errorf("%q fuera de rango", value)
+		}
+		return strconv.FormatFloat(number, 'f', -1, 64), nil
+	case "bool":
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", fmt.Errorf("se esperaba true o false, se recibió %q", value)
+		}
+		return strconv.FormatBool(parsed), nil
+	}
+
+	if len(p.Enum) > 0 {
+		for _, allowed := range p.Enum {
+			if value == allowed {
+				return value, nil
+			}
+		}
+		return "", fmt.Errorf("%q no es uno de %s", value, strings.Join(p.Enum, ", "))
+	}
+	if p.pattern != nil && !p.pattern.MatchString(value) {
+		return "", fmt.Errorf("%q no cumple el patrón", value)
+	}
+	// Se rechazan los valores que parecen opciones, los que contienen .. aunque
+	// cumplan el patrón y, sin patrón, los que parecen rutas: el comando
+	// podría leer o escribir fuera de su directorio
+	if strings.HasPrefix(value, "-") {
+		return "", fmt.Errorf("%q no puede empezar con -", value)
+	}
+	if (p.pattern == nil && strings.ContainsAny(value, "/\\\x00")) || strings.Contains(value, "..") {
+		return "", fmt.Errorf("%q no puede contener /, \\ ni ..", value)
+	}
+	return value, nil
+}
+
+// resolveParams valida los parámetros de la petición contra la declaración
+func (op *Operation) resolveParams(c *gin.Context) (map[string]string, error) {
+	values := make(map[string]string, len(op.Params))
+	for name, param := range op.Params {
+		value := c.PostForm(name)
+		if value == "" {
+			value = param.Default
+		}
+		if value == "" {
+			if param.Required {
+				return nil, fmt.Errorf("falta el parámetro %s", name)
+			}
+			continue
+		}
+		normalized, err := param.validate(value)
+		if err != nil {
+			return nil, invalidParam(name, "parámetro %s inválido: %v", name, err)
+		}
+		values[name] = normalized
+	}
+	return values, nil
+}
+
+// externalOperation es una operación declarada en OPERATIONS_FILE que
+// ejecuta un comando externo. Command es la lista de argumentos; {input},
+// {output} y {parámetro} se reemplazan dentro de cada argumento. No se usa
+// shell, así que los valores no pueden inyectar otros comandos.
+type externalOperation struct {
+	Description string                    `json:"description"`
+	Command     []string                  `json:"command"`
+	Params      map[string]OperationParam `json:"params"`
+	// InputExtension y OutputExtension dan la extensión a los archivos
+	// temporales (sox y otros deducen el formato de ella)
+	InputExtension  string `json:"input_extension"`
+	OutputExtension string `json:"output_extension"`
+	ContentType     string `json:"content_type"`
+	Timeout         string `json:"timeout"`
+	MaxOutputBytes  int64  `json:"max_output_bytes"`
+	// MaxMemoryMB y MaxCPUSeconds limitan la memoria virtual y el tiempo de
+	// CPU del comando (por defecto 1024 MB y el timeout)
+	MaxMemoryMB   int64 `json:"max_memory_mb"`
+	MaxCPUSeconds int64 `json:"max_cpu_seconds"`
+}
+
+// operationLimits son los rlimits del comando de una operación externa; 0
+// no limita
+type operationLimits struct {
+	MemoryBytes uint64
+	CPUSeconds  uint64
+	FileBytes   uint64
+}
+
+// operationSandbox es el prefijo de OPERATIONS_SANDBOX que envuelve cada
+// comando externo (p. ej. bwrap o nsjail); {workdir} se reemplaza por el
+// directorio temporal de la ejecución
+var operationSandbox []string
+
+var placeholderPattern = regexp.MustCompile(`\{([a-z][a-z0-9_]*)\}`)
+
+// loadOperationsConfig registra las operaciones de OPERATIONS_FILE, un JSON
+// {"nombre": {"command": [...], "params": {...}, ...}}
+func loadOperationsConfig() {
+	operationSandbox = strings.Fields(os.Getenv("OPERATIONS_SANDBOX"))
+	if len(operationSandbox) > 0 {
+		sandbox, err := exec.LookPath(operationSandbox[0])
+		if err != nil {
+			fmt.Printf("OPERATIONS_SANDBOX: %v; las operaciones externas no se registran\n", err)
+			return
+		}
+		operationSandbox[0] = sandbox
+	}
+
+	path := os.Getenv("OPERATIONS_FILE")
+	if path == "" {
+		return
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Printf("No se pudo leer OPERATIONS_FILE: %v\n", err)
+		return
+	}
+	var declared map[string]externalOperation
+	if err := json.Unmarshal(raw, &declared); err != nil {
+		fmt.Printf("OPERATIONS_FILE inválido: %v\n", err)
+		return
+	}
+	for name, external := range declared {
+		op, err := external.operation(name)
+		if err == nil {
+			err = RegisterOperation(op)
+		}
+		if err != nil {
+			fmt.Printf("Operación %s ignorada: %v\n", name, err)
+			continue
+		}
+		fmt.Printf("Operación registrada: /ops/%s (%s)\n", name, external.Command[0])
+	}
+}
+
+func (e externalOperation) operation(name string) (Operation, error) {
+	if len(e.Command) == 0 {
+		return Operation{}, errors.New("command vacío")
+	}
+	binary, err := exec.LookPath(e.Command[0])
+	if err != nil {
+		return Operation{}, fmt.Errorf("comando no encontrado: %v", err)
+	}
+
+	usesOutput := false
+	for _, arg := range e.Command[1:] {
+		for _, match := range placeholderPattern.FindAllStringSubmatch(arg, -1) {
+			switch match[1] {
+			case "input":
+			case "output":
+				usesOutput = true
+			default:
+				if _, ok := e.Params[match[1]]; !ok {
+					return Operation{}, fmt.Errorf("{%s} no está declarado en params", match[1])
+				}
+			}
+		}
+	}
+	if !usesOutput {
+		return Operation{}, errors.New("command debe usar {output}")
+	}
+
+	timeout := 2 * time.Minute
+	if e.Timeout != "" {
+		if timeout, err = time.ParseDuration(e.Timeout); err != nil || timeout <= 0 {
+			return Operation{}, fmt.Errorf("timeout inválido %q", e.Timeout)
+		}
+	}
+	maxOutput := e.MaxOutputBytes
+	if maxOutput <= 0 {
+		maxOutput = 200 << 20
+	}
+	limits := operationLimits{
+		MemoryBytes: 1024 << 20,
+		CPUSeconds:  uint64(math.Ceil(timeout.Seconds())),
+		FileBytes:   uint64(maxOutput),
+	}
+	if e.MaxMemoryMB > 0 {
+		limits.MemoryBytes = uint64(e.MaxMemoryMB) << 20
+	}
+	if e.MaxCPUSeconds > 0 {
+		limits.CPUSeconds = uint64(e.MaxCPUSeconds)
+	}
+
+	format := strings.TrimPrefix(e.OutputExtension, ".")
+	return Operation{
+		Name:        name,
+		Description: e.Description,
+		Params:      e.Params,
+		Format:      format,
+		ContentType: e.ContentType,
+		Run: func(ctx context.Context, input []byte, params map[string]string) ([]byte, error) {
+			return e.run(ctx, binary, timeout, maxOutput, limits, input, params)
+		},
+	}, nil
+}
+
+// run ejecuta el comando en un directorio temporal propio, con un entorno
+// mínimo, rlimits de memoria, CPU y archivos, y límite de tiempo y de tamaño
+// de salida. El comando y los procesos que lance forman un grupo que se mata
+// entero al terminar o al vencer el tiempo. Sin OPERATIONS_SANDBOX el
+// comando corre con el usuario del servicio y ve su sistema de archivos y
+// la red.
+func (e externalOperation) run(ctx context.Context, binary string, timeout time.Duration, maxOutput int64, limits operationLimits, input []byte, params map[string]string) ([]byte, error) {
+	workDir, err := os.MkdirTemp("", "op-*")
+	if err != nil {
+		return nil, fmt.Errorf("error al crear el directorio de trabajo: %v", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	inputPath := filepath.Join(workDir, "input"+extensionSuffix(e.InputExtension))
+	outputPath := filepath.Join(workDir, "output"+extensionSuffix(e.OutputExtension))
+	if err := os.WriteFile(inputPath, input, 0o600); err != nil {
+		return nil, fmt.Errorf("error al escribir la entrada: %v", err)
+	}
+
+	values := map[string]string{"input": inputPath, "output": outputPath}
+	for name, value := range params {
+		values[name] = value
+	}
+	args := make([]string, 0, len(e.Command)-1)
+	for _, arg := range e.Command[1:] {
+		args = append(args, placeholderPattern.ReplaceAllStringFunc(arg, func(match string) string {
+			return values[match[1:len(match)-1]]
+		}))
+	}
+
+	if len(operationSandbox) > 0 {
+		wrapped := make([]string, 0, len(operationSandbox)+len(args))
+		for _, arg := range operationSandbox[1:] {
+			wrapped = append(wrapped, strings.ReplaceAll(arg, "{workdir}", workDir))
+		}
+		args = append(append(wrapped, binary), args...)
+		binary = operationSandbox[0]
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cmd, err := operationCommand(ctx, binary, args, limits)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Dir = workDir
+	cmd.Env = append(cmd.Env, "PATH="+os.Getenv("PATH"), "HOME="+workDir, "TMPDIR="+workDir)
+	var errBuffer bytes.Buffer
+	cmd.Stderr = &errBuffer
+
+	err = cmd.Run()
+	killProcessGroup(cmd)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("la operación superó el tiempo límite de %s", timeout)
+		}
+		return nil, fmt.Errorf("error al ejecutar la operación: %v, detalles: %s", err, strings.TrimSpace(errBuffer.String()))
+	}
+
+	info, err := os.Stat(outputPath)
+	if err != nil {
+		return nil, errors.New("la operación no produjo salida")
+	}
+	if info.Size() > maxOutput {
+		return nil, fmt.Errorf("la salida (%d bytes) supera el máximo de %d", info.Size(), maxOutput)
+	}
+	return os.ReadFile(outputPath)
+}
+
+func extensionSuffix(extension string) string {
+	if extension == "" {
+		return ""
+	}
+	return "." + strings.TrimPrefix(extension, ".")
+}
+
+// listOperations atiende GET /ops: operaciones registradas y sus parámetros
+func listOperations(c *gin.Context) {
+	if !validateAPIKey(c) {
+		return
+	}
+
+	operationsMu.RLock()
+	names := make([]string, 0, len(operations))
+	for name := range operations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	list := make([]gin.H, 0, len(names))
+	for _, name := range names {
+		op := operations[name]
+		list = append(list, gin.H{
+			"name":         op.Name,
+			"description":  op.Description,
+			"params":       op.Params,
+			"format":       op.Format,
+			"content_type": op.ContentType,
+		})
+	}
+	operationsMu.RUnlock()
+
+	c.JSON(http.StatusOK, gin.H{"operations": list})
+}
+
+// processOperation atiende POST /ops/:name con la misma entrada (file,
+// base64 o url) que el resto de endpoints
+func processOperation(c *gin.Context) {
+	if !validateAPIKey(c) {
+		return
+	}
+
+	op, ok := lookupOperation(c.Param("name"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("operación desconocida %q", c.Param("name"))})
+		return
+	}
+	params, err := op.resolveParams(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	inputData, err := getInputData(c)
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+
+	fmt.Printf("[ops] Ejecutando %s (%d bytes) con %v\n", op.Name, len(inputData), params)
+	outputData, err := op.Run(c.Request.Context(), inputData, params)
+	if err == nil {
+		outputData, err = interceptOutput(c.Request.Context(), op.Format, outputData)
+	}
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusInternalServerError), err)
+		return
+	}
+
+	if wantsBinaryResponse(c, "") {
+		filename := op.Name + extensionSuffix(op.Format)
+		writeBinaryResponse(c, outputData, filename, op.ContentType, map[string]string{"X-Operation": op.Name})
+		return
+	}
+	c.JSON(http.StatusOK, attachDebug(c.Request.Context(), gin.H{
+		"operation": op.Name,
+		"format":    op.Format,
+		"params":    params,
+		"size":      len(outputData),
+		"output":    base64.StdEncoding.EncodeToString(outputData),
+	}))
+}
@@ -0,0 +1,98 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// operationLimitsEnv lleva los rlimits al lanzador de operaciones externas
+const operationLimitsEnv = "EVOLUTION_OPERATION_RLIMITS"
+
+// El lanzador corre antes que los init() del paquete: una variable del
+// paquete se inicializa primero
+var _ = runOperationLauncher()
+
+// runOperationLauncher es el modo lanzador del binario: cuando el servicio
+// ejecuta una operación externa se vuelve a ejecutar a sí mismo con
+// operationLimitsEnv, fija los rlimits en este proceso y lo reemplaza por
+// el comando con execve. Los límites rigen desde la primera instrucción del
+// comando y los heredan los procesos que lance.
+func runOperationLauncher() bool {
+	value, ok := os.LookupEnv(operationLimitsEnv)
+	if !ok {
+		return false
+	}
+	fields := strings.Split(value, ",")
+	if len(fields) != 3 || len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, "lanzador de operaciones: argumentos inválidos")
+		os.Exit(126)
+	}
+	env := make([]string, 0, len(os.Environ()))
+	for _, entry := range os.Environ() {
+		if !strings.HasPrefix(entry, operationLimitsEnv+"=") {
+			env = append(env, entry)
+		}
+	}
+	// RLIMIT_AS va al final: después ya no se reserva memoria
+	for _, limit := range []struct {
+		resource int
+		value    string
+	}{
+		{syscall.RLIMIT_FSIZE, fields[2]},
+		{syscall.RLIMIT_CPU, fields[1]},
+		{syscall.RLIMIT_AS, fields[0]},
+	} {
+		value, err := strconv.ParseUint(limit.value, 10, 64)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "lanzador de operaciones: límite inválido")
+			os.Exit(126)
+		}
+		if value == 0 {
+			continue
+		}
+		if err := syscall.Setrlimit(limit.resource, &syscall.Rlimit{Cur: value, Max: value}); err != nil {
+			fmt.Fprintf(os.Stderr, "lanzador de operaciones: setrlimit: %v\n", err)
+			os.Exit(126)
+		}
+	}
+	err := syscall.Exec(os.Args[1], os.Args[1:], env)
+	fmt.Fprintf(os.Stderr, "lanzador de operaciones: %v\n", err)
+	os.Exit(127)
+	return true
+}
+
+// operationCommand arma el comando de una operación externa: lo lanza el
+// propio binario del servicio para aplicar los rlimits antes del execve, en
+// su propio grupo de procesos. Al vencer el tiempo se mata el grupo entero,
+// no solo el proceso directo, así que los procesos que lance no sobreviven.
+func operationCommand(ctx context.Context, binary string, args []string, limits operationLimits) (*exec.Cmd, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo ubicar el binario del servicio: %v", err)
+	}
+	cmd := exec.CommandContext(ctx, self, append([]string{binary}, args...)...)
+	cmd.Env = []string{fmt.Sprintf("%s=%d,%d,%d", operationLimitsEnv, limits.MemoryBytes, limits.CPUSeconds, limits.FileBytes)}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	// Un proceso lanzado que conserva stderr abierto no bloquea la espera
+	cmd.WaitDelay = 5 * time.Second
+	return cmd, nil
+}
+
+// killProcessGroup mata lo que quede del grupo del comando después de que el
+// proceso principal terminó (p. ej. procesos en segundo plano)
+func killProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process != nil {
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
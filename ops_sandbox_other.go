@@ -0,0 +1,16 @@
+//go:build !linux
+
+package main
+
+import (
+	"context"
+	"os/exec"
+)
+
+// operationCommand no aísla el comando fuera de Linux: no hay rlimits y al
+// vencer el tiempo solo se mata el proceso directo
+func operationCommand(ctx context.Context, binary string, args []string, limits operationLimits) (*exec.Cmd, error) {
+	return exec.CommandContext(ctx, binary, args...), nil
+}
+
+func killProcessGroup(cmd *exec.Cmd) {}
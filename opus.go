@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strconv"
+)
+
+// opusApplications son los valores de application de libopus
+var opusApplications = map[string]bool{"voip": true, "audio": true, "lowdelay": true}
+
+// opusFrameDurations son las duraciones de trama (ms) que admite libopus
+var opusFrameDurations = map[string]bool{"2.5": true, "5": true, "10": true, "20": true, "40": true, "60": true}
+
+// opusEncoderArgs arma las opciones de libopus para opus_bitrate,
+// application, vbr y frame_duration. Los valores vacíos mantienen los del
+// formato ogg (128k, voip, vbr on, 20 ms).
+func opusEncoderArgs(bitrate, application, vbr, frameDuration string) ([]string, error) {
+	var args []string
+
+	if bitrate != "" {
+		params, err := parseAudioParams(bitrate, "", "")
+		if err != nil {
+			return nil, invalidParam("opus_bitrate", "opus_bitrate inválido %q (p. ej. 64k)", bitrate)
+		}
+		limit := formatAudioLimits["ogg"]
+		if params.Bitrate < limit.minBitrate || params.Bitrate > limit.maxBitrate {
+			return nil, invalidParam("opus_bitrate", "opus_bitrate debe estar entre %d y %d", limit.minBitrate, limit.maxBitrate)
+		}
+		args = append(args, "-b:a", strconv.Itoa(params.Bitrate))
+	}
+
+	if application != "" {
+		if !opusApplications[application] {
+			return nil, invalidParam("application", "application inválido %q (voip, audio o lowdelay)", application)
+		}
+		args = append(args, "-application", application)
+	}
+
+	switch vbr {
+	case "":
+	case "on", "off", "constrained":
+		args = append(args, "-vbr", vbr)
+	default:
+		return nil, invalidParam("vbr", "vbr inválido %q (on, off o constrained)", vbr)
+	}
+
+	if frameDuration != "" {
+		if !opusFrameDurations[frameDuration] {
+			return nil, invalidParam("frame_duration", "frame_duration inválido %q (2.5, 5, 10, 20, 40 o 60 ms)", frameDuration)
+		}
+		args = append(args, "-frame_duration", frameDuration)
+	}
+
+	// El contenido musical conserva los canales de la entrada en lugar de
+	// mezclarse a mono como las notas de voz
+	if application == "audio" {
+		args = append(args, "-ac", "")
+	}
+
+	return args, nil
+}
+
+// applyOpusArgs reemplaza las opciones del formato ogg por las de la
+// petición; "-ac" con valor vacío elimina la mezcla a mono
+func applyOpusArgs(args, opusArgs []string) []string {
+	for i := 0; i+1 < len(opusArgs); i += 2 {
+		if opusArgs[i+1] == "" {
+			args = removeOutputOption(args, opusArgs[i])
+			continue
+		}
+		args = setOutputOption(args, opusArgs[i], opusArgs[i+1])
+	}
+	return args
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// durationPadding es pad_to_duration: silencio (o cuadros congelados en
+// video) antes, después o a ambos lados del contenido hasta Duration
+type durationPadding struct {
+	Duration float64
+	// Position es end (por defecto), start o center
+	Position string
+
+	// lead y tail son los segundos de relleno calculados con la duración
+	// de la entrada
+	lead float64
+	tail float64
+}
+
+// parseDurationPadding valida pad_to_duration (segundos o [hh:]mm:ss[.ms])
+// y pad_position. Devuelve nil si no se pidió.
+func parseDurationPadding(duration, position string) (*durationPadding, error) {
+	if duration == "" {
+		if position != "" {
+			return nil, missingParam("pad_position", "pad_position requiere pad_to_duration")
+		}
+		return nil, nil
+	}
+	seconds, err := parseTimestamp(duration)
+	if err != nil {
+		return nil, invalidParam("pad_to_duration", "pad_to_duration inválido: %v", err)
+	}
+	if seconds == 0 {
+		return nil, errors.New("pad_to_duration debe ser mayor que cero")
+	}
+	switch position {
+	case "":
+		position = "end"
+	case "end", "start", "center":
+	default:
+		return nil, invalidParam("pad_position", "pad_position inválido %q (end, start o center)", position)
+	}
+	return &durationPadding{Duration: seconds, Position: position}, nil
+}
+
+// plan mide la entrada y reparte el relleno. speed es el factor de
+// velocidad de la salida (1 si no cambia). La entrada no puede durar más
+// que Duration: se rechaza en lugar de cortar el contenido.
+func (padding *durationPadding) plan(ctx context.Context, inputData []byte, speed float64) error {
+	_, probe, err := probeMedia(ctx, inputData)
+	if err != nil {
+		return err
+	}
+	source, _ := strconv.ParseFloat(probe.Format.Duration, 64)
+	if source <= 0 {
+		return errors.New("no se pudo determinar la duración de la entrada para pad_to_duration")
+	}
+	content := source / speed
+	// Un milisegundo de tolerancia para el redondeo del contenedor
+	if content > padding.Duration+0.001 {
+		return inputOutOfRange("la entrada dura %s s, más que pad_to_duration (%s s)", formatSeconds(content), formatSeconds(padding.Duration))
+	}
+
+	missing := math.Max(0, padding.Duration-content)
+	switch padding.Position {
+	case "start":
+		padding.lead = missing
+	case "center":
+		padding.lead = missing / 2
+		padding.tail = missing - padding.lead
+	default:
+		padding.tail = missing
+	}
+	recordDebug(ctx, "padding", map[string]interface{}{
+		"content_duration": roundMillis(content),
+		"lead":             roundMillis(padding.lead),
+		"tail":             roundMillis(padding.tail),
+	})
+	return nil
+}
+
+// audioFilter antepone el silencio inicial con adelay, completa con apad y
+// corta en Duration para que la longitud sea exacta
+func (padding *durationPadding) audioFilter() string {
+	filter := ""
+	if padding.lead > 0 {
+		filter = fmt.Sprintf("adelay=%d:all=1,", int64(math.Round(padding.lead*1000)))
+	}
+	return filter + exactDurationFilter(padding.Duration)
+}
+
+// videoFilter repite el primer y el último cuadro con tpad
+func (padding *durationPadding) videoFilter() string {
+	return fmt.Sprintf("tpad=start_mode=clone:start_duration=%s:stop_mode=clone:stop_duration=%s",
+		formatSeconds(padding.lead), formatSeconds(padding.tail))
+}
+
+// report es la representación de la respuesta
+func (padding *durationPadding) report() map[string]interface{} {
+	return map[string]interface{}{
+		"duration": padding.Duration,
+		"position": padding.Position,
+		"lead":     roundMillis(padding.lead),
+		"tail":     roundMillis(padding.tail),
+	}
+}
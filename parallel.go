@@ -0,0 +1,522 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// parallelWorkers es la cantidad de segmentos que se codifican a la vez
+	// entre todas las solicitudes con parallel=true
+	parallelWorkers int
+	// parallelSegmentSeconds es la duración aproximada de cada segmento; el
+	// corte real cae en el keyframe siguiente
+	parallelSegmentSeconds float64
+	// parallelMinDuration es la duración mínima para dividir la entrada: en
+	// videos más cortos el arranque de cada proceso no compensa
+	parallelMinDuration float64
+	parallelSlots       chan struct{}
+)
+
+func loadParallelConfig() {
+	parallelWorkers = envInt("PARALLEL_WORKERS", runtime.NumCPU())
+	if parallelWorkers < 1 {
+		parallelWorkers = 1
+	}
+	parallelSegmentSeconds = envDuration("PARALLEL_SEGMENT_DURATION", time.Minute).Seconds()
+	if parallelSegmentSeconds < 10 {
+		fmt.Println("PARALLEL_SEGMENT_DURATION debe ser de al menos 10s, se usa 1m")
+		parallelSegmentSeconds = 60
+	}
+	parallelMinDuration = envDuration("PARALLEL_MIN_DURATION", 3*time.Minute).Seconds()
+	parallelSlots = make(chan struct{}, parallelWorkers)
+}
+
+// parallelReport describe cómo se hizo la conversión con parallel=true. Si
+// no se dividió, Reason explica por qué se usó una sola pasada.
+type parallelReport struct {
+	Used     bool `json:"used"`
+	Segments int  `json:"segments,omitempty"`
+	Workers  int  `json:"workers,omitempty"`
+	// RemoteSegments son los segmentos codificados en SEGMENT_WORKER_URLS
+	RemoteSegments int    `json:"remote_segments,omitempty"`
+	Reason         string `json:"reason,omitempty"`
+}
+
+// videoSegment es un tramo de la entrada entre dos keyframes (End 0 es hasta
+// el final) y el archivo donde queda codificado
+type videoSegment struct {
+	Start float64
+	End   float64
+	Path  string
+}
+
+// videoPacketIndex son los keyframes del primer stream de video, la cantidad
+// de paquetes y la duración de la entrada
+type videoPacketIndex struct {
+	Keyframes []float64
+	Packets   int
+	Duration  float64
+	HasAudio  bool
+}
+
+// indexVideoPackets lee con ffprobe los paquetes del video, sin decodificar
+func indexVideoPackets(ctx context.Context, inputPath string) (*videoPacketIndex, error) {
+	cmd := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-show_entries", "format=duration:stream=codec_type",
+		"-of", "json",
+		inputPath)
+	var outBuffer, errBuffer bytes.Buffer
+	cmd.Stdout = &outBuffer
+	cmd.Stderr = &errBuffer
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffprobe no pudo leer la entrada: %v, detalles: %s", err, strings.TrimSpace(errBuffer.String()))
+	}
+	var probe struct {
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+		Streams []struct {
+			CodecType string `json:"codec_type"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(outBuffer.Bytes(), &probe); err != nil {
+		return nil, fmt.Errorf("error al leer la salida de ffprobe: %v", err)
+	}
+	index := &videoPacketIndex{}
+	index.Duration, _ = strconv.ParseFloat(probe.Format.Duration, 64)
+	for _, stream := range probe.Streams {
+		if stream.CodecType == "audio" {
+			index.HasAudio = true
+		}
+	}
+
+	cmd = exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "packet=pts_time,flags",
+		"-of", "csv=p=0",
+		inputPath)
+	outBuffer.Reset()
+	errBuffer.Reset()
+	cmd.Stdout = &outBuffer
+	cmd.Stderr = &errBuffer
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffprobe no pudo listar los paquetes de video: %v, detalles: %s", err, strings.TrimSpace(errBuffer.String()))
+	}
+	scanner := bufio.NewScanner(&outBuffer)
+	for scanner.Scan() {
+		// "12.345000,K__"
+		pts, flags, found := strings.Cut(strings.TrimSpace(scanner.Text()), ",")
+		if !found {
+			continue
+		}
+		index.Packets++
+		if !strings.HasPrefix(flags, "K") {
+			continue
+		}
+		seconds, err := strconv.ParseFloat(pts, 64)
+		if err != nil {
+			return nil, errors.New("los keyframes del video no tienen marcas de tiempo")
+		}
+		index.Keyframes = append(index.Keyframes, seconds)
+	}
+	sort.Float64s(index.Keyframes)
+	return index, nil
+}
+
+// planVideoSegments elige los inicios de los segmentos: el primer keyframe a
+// partir de cada segmentSeconds. Un último tramo de menos de un cuarto de
+// segmento se une al anterior.
+func planVideoSegments(index *videoPacketIndex, segmentSeconds float64) []float64 {
+	starts := []float64{0}
+	next := segmentSeconds
+	for _, keyframe := range index.Keyframes {
+		if keyframe >= next {
+			starts = append(starts, keyframe)
+			next = keyframe + segmentSeconds
+		}
+	}
+	if len(starts) > 1 && index.Duration-starts[len(starts)-1] < segmentSeconds/4 {
+		starts = starts[:len(starts)-1]
+	}
+	return starts
+}
+
+// keyframeTime da el tiempo de un keyframe con la precisión de ffprobe, para
+// que -ss y -to caigan exactamente en él
+func keyframeTime(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', 6, 64)
+}
+
+// convertVideoToMp4Parallel divide la entrada en sus keyframes, codifica los
+// segmentos de video a la vez y los une sin recodificar. Si la entrada es
+// corta, no se puede dividir o la unión no pasa la verificación, convierte en
+// una sola pasada e informa el motivo.
+func convertVideoToMp4Parallel(ctx context.Context, inputData []byte, opts videoToMp4Options) ([]byte, *parallelReport, error) {
+	data, report, err := transcodeVideoSegments(ctx, inputData, opts)
+	if err == nil {
+		return data, report, nil
+	}
+	if ctx.Err() != nil {
+		return nil, nil, err
+	}
+	fmt.Printf("[parallel] Conversión en una sola pasada: %v\n", err)
+	data, convertErr := convertVideoToMp4(ctx, inputData, opts)
+	if convertErr != nil {
+		return nil, nil, convertErr
+	}
+	return data, &parallelReport{Reason: err.Error()}, nil
+}
+
+// transcodeVideoSegments hace la conversión por segmentos y devuelve el MP4 y
+// el reporte. El audio se codifica una sola vez al unir, así
+// no quedan huecos del retardo del codificador AAC entre segmentos.
+func transcodeVideoSegments(ctx context.Context, inputData []byte, opts videoToMp4Options) ([]byte, *parallelReport, error) {
+	if opts.rotation != 0 && opts.PreserveRotation {
+		return nil, nil, errors.New("preserve_rotation guarda la rotación en el contenedor y los segmentos no la conservan")
+	}
+
+	dir, err := os.MkdirTemp("", "parallel-*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("error al crear el directorio temporal: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	inputPath := filepath.Join(dir, "input."+opts.InputFormat)
+	if err := os.WriteFile(inputPath, inputData, 0o600); err != nil {
+		return nil, nil, fmt.Errorf("error al escribir la entrada: %v", err)
+	}
+
+	index, err := indexVideoPackets(ctx, inputPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if index.Duration < parallelMinDuration {
+		return nil, nil, fmt.Errorf("la entrada dura %s s, menos que PARALLEL_MIN_DURATION (%s s)",
+			formatSeconds(index.Duration), formatSeconds(parallelMinDuration))
+	}
+	starts := planVideoSegments(index, parallelSegmentSeconds)
+	if len(starts) < 2 {
+		return nil, nil, errors.New("la entrada no tiene keyframes suficientes para dividirla")
+	}
+	recordDebug(ctx, "parallel_segments", starts)
+
+	segments := make([]videoSegment, len(starts))
+	for i, start := range starts {
+		segments[i] = videoSegment{Start: start, Path: filepath.Join(dir, fmt.Sprintf("segment-%04d.ts", i))}
+		if i+1 < len(starts) {
+			segments[i].End = starts[i+1]
+		}
+	}
+	remote, err := encodeVideoSegments(ctx, dir, inputPath, segments, index, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Verificación: cada paquete de video de la entrada debe estar en un
+	// segmento, sin cuadros perdidos ni repetidos en los cortes
+	encoded := 0
+	for _, segment := range segments {
+		packets, err := countVideoPackets(ctx, segment.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+		encoded += packets
+	}
+	if encoded != index.Packets {
+		return nil, nil, fmt.Errorf("los segmentos tienen %d cuadros y la entrada %d", encoded, index.Packets)
+	}
+
+	outputPath := filepath.Join(dir, "output.mp4")
+	if err := concatVideoSegments(ctx, dir, segments, inputPath, outputPath, index, opts); err != nil {
+		return nil, nil, err
+	}
+	packets, err := countVideoPackets(ctx, outputPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if packets != index.Packets {
+		return nil, nil, fmt.Errorf("el MP4 unido tiene %d cuadros y la entrada %d", packets, index.Packets)
+	}
+	duration, err := probeFormatDuration(ctx, outputPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if tolerance := math.Max(0.5, index.Duration*0.01); math.Abs(duration-index.Duration) > tolerance {
+		return nil, nil, fmt.Errorf("el MP4 unido dura %s s y la entrada %s s", formatSeconds(duration), formatSeconds(index.Duration))
+	}
+
+	outputData, err := os.ReadFile(outputPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error al leer archivo de salida: %v", err)
+	}
+	fmt.Printf("[parallel] %d segmentos unidos, %d codificados en otros nodos (%d bytes)\n", len(segments), remote, len(outputData))
+	return outputData, &parallelReport{
+		Used:           true,
+		Segments:       len(segments),
+		Workers:        min(parallelWorkers, len(segments)),
+		RemoteSegments: remote,
+	}, nil
+}
+
+// encodeVideoSegments codifica los segmentos con los cupos locales de
+// PARALLEL_WORKERS y, si hay SEGMENT_WORKER_URLS, también en esos nodos.
+// Cada worker toma el siguiente segmento pendiente; el que falla en un nodo
+// vuelve a la cola y ese nodo deja de recibir segmentos de este trabajo.
+// Devuelve cuántos segmentos se codificaron en otros nodos.
+func encodeVideoSegments(ctx context.Context, dir, inputPath string, segments []videoSegment, index *videoPacketIndex, opts videoToMp4Options) (int, error) {
+	// Los segmentos no informan avance: el del trabajo sigue a la unión
+	segmentCtx, cancel := context.WithCancel(withJobProgress(ctx, nil))
+	defer cancel()
+
+	queue := make(chan int, len(segments))
+	for i := range segments {
+		queue <- i
+	}
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		remaining = len(segments)
+		remote    int
+		firstErr  error
+		failed    = map[string]bool{}
+	)
+	next := func() (int, bool) {
+		select {
+		case i, ok := <-queue:
+			return i, ok
+		case <-segmentCtx.Done():
+			return 0, false
+		}
+	}
+	done := func(remoteNode bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		if remoteNode {
+			remote++
+		}
+		if remaining--; remaining == 0 {
+			close(queue)
+		}
+	}
+	fail := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+		cancel()
+	}
+
+	for w := 0; w < min(parallelWorkers, len(segments)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i, ok := next()
+				if !ok {
+					return
+				}
+				select {
+				case parallelSlots <- struct{}{}:
+				case <-segmentCtx.Done():
+					return
+				}
+				segment := segments[i]
+				err := encodeVideoSegment(segmentCtx, inputPath, segment.Path, segment.Start, segment.End, opts)
+				<-parallelSlots
+				if err != nil {
+					fail(err)
+					return
+				}
+				done(false)
+			}
+		}()
+	}
+
+	for _, node := range segmentWorkersFor(index, opts) {
+		for w := 0; w < segmentWorkerConcurrency; w++ {
+			wg.Add(1)
+			go func(node string) {
+				defer wg.Done()
+				for {
+					mu.Lock()
+					nodeFailed := failed[node]
+					mu.Unlock()
+					if nodeFailed {
+						return
+					}
+					i, ok := next()
+					if !ok {
+						return
+					}
+					chunkPath := filepath.Join(dir, fmt.Sprintf("chunk-%04d.mkv", i))
+					err := encodeRemoteSegment(segmentCtx, node, inputPath, chunkPath, segments[i], opts)
+					os.Remove(chunkPath)
+					if err != nil {
+						if segmentCtx.Err() == nil {
+							fmt.Printf("[parallel] El nodo %s no codificó el segmento %d, vuelve a la cola: %v\n", node, i, err)
+							mu.Lock()
+							failed[node] = true
+							mu.Unlock()
+							queue <- i
+						}
+						return
+					}
+					done(true)
+				}
+			}(node)
+		}
+	}
+
+	wg.Wait()
+	if firstErr != nil {
+		return 0, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return remote, nil
+}
+
+// encodeVideoSegment codifica el video entre dos keyframes (end 0 es hasta el
+// final) con los mismos ajustes que la conversión en una pasada. MPEG-TS
+// repite SPS/PPS en el stream, así la unión no depende de la cabecera del
+// primer segmento; fps_mode passthrough evita duplicar o quitar cuadros.
+func encodeVideoSegment(ctx context.Context, inputPath, outputPath string, start, end float64, opts videoToMp4Options) error {
+	args := rotationInputArgs(opts.rotation, opts.PreserveRotation)
+	if start > 0 {
+		args = append(args, "-ss", keyframeTime(start))
+	}
+	if end > 0 {
+		args = append(args, "-to", keyframeTime(end))
+	}
+	args = append(args,
+		"-i", inputPath,
+		"-map", "0:v:0",
+		"-an", "-sn", "-dn",
+		"-fps_mode", "passthrough",
+		"-pix_fmt", "yuv420p",
+		"-c:v", "libx264",
+		"-preset", "ultrafast",
+		"-crf", "23",
+	)
+	if len(opts.fitFilters) > 0 {
+		args = append(args, "-vf", strings.Join(opts.fitFilters, ","))
+	}
+	// Sin FFMPEG_THREADS_* los núcleos se reparten entre los segmentos
+	if classThreadArgs(ctx, classBatch) == nil {
+		args = append(args, "-threads", strconv.Itoa(max(1, runtime.NumCPU()/parallelWorkers)))
+	}
+	args = append(args, "-f", "mpegts", "-y", outputPath)
+
+	cmd := ffmpegCommand(ctx, classBatch, args...)
+	var errBuffer bytes.Buffer
+	cmd.Stderr = &errBuffer
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error al codificar el segmento desde %s s: %v, detalles: %s", keyframeTime(start), err, errBuffer.String())
+	}
+	return nil
+}
+
+// concatVideoSegments une los segmentos con el demuxer concat y codifica el
+// audio de la entrada, o silencio si no tiene, en la misma pasada. La
+// duración de cada segmento va en la lista para que los tiempos no dependan
+// de la estimación de MPEG-TS.
+func concatVideoSegments(ctx context.Context, dir string, segments []videoSegment, inputPath, outputPath string, index *videoPacketIndex, opts videoToMp4Options) error {
+	var list strings.Builder
+	list.WriteString("ffconcat version 1.0\n")
+	for _, segment := range segments {
+		fmt.Fprintf(&list, "file '%s'\n", filepath.Base(segment.Path))
+		if segment.End > 0 {
+			fmt.Fprintf(&list, "duration %s\n", keyframeTime(segment.End-segment.Start))
+		}
+	}
+	listPath := filepath.Join(dir, "segments.ffconcat")
+	if err := os.WriteFile(listPath, []byte(list.String()), 0o600); err != nil {
+		return fmt.Errorf("error al escribir la lista de segmentos: %v", err)
+	}
+
+	args := []string{"-f", "concat", "-safe", "0", "-i", listPath}
+	if index.HasAudio {
+		args = append(args, "-i", inputPath)
+	} else {
+		args = append(args, "-f", "lavfi", "-i", "anullsrc=r=48000:cl=stereo:d="+keyframeTime(index.Duration))
+	}
+	args = append(args,
+		"-map", "0:v:0",
+		"-map", "1:a:0",
+		"-c:v", "copy",
+	)
+	args = append(args, opts.audioArgs()...)
+	args = append(args, "-movflags", "faststart")
+	args = append(args, rotationOutputArgs(opts.rotation, opts.PreserveRotation)...)
+	args = append(args, encodeMarkerArgs(ctx)...)
+	args = append(args, "-y", outputPath)
+
+	cmd := ffmpegCommand(ctx, classBatch, args...)
+	var errBuffer bytes.Buffer
+	cmd.Stderr = &errBuffer
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error al unir los segmentos: %v, detalles: %s", err, errBuffer.String())
+	}
+	return nil
+}
+
+// probeFormatDuration lee la duración del contenedor
+func probeFormatDuration(ctx context.Context, path string) (float64, error) {
+	cmd := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "csv=p=0",
+		path)
+	var outBuffer, errBuffer bytes.Buffer
+	cmd.Stdout = &outBuffer
+	cmd.Stderr = &errBuffer
+	if err := cmd.Run(); err != nil {
+		return 0, fmt.Errorf("ffprobe no pudo leer la duración de %s: %v, detalles: %s", filepath.Base(path), err, strings.TrimSpace(errBuffer.String()))
+	}
+	duration, err := strconv.ParseFloat(strings.TrimSpace(outBuffer.String()), 64)
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe no devolvió la duración de %s", filepath.Base(path))
+	}
+	return duration, nil
+}
+
+// countVideoPackets cuenta los paquetes del primer stream de video sin
+// decodificarlos
+func countVideoPackets(ctx context.Context, path string) (int, error) {
+	cmd := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-count_packets",
+		"-show_entries", "stream=nb_read_packets",
+		"-of", "csv=p=0",
+		path)
+	var outBuffer, errBuffer bytes.Buffer
+	cmd.Stdout = &outBuffer
+	cmd.Stderr = &errBuffer
+	if err := cmd.Run(); err != nil {
+		return 0, fmt.Errorf("ffprobe no pudo contar los cuadros de %s: %v, detalles: %s", filepath.Base(path), err, strings.TrimSpace(errBuffer.String()))
+	}
+	packets, err := strconv.Atoi(strings.TrimSpace(outBuffer.String()))
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe no devolvió la cantidad de cuadros de %s", filepath.Base(path))
+	}
+	return packets, nil
+}
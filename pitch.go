@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// rubberbandAvailable indica si ffmpeg incluye el filtro rubberband, que
+// cambia el tono con mejor calidad que asetrate + atempo
+var rubberbandAvailable bool
+
+func loadPitchConfig() {
+	rubberbandAvailable = availableFilters()["rubberband"]
+	fmt.Printf("Filtro rubberband disponible: %v\n", rubberbandAvailable)
+}
+
+// parsePitchSemitones valida pitch_semitones (entre -12 y 12; 0 no cambia el tono)
+func parsePitchSemitones(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	semitones, err := strconv.ParseFloat(value, 64)
+	if err != nil || semitones < -12 || semitones > 12 {
+		return 0, invalidParam("pitch_semitones", "pitch_semitones inválido %q (entre -12 y 12)", value)
+	}
+	return semitones, nil
+}
+
+// preparePitch obtiene la frecuencia de muestreo de la entrada, necesaria
+// para asetrate cuando no hay rubberband
+func (opts *audioOptions) preparePitch(ctx context.Context, inputData []byte) {
+	if opts.PitchSemitones == 0 || rubberbandAvailable || opts.pitchSampleRate != "" {
+		return
+	}
+	opts.pitchSampleRate = "48000"
+	if stream, err := probeAudioStream(ctx, inputData); err == nil && stream.SampleRate != "" {
+		opts.pitchSampleRate = stream.SampleRate
+	}
+}
+
+// pitchFilter cambia el tono sin alterar la duración. Sin rubberband se
+// reproduce a otra frecuencia (asetrate), se vuelve a la original y atempo
+// compensa el cambio de velocidad.
+func pitchFilter(semitones float64, sampleRate string) string {
+	factor := math.Pow(2, semitones/12)
+	if rubberbandAvailable {
+		return "rubberband=pitch=" + strconv.FormatFloat(factor, 'f', 6, 64)
+	}
+
+	rate, err := strconv.Atoi(sampleRate)
+	if err != nil || rate <= 0 {
+		rate = 48000
+	}
+	return fmt.Sprintf("asetrate=%d,aresample=%d,%s",
+		int(math.Round(float64(rate)*factor)), rate, atempoFilter(1/factor))
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// videoPreset declara las restricciones de entrega de una plataforma. Los
+// límites de resolución se expresan en horizontal y se invierten para las
+// salidas verticales.
+type videoPreset struct {
+	MaxWidth  int `json:"max_width"`
+	MaxHeight int `json:"max_height"`
+	// Aspect fuerza una relación "16:9"; "" conserva la de la entrada
+	Aspect string `json:"aspect"`
+	// Fit es "pad" (barras negras) o "crop" (recorte en el punto focal)
+	Fit string `json:"fit"`
+	// AllowPortrait permite salidas verticales; si es false se encuadran en
+	// el aspecto del preset (16:9 si no declara uno)
+	AllowPortrait bool `json:"allow_portrait"`
+}
+
+// builtinVideoPresets son los presets incluidos; VIDEO_PRESETS_FILE agrega o
+// reemplaza entradas desde un JSON {"nombre": {...}}
+var builtinVideoPresets = map[string]videoPreset{
+	"hd_1080p":  {MaxWidth: 1920, MaxHeight: 1080, Fit: "pad", AllowPortrait: true},
+	"hd_720p":   {MaxWidth: 1280, MaxHeight: 720, Fit: "pad", AllowPortrait: true},
+	"landscape": {MaxWidth: 1920, MaxHeight: 1080, Aspect: "16:9", Fit: "pad"},
+	"square":    {MaxWidth: 1080, MaxHeight: 1080, Aspect: "1:1", Fit: "crop", AllowPortrait: true},
+	"vertical":  {MaxWidth: 1920, MaxHeight: 1080, Aspect: "9:16", Fit: "crop", AllowPortrait: true},
+}
+
+// presetConfig guarda los presets disponibles: los incluidos más los de
+// VIDEO_PRESETS_FILE
+type presetConfig struct {
+	videoPresets map[string]videoPreset
+}
+
+func loadPresetConfig(cfg *reloadableConfig) {
+	presets, err := readVideoPresets()
+	if err != nil {
+		fmt.Println(err)
+		presets = builtinVideoPresets
+	}
+	cfg.videoPresets = presets
+	if os.Getenv("VIDEO_PRESETS_FILE") != "" {
+		fmt.Printf("Presets de video cargados: %d\n", len(presets))
+	}
+}
+
+// readVideoPresets arma los presets incluidos más los de VIDEO_PRESETS_FILE.
+// Los presets inválidos se ignoran; un archivo ilegible es un error.
+func readVideoPresets() (map[string]videoPreset, error) {
+	presets := make(map[string]videoPreset, len(builtinVideoPresets))
+	for name, preset := range builtinVideoPresets {
+		presets[name] = preset
+	}
+	path := os.Getenv("VIDEO_PRESETS_FILE")
+	if path == "" {
+		return presets, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo leer VIDEO_PRESETS_FILE: %v", err)
+	}
+	var custom map[string]videoPreset
+	if err := json.Unmarshal(raw, &custom); err != nil {
+		return nil, fmt.Errorf("VIDEO_PRESETS_FILE inválido: %v", err)
+	}
+	for name, preset := range custom {
+		if err := preset.validate(); err != nil {
+			fmt.Printf("Preset %s ignorado: %v\n", name, err)
+			continue
+		}
+		presets[name] = preset
+	}
+	return presets, nil
+}
+
+func (preset videoPreset) validate() error {
+	if preset.MaxWidth < 0 || preset.MaxHeight < 0 {
+		return errors.New("max_width/max_height no pueden ser negativos")
+	}
+	if preset.Aspect != "" {
+		if _, err := parseAspect(preset.Aspect); err != nil {
+			return err
+		}
+	}
+	if preset.Fit != "" && preset.Fit != "pad" && preset.Fit != "crop" {
+		return fmt.Errorf("fit inválido %q (pad o crop)", preset.Fit)
+	}
+	return nil
+}
+
+// lookupVideoPreset devuelve el preset por nombre
+func lookupVideoPreset(name string) (*videoPreset, error) {
+	if name == "" {
+		return nil, nil
+	}
+	preset, ok := config().videoPresets[name]
+	if !ok {
+		return nil, invalidParam("preset", "preset desconocido %q", name)
+	}
+	return &preset, nil
+}
+
+// parseAspect convierte "16:9" en su relación ancho/alto
+func parseAspect(aspect string) (float64, error) {
+	parts := strings.Split(aspect, ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("aspect inválido %q (p. ej. 16:9)", aspect)
+	}
+	w, errW := strconv.Atoi(parts[0])
+	h, errH := strconv.Atoi(parts[1])
+	if errW != nil || errH != nil || w <= 0 || h <= 0 {
+		return 0, fmt.Errorf("aspect inválido %q (p. ej. 16:9)", aspect)
+	}
+	return float64(w) / float64(h), nil
+}
+
+// videoFitPlan es el resultado de ajustar una entrada a un preset
+type videoFitPlan struct {
+	Filters []string
+	// Transformations describe cada cambio para la respuesta
+	Transformations []string
+	Width           int
+	Height          int
+}
+
+// planVideoFit calcula los filtros para que un video de width x height
+// (dimensiones de visualización, con la rotación ya aplicada) cumpla el
+// preset. Los recortes se centran en focus.
+func planVideoFit(width, height int, preset videoPreset, focus focalPoint) videoFitPlan {
+	plan := videoFitPlan{Width: width, Height: height}
+
+	aspect := 0.0
+	if preset.Aspect != "" {
+		aspect, _ = parseAspect(preset.Aspect)
+	}
+	if !preset.AllowPortrait && height > width && (aspect == 0 || aspect < 1) {
+		aspect = 16.0 / 9.0
+	}
+
+	current := float64(plan.Width) / float64(plan.Height)
+	if aspect > 0 && math.Abs(current-aspect) > 0.01 {
+		fit := preset.Fit
+		if fit == "" {
+			fit = "pad"
+		}
+		targetW, targetH := plan.Width, plan.Height
+		switch {
+		case fit == "crop" && current > aspect:
+			targetW = evenDimension(float64(plan.Height) * aspect)
+		case fit == "crop":
+			targetH = evenDimension(float64(plan.Width) / aspect)
+		case current > aspect:
+			targetH = evenDimension(float64(plan.Width) / aspect)
+		default:
+			targetW = evenDimension(float64(plan.Height) * aspect)
+		}
+
+		detail := aspectLabel(preset.Aspect, aspect)
+		if fit == "crop" {
+			x := cropOffset(focus.X, plan.Width, targetW)
+			y := cropOffset(focus.Y, plan.Height, targetH)
+			plan.Filters = append(plan.Filters, fmt.Sprintf("crop=%d:%d:%d:%d", targetW, targetH, x, y))
+			if focus != centerFocus {
+				detail += fmt.Sprintf(", focus %.2f,%.2f", focus.X, focus.Y)
+			}
+		} else {
+			plan.Filters = append(plan.Filters, fmt.Sprintf("pad=%d:%d:(ow-iw)/2:(oh-ih)/2:black", targetW, targetH))
+		}
+		plan.Transformations = append(plan.Transformations,
+			fmt.Sprintf("%s %dx%d -> %dx%d (%s)", fit, plan.Width, plan.Height, targetW, targetH, detail))
+		plan.Width, plan.Height = targetW, targetH
+	}
+
+	// Los límites del preset son horizontales; en vertical se invierten
+	maxW, maxH := preset.MaxWidth, preset.MaxHeight
+	if plan.Height > plan.Width {
+		maxW, maxH = maxH, maxW
+	}
+	scale := 1.0
+	if maxW > 0 && plan.Width > maxW {
+		scale = math.Min(scale, float64(maxW)/float64(plan.Width))
+	}
+	if maxH > 0 && plan.Height > maxH {
+		scale = math.Min(scale, float64(maxH)/float64(plan.Height))
+	}
+	if scale < 1 {
+		targetW := evenDimension(float64(plan.Width) * scale)
+		targetH := evenDimension(float64(plan.Height) * scale)
+		plan.Filters = append(plan.Filters, fmt.Sprintf("scale=%d:%d", targetW, targetH))
+		plan.Transformations = append(plan.Transformations,
+			fmt.Sprintf("scale %dx%d -> %dx%d", plan.Width, plan.Height, targetW, targetH))
+		plan.Width, plan.Height = targetW, targetH
+	}
+
+	return plan
+}
+
+// cropOffset ubica una ventana de size píxeles centrada en focus (0-1)
+// dentro de total, sin salirse del cuadro
+func cropOffset(focus float64, total, size int) int {
+	offset := int(math.Round(focus*float64(total) - float64(size)/2))
+	if offset < 0 {
+		return 0
+	}
+	if offset > total-size {
+		return total - size
+	}
+	return offset
+}
+
+func aspectLabel(declared string, aspect float64) string {
+	if declared != "" {
+		return declared
+	}
+	return strconv.FormatFloat(aspect, 'f', 3, 64)
+}
+
+// evenDimension redondea al par más cercano: libx264 con yuv420p no admite
+// dimensiones impares
+func evenDimension(value float64) int {
+	dimension := int(math.Round(value/2)) * 2
+	if dimension < 2 {
+		return 2
+	}
+	return dimension
+}
+
+// probeVideoDimensions devuelve las dimensiones de visualización del primer
+// stream de video, teniendo en cuenta la rotación que se aplicará
+func probeVideoDimensions(ctx context.Context, inputData []byte, rotation int) (int, int, error) {
+	_, probe, err := probeMedia(ctx, inputData)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, stream := range probe.Streams {
+		if stream.CodecType == "video" && stream.Width > 0 && stream.Height > 0 {
+			if rotation == 90 || rotation == 270 {
+				return stream.Height, stream.Width, nil
+			}
+			return stream.Width, stream.Height, nil
+		}
+	}
+	return 0, 0, errors.New("la entrada no contiene video")
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+)
+
+// Clases de proceso: las conversiones interactivas (notas de voz, imágenes,
+// frames) y las de lote (video, GIF y todo lo que corre en la cola de trabajos)
+// pueden tener hilos y prioridad de sistema distintos.
+const (
+	classInteractive = "interactive"
+	classBatch       = "batch"
+)
+
+// processClassConfig es la configuración de una clase de proceso
+type processClassConfig struct {
+	threads       int
+	nice          int
+	ioniceClass   int
+	ioniceLevel   int
+	useIonice     bool
+	niceAvailable bool
+}
+
+var processClasses = map[string]processClassConfig{}
+
+func loadPriorityConfig() {
+	_, niceErr := exec.LookPath("nice")
+	_, ioniceErr := exec.LookPath("ionice")
+
+	for _, class := range []string{classInteractive, classBatch} {
+		suffix := "_INTERACTIVE"
+		if class == classBatch {
+			suffix = "_BATCH"
+		}
+
+		config := processClassConfig{
+			threads:     envInt("FFMPEG_THREADS"+suffix, 0),
+			nice:        envInt("FFMPEG_NICE"+suffix, 0),
+			ioniceClass: envInt("FFMPEG_IONICE_CLASS"+suffix, 0),
+			ioniceLevel: envInt("FFMPEG_IONICE_LEVEL"+suffix, -1),
+		}
+		config.niceAvailable = niceErr == nil
+		config.useIonice = config.ioniceClass > 0 && ioniceErr == nil
+
+		if config.nice != 0 && niceErr != nil {
+			fmt.Printf("FFMPEG_NICE%s configurado pero 'nice' no está disponible\n", suffix)
+		}
+		if config.ioniceClass > 0 && ioniceErr != nil {
+			fmt.Printf("FFMPEG_IONICE_CLASS%s configurado pero 'ionice' no está disponible\n", suffix)
+		}
+
+		processClasses[class] = config
+	}
+}
+
+// processClassFrom devuelve la clase asociada al contexto o defaultClass
+func processClassFrom(ctx context.Context, defaultClass string) string {
+	if class := requestInfoFrom(ctx).Class; class != "" {
+		return class
+	}
+	return defaultClass
+}
+
+// ffmpegCommand construye el comando ffmpeg aplicando la configuración de la
+// clase: -threads se inserta antes del destino (último argumento) si el
+// comando no lo define ya, y el proceso se envuelve con nice/ionice. Dentro
+// de un trabajo se agrega -progress.
+func ffmpegCommand(ctx context.Context, defaultClass string, args ...string) *exec.Cmd {
+	config := processClasses[processClassFrom(ctx, defaultClass)]
+	traceFilterGraphs(ctx, args)
+
+	if config.threads > 0 && !containsArg(args, "-threads") && len(args) > 0 {
+		last := len(args) - 1
+		withThreads := make([]string, 0, len(args)+2)
+		withThreads = append(withThreads, args[:last]...)
+		withThreads = append(withThreads, "-threads", strconv.Itoa(config.threads), args[last])
+		args = withThreads
+	}
+	// En los trabajos en cola ffmpeg informa su avance (ver progress.go)
+	if progress := jobProgressFrom(ctx); progress != nil {
+		args = append(progress.progressArgs(), args...)
+	}
+
+	command := append([]string{"ffmpeg"}, args...)
+	if config.nice != 0 && config.niceAvailable {
+		command = append([]string{"nice", "-n", strconv.Itoa(config.nice)}, command...)
+	}
+	if config.useIonice {
+		ionice := []string{"ionice", "-c", strconv.Itoa(config.ioniceClass)}
+		if config.ioniceLevel >= 0 {
+			ionice = append(ionice, "-n", strconv.Itoa(config.ioniceLevel))
+		}
+		command = append(ionice, command...)
+	}
+
+	return exec.CommandContext(ctx, command[0], command[1:]...)
+}
+
+// classThreadArgs devuelve "-threads N" para la clase, o nada si no se configuró
+func classThreadArgs(ctx context.Context, defaultClass string) []string {
+	config := processClasses[processClassFrom(ctx, defaultClass)]
+	if config.threads <= 0 {
+		return nil
+	}
+	return []string{"-threads", strconv.Itoa(config.threads)}
+}
+
+func containsArg(args []string, name string) bool {
+	for _, arg := range args {
+		if arg == name {
+			return true
+		}
+	}
+	return false
+}
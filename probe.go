@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ffprobeOutput es la salida de ffprobe -show_format -show_streams
+type ffprobeOutput struct {
+	Format struct {
+		FormatName     string            `json:"format_name"`
+		FormatLongName string            `json:"format_long_name"`
+		Duration       string            `json:"duration"`
+		BitRate        string            `json:"bit_rate"`
+		Size           string            `json:"size"`
+		Tags           map[string]string `json:"tags"`
+	} `json:"format"`
+	Streams []struct {
+		Index         int               `json:"index"`
+		CodecType     string            `json:"codec_type"`
+		CodecName     string            `json:"codec_name"`
+		CodecLongName string            `json:"codec_long_name"`
+		Profile       string            `json:"profile"`
+		Width         int               `json:"width"`
+		Height        int               `json:"height"`
+		PixFmt        string            `json:"pix_fmt"`
+		AvgFrameRate  string            `json:"avg_frame_rate"`
+		SampleRate    string            `json:"sample_rate"`
+		SampleFmt     string            `json:"sample_fmt"`
+		Channels      int               `json:"channels"`
+		ChannelLayout string            `json:"channel_layout"`
+		BitRate       string            `json:"bit_rate"`
+		Duration      string            `json:"duration"`
+		Tags          map[string]string `json:"tags"`
+		Disposition   struct {
+			AttachedPic int `json:"attached_pic"`
+		} `json:"disposition"`
+	} `json:"streams"`
+}
+
+// probeMedia ejecuta ffprobe sobre la entrada y devuelve la salida JSON sin
+// procesar junto con su versión decodificada
+func probeMedia(ctx context.Context, inputData []byte) ([]byte, *ffprobeOutput, error) {
+	// Archivo temporal: MP4/MOV necesita seek para encontrar el moov
+	inputPath, cleanup, err := writeTempInput(inputData, "probe-media-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cleanup()
+
+	cmd := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-show_format",
+		"-show_streams",
+		"-of", "json",
+		inputPath)
+
+	var outBuffer, errBuffer bytes.Buffer
+	cmd.Stdout = &outBuffer
+	cmd.Stderr = &errBuffer
+
+	if err := cmd.Run(); err != nil {
+		return nil, nil, fmt.Errorf("ffprobe no pudo leer la entrada: %v, detalles: %s", err, strings.TrimSpace(errBuffer.String()))
+	}
+
+	var probe ffprobeOutput
+	if err := json.Unmarshal(outBuffer.Bytes(), &probe); err != nil {
+		return nil, nil, fmt.Errorf("error al leer la salida de ffprobe: %v", err)
+	}
+	return outBuffer.Bytes(), &probe, nil
+}
+
+// suggestedInputFormat traduce el format_name de ffprobe al valor de
+// input_format (la extensión del archivo temporal de /video-to-mp4)
+func suggestedInputFormat(probe *ffprobeOutput) string {
+	names := strings.Split(probe.Format.FormatName, ",")
+	switch names[0] {
+	case "mov":
+		// mov,mp4,m4a,3gp,3g2,mj2: la marca no se distingue, mp4 sirve para todos
+		return "mp4"
+	case "matroska":
+		for _, stream := range probe.Streams {
+			if stream.CodecType == "video" && stream.CodecName != "vp8" && stream.CodecName != "vp9" && stream.CodecName != "av1" {
+				return "mkv"
+			}
+		}
+		return "webm"
+	case "mpegts":
+		return "ts"
+	case "image2", "png_pipe", "jpeg_pipe", "webp_pipe":
+		if len(probe.Streams) > 0 {
+			return strings.TrimSuffix(probe.Streams[0].CodecName, "_pipe")
+		}
+	}
+	return names[0]
+}
+
+// parseProbeNumber convierte los números que ffprobe entrega como texto
+func parseProbeNumber(value string) interface{} {
+	if value == "" || value == "N/A" {
+		return nil
+	}
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		return f
+	}
+	return nil
+}
+
+// probeSummary resume la salida de ffprobe para la respuesta de /probe
+func probeSummary(probe *ffprobeOutput) gin.H {
+	streams := make([]gin.H, 0, len(probe.Streams))
+	for _, stream := range probe.Streams {
+		entry := gin.H{
+			"index":      stream.Index,
+			"type":       stream.CodecType,
+			"codec":      stream.CodecName,
+			"codec_name": stream.CodecLongName,
+			"bit_rate":   parseProbeNumber(stream.BitRate),
+			"duration":   parseProbeNumber(stream.Duration),
+		}
+		if stream.Profile != "" {
+			entry["profile"] = stream.Profile
+		}
+		switch stream.CodecType {
+		case "video":
+			entry["width"] = stream.Width
+			entry["height"] = stream.Height
+			entry["resolution"] = fmt.Sprintf("%dx%d", stream.Width, stream.Height)
+			entry["pix_fmt"] = stream.PixFmt
+			entry["frame_rate"] = stream.AvgFrameRate
+		case "audio":
+			entry["sample_rate"] = parseProbeNumber(stream.SampleRate)
+			entry["sample_fmt"] = stream.SampleFmt
+			entry["channels"] = stream.Channels
+			entry["channel_layout"] = stream.ChannelLayout
+		}
+		if len(stream.Tags) > 0 {
+			entry["tags"] = stream.Tags
+		}
+		streams = append(streams, entry)
+	}
+
+	container := gin.H{
+		"format":      probe.Format.FormatName,
+		"format_name": probe.Format.FormatLongName,
+		"duration":    parseProbeNumber(probe.Format.Duration),
+		"bit_rate":    parseProbeNumber(probe.Format.BitRate),
+		"size":        parseProbeNumber(probe.Format.Size),
+	}
+	if len(probe.Format.Tags) > 0 {
+		container["tags"] = probe.Format.Tags
+	}
+
+	return gin.H{
+		"container":    container,
+		"streams":      streams,
+		"input_format": suggestedInputFormat(probe),
+	}
+}
+
+// processProbe atiende /probe: describe la entrada sin convertirla
+func processProbe(c *gin.Context) {
+	if !validateAPIKey(c) {
+		return
+	}
+
+	inputData, err := getInputData(c)
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+
+	raw, probe, err := probeMedia(c.Request.Context(), inputData)
+	if err != nil {
+		respondError(c, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	response := probeSummary(probe)
+	// raw=true incluye la salida completa de ffprobe
+	if c.PostForm("raw") == "true" || c.Query("raw") == "true" {
+		response["ffprobe"] = json.RawMessage(raw)
+	}
+
+	c.JSON(http.StatusOK, attachDebug(c.Request.Context(), response))
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// progressPollInterval es cada cuánto se lee el archivo -progress de ffmpeg
+const progressPollInterval = 500 * time.Millisecond
+
+// jobProgress sigue el avance de los procesos ffmpeg de un trabajo. Cada
+// proceso escribe su -progress en un archivo temporal; se lee el último
+// bloque del proceso más reciente.
+type jobProgress struct {
+	mu sync.Mutex
+	// duration es la duración de la entrada en segundos (0 si no se conoce)
+	duration  float64
+	outTime   float64
+	speed     float64
+	updatedAt time.Time
+
+	current string
+	files   []string
+	stop    chan struct{}
+}
+
+func newJobProgress() *jobProgress {
+	progress := &jobProgress{stop: make(chan struct{})}
+	go progress.poll()
+	return progress
+}
+
+func withJobProgress(ctx context.Context, progress *jobProgress) context.Context {
+	return context.WithValue(ctx, jobProgressKey, progress)
+}
+
+func jobProgressFrom(ctx context.Context) *jobProgress {
+	progress, _ := ctx.Value(jobProgressKey).(*jobProgress)
+	return progress
+}
+
+// probeDuration fija la duración de referencia a partir de la entrada
+func (p *jobProgress) probeDuration(ctx context.Context, inputData []byte) {
+	if len(inputData) == 0 {
+		return
+	}
+	_, probe, err := probeMedia(ctx, inputData)
+	if err != nil {
+		return
+	}
+	duration, err := strconv.ParseFloat(probe.Format.Duration, 64)
+	if err != nil || duration <= 0 {
+		return
+	}
+	p.mu.Lock()
+	p.duration = duration
+	p.mu.Unlock()
+}
+
+// progressArgs crea el archivo de progreso para un nuevo proceso y devuelve
+// las opciones globales que lo activan
+func (p *jobProgress) progressArgs() []string {
+	file, err := os.CreateTemp("", "ffmpeg-progress-*")
+	if err != nil {
+		return nil
+	}
+	file.Close()
+
+	p.mu.Lock()
+	p.current = file.Name()
+	p.files = append(p.files, file.Name())
+	p.outTime = 0
+	p.speed = 0
+	p.mu.Unlock()
+
+	return []string{"-progress", file.Name()}
+}
+
+func (p *jobProgress) poll() {
+	ticker := time.NewTicker(progressPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			path := p.current
+			p.mu.Unlock()
+			if path == "" {
+				continue
+			}
+			outTime, speed, ok := readProgressFile(path)
+			if !ok {
+				continue
+			}
+			p.mu.Lock()
+			if p.current == path {
+				p.outTime, p.speed, p.updatedAt = outTime, speed, time.Now()
+			}
+			p.mu.Unlock()
+		}
+	}
+}
+
+// close detiene la lectura y borra los archivos de progreso
+func (p *jobProgress) close() {
+	close(p.stop)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, path := range p.files {
+		os.Remove(path)
+	}
+	p.files = nil
+	p.current = ""
+}
+
+// readProgressFile lee el último bloque completo de -progress. Solo se
+// revisa el final del archivo: ffmpeg agrega un bloque por intervalo.
+func readProgressFile(path string) (outTime, speed float64, ok bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, false
+	}
+	defer file.Close()
+
+	if info, err := file.Stat(); err == nil && info.Size() > 4096 {
+		file.Seek(info.Size()-4096, io.SeekStart)
+	}
+
+	block := map[string]string{}
+	latest := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !found {
+			continue
+		}
+		block[key] = value
+		// "progress=continue|end" cierra cada bloque
+		if key == "progress" {
+			latest, block = block, map[string]string{}
+		}
+	}
+
+	outTimeUs, err := strconv.ParseInt(latest["out_time_us"], 10, 64)
+	if err != nil || outTimeUs < 0 {
+		return 0, 0, false
+	}
+	speed, _ = strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(latest["speed"]), "x"), 64)
+	return float64(outTimeUs) / 1e6, speed, true
+}
+
+// view devuelve el avance para la representación del trabajo: porcentaje,
+// velocidad (×tiempo real) y tiempo restante estimado
+func (p *jobProgress) view() gin.H {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.updatedAt.IsZero() {
+		return nil
+	}
+	view := gin.H{
+		"processed_seconds": math.Round(p.outTime*100) / 100,
+		"speed":             math.Round(p.speed*100) / 100,
+		"updated_at":        p.updatedAt.UTC().Format(time.RFC3339),
+	}
+	if p.duration > 0 {
+		view["duration_seconds"] = math.Round(p.duration*100) / 100
+		percent := math.Min(p.outTime/p.duration*100, 100)
+		view["percent"] = math.Round(percent*10) / 10
+		if p.speed > 0 {
+			remaining := math.Max(p.duration-p.outTime, 0) / p.speed
+			view["eta_seconds"] = math.Round(remaining)
+		}
+	}
+	return view
+}
+
+// streamJobEvents atiende GET /jobs/:id/events: emite el estado del trabajo
+// como Server-Sent Events cada segundo hasta que termina
+func streamJobEvents(c *gin.Context) {
+	if !validateAPIKey(c) {
+		return
+	}
+
+	j, ok := lookupRequestJob(c)
+	if !ok {
+		return
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Stream(func(w io.Writer) bool {
+		view := j.view()
+		status := view["status"].(jobStatus)
+		if status == jobSucceeded || status == jobFailed {
+			c.SSEvent("done", view)
+			return false
+		}
+		c.SSEvent("progress", view)
+
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-ticker.C:
+			return true
+		}
+	})
+	fmt.Printf("[jobs] Stream de eventos del trabajo %s cerrado\n", j.ID)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+)
+
+// proxyVideoScale reduce el lado menor a 480 px como máximo, sin agrandar,
+// tanto en los videos horizontales como en los verticales
+const proxyVideoScale = "scale='if(gt(iw,ih),-2,min(480,iw))':'if(gt(iw,ih),min(480,ih),-2)'"
+
+// renderAudioProxy codifica una vista previa rápida del audio: Opus mono a
+// 32 kbps, sin los filtros de la conversión completa
+func renderAudioProxy(ctx context.Context, inputData []byte) ([]byte, error) {
+	inputSource, stdin, cleanup, err := ffmpegInput(inputData, "proxy-input-*")
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	cmd := ffmpegCommand(ctx, classInteractive,
+		"-i", inputSource,
+		"-map", "0:a:0",
+		"-vn",
+		"-c:a", "libopus",
+		"-b:a", "32k",
+		"-ac", "1",
+		"-f", "ogg",
+		"pipe:1",
+	)
+	cmd.Stdin = stdin
+	var output, errBuffer bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &errBuffer
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error al generar la vista previa: %v, detalles: %s", err, errBuffer.String())
+	}
+	return output.Bytes(), nil
+}
+
+// renderVideoProxy codifica una vista previa rápida del video: 480p con
+// libx264 ultrafast y AAC a 64 kbps, sin los ajustes de la conversión
+// completa
+func renderVideoProxy(ctx context.Context, inputData []byte) ([]byte, error) {
+	inputPath, cleanup, err := writeTempInput(inputData, "proxy-input-*")
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	outputFile, err := os.CreateTemp("", "proxy-output-*.mp4")
+	if err != nil {
+		return nil, err
+	}
+	outputPath := outputFile.Name()
+	outputFile.Close()
+	defer os.Remove(outputPath)
+
+	// faststart necesita un archivo para mover el moov al principio
+	args := []string{
+		"-i", inputPath,
+		"-map", "0:v:0",
+		"-map", "0:a:0?",
+		"-vf", proxyVideoScale,
+		"-c:v", "libx264",
+		"-preset", "ultrafast",
+		"-crf", "30",
+		"-pix_fmt", "yuv420p",
+		"-c:a", "aac",
+		"-b:a", "64k",
+		"-ac", "2",
+		"-movflags", "+faststart",
+		"-y", outputPath,
+	}
+	if err := checkFilterArgs(args); err != nil {
+		return nil, err
+	}
+	cmd := ffmpegCommand(ctx, classInteractive, args...)
+	var errBuffer bytes.Buffer
+	cmd.Stderr = &errBuffer
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error al generar la vista previa: %v, detalles: %s", err, errBuffer.String())
+	}
+	return os.ReadFile(outputPath)
+}
+
+// respondWithProxy responde a una solicitud con fast_start=true: la
+// conversión completa ya está encolada en j y se entrega por callback_url (o
+// en /jobs/:id), y mientras tanto se devuelve una vista previa de baja
+// calidad. kind es audio o video. Si la vista previa falla se responde solo
+// con el trabajo, que sigue en curso.
+func respondWithProxy(c *gin.Context, j *job, kind string, inputData []byte, binary bool) {
+	ctx := c.Request.Context()
+	render, format, contentType := renderAudioProxy, "ogg", "audio/ogg"
+	if kind == "video" {
+		render, format, contentType = renderVideoProxy, "mp4", "video/mp4"
+	}
+
+	proxy, err := render(ctx, inputData)
+	if err == nil {
+		proxy, err = interceptOutput(ctx, format, proxy)
+	}
+	if err != nil {
+		fmt.Printf("[jobs] Vista previa del trabajo %s fallida: %v\n", j.ID, err)
+		view := j.view()
+		view["proxy_error"] = err.Error()
+		c.JSON(http.StatusAccepted, attachDebug(ctx, view))
+		return
+	}
+	recordDebug(ctx, "proxy", gin.H{"format": format, "size": len(proxy)})
+
+	if binary {
+		writeBinaryResponse(c, proxy, "preview."+format, contentType, map[string]string{
+			"X-Format": format,
+			"X-Proxy":  "true",
+			"X-Job-ID": j.ID,
+		})
+		return
+	}
+	view := j.view()
+	view["proxy"] = gin.H{
+		"format": format,
+		kind:     base64.StdEncoding.EncodeToString(proxy),
+		"size":   len(proxy),
+	}
+	c.JSON(http.StatusAccepted, attachDebug(ctx, view))
+}
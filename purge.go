@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// downloadLinkPattern extrae el ID de los enlaces de /downloads/:id que
+// aparecen en un resultado
+var downloadLinkPattern = regexp.MustCompile(`/downloads/([0-9a-f]{32})\?`)
+
+var (
+	errJobNotFinished  = errors.New("el trabajo todavía no terminó")
+	errArtifactsRemain = errors.New("no se pudieron borrar todos los objetos de S3; el resultado se conserva para reintentar")
+)
+
+// storedObject es una salida subida a S3 por el servicio
+type storedObject struct {
+	Bucket string
+	Key    string
+	// Region es la storage_region del destino, si se usó una
+	Region string
+}
+
+// storedArtifacts son los archivos que un resultado dejó fuera de la memoria
+type storedArtifacts struct {
+	Downloads []string
+	Objects   []storedObject
+}
+
+// collectArtifacts recorre un resultado buscando enlaces de descarga y los
+// objetos de S3 indicados en "storage"
+func collectArtifacts(value interface{}, artifacts *storedArtifacts) {
+	switch v := value.(type) {
+	case gin.H:
+		collectArtifacts(map[string]interface{}(v), artifacts)
+	case map[string]interface{}:
+		for key, item := range v {
+			if storage, ok := item.(gin.H); ok && key == "storage" {
+				bucket, _ := storage["bucket"].(string)
+				objectKey, _ := storage["key"].(string)
+				region, _ := storage["storage_region"].(string)
+				if bucket != "" && objectKey != "" {
+					artifacts.Objects = append(artifacts.Objects, storedObject{Bucket: bucket, Key: objectKey, Region: region})
+				}
+				continue
+			}
+			collectArtifacts(item, artifacts)
+		}
+	case []gin.H:
+		for _, item := range v {
+			collectArtifacts(item, artifacts)
+		}
+	case []interface{}:
+		for _, item := range v {
+			collectArtifacts(item, artifacts)
+		}
+	case string:
+		for _, match := range downloadLinkPattern.FindAllStringSubmatch(v, -1) {
+			artifacts.Downloads = append(artifacts.Downloads, match[1])
+		}
+	}
+}
+
+// purgeReport resume lo borrado por una o varias eliminaciones
+type purgeReport struct {
+	Downloads int
+	Objects   int
+	Errors    []string
+}
+
+func (report *purgeReport) view() gin.H {
+	view := gin.H{
+		"downloads_deleted": report.Downloads,
+		"objects_deleted":   report.Objects,
+	}
+	if len(report.Errors) > 0 {
+		view["errors"] = report.Errors
+	}
+	return view
+}
+
+// deleteJobResult borra el resultado de un trabajo terminado y los archivos
+// que generó. El trabajo se conserva, sin resultado y con ResultDeletedAt,
+// para que quien lo consulte sepa que se eliminó. Si algún objeto de S3 no
+// se pudo borrar, el resultado queda intacto para poder reintentar: es el
+// único registro de dónde están los archivos.
+func deleteJobResult(ctx context.Context, j *job, report *purgeReport) error {
+	j.mu.Lock()
+	if j.FinishedAt.IsZero() {
+		j.mu.Unlock()
+		return errJobNotFinished
+	}
+	result := j.Result
+	j.mu.Unlock()
+
+	var artifacts storedArtifacts
+	collectArtifacts(result, &artifacts)
+	failed := 0
+	for _, object := range artifacts.Objects {
+		if err := deleteFromS3(ctx, object); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s/%s: %v", object.Bucket, object.Key, err))
+			failed++
+			continue
+		}
+		report.Objects++
+	}
+	if failed > 0 {
+		fmt.Printf("[purge] Resultado del trabajo %s conservado: %d objetos sin borrar\n", j.ID, failed)
+		return errArtifactsRemain
+	}
+	for _, id := range artifacts.Downloads {
+		if removeDownload(id) {
+			report.Downloads++
+		}
+	}
+
+	j.mu.Lock()
+	j.Result = nil
+	if j.ResultDeletedAt.IsZero() {
+		j.ResultDeletedAt = time.Now()
+	}
+	j.mu.Unlock()
+	fmt.Printf("[purge] Resultado del trabajo %s eliminado\n", j.ID)
+	return nil
+}
+
+// deleteJobResultHandler atiende DELETE /jobs/:id/result
+func deleteJobResultHandler(c *gin.Context) {
+	if !validateAPIKey(c) {
+		return
+	}
+
+	j, ok := lookupRequestJob(c)
+	if !ok {
+		return
+	}
+
+	var report purgeReport
+	err := deleteJobResult(c.Request.Context(), j, &report)
+	if errors.Is(err, errJobNotFinished) {
+		respondError(c, http.StatusConflict, err)
+		return
+	}
+	response := report.view()
+	response["job_id"] = j.ID
+	if err != nil {
+		response["error"] = err.Error()
+		c.JSON(http.StatusBadGateway, response)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// purgeFilter selecciona trabajos terminados por antigüedad, etiquetas y
+// prefijo de clave S3; todas las condiciones indicadas deben cumplirse
+type purgeFilter struct {
+	OlderThan time.Duration
+	Labels    map[string]string
+	KeyPrefix string
+}
+
+func parsePurgeFilter(c *gin.Context) (purgeFilter, error) {
+	filter := purgeFilter{KeyPrefix: c.PostForm("key"), Labels: map[string]string{}}
+	if value := c.PostForm("older_than"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < 0 {
+			return filter, invalidParam("older_than", "older_than inválido %q (p. ej. 720h)", value)
+		}
+		filter.OlderThan = parsed
+	}
+	for _, value := range c.PostFormArray("label") {
+		key, labelValue, ok := strings.Cut(value, "=")
+		if !ok || key == "" {
+			return filter, invalidParam("label", "label inválido %q (clave=valor)", value)
+		}
+		filter.Labels[key] = labelValue
+	}
+	if filter.OlderThan == 0 && len(filter.Labels) == 0 && filter.KeyPrefix == "" {
+		return filter, errors.New("indique al menos un filtro: key, older_than o label")
+	}
+	return filter, nil
+}
+
+// matches se llama con j.mu tomado
+func (filter purgeFilter) matches(j *job, now time.Time) bool {
+	if j.FinishedAt.IsZero() || j.Result == nil {
+		return false
+	}
+	if filter.OlderThan > 0 && now.Sub(j.FinishedAt) < filter.OlderThan {
+		return false
+	}
+	for key, value := range filter.Labels {
+		if j.info.Labels[key] != value {
+			return false
+		}
+	}
+	if filter.KeyPrefix != "" {
+		var artifacts storedArtifacts
+		collectArtifacts(j.Result, &artifacts)
+		for _, object := range artifacts.Objects {
+			if strings.HasPrefix(object.Key, filter.KeyPrefix) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// purgeResults atiende POST /admin/purge: borra en bloque los resultados de
+// trabajos que cumplen los filtros, p. ej. para atender pedidos de
+// eliminación de datos personales. dry_run=true solo lista los trabajos.
+func purgeResults(c *gin.Context) {
+	if !validateAPIKey(c) {
+		return
+	}
+
+	filter, err := parsePurgeFilter(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	now := time.Now()
+	var matched []*job
+	jobsMu.Lock()
+	for _, j := range jobs {
+		j.mu.Lock()
+		if filter.matches(j, now) {
+			matched = append(matched, j)
+		}
+		j.mu.Unlock()
+	}
+	jobsMu.Unlock()
+
+	ids := make([]string, 0, len(matched))
+	for _, j := range matched {
+		ids = append(ids, j.ID)
+	}
+	dryRun := c.PostForm("dry_run") == "true"
+
+	var report purgeReport
+	var kept []string
+	if !dryRun {
+		for _, j := range matched {
+			if errors.Is(deleteJobResult(c.Request.Context(), j, &report), errArtifactsRemain) {
+				kept = append(kept, j.ID)
+			}
+		}
+	}
+	response := report.view()
+	if len(kept) > 0 {
+		response["kept_job_ids"] = kept
+	}
+	response["job_ids"] = ids
+	response["matched"] = len(ids)
+	response["dry_run"] = dryRun
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// quarantineThreshold es la cantidad de caídas de ffmpeg con la misma
+	// entrada y operación que la ponen en cuarentena (0 lo desactiva)
+	quarantineThreshold int
+	quarantineWindow    time.Duration
+	quarantineTTL       time.Duration
+	// quarantineSamples guarda una copia de la entrada en quarantineDir para
+	// depurar la caída
+	quarantineSamples bool
+	quarantineDir     string
+)
+
+func loadQuarantineConfig() {
+	quarantineThreshold = envInt("QUARANTINE_CRASH_THRESHOLD", 3)
+	quarantineWindow = envDuration("QUARANTINE_WINDOW", time.Hour)
+	quarantineTTL = envDuration("QUARANTINE_TTL", 24*time.Hour)
+	quarantineSamples = envBool("QUARANTINE_STORE_SAMPLES", false)
+	quarantineDir = os.Getenv("QUARANTINE_DIR")
+	if quarantineDir == "" {
+		quarantineDir = filepath.Join(os.TempDir(), "audio-converter-quarantine")
+	}
+}
+
+// crashRecord cuenta las caídas de una entrada en una operación
+type crashRecord struct {
+	Endpoint         string
+	Hash             string
+	Crashes          int
+	FirstCrash       time.Time
+	LastError        string
+	QuarantinedUntil time.Time
+	Sample           string
+}
+
+var (
+	crashMu      sync.Mutex
+	crashRecords = map[string]*crashRecord{}
+)
+
+// quarantinedInputError rechaza una entrada en cuarentena sin ejecutar ffmpeg
+type quarantinedInputError struct {
+	Hash  string
+	Until time.Time
+}
+
+func (e *quarantinedInputError) Error() string {
+	return fmt.Sprintf("entrada en cuarentena (sha256 %s) por caídas repetidas de ffmpeg hasta %s", e.Hash, e.Until.UTC().Format(time.RFC3339))
+}
+
+func crashKey(endpoint, hash string) string {
+	return endpoint + " " + hash
+}
+
+// checkQuarantine rechaza la entrada si está en cuarentena para este endpoint
+func checkQuarantine(endpoint, hash string) error {
+	if quarantineThreshold <= 0 {
+		return nil
+	}
+
+	crashMu.Lock()
+	defer crashMu.Unlock()
+	record, ok := crashRecords[crashKey(endpoint, hash)]
+	if !ok || record.QuarantinedUntil.IsZero() {
+		return nil
+	}
+	if time.Now().After(record.QuarantinedUntil) {
+		forgetCrashRecord(crashKey(endpoint, hash))
+		return nil
+	}
+	return &quarantinedInputError{Hash: hash, Until: record.QuarantinedUntil}
+}
+
+// ffmpegCrashSignals son las señales que indican que ffmpeg se cayó; las que
+// envía el propio servicio (killed por timeout o cancelación) no cuentan
+var ffmpegCrashSignals = []string{
+	"signal: segmentation fault",
+	"signal: aborted",
+	"signal: illegal instruction",
+	"signal: floating point exception",
+	"signal: bus error",
+}
+
+func isFFmpegCrash(message string) bool {
+	for _, signal := range ffmpegCrashSignals {
+		if strings.Contains(message, signal) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordCrash cuenta una caída para la entrada de la petición. Solo se
+// registra cuando hay una sola entrada: en un lote no se sabe cuál falló.
+func recordCrash(info *requestInfo, message string) {
+	if quarantineThreshold <= 0 || len(info.Inputs) != 1 || !isFFmpegCrash(message) {
+		return
+	}
+	input := info.Inputs[0]
+	key := crashKey(info.Endpoint, input.Hash)
+
+	crashMu.Lock()
+	defer crashMu.Unlock()
+
+	now := time.Now()
+	pruneCrashRecords(now)
+	record, ok := crashRecords[key]
+	if !ok || now.Sub(record.FirstCrash) > quarantineWindow {
+		record = &crashRecord{Endpoint: info.Endpoint, Hash: input.Hash, FirstCrash: now}
+		crashRecords[key] = record
+	}
+	record.Crashes++
+	record.LastError = truncateErrorMessage(message)
+	fmt.Printf("[quarantine] Caída de ffmpeg %d/%d en %s con la entrada %s\n", record.Crashes, quarantineThreshold, info.Endpoint, input.Hash)
+
+	if record.Crashes < quarantineThreshold || !record.QuarantinedUntil.IsZero() {
+		return
+	}
+	record.QuarantinedUntil = now.Add(quarantineTTL)
+	fmt.Printf("[quarantine] Entrada %s en cuarentena para %s hasta %s\n", input.Hash, info.Endpoint, record.QuarantinedUntil.Format(time.RFC3339))
+
+	if quarantineSamples {
+		if err := os.MkdirAll(quarantineDir, 0o700); err != nil {
+			fmt.Printf("[quarantine] No se pudo crear %s: %v\n", quarantineDir, err)
+			return
+		}
+		path := filepath.Join(quarantineDir, input.Hash)
+		if err := writeAtRest(path, input.Data); err != nil {
+			fmt.Printf("[quarantine] No se pudo guardar la muestra: %v\n", err)
+			return
+		}
+		record.Sample = path
+		info.retain("quarantine", input.Hash, record.QuarantinedUntil)
+	}
+}
+
+// forgetCrashRecord borra el registro y su muestra, que no se conserva más
+// allá de la cuarentena. Se llama con crashMu tomado.
+func forgetCrashRecord(key string) {
+	if record, ok := crashRecords[key]; ok && record.Sample != "" {
+		os.Remove(record.Sample)
+	}
+	delete(crashRecords, key)
+}
+
+// pruneCrashRecords olvida los contadores fuera de la ventana y las
+// cuarentenas vencidas. Se llama con crashMu tomado.
+func pruneCrashRecords(now time.Time) {
+	for key, record := range crashRecords {
+		if record.QuarantinedUntil.IsZero() && now.Sub(record.FirstCrash) > quarantineWindow {
+			forgetCrashRecord(key)
+		} else if !record.QuarantinedUntil.IsZero() && now.After(record.QuarantinedUntil) {
+			forgetCrashRecord(key)
+		}
+	}
+}
+
+// cleanupQuarantine aplica periódicamente QUARANTINE_TTL, para que las
+// muestras se borren aunque no lleguen más caídas
+func cleanupQuarantine() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		crashMu.Lock()
+		pruneCrashRecords(time.Now())
+		crashMu.Unlock()
+	}
+}
+
+// quarantineMiddleware detecta las caídas de ffmpeg en las respuestas de
+// error de las conversiones síncronas
+func quarantineMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if quarantineThreshold <= 0 {
+			c.Next()
+			return
+		}
+
+		writer := &errorCaptureWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		if c.Writer.Status() < http.StatusInternalServerError {
+			return
+		}
+		var errorBody struct {
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(writer.body.Bytes(), &errorBody); err == nil {
+			recordCrash(requestInfoFrom(c.Request.Context()), errorBody.Error)
+		}
+	}
+}
+
+// listQuarantine atiende GET /admin/quarantine
+func listQuarantine(c *gin.Context) {
+	if !validateAPIKey(c) {
+		return
+	}
+
+	crashMu.Lock()
+	entries := make([]gin.H, 0, len(crashRecords))
+	for _, record := range crashRecords {
+		entry := gin.H{
+			"endpoint":    record.Endpoint,
+			"sha256":      record.Hash,
+			"crashes":     record.Crashes,
+			"first_crash": record.FirstCrash.UTC().Format(time.RFC3339),
+			"last_error":  record.LastError,
+			"quarantined": !record.QuarantinedUntil.IsZero(),
+		}
+		if !record.QuarantinedUntil.IsZero() {
+			entry["quarantined_until"] = record.QuarantinedUntil.UTC().Format(time.RFC3339)
+		}
+		if record.Sample != "" {
+			entry["sample"] = record.Sample
+		}
+		entries = append(entries, entry)
+	}
+	crashMu.Unlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i]["first_crash"].(string) < entries[j]["first_crash"].(string)
+	})
+	c.JSON(http.StatusOK, gin.H{"entries": entries})
+}
+
+// releaseQuarantine atiende DELETE /admin/quarantine/:sha256: libera la
+// entrada en todos los endpoints (p. ej. tras actualizar ffmpeg)
+func releaseQuarantine(c *gin.Context) {
+	if !validateAPIKey(c) {
+		return
+	}
+
+	hash := c.Param("sha256")
+	released := 0
+	crashMu.Lock()
+	for key, record := range crashRecords {
+		if record.Hash == hash {
+			forgetCrashRecord(key)
+			released++
+		}
+	}
+	crashMu.Unlock()
+
+	if released == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "La entrada no está registrada"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sha256": hash, "released": released})
+}
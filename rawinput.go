@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// rawInputFormat describe un formato sin cabecera que ffmpeg no puede
+// detectar: el demuxer a usar, su frecuencia por defecto (0 la exige) y el
+// codec con que se guarda en WAV ("" copia las muestras sin cambios)
+type rawInputFormat struct {
+	defaultSampleRate int
+	wavCodec          string
+}
+
+// rawInputFormats son los valores aceptados en input_format para /process-audio
+var rawInputFormats = map[string]rawInputFormat{
+	"s16le": {},
+	"s16be": {wavCodec: "pcm_s16le"},
+	"s24le": {},
+	"s32le": {},
+	"f32le": {},
+	"u8":    {},
+	// G.711 de grabadores SIP/RTP
+	"mulaw": {defaultSampleRate: 8000},
+	"alaw":  {defaultSampleRate: 8000},
+	"g722":  {defaultSampleRate: 16000},
+	"gsm":   {defaultSampleRate: 8000, wavCodec: "pcm_s16le"},
+}
+
+// rawInputOptions son las opciones de demuxer permitidas en input_args
+var rawInputOptions = map[string]bool{
+	"-f":          true,
+	"-ar":         true,
+	"-ac":         true,
+	"-ch_layout":  true,
+	"-code_size":  true,
+	"-block_size": true,
+}
+
+// rawInputHints son los datos que faltan en una entrada sin cabecera
+type rawInputHints struct {
+	Format     string
+	SampleRate int
+	Channels   int
+	// extraArgs son las demás opciones de input_args, ya validadas
+	extraArgs []string
+}
+
+// parseRawInputHints combina input_format, input_sample_rate,
+// input_channels e input_args. Devuelve nil si la petición no da pistas.
+func parseRawInputHints(format, sampleRate, channels, inputArgs string) (*rawInputHints, error) {
+	if format == "" && sampleRate == "" && channels == "" && inputArgs == "" {
+		return nil, nil
+	}
+
+	hints := &rawInputHints{Format: format, Channels: 1}
+
+	fields := strings.Fields(inputArgs)
+	if len(fields)%2 != 0 {
+		return nil, errors.New("input_args debe tener pares opción valor")
+	}
+	for i := 0; i < len(fields); i += 2 {
+		option, value := fields[i], fields[i+1]
+		if !rawInputOptions[option] {
+			return nil, fmt.Errorf("opción %q no permitida en input_args", option)
+		}
+		switch option {
+		case "-f":
+			if format == "" {
+				hints.Format = value
+			}
+		case "-ar":
+			if sampleRate == "" {
+				sampleRate = value
+			}
+		case "-ac":
+			if channels == "" {
+				channels = value
+			}
+		default:
+			hints.extraArgs = append(hints.extraArgs, option, value)
+		}
+	}
+
+	raw, ok := rawInputFormats[hints.Format]
+	if !ok {
+		return nil, invalidParam("input_format", "input_format inválido %q (s16le, s16be, s24le, s32le, f32le, u8, mulaw, alaw, g722 o gsm)", hints.Format)
+	}
+
+	hints.SampleRate = raw.defaultSampleRate
+	if sampleRate != "" {
+		value, err := strconv.Atoi(sampleRate)
+		if err != nil || value < 1000 || value > 384000 {
+			return nil, invalidParam("input_sample_rate", "input_sample_rate inválido %q", sampleRate)
+		}
+		hints.SampleRate = value
+	}
+	if hints.SampleRate == 0 {
+		return nil, missingParam("input_format", "input_format %s requiere input_sample_rate", hints.Format)
+	}
+	if channels != "" {
+		value, err := strconv.Atoi(channels)
+		if err != nil || value < 1 || value > 8 {
+			return nil, invalidParam("input_channels", "input_channels inválido %q (1 a 8)", channels)
+		}
+		hints.Channels = value
+	}
+	return hints, nil
+}
+
+// demuxerArgs son las opciones que van antes de -i
+func (hints *rawInputHints) demuxerArgs() []string {
+	args := []string{"-f", hints.Format, "-ar", strconv.Itoa(hints.SampleRate), "-ac", strconv.Itoa(hints.Channels)}
+	return append(args, hints.extraArgs...)
+}
+
+// wrapRawInput guarda la entrada sin cabecera en un WAV con las pistas
+// dadas. El resto de la conversión (sondeo, copia de codec, mediciones) ve
+// así una entrada normal.
+func wrapRawInput(ctx context.Context, inputData []byte, hints *rawInputHints) ([]byte, error) {
+	outputPath, cleanup, err := createTempOutput("raw-input-*.wav")
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	codec := rawInputFormats[hints.Format].wavCodec
+	if codec == "" {
+		codec = "copy"
+	}
+
+	args := append(hints.demuxerArgs(), "-i", "pipe:0", "-c:a", codec, "-f", "wav", "-y", outputPath)
+	cmd := ffmpegCommand(ctx, classInteractive, args...)
+	cmd.Stdin = bytes.NewReader(inputData)
+
+	var errBuffer bytes.Buffer
+	cmd.Stderr = &errBuffer
+
+	fmt.Printf("[rawInput] Interpretando %d bytes como %s %d Hz, %d canales\n", len(inputData), hints.Format, hints.SampleRate, hints.Channels)
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("no se pudo leer la entrada como %s: %v, detalles: %s", hints.Format, err, errBuffer.String())
+	}
+
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		return nil, fmt.Errorf("error al leer la entrada interpretada: %v", err)
+	}
+	if len(data) <= 44 {
+		return nil, fmt.Errorf("la entrada no contiene muestras %s", hints.Format)
+	}
+	return data, nil
+}
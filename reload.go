@@ -0,0 +1,238 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joho/godotenv"
+)
+
+var (
+	// configFile es el archivo de entorno que se relee: CONFIG_FILE, o .env
+	// en modo -dev
+	configFile string
+	// processEnv son las variables que el proceso ya tenía al arrancar. El
+	// archivo no las pisa, igual que godotenv.Load.
+	processEnv map[string]bool
+	// fileEnv son las variables tomadas del archivo en la última carga
+	fileEnv = map[string]string{}
+
+	reloadMu sync.Mutex
+)
+
+// reloadableConfig es la configuración que se relee con POST /admin/reload y
+// SIGHUP: claves, límites, presets y almacenamiento. Cada archivo declara su
+// parte. El resto (colas, caché, cifrado en reposo...) sigue necesitando un
+// reinicio.
+type reloadableConfig struct {
+	apiKey string
+	tenantConfig
+	downloadConfig
+	callbackConfig
+	s3Config
+	cloudInputConfig
+	presetConfig
+	inputConfig
+	tokenConfig
+}
+
+// activeConfig es la configuración vigente. Una carga arma una nueva y la
+// publica entera: nunca se modifica una ya publicada, así que quien la lee
+// no ve una recarga a medias.
+var activeConfig atomic.Pointer[reloadableConfig]
+
+// reloadableLoaders arman cada parte de reloadableConfig. La API key va
+// primero porque las claves de firma la usan por defecto, y los tenants
+// después de S3 porque sus storage_regions se validan contra STORAGE_REGIONS.
+var reloadableLoaders = []func(*reloadableConfig){
+	loadAPIKeyConfig,
+	loadDownloadConfig,
+	loadCallbackConfig,
+	loadS3Config,
+	loadTenantConfig,
+	loadCloudInputConfig,
+	loadPresetConfig,
+	loadInputConfig,
+	loadTokenConfig,
+}
+
+// config devuelve la configuración recargable vigente. Quien necesita varios
+// valores que deben ser coherentes entre sí la lee una sola vez.
+func config() *reloadableConfig {
+	return activeConfig.Load()
+}
+
+// loadReloadableConfig arma la configuración recargable desde el entorno y
+// la publica
+func loadReloadableConfig() *reloadableConfig {
+	cfg := &reloadableConfig{}
+	for _, load := range reloadableLoaders {
+		load(cfg)
+	}
+	activeConfig.Store(cfg)
+	return cfg
+}
+
+// envValue es el valor de una variable antes de recargar
+type envValue struct {
+	value string
+	set   bool
+}
+
+// loadConfigFile aplica configFile al entorno. Devuelve las variables que
+// cambiaron y sus valores anteriores; las que se quitaron del archivo desde
+// la carga anterior se eliminan.
+func loadConfigFile() ([]string, map[string]envValue, error) {
+	if processEnv == nil {
+		processEnv = map[string]bool{}
+		for _, entry := range os.Environ() {
+			processEnv[strings.SplitN(entry, "=", 2)[0]] = true
+		}
+	}
+	values, err := godotenv.Read(configFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	applied := map[string]string{}
+	previous := map[string]envValue{}
+	var changed []string
+	set := func(name string, value *string) {
+		current, ok := os.LookupEnv(name)
+		if value != nil && ok && current == *value {
+			return
+		}
+		previous[name] = envValue{value: current, set: ok}
+		changed = append(changed, name)
+		if value == nil {
+			os.Unsetenv(name)
+		} else {
+			os.Setenv(name, *value)
+		}
+	}
+	for name := range fileEnv {
+		if _, ok := values[name]; !ok {
+			set(name, nil)
+		}
+	}
+	for name, value := range values {
+		if processEnv[name] {
+			continue
+		}
+		value := value
+		applied[name] = value
+		set(name, &value)
+	}
+	fileEnv = applied
+	sort.Strings(changed)
+	return changed, previous, nil
+}
+
+// restoreEnv deshace los cambios de loadConfigFile
+func restoreEnv(previous map[string]envValue, file map[string]string) {
+	for name, old := range previous {
+		if old.set {
+			os.Setenv(name, old.value)
+		} else {
+			os.Unsetenv(name)
+		}
+	}
+	fileEnv = file
+}
+
+// validateReloadableConfig rechaza una configuración que dejaría al servicio
+// sin API key o con presets, regiones de almacenamiento o tenants ilegibles
+func validateReloadableConfig() error {
+	if os.Getenv("API_KEY") == "" {
+		return errors.New("API_KEY vacío: la recarga dejaría el servicio sin API key")
+	}
+	if _, err := readVideoPresets(); err != nil {
+		return err
+	}
+	if _, err := readStorageRegions(); err != nil {
+		return err
+	}
+	if _, err := readTenantKeys(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// reloadConfig relee configFile y vuelve a cargar la configuración
+// recargable. Primero valida: si algo falla, el entorno vuelve a su estado
+// anterior y no se aplica nada. La configuración nueva se publica de una vez
+// con activeConfig; las lecturas siguientes la ven entera y las anteriores
+// conservan la que ya tenían.
+func reloadConfig(source string) (gin.H, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	changed := []string{}
+	if configFile != "" {
+		file := fileEnv
+		names, previous, err := loadConfigFile()
+		if err != nil {
+			fmt.Printf("Recarga de configuración (%s) rechazada: %v\n", source, err)
+			return nil, fmt.Errorf("no se pudo leer %s: %v", configFile, err)
+		}
+		if err := validateReloadableConfig(); err != nil {
+			restoreEnv(previous, file)
+			fmt.Printf("Recarga de configuración (%s) rechazada: %v\n", source, err)
+			return nil, err
+		}
+		if names != nil {
+			changed = names
+		}
+	} else if err := validateReloadableConfig(); err != nil {
+		return nil, err
+	}
+
+	cfg := loadReloadableConfig()
+	fmt.Printf("Configuración recargada (%s): %d variables cambiaron\n", source, len(changed))
+
+	return gin.H{
+		"reloaded_at":     time.Now().UTC(),
+		"config_file":     configFile,
+		"changed":         changed,
+		"video_presets":   len(cfg.videoPresets),
+		"storage_regions": len(cfg.storageRegions),
+		"tenants":         len(cfg.tenantKeys),
+	}, nil
+}
+
+// processReload atiende POST /admin/reload. La solicitud se autoriza con la
+// API key anterior; la respuesta lista solo los nombres de las variables
+// que cambiaron, nunca sus valores.
+func processReload(c *gin.Context) {
+	if !validateAPIKey(c) {
+		return
+	}
+
+	report, err := reloadConfig("admin")
+	if err != nil {
+		respondError(c, http.StatusUnprocessableEntity, err)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// watchReloadSignal recarga la configuración con cada SIGHUP
+func watchReloadSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			reloadConfig("SIGHUP")
+		}
+	}()
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// mp4VideoCodecs son los códecs de video que se copian al MP4 sin recodificar
+var mp4VideoCodecs = map[string]bool{
+	"h264":  true,
+	"hevc":  true,
+	"mpeg4": true,
+	"av1":   true,
+}
+
+// replaceAudioOptions son los parámetros de /replace-audio
+type replaceAudioOptions struct {
+	// Fit ajusta el audio a la duración del video: trim (corta o completa
+	// con silencio), loop (repite) o none (conserva ambas duraciones)
+	Fit string
+}
+
+// getNamedInput lee una entrada adicional de field (archivo), field_base64 o
+// field_url, para los endpoints que combinan dos medios. label la nombra en
+// los errores.
+func getNamedInput(c *gin.Context, field, label string) ([]byte, error) {
+	var (
+		data []byte
+		err  error
+	)
+	if file, _, fileErr := c.Request.FormFile(field); fileErr == nil {
+		data, err = io.ReadAll(file)
+	} else if value := c.PostForm(field + "_base64"); value != "" {
+		data, err = base64.StdEncoding.DecodeString(value)
+	} else if url := c.PostForm(field + "_url"); url != "" {
+		data, err = fetchAudioFromURL(c.Request.Context(), url)
+	} else {
+		return nil, fmt.Errorf("falta %s (%s, %s_base64 o %s_url)", label, field, field, field)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo leer %s: %w", label, err)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%s está vacío", label)
+	}
+	info := requestInfoFrom(c.Request.Context())
+	info.addInput(data)
+	if err := checkTokenInputLimit(c, info); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// replaceAudioResult es el MP4 con el audio reemplazado
+type replaceAudioResult struct {
+	Data        []byte
+	Duration    float64
+	VideoCopied bool
+}
+
+// replaceAudio combina los cuadros del video con el audio nuevo en un MP4.
+// El video se copia si su códec cabe en MP4; el audio siempre se codifica
+// en AAC.
+func replaceAudio(ctx context.Context, videoData, audioData []byte, opts replaceAudioOptions) (*replaceAudioResult, error) {
+	_, probe, err := probeMedia(ctx, videoData)
+	if err != nil {
+		return nil, err
+	}
+	videoCodec := ""
+	for _, stream := range probe.Streams {
+		if stream.CodecType == "video" && stream.Disposition.AttachedPic == 0 {
+			videoCodec = stream.CodecName
+			break
+		}
+	}
+	if videoCodec == "" {
+		return nil, errors.New("la entrada no tiene pista de video")
+	}
+	duration, _ := strconv.ParseFloat(probe.Format.Duration, 64)
+	if duration <= 0 && opts.Fit != "none" {
+		return nil, errors.New("no se pudo determinar la duración del video para ajustar el audio")
+	}
+
+	videoPath, cleanupVideo, err := writeTempInput(videoData, "replace-video-*")
+	if err != nil {
+		return nil, err
+	}
+	defer cleanupVideo()
+	audioPath, cleanupAudio, err := writeTempInput(audioData, "replace-audio-*")
+	if err != nil {
+		return nil, err
+	}
+	defer cleanupAudio()
+	outputPath, cleanupOutput, err := createTempOutput("replace-output-*.mp4")
+	if err != nil {
+		return nil, err
+	}
+	defer cleanupOutput()
+
+	args := []string{"-i", videoPath}
+	if opts.Fit == "loop" {
+		args = append(args, "-stream_loop", "-1")
+	}
+	args = append(args, "-i", audioPath, "-map", "0:v:0", "-map", "1:a:0")
+
+	result := &replaceAudioResult{VideoCopied: mp4VideoCodecs[videoCodec], Duration: duration}
+	if result.VideoCopied {
+		args = append(args, "-c:v", "copy")
+	} else {
+		args = append(args, "-c:v", "libx264", "-preset", "veryfast", "-crf", "23", "-pix_fmt", "yuv420p")
+		args = append(args, classThreadArgs(ctx, classBatch)...)
+	}
+	args = append(args, "-c:a", defaultAACEncoder, "-b:a", "128k")
+	switch opts.Fit {
+	case "trim":
+		// apad completa con silencio un audio más corto que el video
+		args = append(args, "-af", "apad", "-t", formatSeconds(duration))
+	case "loop":
+		args = append(args, "-t", formatSeconds(duration))
+	}
+	args = append(args, "-movflags", "+faststart", "-f", "mp4", "-y", outputPath)
+
+	cmd := ffmpegCommand(ctx, classBatch, args...)
+	var errBuffer bytes.Buffer
+	cmd.Stderr = &errBuffer
+
+	fmt.Printf("[replaceAudio] Video %s (%d bytes) + audio (%d bytes), ajuste %s\n", videoCodec, len(videoData), len(audioData), opts.Fit)
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error al reemplazar el audio: %v, detalles: %s", err, errBuffer.String())
+	}
+
+	if result.Data, err = os.ReadFile(outputPath); err != nil {
+		return nil, fmt.Errorf("error al leer archivo de salida: %v", err)
+	}
+	if len(result.Data) == 0 {
+		return nil, errors.New("la conversión produjo un archivo vacío")
+	}
+	return result, nil
+}
+
+// processReplaceAudio atiende /replace-audio: un video (file, base64 o url)
+// y el audio nuevo
+func processReplaceAudio(c *gin.Context) {
+	if !validateAPIKey(c) {
+		return
+	}
+
+	videoData, err := getInputData(c)
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+	audioData, err := getNamedInput(c, "audio", "el audio nuevo")
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+
+	opts := replaceAudioOptions{Fit: c.DefaultPostForm("audio_fit", "trim")}
+	if opts.Fit != "trim" && opts.Fit != "loop" && opts.Fit != "none" {
+		respondError(c, http.StatusBadRequest, invalidParam("audio_fit", "audio_fit inválido %q (trim, loop o none)", opts.Fit))
+		return
+	}
+
+	ctx := c.Request.Context()
+	result, err := replaceAudio(ctx, videoData, audioData, opts)
+	if err == nil {
+		result.Data, err = interceptOutput(ctx, "mp4", result.Data)
+	}
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusInternalServerError), err)
+		return
+	}
+
+	if wantsBinaryResponse(c, "") {
+		writeBinaryResponse(c, result.Data, "video.mp4", "video/mp4", map[string]string{
+			"X-Format":       "mp4",
+			"X-Audio-Fit":    opts.Fit,
+			"X-Video-Copied": strconv.FormatBool(result.VideoCopied),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, attachDebug(ctx, gin.H{
+		"format":         "mp4",
+		"video_duration": result.Duration,
+		"audio_fit":      opts.Fit,
+		"video_copied":   result.VideoCopied,
+		"size":           len(result.Data),
+		"video":          base64.StdEncoding.EncodeToString(result.Data),
+	}))
+}
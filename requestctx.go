@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ctxKey int
+
+const (
+	requestInfoKey ctxKey = iota
+	jobProgressKey
+)
+
+const (
+	maxLabels          = 16
+	maxLabelValueBytes = 256
+)
+
+var labelKeyPattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_.-]{0,62}$`)
+
+// requestInfo acompaña a cada conversión desde el handler hasta los logs,
+// métricas y notificaciones
+type requestInfo struct {
+	ID     string
+	Labels map[string]string
+	Debug  *debugInfo
+	// Class fuerza la clase de proceso de ffmpeg (ver priority.go)
+	Class string
+	// Endpoint es la ruta que atiende la solicitud
+	Endpoint string
+	// Inputs son las entradas leídas, para la cuarentena y la captura de
+	// depuración cuando la conversión falla
+	Inputs []requestInput
+	// Generation es la mayor generación de la marca de las entradas (ver
+	// marker.go); 0 si ninguna es una salida del servicio
+	Generation int
+	// JobID es el trabajo que recibió las entradas; el trabajo las libera
+	// al terminar (ver audit.go)
+	JobID string
+	// Retained son las copias de las entradas que sobreviven a la solicitud
+	Retained []retainedCopy
+	// Tenant es el tenant de la API key o del token (ver tenant.go); "" con
+	// la API key principal
+	Tenant string
+	// Token es el token de conversión que autorizó la solicitud; nil con una
+	// API key (ver tokens.go)
+	Token *conversionToken
+}
+
+// requestInput es una entrada leída por la solicitud
+type requestInput struct {
+	Hash string
+	Data []byte
+}
+
+// addInput registra una entrada leída y devuelve su SHA-256
+func (info *requestInfo) addInput(data []byte) string {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	info.Inputs = append(info.Inputs, requestInput{Hash: hash, Data: data})
+	return hash
+}
+
+// debugInfo acumula metadatos de diagnóstico cuando la solicitud usa debug=true
+type debugInfo struct {
+	mu     sync.Mutex
+	values map[string]interface{}
+}
+
+// recordDebug guarda un valor de diagnóstico si la solicitud lo pidió
+func recordDebug(ctx context.Context, key string, value interface{}) {
+	debug := requestInfoFrom(ctx).Debug
+	if debug == nil {
+		return
+	}
+
+	debug.mu.Lock()
+	debug.values[key] = value
+	debug.mu.Unlock()
+}
+
+// appendDebug agrega un valor a la lista de diagnóstico key
+func appendDebug(ctx context.Context, key string, value interface{}) {
+	debug := requestInfoFrom(ctx).Debug
+	if debug == nil {
+		return
+	}
+
+	debug.mu.Lock()
+	list, _ := debug.values[key].([]interface{})
+	debug.values[key] = append(list, value)
+	debug.mu.Unlock()
+}
+
+// attachDebug añade el bloque "debug" a la respuesta cuando corresponde
+func attachDebug(ctx context.Context, response gin.H) gin.H {
+	debug := requestInfoFrom(ctx).Debug
+	if debug == nil {
+		return response
+	}
+
+	debug.mu.Lock()
+	defer debug.mu.Unlock()
+
+	snapshot := make(map[string]interface{}, len(debug.values)+1)
+	for key, value := range debug.values {
+		snapshot[key] = value
+	}
+	snapshot["request_id"] = requestInfoFrom(ctx).ID
+	response["debug"] = snapshot
+	return response
+}
+
+func withRequestInfo(ctx context.Context, info *requestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey, info)
+}
+
+// requestInfoFrom devuelve la información de la solicitud o una vacía si no existe
+func requestInfoFrom(ctx context.Context) *requestInfo {
+	if ctx != nil {
+		if info, ok := ctx.Value(requestInfoKey).(*requestInfo); ok {
+			return info
+		}
+	}
+	return &requestInfo{}
+}
+
+// parseLabels lee las etiquetas como objeto JSON desde el campo de formulario
+// "labels", el parámetro de consulta del mismo nombre o la cabecera X-Labels
+func parseLabels(c *gin.Context) (map[string]string, error) {
+	raw := c.PostForm("labels")
+	if raw == "" {
+		raw = c.Query("labels")
+	}
+	if raw == "" {
+		raw = c.GetHeader("X-Labels")
+	}
+	if raw == "" {
+		return nil, nil
+	}
+
+	var labels map[string]string
+	if err := json.Unmarshal([]byte(raw), &labels); err != nil {
+		return nil, fmt.Errorf("labels must be a JSON object of string values: %v", err)
+	}
+
+	if len(labels) > maxLabels {
+		return nil, fmt.Errorf("too many labels (max %d)", maxLabels)
+	}
+
+	for key, value := range labels {
+		if !labelKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("invalid label key %q", key)
+		}
+		if len(value) > maxLabelValueBytes {
+			return nil, fmt.Errorf("label %q exceeds %d bytes", key, maxLabelValueBytes)
+		}
+	}
+
+	return labels, nil
+}
+
+func debugRequested(c *gin.Context) bool {
+	value := c.PostForm("debug")
+	if value == "" {
+		value = c.Query("debug")
+	}
+	return value == "true" || value == "1"
+}
+
+// formatLabels serializa las etiquetas de forma estable para logs
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	parts := make([]string, 0, len(labels))
+	for _, key := range sortedKeys(labels) {
+		parts = append(parts, key+"="+labels[key])
+	}
+	return strings.Join(parts, ",")
+}
+
+// sortedKeys devuelve las claves del mapa en orden alfabético
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// requestMiddleware asigna un ID a la solicitud, valida las etiquetas y al
+// terminar registra el resultado en el log y en las métricas. Va después de
+// apiKeyMiddleware: leer labels del formulario parsea el cuerpo.
+func requestMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		labels, err := parseLabels(c)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, err)
+			c.Abort()
+			return
+		}
+
+		info := &requestInfo{ID: newRandomID(), Labels: labels, Endpoint: c.FullPath(), Tenant: requestTenant(c)}
+		if token, ok := c.Get(conversionTokenKey); ok {
+			info.Token = token.(*conversionToken)
+		}
+		if debugRequested(c) {
+			info.Debug = &debugInfo{values: map[string]interface{}{}}
+		}
+		c.Request = c.Request.WithContext(withRequestInfo(c.Request.Context(), info))
+		c.Set("request_id", info.ID)
+		c.Header("X-Request-ID", info.ID)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		elapsed := time.Since(start)
+		fmt.Printf("[request] id=%s endpoint=%s status=%d duration=%s labels=%s\n",
+			info.ID, c.FullPath(), status, elapsed.Round(time.Millisecond), formatLabels(labels))
+		recordConversionMetric(c.FullPath(), status, elapsed, labels)
+
+		// Las entradas no se conservan después de responder, salvo en un
+		// trabajo encolado, que las libera al terminar
+		if info.JobID == "" {
+			releaseInputs(info)
+		} else {
+			info.Inputs = nil
+		}
+	}
+}
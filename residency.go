@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// storageRegion es un destino de almacenamiento con nombre (p. ej. "eu") para
+// cumplir requisitos de residencia de datos. Sin credenciales propias usa las
+// del servidor.
+type storageRegion struct {
+	Bucket          string `json:"bucket"`
+	Region          string `json:"region"`
+	Endpoint        string `json:"endpoint"`
+	AccessKeyID     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key"`
+}
+
+type storageRegionConfig struct {
+	storageRegions       map[string]storageRegion
+	storageDefaultRegion string
+}
+
+// loadStorageRegionConfig lee STORAGE_REGIONS, un objeto JSON de nombre a
+// destino, y STORAGE_DEFAULT_REGION, el que se usa cuando la solicitud envía
+// s3_key sin s3_bucket
+func loadStorageRegionConfig(cfg *reloadableConfig) {
+	regions, err := readStorageRegions()
+	if err != nil {
+		fmt.Printf("%v, se ignora\n", err)
+		regions = map[string]storageRegion{}
+	}
+	for name, region := range regions {
+		if region.Bucket == "" {
+			fmt.Printf("STORAGE_REGIONS: la región %s no tiene bucket, se ignora\n", name)
+			delete(regions, name)
+			continue
+		}
+		if region.Region == "" {
+			region.Region = cfg.s3DefaultRegion
+		}
+		region.Endpoint = strings.TrimRight(region.Endpoint, "/")
+		regions[name] = region
+	}
+
+	defaultRegion := os.Getenv("STORAGE_DEFAULT_REGION")
+	if _, ok := regions[defaultRegion]; defaultRegion != "" && !ok {
+		fmt.Printf("STORAGE_DEFAULT_REGION %s no está en STORAGE_REGIONS, se ignora\n", defaultRegion)
+		defaultRegion = ""
+	}
+	cfg.storageRegions, cfg.storageDefaultRegion = regions, defaultRegion
+}
+
+// readStorageRegions decodifica STORAGE_REGIONS
+func readStorageRegions() (map[string]storageRegion, error) {
+	regions := map[string]storageRegion{}
+	if raw := strings.TrimSpace(os.Getenv("STORAGE_REGIONS")); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &regions); err != nil {
+			return nil, fmt.Errorf("STORAGE_REGIONS inválido: %v", err)
+		}
+	}
+	return regions, nil
+}
+
+// storageRegionNames lista las regiones configuradas para los mensajes de error
+func storageRegionNames(regions map[string]storageRegion) string {
+	names := make([]string, 0, len(regions))
+	for name := range regions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// resolveStorageRegion completa el destino con la región pedida (o la región
+// por defecto). Devuelve false si el destino no usa una región con nombre.
+func (dest *s3Destination) resolveStorageRegion() (bool, error) {
+	cfg := config()
+	name := dest.StorageRegion
+	if name == "" && dest.PresignedURL == "" && dest.Bucket == "" && dest.Key != "" {
+		name = cfg.storageDefaultRegion
+	}
+	if name == "" {
+		return false, nil
+	}
+
+	region, ok := cfg.storageRegions[name]
+	if !ok {
+		return false, invalidParam("storage_region", "storage_region desconocida %q (configuradas: %s)", name, storageRegionNames(cfg.storageRegions))
+	}
+	if dest.PresignedURL != "" {
+		return false, conflictingParams("storage_region", "storage_region no se combina con s3_presigned_url")
+	}
+	if dest.Bucket != "" && dest.Bucket != region.Bucket {
+		return false, fmt.Errorf("s3_bucket %s no pertenece a la storage_region %s", dest.Bucket, name)
+	}
+	if dest.AccessKeyID != "" || dest.SecretAccessKey != "" || dest.Endpoint != "" || dest.Region != "" {
+		return false, errors.New("storage_region fija el bucket, la región y las credenciales; no envíe s3_region, s3_endpoint ni credenciales")
+	}
+	if dest.Key == "" {
+		return false, errors.New("s3_key es obligatorio para subir a S3")
+	}
+
+	dest.StorageRegion = name
+	dest.shared = true
+	dest.Bucket = region.Bucket
+	dest.Region = region.Region
+	dest.Endpoint = region.Endpoint
+	dest.AccessKeyID, dest.SecretAccessKey = region.AccessKeyID, region.SecretAccessKey
+	if dest.AccessKeyID == "" {
+		if cfg.s3AccessKeyID == "" || cfg.s3SecretAccessKey == "" {
+			return false, notConfigured("no hay credenciales S3 configuradas en el servidor")
+		}
+		dest.AccessKeyID, dest.SecretAccessKey, dest.SessionToken = cfg.s3AccessKeyID, cfg.s3SecretAccessKey, cfg.s3SessionToken
+	}
+	return true, nil
+}
+
+// checkStorageResidency rechaza un destino fuera de las regiones que permiten
+// el tenant (storage_regions en TENANT_KEYS) y el token de conversión de la
+// solicitud. El tenant limita las subidas con credenciales del servidor; el
+// token, todas. Con la API key principal no hay restricción.
+func checkStorageResidency(c *gin.Context, dest *s3Destination) error {
+	if dest == nil {
+		return nil
+	}
+	tenant := requestTenant(c)
+	if allowed, ok := config().tenantStorageRegions[tenant]; ok && dest.shared && !regionAllowed(allowed, dest.StorageRegion) {
+		if len(allowed) == 0 {
+			return fmt.Errorf("el tenant %s no tiene storage_regions válidas configuradas", tenant)
+		}
+		return fmt.Errorf("el tenant %s solo puede guardar en storage_region %s", tenant, strings.Join(allowed, ", "))
+	}
+
+	value, ok := c.Get(conversionTokenKey)
+	if !ok {
+		return nil
+	}
+	allowed := value.(*conversionToken).StorageRegions
+	if len(allowed) == 0 || regionAllowed(allowed, dest.StorageRegion) {
+		return nil
+	}
+	return fmt.Errorf("el token solo permite guardar en storage_region %s", strings.Join(allowed, ", "))
+}
+
+// regionAllowed indica si name está entre las regiones permitidas
+func regionAllowed(allowed []string, name string) bool {
+	for _, region := range allowed {
+		if name == region {
+			return true
+		}
+	}
+	return false
+}
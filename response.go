@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// wantsBinaryResponse indica si el cliente pidió los bytes convertidos en
+// lugar del JSON con base64: response=binary (form, query o JSON) o un
+// header Accept que no admite JSON pero sí audio/*, video/*, image/* u
+// octet-stream
+func wantsBinaryResponse(c *gin.Context, jsonValue string) bool {
+	for _, value := range []string{jsonValue, c.PostForm("response"), c.Query("response")} {
+		if value != "" {
+			return strings.EqualFold(value, "binary")
+		}
+	}
+
+	accept := c.GetHeader("Accept")
+	if accept == "" {
+		return false
+	}
+
+	binary := false
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch {
+		case mediaType == "application/json" || mediaType == "*/*" || mediaType == "application/*":
+			return false
+		case mediaType == "application/octet-stream",
+			strings.HasPrefix(mediaType, "audio/"),
+			strings.HasPrefix(mediaType, "video/"),
+			strings.HasPrefix(mediaType, "image/"):
+			binary = true
+		}
+	}
+	return binary
+}
+
+// writeBinaryResponse escribe los bytes convertidos directamente. La duración
+// y el resto de metadatos que iban en el JSON se envían como headers X-*.
+func writeBinaryResponse(c *gin.Context, data []byte, filename string, contentType string, headers map[string]string) {
+	for name, value := range headers {
+		c.Header(name, value)
+	}
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	c.Header("Content-Length", strconv.Itoa(len(data)))
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// emailStatusHeader resume la entrega por email para las respuestas binarias
+func emailStatusHeader(result map[string]interface{}) string {
+	status := fmt.Sprint(result["status"])
+	if delivery, ok := result["delivery"].(string); ok && delivery != "" {
+		status += "; delivery=" + delivery
+	}
+	return status
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	fieldCaseSnake = "snake"
+	fieldCaseCamel = "camel"
+)
+
+var (
+	// responseFieldCase es el estilo de los nombres de campo de las
+	// respuestas JSON; X-Response-Case lo cambia por petición
+	responseFieldCase = fieldCaseSnake
+	// responseCompatFields conserva los nombres snake_case actuales junto a
+	// los camelCase, para migrar clientes sin romper integraciones
+	responseCompatFields bool
+)
+
+// opaqueResponseFields contienen claves definidas por el cliente o por
+// ffprobe que se devuelven tal cual
+var opaqueResponseFields = map[string]bool{
+	"labels": true,
+	"tags":   true,
+	"raw":    true,
+}
+
+func loadResponseCaseConfig() {
+	if value := strings.ToLower(strings.TrimSpace(os.Getenv("RESPONSE_FIELD_CASE"))); value != "" {
+		if value != fieldCaseSnake && value != fieldCaseCamel {
+			fmt.Printf("Valor inválido para RESPONSE_FIELD_CASE (%s), usando %s\n", value, fieldCaseSnake)
+		} else {
+			responseFieldCase = value
+		}
+	}
+	responseCompatFields = envBool("RESPONSE_COMPAT_FIELDS", false)
+}
+
+// requestedFieldCase devuelve el estilo pedido en X-Response-Case, o ""
+func requestedFieldCase(c *gin.Context) string {
+	switch value := strings.ToLower(c.GetHeader("X-Response-Case")); value {
+	case fieldCaseCamel, fieldCaseSnake:
+		return value
+	}
+	return ""
+}
+
+// fieldCaseFor devuelve el estilo pedido en X-Response-Case, el del tenant
+// (field_case en TENANT_KEYS) o el global
+func fieldCaseFor(c *gin.Context) string {
+	if fieldCase := requestedFieldCase(c); fieldCase != "" {
+		return fieldCase
+	}
+	if fieldCase, ok := config().tenantFieldCases[requestTenant(c)]; ok {
+		return fieldCase
+	}
+	return responseFieldCase
+}
+
+// mayUseCamelCase indica si la respuesta puede terminar en camelCase. El
+// tenant se conoce recién al autenticar, después de este middleware, así
+// que sin X-Response-Case basta con que algún tenant o el global use camel.
+func mayUseCamelCase(c *gin.Context) bool {
+	if fieldCase := requestedFieldCase(c); fieldCase != "" {
+		return fieldCase == fieldCaseCamel
+	}
+	if responseFieldCase == fieldCaseCamel {
+		return true
+	}
+	for _, fieldCase := range config().tenantFieldCases {
+		if fieldCase == fieldCaseCamel {
+			return true
+		}
+	}
+	return false
+}
+
+// responseCaseMiddleware reescribe las claves de las respuestas JSON cuando
+// corresponde camelCase. Las respuestas binarias y los eventos SSE pasan sin
+// cambios.
+func responseCaseMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !mayUseCamelCase(c) {
+			c.Next()
+			return
+		}
+
+		writer := &caseRewriteWriter{ResponseWriter: c.Writer, context: c}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		if writer.buffering {
+			writer.ResponseWriter.Write(rewriteResponseFields(writer.body.Bytes(), responseCompatFields))
+		}
+	}
+}
+
+// caseRewriteWriter retiene el cuerpo de las respuestas JSON para
+// reescribirlo al terminar el handler. El estilo se decide con la primera
+// escritura, cuando ya se sabe el tenant.
+type caseRewriteWriter struct {
+	gin.ResponseWriter
+	context   *gin.Context
+	decided   bool
+	buffering bool
+	body      bytes.Buffer
+}
+
+func (w *caseRewriteWriter) decide() {
+	if w.decided {
+		return
+	}
+	w.decided = true
+	w.buffering = strings.Contains(w.Header().Get("Content-Type"), "json") && fieldCaseFor(w.context) == fieldCaseCamel
+	if w.buffering {
+		// La longitud cambia al renombrar las claves
+		w.Header().Del("Content-Length")
+	}
+}
+
+func (w *caseRewriteWriter) Write(data []byte) (int, error) {
+	w.decide()
+	if w.buffering {
+		return w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *caseRewriteWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// rewriteResponseFields convierte las claves del JSON a camelCase; con
+// compat también se mantienen las originales. Si el cuerpo no es JSON
+// válido se devuelve sin cambios.
+func rewriteResponseFields(body []byte, compat bool) []byte {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return body
+	}
+
+	rewritten, err := json.Marshal(camelizeValue(value, compat))
+	if err != nil {
+		return body
+	}
+	return rewritten
+}
+
+func camelizeValue(value interface{}, compat bool) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if !opaqueResponseFields[key] {
+				item = camelizeValue(item, compat)
+			}
+			result[camelCase(key)] = item
+			if compat {
+				result[key] = item
+			}
+		}
+		return result
+	case []interface{}:
+		for i, item := range v {
+			v[i] = camelizeValue(item, compat)
+		}
+		return v
+	}
+	return value
+}
+
+// camelCase convierte "job_id" en "jobId"; las claves sin guion bajo no cambian
+func camelCase(key string) string {
+	if !strings.Contains(key, "_") {
+		return key
+	}
+	parts := strings.Split(key, "_")
+	var builder strings.Builder
+	builder.WriteString(parts[0])
+	for _, part := range parts[1:] {
+		if part == "" {
+			continue
+		}
+		// Los segmentos numéricos ("channel_2") se unen sin cambios
+		if _, err := strconv.Atoi(part[:1]); err == nil {
+			builder.WriteString(part)
+			continue
+		}
+		builder.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return builder.String()
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestResponseCaseTenant(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	withTestConfig(t, func(cfg *reloadableConfig) {
+		cfg.tenantFieldCases = map[string]string{"acme": fieldCaseCamel}
+	})
+
+	tests := []struct {
+		name   string
+		tenant string
+		header string
+		want   string
+	}{
+		{"tenant con camel", "acme", "", `"jobId"`},
+		{"X-Response-Case manda", "acme", "snake", `"job_id"`},
+		{"tenant sin field_case", "globex", "", `"job_id"`},
+		{"API key principal", "", "", `"job_id"`},
+		{"API key principal con camel pedido", "", "camel", `"jobId"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(responseCaseMiddleware())
+			router.GET("/", func(c *gin.Context) {
+				setRequestTenant(c, tt.tenant)
+				c.JSON(http.StatusOK, gin.H{"job_id": "1"})
+			})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set("X-Response-Case", tt.header)
+			}
+			router.ServeHTTP(w, req)
+			if !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("cuerpo = %s, se esperaba %s", w.Body.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+)
+
+// probeRotation devuelve la rotación de visualización del primer stream de
+// video en grados horarios (0, 90, 180 o 270). Los teléfonos la guardan en la
+// matriz de visualización y los archivos antiguos en la etiqueta "rotate".
+func probeRotation(ctx context.Context, inputData []byte) (int, error) {
+	inputPath, cleanup, err := writeTempInput(inputData, "probe-rotation-*")
+	if err != nil {
+		return 0, err
+	}
+	defer cleanup()
+
+	cmd := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "stream_tags=rotate:stream_side_data=rotation",
+		"-of", "json",
+		inputPath)
+
+	var outBuffer bytes.Buffer
+	cmd.Stdout = &outBuffer
+
+	if err := cmd.Run(); err != nil {
+		return 0, fmt.Errorf("error al ejecutar ffprobe: %v", err)
+	}
+
+	var result struct {
+		Streams []struct {
+			Tags struct {
+				Rotate string `json:"rotate"`
+			} `json:"tags"`
+			SideDataList []struct {
+				Rotation *float64 `json:"rotation"`
+			} `json:"side_data_list"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(outBuffer.Bytes(), &result); err != nil {
+		return 0, fmt.Errorf("error al leer la salida de ffprobe: %v", err)
+	}
+	if len(result.Streams) == 0 {
+		return 0, nil
+	}
+
+	stream := result.Streams[0]
+	// La matriz de visualización expresa la rotación en sentido antihorario
+	for _, sideData := range stream.SideDataList {
+		if sideData.Rotation != nil {
+			return normalizeRotation(-*sideData.Rotation), nil
+		}
+	}
+	if stream.Tags.Rotate != "" {
+		degrees, err := strconv.ParseFloat(stream.Tags.Rotate, 64)
+		if err == nil {
+			return normalizeRotation(degrees), nil
+		}
+	}
+	return 0, nil
+}
+
+// normalizeRotation lleva los grados al múltiplo de 90 más cercano en [0, 360)
+func normalizeRotation(degrees float64) int {
+	rotation := int(math.Round(degrees/90)) * 90 % 360
+	if rotation < 0 {
+		rotation += 360
+	}
+	return rotation
+}
+
+// rotationInputArgs son las opciones de entrada según preserve_rotation.
+// Por defecto ffmpeg aplica la rotación (autorotate inserta transpose o
+// hflip,vflip) y no copia la matriz de visualización a la salida; para
+// conservar la metadata hay que desactivarlo y dejar los píxeles como están.
+func rotationInputArgs(rotation int, preserve bool) []string {
+	if rotation != 0 && preserve {
+		return []string{"-noautorotate"}
+	}
+	return nil
+}
+
+// rotationOutputArgs borra la etiqueta rotate cuando la rotación se aplicó a
+// los píxeles. Algunas versiones de ffmpeg la copian igualmente y el video
+// queda rotado dos veces en los reproductores que la respetan.
+func rotationOutputArgs(rotation int, preserve bool) []string {
+	if rotation != 0 && !preserve {
+		return []string{"-metadata:s:v:0", "rotate=0"}
+	}
+	return nil
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// s3Destination es el destino S3 de una salida: un PUT prefirmado o
+// bucket/key firmados con SigV4 (credenciales de la solicitud o del servidor)
+type s3Destination struct {
+	PresignedURL    string `json:"presigned_url"`
+	Bucket          string `json:"bucket"`
+	Key             string `json:"key"`
+	Region          string `json:"region"`
+	Endpoint        string `json:"endpoint"`
+	AccessKeyID     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key"`
+	SessionToken    string `json:"session_token"`
+	// StorageRegion elige uno de los destinos de STORAGE_REGIONS (ver
+	// residency.go)
+	StorageRegion string `json:"storage_region"`
+
+	// shared indica que el destino usa credenciales del servidor: un bucket
+	// compartido donde cada tenant escribe en su espacio (ver tenant.go)
+	shared bool
+}
+
+type s3Config struct {
+	s3DefaultRegion   string
+	s3DefaultEndpoint string
+	s3AccessKeyID     string
+	s3SecretAccessKey string
+	s3SessionToken    string
+	s3ForcePathStyle  bool
+	s3AllowedBuckets  map[string]bool
+	storageRegionConfig
+}
+
+var (
+	s3Client              = &http.Client{Timeout: 10 * time.Minute}
+	s3MetadataKeyReplacer = strings.NewReplacer("_", "-", ".", "-")
+)
+
+func loadS3Config(cfg *reloadableConfig) {
+	cfg.s3DefaultRegion = os.Getenv("S3_REGION")
+	if cfg.s3DefaultRegion == "" {
+		cfg.s3DefaultRegion = "us-east-1"
+	}
+	cfg.s3DefaultEndpoint = strings.TrimRight(os.Getenv("S3_ENDPOINT"), "/")
+	cfg.s3AccessKeyID = os.Getenv("S3_ACCESS_KEY_ID")
+	cfg.s3SecretAccessKey = os.Getenv("S3_SECRET_ACCESS_KEY")
+	cfg.s3SessionToken = os.Getenv("S3_SESSION_TOKEN")
+	cfg.s3ForcePathStyle = envBool("S3_FORCE_PATH_STYLE", false)
+
+	cfg.s3AllowedBuckets = map[string]bool{}
+	for _, bucket := range strings.Split(os.Getenv("S3_ALLOWED_BUCKETS"), ",") {
+		if bucket = strings.TrimSpace(bucket); bucket != "" {
+			cfg.s3AllowedBuckets[bucket] = true
+		}
+	}
+	loadStorageRegionConfig(cfg)
+}
+
+// parseS3Destination lee los campos s3_* del formulario. Devuelve nil si la
+// solicitud no pidió subir a S3.
+func parseS3Destination(c *gin.Context) (*s3Destination, error) {
+	dest := &s3Destination{
+		PresignedURL:    c.PostForm("s3_presigned_url"),
+		Bucket:          c.PostForm("s3_bucket"),
+		Key:             c.PostForm("s3_key"),
+		Region:          c.PostForm("s3_region"),
+		Endpoint:        c.PostForm("s3_endpoint"),
+		AccessKeyID:     c.PostForm("s3_access_key_id"),
+		SecretAccessKey: c.PostForm("s3_secret_access_key"),
+		SessionToken:    c.PostForm("s3_session_token"),
+		StorageRegion:   c.PostForm("storage_region"),
+	}
+	dest, err := dest.validate()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStorageResidency(c, dest); err != nil {
+		return nil, err
+	}
+	if err := checkTokenStorage(c.Request.Context(), dest); err != nil {
+		return nil, err
+	}
+	return dest, applyTenantNamespace(c, dest)
+}
+
+// validate completa los valores por defecto y verifica el destino; un destino
+// vacío se convierte en nil
+func (dest *s3Destination) validate() (*s3Destination, error) {
+	if dest == nil || (dest.PresignedURL == "" && dest.Bucket == "" && dest.Key == "" && dest.StorageRegion == "") {
+		return nil, nil
+	}
+	if named, err := dest.resolveStorageRegion(); named || err != nil {
+		if err != nil {
+			return nil, err
+		}
+		return dest, nil
+	}
+
+	if dest.PresignedURL != "" {
+		parsed, err := url.Parse(dest.PresignedURL)
+		if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return nil, errors.New("s3_presigned_url debe ser una URL http(s) absoluta")
+		}
+		return dest, nil
+	}
+
+	if dest.Bucket == "" || dest.Key == "" {
+		return nil, errors.New("s3_bucket y s3_key son obligatorios para subir a S3")
+	}
+	cfg := config()
+	if dest.Region == "" {
+		dest.Region = cfg.s3DefaultRegion
+	}
+	if dest.Endpoint == "" {
+		dest.Endpoint = cfg.s3DefaultEndpoint
+	}
+
+	// Sin credenciales propias se usan las del servidor, solo en los buckets
+	// de S3_ALLOWED_BUCKETS y con el endpoint configurado
+	if dest.AccessKeyID == "" && dest.SecretAccessKey == "" {
+		dest.Endpoint = cfg.s3DefaultEndpoint
+		if cfg.s3AccessKeyID == "" || cfg.s3SecretAccessKey == "" {
+			return nil, notConfigured("no hay credenciales S3 configuradas en el servidor")
+		}
+		if len(cfg.s3AllowedBuckets) == 0 {
+			return nil, notConfigured("subir con las credenciales del servidor requiere S3_ALLOWED_BUCKETS; envíe credenciales propias o s3_presigned_url")
+		}
+		if !cfg.s3AllowedBuckets[dest.Bucket] {
+			return nil, fmt.Errorf("el bucket %s no está permitido", dest.Bucket)
+		}
+		dest.AccessKeyID = cfg.s3AccessKeyID
+		dest.SecretAccessKey = cfg.s3SecretAccessKey
+		dest.SessionToken = cfg.s3SessionToken
+		dest.shared = true
+	} else if dest.AccessKeyID == "" || dest.SecretAccessKey == "" {
+		return nil, errors.New("s3_access_key_id y s3_secret_access_key deben enviarse juntos")
+	}
+
+	return dest, nil
+}
+
+// forOutput devuelve el destino para un formato cuando una solicitud genera
+// varias salidas: {format} en la clave se reemplaza, o se agrega .<formato>
+func (dest *s3Destination) forOutput(format string) *s3Destination {
+	copied := *dest
+	if strings.Contains(copied.Key, "{format}") {
+		copied.Key = strings.ReplaceAll(copied.Key, "{format}", format)
+	} else if copied.Key != "" {
+		copied.Key += "." + format
+	}
+	return &copied
+}
+
+// storeOutput sube data al destino y agrega a la respuesta la URL del objeto,
+// que reemplaza al campo base64
+func storeOutput(ctx context.Context, response gin.H, data []byte, contentType string, dest *s3Destination) error {
+	objectURL, err := uploadToS3(ctx, dest, data, contentType)
+	if err != nil {
+		return err
+	}
+
+	response["url"] = objectURL
+	if dest.Bucket != "" {
+		storage := gin.H{"bucket": dest.Bucket, "key": dest.Key}
+		if dest.StorageRegion != "" {
+			storage["storage_region"] = dest.StorageRegion
+		}
+		response["storage"] = storage
+	}
+	return nil
+}
+
+// uploadToS3 sube el objeto y devuelve su URL (sin la firma en el caso
+// prefirmado). Las etiquetas de la solicitud se guardan como x-amz-meta-*.
+func uploadToS3(ctx context.Context, dest *s3Destination, data []byte, contentType string) (string, error) {
+	var req *http.Request
+	var objectURL string
+	var err error
+
+	if dest.PresignedURL != "" {
+		req, err = http.NewRequestWithContext(ctx, http.MethodPut, dest.PresignedURL, bytes.NewReader(data))
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Content-Type", contentType)
+
+		parsed, _ := url.Parse(dest.PresignedURL)
+		parsed.RawQuery = ""
+		objectURL = parsed.String()
+	} else {
+		objectURL = dest.objectURL()
+		req, err = http.NewRequestWithContext(ctx, http.MethodPut, objectURL, bytes.NewReader(data))
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Content-Type", contentType)
+		for key, value := range requestInfoFrom(ctx).Labels {
+			req.Header.Set("X-Amz-Meta-"+s3MetadataKeyReplacer.Replace(key), value)
+		}
+		// El sha256 queda en los metadatos del objeto para verificarlo después
+		req.Header.Set("X-Amz-Meta-Sha256", artifactChecksum(data))
+		signS3Request(req, dest, data, time.Now().UTC())
+	}
+	req.ContentLength = int64(len(data))
+
+	start := time.Now()
+	resp, err := s3Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error al subir a S3: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+		return "", fmt.Errorf("S3 respondió HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	fmt.Printf("[s3] Subidos %d bytes a %s en %s\n", len(data), objectURL, time.Since(start).Round(time.Millisecond))
+	appendDebug(ctx, "s3_upload", map[string]interface{}{
+		"url":   objectURL,
+		"bytes": len(data),
+		"etag":  resp.Header.Get("ETag"),
+	})
+	return objectURL, nil
+}
+
+// deleteFromS3 borra un objeto subido antes por el servicio. Solo usa las
+// credenciales del servidor: las de la solicitud original no se guardan.
+func deleteFromS3(ctx context.Context, object storedObject) error {
+	dest, err := (&s3Destination{Bucket: object.Bucket, Key: object.Key, StorageRegion: object.Region}).validate()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, dest.objectURL(), nil)
+	if err != nil {
+		return err
+	}
+	signS3Request(req, dest, nil, time.Now().UTC())
+
+	resp, err := s3Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error al borrar de S3: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// S3 responde 204 aunque el objeto ya no exista
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+		return fmt.Errorf("S3 respondió HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	fmt.Printf("[s3] Borrado %s/%s\n", object.Bucket, object.Key)
+	return nil
+}
+
+// objectURL arma la URL del objeto: estilo virtual-host en AWS, o estilo
+// ruta con un endpoint propio (MinIO, R2, etc.) o S3_FORCE_PATH_STYLE
+func (dest *s3Destination) objectURL() string {
+	key := s3EscapePath(dest.Key)
+	if dest.Endpoint != "" {
+		return dest.Endpoint + "/" + dest.Bucket + "/" + key
+	}
+	if config().s3ForcePathStyle {
+		return fmt.Sprintf("https://s3.%s.amazonaws.com/%s/%s", dest.Region, dest.Bucket, key)
+	}
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", dest.Bucket, dest.Region, key)
+}
+
+// s3EscapePath codifica cada segmento de la clave según las reglas de SigV4
+func s3EscapePath(key string) string {
+	segments := strings.Split(strings.TrimLeft(key, "/"), "/")
+	for i, segment := range segments {
+		segments[i] = s3Escape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func s3Escape(value string) string {
+	var builder strings.Builder
+	for _, b := range []byte(value) {
+		if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') ||
+			b == '-' || b == '_' || b == '.' || b == '~' {
+			builder.WriteByte(b)
+		} else {
+			fmt.Fprintf(&builder, "%%%02X", b)
+		}
+	}
+	return builder.String()
+}
+
+// signS3Request firma la solicitud con AWS Signature Version 4
+func signS3Request(req *http.Request, dest *s3Destination, payload []byte, now time.Time) {
+	payloadHash := sha256.Sum256(payload)
+	payloadHex := hex.EncodeToString(payloadHash[:])
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHex)
+	if dest.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", dest.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHex,
+	}, "\n")
+
+	scope := date + "/" + dest.Region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+dest.SecretAccessKey), date)
+	key = hmacSHA256(key, dest.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		dest.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	selfTestOnBoot bool
+	// selfTestFormats son las salidas de audio que se prueban; los formatos
+	// cuyo codificador no está en el build no deben incluirse
+	selfTestFormats []string
+	selfTestTimeout time.Duration
+
+	selfTestMu     sync.Mutex
+	lastSelfTest   gin.H
+	selfTestPassed bool
+)
+
+func loadSelfTestConfig() {
+	selfTestOnBoot = envBool("SELFTEST_ON_BOOT", true)
+	selfTestTimeout = envDuration("SELFTEST_TIMEOUT", time.Minute)
+	selfTestFormats = parseOutputFormats(os.Getenv("SELFTEST_AUDIO_FORMATS"))
+	if len(selfTestFormats) == 0 {
+		selfTestFormats = []string{"ogg", "mp3", "m4a", "wav", "flac"}
+	}
+	// Sin prueba de arranque el servicio queda listo de inmediato
+	selfTestPassed = !selfTestOnBoot
+}
+
+// startSelfTest ejecuta la prueba de arranque en segundo plano; /ready
+// responde 503 hasta que termina bien
+func startSelfTest() {
+	if !selfTestOnBoot {
+		return
+	}
+	go func() {
+		report := runSelfTest(context.Background())
+		fmt.Printf("[selftest] Prueba de arranque terminada: passed=%v\n", report["passed"])
+	}()
+}
+
+// runSelfTest pasa un medio de prueba mínimo, generado en memoria, por cada
+// pipeline: directorio temporal, cada formato de audio, imagen y video
+func runSelfTest(ctx context.Context) gin.H {
+	ctx, cancel := context.WithTimeout(ctx, selfTestTimeout)
+	defer cancel()
+
+	started := time.Now()
+	var checks []gin.H
+	passed := true
+	check := func(name string, run func() error) {
+		checkStart := time.Now()
+		err := run()
+		result := gin.H{
+			"name":        name,
+			"ok":          err == nil,
+			"duration_ms": time.Since(checkStart).Milliseconds(),
+		}
+		if err != nil {
+			passed = false
+			result["error"] = truncateErrorMessage(err.Error())
+			fmt.Printf("[selftest] %s falló: %v\n", name, err)
+		}
+		checks = append(checks, result)
+	}
+
+	check("temp_dir", func() error {
+		path, cleanup, err := writeTempInput([]byte("selftest"), "selftest-*")
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		data, err := os.ReadFile(path)
+		if err != nil || string(data) != "selftest" {
+			return fmt.Errorf("el archivo temporal no se pudo leer de vuelta: %v", err)
+		}
+		return nil
+	})
+
+	wav := syntheticWAV(0.5, 16000)
+	for _, format := range selfTestFormats {
+		format := format
+		check("audio_"+format, func() error {
+			data, _, err := convertAudio(ctx, wav, audioOptions{Format: format, DisableCodecCopy: true})
+			if err == nil && len(data) == 0 {
+				err = fmt.Errorf("salida vacía")
+			}
+			return err
+		})
+	}
+
+	check("image_png", func() error {
+		_, err := convertImageToPng(ctx, syntheticPNG())
+		return err
+	})
+
+	check("video_mp4", func() error {
+		_, err := convertGifToMp4(ctx, syntheticGIF())
+		return err
+	})
+
+	report := gin.H{
+		"passed":      passed,
+		"started_at":  started.UTC().Format(time.RFC3339),
+		"duration_ms": time.Since(started).Milliseconds(),
+		"checks":      checks,
+	}
+
+	selfTestMu.Lock()
+	lastSelfTest = report
+	selfTestPassed = passed
+	selfTestMu.Unlock()
+	return report
+}
+
+func truncateErrorMessage(message string) string {
+	message = strings.TrimSpace(message)
+	if len(message) > 500 {
+		return message[:500] + "..."
+	}
+	return message
+}
+
+// syntheticWAV genera un tono de 440 Hz en PCM mono de 16 bits
+func syntheticWAV(seconds float64, sampleRate int) []byte {
+	samples := int(seconds * float64(sampleRate))
+
+	var pcm bytes.Buffer
+	for i := 0; i < samples; i++ {
+		value := int16(8000 * math.Sin(2*math.Pi*440*float64(i)/float64(sampleRate)))
+		binary.Write(&pcm, binary.LittleEndian, value)
+	}
+	return wavFromPCM(pcm.Bytes(), sampleRate)
+}
+
+// syntheticPNG genera una imagen de 16x16
+func syntheticPNG() []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 16), uint8(y * 16), 128, 255})
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+// syntheticGIF genera una animación de dos cuadros de 16x16
+func syntheticGIF() []byte {
+	palette := color.Palette{color.Black, color.White}
+	animation := &gif.GIF{}
+	for frame := 0; frame < 2; frame++ {
+		img := image.NewPaletted(image.Rect(0, 0, 16, 16), palette)
+		for y := 0; y < 16; y++ {
+			for x := 0; x < 16; x++ {
+				img.SetColorIndex(x, y, uint8((x+y+frame)%2))
+			}
+		}
+		animation.Image = append(animation.Image, img)
+		animation.Delay = append(animation.Delay, 10)
+	}
+	var buf bytes.Buffer
+	gif.EncodeAll(&buf, animation)
+	return buf.Bytes()
+}
+
+// serveReady atiende GET /ready: 200 si la última prueba pasó, 503 si falló
+// o todavía no terminó
+func serveReady(c *gin.Context) {
+	selfTestMu.Lock()
+	passed, report := selfTestPassed, lastSelfTest
+	selfTestMu.Unlock()
+
+	response := gin.H{"status": "ready"}
+	if report != nil {
+		response["selftest"] = report
+	}
+	if !passed {
+		response["status"] = "not_ready"
+		c.JSON(http.StatusServiceUnavailable, response)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// processSelfTest atiende POST /admin/selftest: ejecuta la prueba y
+// actualiza el estado de /ready
+func processSelfTest(c *gin.Context) {
+	if !validateAPIKey(c) {
+		return
+	}
+
+	report := runSelfTest(c.Request.Context())
+	if report["passed"] != true {
+		c.JSON(http.StatusServiceUnavailable, report)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
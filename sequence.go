@@ -0,0 +1,343 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// frameExtensions son los formatos de imagen que acepta /frames-to-video
+var frameExtensions = map[string]bool{
+	".png":  true,
+	".jpg":  true,
+	".jpeg": true,
+	".webp": true,
+	".bmp":  true,
+	".tif":  true,
+	".tiff": true,
+}
+
+// frameNumberPattern toma el último grupo de dígitos del nombre, p. ej. 42 en
+// "shot_010.0042.png"
+var frameNumberPattern = regexp.MustCompile(`(\d+)\D*$`)
+
+// sequenceFormats son las salidas de /frames-to-video: códec de video, pixel
+// format y contenedor
+var sequenceFormats = map[string]struct {
+	args        []string
+	contentType string
+}{
+	"mp4":  {args: []string{"-c:v", "libx264", "-preset", "medium", "-pix_fmt", "yuv420p", "-movflags", "+faststart", "-f", "mp4"}, contentType: "video/mp4"},
+	"webm": {args: []string{"-c:v", "libvpx-vp9", "-b:v", "0", "-pix_fmt", "yuv420p", "-f", "webm"}, contentType: "video/webm"},
+	"mov":  {args: []string{"-c:v", "prores_ks", "-profile:v", "3", "-pix_fmt", "yuv422p10le", "-f", "mov"}, contentType: "video/quicktime"},
+}
+
+// sequenceFrame es un cuadro de la secuencia con su número
+type sequenceFrame struct {
+	Name   string
+	Number int
+	Data   []byte
+}
+
+// frameNumber extrae el número de cuadro del nombre; -1 si no tiene
+func frameNumber(name string) int {
+	base := strings.TrimSuffix(path.Base(name), path.Ext(name))
+	matches := frameNumberPattern.FindStringSubmatch(base)
+	if matches == nil {
+		return -1
+	}
+	number, err := strconv.Atoi(matches[1])
+	if err != nil {
+		return -1
+	}
+	return number
+}
+
+// readZipFrames extrae las imágenes de un zip, sin carpetas ni archivos
+// ocultos (p. ej. __MACOSX). El tamaño descomprimido se controla al leer, no
+// con el valor declarado en el zip.
+func readZipFrames(data []byte) ([]sequenceFrame, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("zip inválido: %v", err)
+	}
+
+	var (
+		frames []sequenceFrame
+		total  int64
+	)
+	cfg := config()
+	limit := int64(cfg.maxSequenceMB) << 20
+	for _, file := range reader.File {
+		name := file.Name
+		if file.FileInfo().IsDir() || strings.HasPrefix(path.Base(name), ".") || strings.HasPrefix(name, "__MACOSX/") {
+			continue
+		}
+		if !frameExtensions[strings.ToLower(path.Ext(name))] {
+			continue
+		}
+		if len(frames) == cfg.maxSequenceFrames {
+			return nil, fmt.Errorf("el zip tiene más de %d cuadros", cfg.maxSequenceFrames)
+		}
+
+		entry, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("error al leer %s del zip: %v", name, err)
+		}
+		frame, err := io.ReadAll(io.LimitReader(entry, limit-total+1))
+		entry.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error al leer %s del zip: %v", name, err)
+		}
+		if total += int64(len(frame)); total > limit {
+			return nil, inputOutOfRange("los cuadros descomprimidos superan %d MB", cfg.maxSequenceMB)
+		}
+		frames = append(frames, sequenceFrame{Name: name, Number: frameNumber(name), Data: frame})
+	}
+	if len(frames) == 0 {
+		return nil, errors.New("el zip no contiene imágenes (png, jpg, webp, bmp o tiff)")
+	}
+	return frames, nil
+}
+
+// getSequenceFrames lee los cuadros de frame_url (repetido, una URL por
+// cuadro) o de un zip enviado como file, base64 o url
+func getSequenceFrames(c *gin.Context) ([]sequenceFrame, error) {
+	urls := c.PostFormArray("frame_url")
+	if len(urls) == 0 {
+		data, err := getInputData(c)
+		if err != nil {
+			return nil, err
+		}
+		return readZipFrames(data)
+	}
+
+	if maxFrames := config().maxSequenceFrames; len(urls) > maxFrames {
+		return nil, fmt.Errorf("se recibieron %d cuadros; el máximo es %d", len(urls), maxFrames)
+	}
+	info := requestInfoFrom(c.Request.Context())
+	frames := make([]sequenceFrame, 0, len(urls))
+	for i, url := range urls {
+		name := filepath.Base(url)
+		if index := strings.IndexAny(name, "?#"); index >= 0 {
+			name = name[:index]
+		}
+		if !frameExtensions[strings.ToLower(path.Ext(name))] {
+			return nil, fmt.Errorf("cuadro %d: %s no es una imagen png, jpg, webp, bmp o tiff", i+1, name)
+		}
+		data, err := fetchImageFromURL(c.Request.Context(), url)
+		if err != nil {
+			return nil, fmt.Errorf("cuadro %d: %w", i+1, err)
+		}
+		info.addInput(data)
+		if err := checkTokenInputLimit(c, info); err != nil {
+			return nil, err
+		}
+		frames = append(frames, sequenceFrame{Name: name, Number: frameNumber(name), Data: data})
+	}
+	return frames, nil
+}
+
+// orderFrames ordena los cuadros por número (o por nombre si no tienen) y
+// devuelve la extensión común y los huecos de la numeración
+func orderFrames(frames []sequenceFrame) (string, []string, error) {
+	extension := strings.ToLower(path.Ext(frames[0].Name))
+	if extension == ".jpeg" {
+		extension = ".jpg"
+	}
+	for _, frame := range frames {
+		frameExtension := strings.ToLower(path.Ext(frame.Name))
+		if frameExtension == ".jpeg" {
+			frameExtension = ".jpg"
+		}
+		if frameExtension != extension {
+			return "", nil, fmt.Errorf("todos los cuadros deben tener el mismo formato: %s y %s", frames[0].Name, frame.Name)
+		}
+	}
+
+	sort.SliceStable(frames, func(i, j int) bool {
+		if frames[i].Number != frames[j].Number {
+			return frames[i].Number < frames[j].Number
+		}
+		return frames[i].Name < frames[j].Name
+	})
+
+	var warnings []string
+	for i := 1; i < len(frames); i++ {
+		previous, current := frames[i-1].Number, frames[i].Number
+		switch {
+		case previous < 0 || current < 0:
+		case current == previous:
+			warnings = append(warnings, fmt.Sprintf("cuadro %d repetido (%s y %s)", current, frames[i-1].Name, frames[i].Name))
+		case current > previous+1:
+			warnings = append(warnings, fmt.Sprintf("faltan los cuadros %d a %d", previous+1, current-1))
+		}
+	}
+	return extension, warnings, nil
+}
+
+// parseSequenceFPS acepta un número (24, 29.97) o una fracción (30000/1001)
+func parseSequenceFPS(value string) (string, error) {
+	if value == "" {
+		return "24", nil
+	}
+	numerator, denominator, isFraction := strings.Cut(value, "/")
+	fps, err := strconv.ParseFloat(numerator, 64)
+	if err == nil && isFraction {
+		var divisor float64
+		if divisor, err = strconv.ParseFloat(denominator, 64); err == nil && divisor > 0 {
+			fps /= divisor
+		} else {
+			err = errors.New("denominador inválido")
+		}
+	}
+	if err != nil || fps < 1 || fps > 120 {
+		return "", invalidParam("fps", "fps inválido %q (entre 1 y 120, p. ej. 24 o 30000/1001)", value)
+	}
+	return value, nil
+}
+
+// sequenceOptions son los parámetros de /frames-to-video
+type sequenceOptions struct {
+	FPS    string
+	Format string
+	// CRF es la calidad de mp4 y webm (menor es mejor); "" usa 18 y 31
+	CRF string
+}
+
+// framesToVideo escribe los cuadros numerados en una carpeta temporal y los
+// une con el demuxer image2 de ffmpeg
+func framesToVideo(ctx context.Context, frames []sequenceFrame, extension string, opts sequenceOptions) ([]byte, error) {
+	workDir, err := os.MkdirTemp("", "sequence-*")
+	if err != nil {
+		return nil, fmt.Errorf("error al crear la carpeta temporal: %v", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	for i, frame := range frames {
+		framePath := filepath.Join(workDir, fmt.Sprintf("frame-%06d%s", i+1, extension))
+		if err := os.WriteFile(framePath, frame.Data, 0o600); err != nil {
+			return nil, fmt.Errorf("error al escribir el cuadro %s: %v", frame.Name, err)
+		}
+	}
+	outputPath := filepath.Join(workDir, "output."+opts.Format)
+
+	format := sequenceFormats[opts.Format]
+	args := []string{
+		"-framerate", opts.FPS,
+		"-start_number", "1",
+		"-i", filepath.Join(workDir, "frame-%06d"+extension),
+		// H.264 y VP9 en 4:2:0 necesitan dimensiones pares
+		"-vf", "scale=trunc(iw/2)*2:trunc(ih/2)*2",
+	}
+	args = append(args, format.args...)
+	if crf := opts.CRF; opts.Format != "mov" {
+		if crf == "" {
+			crf = map[string]string{"mp4": "18", "webm": "31"}[opts.Format]
+		}
+		args = append(args, "-crf", crf)
+	}
+	args = append(args, classThreadArgs(ctx, classBatch)...)
+	args = append(args, "-y", outputPath)
+
+	cmd := ffmpegCommand(ctx, classBatch, args...)
+	var errBuffer bytes.Buffer
+	cmd.Stderr = &errBuffer
+
+	fmt.Printf("[sequence] %d cuadros %s a %s fps -> %s\n", len(frames), extension, opts.FPS, opts.Format)
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error al unir los cuadros: %v, detalles: %s", err, errBuffer.String())
+	}
+
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		return nil, fmt.Errorf("error al leer archivo de salida: %v", err)
+	}
+	if len(data) == 0 {
+		return nil, errors.New("la conversión produjo un archivo vacío")
+	}
+	return data, nil
+}
+
+// processFramesToVideo atiende /frames-to-video: una secuencia de imágenes
+// numeradas (zip o frame_url) a video
+func processFramesToVideo(c *gin.Context) {
+	if !validateAPIKey(c) {
+		return
+	}
+
+	opts := sequenceOptions{Format: c.DefaultPostForm("output_format", "mp4"), CRF: c.PostForm("crf")}
+	if _, ok := sequenceFormats[opts.Format]; !ok {
+		respondError(c, http.StatusBadRequest, invalidParam("output_format", "output_format inválido %q (mp4, webm o mov)", opts.Format))
+		return
+	}
+	var err error
+	if opts.FPS, err = parseSequenceFPS(c.PostForm("fps")); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	if opts.CRF != "" {
+		if crf, err := strconv.Atoi(opts.CRF); err != nil || crf < 0 || crf > 51 || opts.Format == "mov" {
+			respondError(c, http.StatusBadRequest, invalidParam("crf", "crf inválido %q (0 a 51, solo mp4 y webm)", opts.CRF))
+			return
+		}
+	}
+
+	frames, err := getSequenceFrames(c)
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+	extension, warnings, err := orderFrames(frames)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	data, err := framesToVideo(ctx, frames, extension, opts)
+	if err == nil {
+		data, err = interceptOutput(ctx, opts.Format, data)
+	}
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusInternalServerError), err)
+		return
+	}
+
+	if wantsBinaryResponse(c, "") {
+		headers := map[string]string{
+			"X-Format": opts.Format,
+			"X-Frames": strconv.Itoa(len(frames)),
+		}
+		if len(warnings) > 0 {
+			headers["X-Warnings"] = strings.Join(warnings, "; ")
+		}
+		writeBinaryResponse(c, data, "video."+opts.Format, sequenceFormats[opts.Format].contentType, headers)
+		return
+	}
+	response := gin.H{
+		"format": opts.Format,
+		"frames": len(frames),
+		"fps":    opts.FPS,
+		"size":   len(data),
+		"video":  base64.StdEncoding.EncodeToString(data),
+	}
+	if len(warnings) > 0 {
+		response["warnings"] = warnings
+	}
+	c.JSON(http.StatusOK, attachDebug(ctx, response))
+}
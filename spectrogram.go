@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// spectrogramScales son las escalas de intensidad de showspectrumpic
+var spectrogramScales = map[string]bool{
+	"lin":   true,
+	"sqrt":  true,
+	"cbrt":  true,
+	"log":   true,
+	"4thrt": true,
+	"5thrt": true,
+}
+
+// spectrogramOptions son los parámetros de /spectrogram
+type spectrogramOptions struct {
+	Width  int
+	Height int
+	Scale  string
+	// FScale es la escala de frecuencias: lin o log
+	FScale string
+	// Legend agrega ejes de tiempo y frecuencia alrededor del espectro
+	Legend bool
+}
+
+func parseSpectrogramOptions(c *gin.Context) (spectrogramOptions, error) {
+	opts := spectrogramOptions{
+		Scale:  c.DefaultPostForm("scale", "log"),
+		FScale: c.DefaultPostForm("fscale", "lin"),
+		Legend: c.DefaultPostForm("legend", "true") == "true",
+	}
+	var err error
+	if opts.Width, opts.Height, err = parseImageSize(c, 1024, 512); err != nil {
+		return opts, err
+	}
+	if !spectrogramScales[opts.Scale] {
+		return opts, invalidParam("scale", "scale inválido %q (lin, sqrt, cbrt, log, 4thrt o 5thrt)", opts.Scale)
+	}
+	if opts.FScale != "lin" && opts.FScale != "log" {
+		return opts, invalidParam("fscale", "fscale inválido %q (lin o log)", opts.FScale)
+	}
+	return opts, nil
+}
+
+// renderSpectrogram dibuja el espectro completo del audio con showspectrumpic.
+// Width y Height son los del espectro; la leyenda agrega márgenes.
+func renderSpectrogram(ctx context.Context, inputData []byte, opts spectrogramOptions) ([]byte, error) {
+	legend := 0
+	if opts.Legend {
+		legend = 1
+	}
+	graph := fmt.Sprintf("[0:a]showspectrumpic=s=%dx%d:scale=%s:fscale=%s:legend=%d",
+		opts.Width, opts.Height, opts.Scale, opts.FScale, legend)
+	return renderAudioPicture(ctx, inputData, graph)
+}
+
+// processSpectrogram atiende /spectrogram
+func processSpectrogram(c *gin.Context) {
+	if !validateAPIKey(c) {
+		return
+	}
+
+	inputData, err := getInputData(c)
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+
+	opts, err := parseSpectrogramOptions(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	image, err := renderSpectrogram(ctx, inputData, opts)
+	if err == nil {
+		image, err = interceptOutput(ctx, "png", image)
+	}
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusInternalServerError), err)
+		return
+	}
+
+	if wantsBinaryResponse(c, "") {
+		writeBinaryResponse(c, image, "spectrogram.png", "image/png", map[string]string{
+			"X-Width":  strconv.Itoa(opts.Width),
+			"X-Height": strconv.Itoa(opts.Height),
+			"X-Scale":  opts.Scale,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, attachDebug(ctx, gin.H{
+		"format": "png",
+		"width":  opts.Width,
+		"height": opts.Height,
+		"scale":  opts.Scale,
+		"fscale": opts.FScale,
+		"legend": opts.Legend,
+		"size":   len(image),
+		"image":  base64.StdEncoding.EncodeToString(image),
+	}))
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxSplitSegments limita las salidas del único proceso ffmpeg de /split-audio
+const maxSplitSegments = 500
+
+// mediaSegment es un tramo [Start, End) de la entrada con su salida
+type mediaSegment struct {
+	Start float64
+	End   float64
+	Data  []byte
+}
+
+// splitOptions son los parámetros de /split-audio; MaxDuration y MinDuration
+// en 0 no limitan
+type splitOptions struct {
+	Silence     *silenceRemoval
+	MaxDuration float64
+	MinDuration float64
+	Format      string
+}
+
+// parseSplitDuration lee una duración opcional en segundos
+func parseSplitDuration(c *gin.Context, name string) (float64, error) {
+	value := c.PostForm(name)
+	if value == "" {
+		return 0, nil
+	}
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil || seconds < 1 || seconds > 86400 {
+		return 0, invalidParam(name, "%s inválido %q (segundos, desde 1)", name, value)
+	}
+	return seconds, nil
+}
+
+func parseSplitOptions(c *gin.Context) (splitOptions, error) {
+	opts := splitOptions{Format: negotiateFormat(c, audioNegotiationFormats, "ogg")}
+	var err error
+	if opts.Silence, err = parseSilenceRemoval(c.PostForm("silence_threshold"), c.PostForm("silence_min_duration")); err != nil {
+		return opts, err
+	}
+	if opts.MaxDuration, err = parseSplitDuration(c, "max_segment_duration"); err != nil {
+		return opts, err
+	}
+	if opts.MinDuration, err = parseSplitDuration(c, "min_segment_duration"); err != nil {
+		return opts, err
+	}
+	if opts.MaxDuration > 0 && opts.MinDuration >= opts.MaxDuration {
+		return opts, errors.New("min_segment_duration debe ser menor que max_segment_duration")
+	}
+	for _, format := range audioNegotiationFormats {
+		if opts.Format == format {
+			return opts, nil
+		}
+	}
+	return opts, invalidParam("output_format", "output_format inválido %q (%s)", opts.Format, strings.Join(audioNegotiationFormats, ", "))
+}
+
+// planSegments elige los cortes en la mitad de cada silencio para no perder
+// habla en los bordes. Sin MaxDuration se corta en cada silencio; con
+// MaxDuration solo donde hace falta, en el último silencio que entra en el
+// límite o, si no hay ninguno, en el límite mismo. MinDuration descarta los
+// silencios que dejarían un tramo más corto.
+func planSegments(report *silenceReport, opts splitOptions) []mediaSegment {
+	var cuts []float64
+	for _, region := range report.Regions {
+		// Los silencios al inicio o al final no separan nada
+		if region.Start > 0 && region.End < report.Duration {
+			cuts = append(cuts, (region.Start+region.End)/2)
+		}
+	}
+	usable := func(cut, start float64) bool {
+		return cut > start && cut-start >= opts.MinDuration
+	}
+
+	var segments []mediaSegment
+	for start := 0.0; report.Duration-start > 0.001; {
+		end := report.Duration
+		switch {
+		case opts.MaxDuration == 0:
+			for _, cut := range cuts {
+				if usable(cut, start) {
+					end = cut
+					break
+				}
+			}
+		case end-start > opts.MaxDuration:
+			end = start + opts.MaxDuration
+			for i := len(cuts) - 1; i >= 0; i-- {
+				if cuts[i] <= end && usable(cuts[i], start) {
+					end = cuts[i]
+					break
+				}
+			}
+		}
+		segments = append(segments, mediaSegment{Start: start, End: end})
+		start = end
+	}
+	return segments
+}
+
+// splitAtSegments corta la entrada en un único proceso ffmpeg, como
+// splitByCue: la entrada se decodifica una vez y cada salida aplica su -ss/-to
+func splitAtSegments(ctx context.Context, inputData []byte, segments []mediaSegment, format string) error {
+	inputSource, stdin, cleanup, err := ffmpegInput(inputData, "split-input-*")
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	outputPaths := make([]string, len(segments))
+	args := []string{"-i", inputSource}
+	for i, segment := range segments {
+		outputPath, cleanupOutput, err := createTempOutput(fmt.Sprintf("split-segment-%03d-*.%s", i+1, format))
+		if err != nil {
+			return err
+		}
+		defer cleanupOutput()
+		outputPaths[i] = outputPath
+
+		args = append(args, "-map", "0:a:0", "-ss", formatSeconds(segment.Start), "-to", formatSeconds(segment.End))
+		args = append(args, getFFmpegOutputArgs(format)...)
+		args = append(args, classThreadArgs(ctx, classBatch)...)
+		args = append(args, "-y", outputPath)
+	}
+
+	cmd := ffmpegCommand(ctx, classBatch, args...)
+	cmd.Stdin = stdin
+	var errBuffer bytes.Buffer
+	cmd.Stderr = &errBuffer
+
+	fmt.Printf("[splitAudio] Cortando %d tramos a %s\n", len(segments), format)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error al cortar el audio: %v, detalles: %s", err, errBuffer.String())
+	}
+
+	for i := range segments {
+		data, err := os.ReadFile(outputPaths[i])
+		if err != nil {
+			return fmt.Errorf("error al leer el tramo %d: %v", i+1, err)
+		}
+		if len(data) == 0 {
+			return fmt.Errorf("el tramo %d quedó vacío", i+1)
+		}
+		if format == "m4a" {
+			data = addGaplessInfo(data)
+		}
+		segments[i].Data = data
+	}
+	return nil
+}
+
+// segmentFilename nombra los tramos dentro del ZIP y en el manifiesto
+func segmentFilename(index int, format string) string {
+	return fmt.Sprintf("segment-%03d.%s", index+1, format)
+}
+
+// runSplitAudio detecta los silencios, corta la entrada y devuelve los tramos
+func runSplitAudio(ctx context.Context, inputData []byte, opts splitOptions) ([]mediaSegment, error) {
+	report, err := detectSilence(ctx, inputData, opts.Silence)
+	if err != nil {
+		return nil, err
+	}
+	if report.Duration <= 0 {
+		return nil, errors.New("no se pudo determinar la duración de la entrada")
+	}
+
+	segments := planSegments(report, opts)
+	if len(segments) > maxSplitSegments {
+		return nil, fmt.Errorf("el corte produciría %d tramos; el máximo es %d (suba silence_min_duration o min_segment_duration)", len(segments), maxSplitSegments)
+	}
+	recordDebug(ctx, "split_segments", len(segments))
+	if err := splitAtSegments(ctx, inputData, segments, opts.Format); err != nil {
+		return nil, err
+	}
+	for i := range segments {
+		if segments[i].Data, err = interceptOutput(ctx, opts.Format, segments[i].Data); err != nil {
+			return nil, err
+		}
+	}
+	return segments, nil
+}
+
+// splitAudioView es el cuerpo JSON de /split-audio
+func splitAudioView(segments []mediaSegment, format string) gin.H {
+	parts := make([]gin.H, 0, len(segments))
+	manifest := newArtifactManifest()
+	for i, segment := range segments {
+		part := gin.H{
+			"index":    i + 1,
+			"start":    roundMillis(segment.Start),
+			"end":      roundMillis(segment.End),
+			"duration": roundMillis(segment.End - segment.Start),
+			"format":   format,
+			"audio":    base64.StdEncoding.EncodeToString(segment.Data),
+		}
+		manifest.add(part, segmentFilename(i, format), format, segment.Data)
+		parts = append(parts, part)
+	}
+	return gin.H{
+		"segments": parts,
+		"count":    len(parts),
+		"format":   format,
+		"manifest": manifest,
+	}
+}
+
+// zipSegments empaqueta los tramos sin recomprimir: el audio ya está
+// comprimido
+func zipSegments(segments []mediaSegment, format string) ([]byte, error) {
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	for i, segment := range segments {
+		entry, err := archive.CreateHeader(&zip.FileHeader{Name: segmentFilename(i, format), Method: zip.Store})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := entry.Write(segment.Data); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// wantsZipResponse indica si se pidió el ZIP (response=zip o binary, o
+// Accept: application/zip) en lugar del JSON con los tramos en base64
+func wantsZipResponse(c *gin.Context) bool {
+	for _, value := range []string{c.PostForm("response"), c.Query("response")} {
+		if strings.EqualFold(value, "zip") {
+			return true
+		}
+	}
+	for _, accepted := range parseAccept(c.GetHeader("Accept")) {
+		if accepted.mediaType == "application/zip" {
+			return true
+		}
+	}
+	return wantsBinaryResponse(c, "")
+}
+
+// processSplitAudio atiende /split-audio: corta una grabación larga en los
+// silencios, p. ej. para motores de ASR con límite de duración por solicitud
+func processSplitAudio(c *gin.Context) {
+	if !validateAPIKey(c) {
+		return
+	}
+
+	inputData, err := getInputData(c)
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+	opts, err := parseSplitOptions(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	// Las grabaciones largas pueden procesarse en segundo plano con callback_url
+	callbackURL, err := parseCallbackURL(c.Request.Context(), c.PostForm("callback_url"))
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+	if callbackURL != "" {
+		job, err := submitJob(c.Request.Context(), "split-audio", callbackURL, inputData, func(ctx context.Context) (gin.H, error) {
+			segments, err := runSplitAudio(ctx, inputData, opts)
+			if err != nil {
+				return nil, err
+			}
+			return splitAudioView(segments, opts.Format), nil
+		})
+		if err != nil {
+			respondError(c, http.StatusServiceUnavailable, err)
+			return
+		}
+		c.JSON(http.StatusAccepted, job.view())
+		return
+	}
+
+	ctx := c.Request.Context()
+	segments, err := runSplitAudio(ctx, inputData, opts)
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusInternalServerError), err)
+		return
+	}
+
+	if wantsZipResponse(c) {
+		archive, err := zipSegments(segments, opts.Format)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error al crear el ZIP: " + err.Error()})
+			return
+		}
+		writeBinaryResponse(c, archive, "segments.zip", "application/zip", map[string]string{
+			"X-Format":   opts.Format,
+			"X-Segments": strconv.Itoa(len(segments)),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, attachDebug(ctx, splitAudioView(segments, opts.Format)))
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// stereoAnalysis resume la correlación de fase y la compatibilidad mono
+type stereoAnalysis struct {
+	Channels        int
+	MeanCorrelation float64
+	MinCorrelation  float64
+	// NegativeRatio es la fracción del audio con correlación negativa
+	NegativeRatio float64
+	LeftRMS       float64
+	RightRMS      float64
+	StereoRMS     float64
+	MonoRMS       float64
+	// DownmixLoss es cuánto nivel se pierde al sumar a mono (dB)
+	DownmixLoss    float64
+	MonoCompatible bool
+	// Downmix es la corrección que aplica mono_downmix_safe ("" si ninguna)
+	Downmix string
+}
+
+// Umbrales de compatibilidad mono
+const (
+	monoMaxNegativeRatio = 0.05
+	monoMaxDownmixLoss   = 3.0
+	// Correlación media por debajo de la cual se considera una pista con
+	// la polaridad de un canal invertida
+	invertedPolarityCorrelation = -0.5
+)
+
+var (
+	phaseValueRe = regexp.MustCompile(`lavfi\.aphasemeter\.phase=(-?[\d.]+)`)
+	rmsLevelRe   = regexp.MustCompile(`RMS level dB:\s*(-?[\d.]+|-inf)`)
+)
+
+// analyzeStereo mide la correlación de fase con aphasemeter y el nivel RMS de
+// la señal estéreo frente a su suma mono, en una sola pasada
+func analyzeStereo(ctx context.Context, inputData []byte) (*stereoAnalysis, error) {
+	stream, err := probeAudioStream(ctx, inputData)
+	if err != nil {
+		return nil, err
+	}
+	if stream.Channels < 2 {
+		return &stereoAnalysis{Channels: stream.Channels, MeanCorrelation: 1, MinCorrelation: 1, MonoCompatible: true}, nil
+	}
+
+	inputSource, stdin, cleanup, err := ffmpegInput(inputData, "stereo-input-*")
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	graph := strings.Join([]string{
+		"[0:a]aformat=channel_layouts=stereo,asplit=3[p][s][m]",
+		"[p]aphasemeter=video=0,ametadata=mode=print:key=lavfi.aphasemeter.phase,anullsink",
+		"[s]astats@stereo,anullsink",
+		"[m]pan=mono|c0=0.5*c0+0.5*c1,astats@mono[out]",
+	}, ";")
+
+	args := []string{"-nostats", "-i", inputSource, "-filter_complex", graph, "-map", "[out]", "-f", "null", "-"}
+	cmd := ffmpegCommand(ctx, classInteractive, args...)
+	cmd.Stdin = stdin
+	var errBuffer bytes.Buffer
+	cmd.Stderr = &errBuffer
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error en el análisis estéreo: %v, detalles: %s", err, errBuffer.String())
+	}
+
+	return parseStereoAnalysis(errBuffer.String(), stream.Channels)
+}
+
+func parseStereoAnalysis(stderrOutput string, channels int) (*stereoAnalysis, error) {
+	analysis := &stereoAnalysis{Channels: channels, MinCorrelation: 1}
+
+	matches := phaseValueRe.FindAllStringSubmatch(stderrOutput, -1)
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("aphasemeter no reportó valores")
+	}
+	negative := 0
+	sum := 0.0
+	for _, match := range matches {
+		value, err := strconv.ParseFloat(match[1], 64)
+		if err != nil {
+			continue
+		}
+		sum += value
+		if value < analysis.MinCorrelation {
+			analysis.MinCorrelation = value
+		}
+		if value < 0 {
+			negative++
+		}
+	}
+	analysis.MeanCorrelation = sum / float64(len(matches))
+	analysis.NegativeRatio = float64(negative) / float64(len(matches))
+
+	// astats imprime el RMS de cada canal y al final el global ("Overall")
+	stereoLevels := astatsLevels(stderrOutput, "astats@stereo")
+	monoLevels := astatsLevels(stderrOutput, "astats@mono")
+	if len(stereoLevels) < 3 || len(monoLevels) == 0 {
+		return nil, fmt.Errorf("astats no reportó niveles RMS")
+	}
+	analysis.LeftRMS = stereoLevels[0]
+	analysis.RightRMS = stereoLevels[1]
+	analysis.StereoRMS = stereoLevels[len(stereoLevels)-1]
+	analysis.MonoRMS = monoLevels[len(monoLevels)-1]
+	if !math.IsInf(analysis.StereoRMS, -1) && !math.IsInf(analysis.MonoRMS, -1) {
+		analysis.DownmixLoss = math.Max(0, analysis.StereoRMS-analysis.MonoRMS)
+	} else if !math.IsInf(analysis.StereoRMS, -1) {
+		// La suma mono se cancela por completo
+		analysis.DownmixLoss = math.Inf(1)
+	}
+
+	analysis.MonoCompatible = analysis.NegativeRatio <= monoMaxNegativeRatio && analysis.DownmixLoss <= monoMaxDownmixLoss
+	analysis.Downmix = monoDownmixFix(analysis)
+	return analysis, nil
+}
+
+// astatsLevels devuelve los valores "RMS level dB" de una instancia de astats
+func astatsLevels(stderrOutput string, instance string) []float64 {
+	var levels []float64
+	for _, line := range strings.Split(stderrOutput, "\n") {
+		if !strings.Contains(line, "["+instance+" @") {
+			continue
+		}
+		match := rmsLevelRe.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		if match[1] == "-inf" {
+			levels = append(levels, math.Inf(-1))
+			continue
+		}
+		if value, err := strconv.ParseFloat(match[1], 64); err == nil {
+			levels = append(levels, value)
+		}
+	}
+	return levels
+}
+
+// monoDownmixFix elige la corrección para que la pista sobreviva a una
+// emisión en mono: invertir el canal derecho si la polaridad está invertida,
+// o usar solo el canal dominante si hay cancelaciones parciales
+func monoDownmixFix(analysis *stereoAnalysis) string {
+	switch {
+	case analysis.MonoCompatible:
+		return ""
+	case analysis.MeanCorrelation <= invertedPolarityCorrelation:
+		return "invert_right"
+	case analysis.LeftRMS >= analysis.RightRMS:
+		return "left_only"
+	default:
+		return "right_only"
+	}
+}
+
+// monoDownmixFilter traduce la corrección a un filtro pan. Se conserva el
+// diseño estéreo para que las salidas estéreo también queden compatibles.
+func monoDownmixFilter(fix string) string {
+	switch fix {
+	case "invert_right":
+		return "pan=stereo|c0=c0|c1=-1*c1"
+	case "left_only":
+		return "pan=stereo|c0=c0|c1=c0"
+	case "right_only":
+		return "pan=stereo|c0=c1|c1=c1"
+	}
+	return ""
+}
+
+// analyzedStereo analiza la entrada la primera vez y reutiliza el resultado
+func (opts *audioOptions) analyzedStereo(ctx context.Context, inputData []byte) (*stereoAnalysis, error) {
+	if opts.stereo != nil {
+		return opts.stereo, nil
+	}
+
+	analysis, err := analyzeStereo(ctx, inputData)
+	if err != nil {
+		return nil, err
+	}
+	opts.stereo = analysis
+	return analysis, nil
+}
+
+// report es la representación de la respuesta, sin infinitos (que
+// encoding/json no admite)
+func (analysis *stereoAnalysis) report() map[string]interface{} {
+	finite := func(value float64) interface{} {
+		if math.IsInf(value, 0) || math.IsNaN(value) {
+			return nil
+		}
+		return math.Round(value*1000) / 1000
+	}
+
+	report := map[string]interface{}{
+		"channels":         analysis.Channels,
+		"mean_correlation": finite(analysis.MeanCorrelation),
+		"min_correlation":  finite(analysis.MinCorrelation),
+		"negative_ratio":   finite(analysis.NegativeRatio),
+		"mono_compatible":  analysis.MonoCompatible,
+	}
+	if analysis.Channels >= 2 {
+		report["left_rms_db"] = finite(analysis.LeftRMS)
+		report["right_rms_db"] = finite(analysis.RightRMS)
+		report["stereo_rms_db"] = finite(analysis.StereoRMS)
+		report["mono_rms_db"] = finite(analysis.MonoRMS)
+		report["downmix_loss_db"] = finite(analysis.DownmixLoss)
+	}
+	if analysis.Downmix != "" {
+		report["downmix_fix"] = analysis.Downmix
+	}
+	return report
+}
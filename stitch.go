@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxTimelineClips limita los clips de una línea de tiempo: cada clip es una
+// entrada más de ffmpeg
+const maxTimelineClips = 20
+
+// xfadeTransitions son las transiciones de xfade que acepta transition
+var xfadeTransitions = map[string]bool{
+	"fade":       true,
+	"fadeblack":  true,
+	"fadewhite":  true,
+	"dissolve":   true,
+	"wipeleft":   true,
+	"wiperight":  true,
+	"slideleft":  true,
+	"slideright": true,
+	"circleopen": true,
+}
+
+// timelineSpec es la línea de tiempo de /stitch-video (campo timeline, JSON)
+type timelineSpec struct {
+	Clips []timelineClip `json:"clips"`
+	// Width, Height y FPS son los del video de salida; por defecto el tamaño
+	// del primer clip y 30 fps
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	FPS    int `json:"fps"`
+	// Music agrega una pista de fondo enviada como music, music_base64 o
+	// music_url
+	Music *timelineMusic `json:"music"`
+}
+
+// timelineClip es un tramo [In, Out) de una de las entradas (Source, desde 1)
+type timelineClip struct {
+	Source int     `json:"source"`
+	In     float64 `json:"in"`
+	// Out en 0 toma hasta el final de la entrada
+	Out float64 `json:"out"`
+	// Transition enlaza el clip con el anterior (xfade); vacío es un corte
+	Transition         string  `json:"transition"`
+	TransitionDuration float64 `json:"transition_duration"`
+	// Volume multiplica el audio del clip (1 por defecto)
+	Volume *float64 `json:"volume"`
+
+	duration float64
+	hasAudio bool
+}
+
+// timelineMusic es la música de fondo de la línea de tiempo
+type timelineMusic struct {
+	Volume  *float64 `json:"volume"`
+	Ducking bool     `json:"ducking"`
+	Loop    bool     `json:"loop"`
+}
+
+// parseTimeline decodifica y valida la línea de tiempo contra las entradas:
+// completa la duración de cada clip y si su fuente tiene audio
+func parseTimeline(ctx context.Context, raw string, inputs []inputFile) (*timelineSpec, error) {
+	if raw == "" {
+		return nil, errors.New("falta timeline (JSON con clips)")
+	}
+	var spec timelineSpec
+	if err := json.Unmarshal([]byte(raw), &spec); err != nil {
+		return nil, invalidParam("timeline", "timeline inválido: %v", err)
+	}
+	if len(spec.Clips) == 0 || len(spec.Clips) > maxTimelineClips {
+		return nil, fmt.Errorf("timeline debe tener entre 1 y %d clips", maxTimelineClips)
+	}
+	if spec.FPS == 0 {
+		spec.FPS = 30
+	}
+	if spec.FPS < 1 || spec.FPS > 60 {
+		return nil, invalidParam("fps", "fps inválido %d (entre 1 y 60)", spec.FPS)
+	}
+	if (spec.Width != 0 || spec.Height != 0) && (spec.Width < 16 || spec.Width > 4096 || spec.Height < 16 || spec.Height > 4096) {
+		return nil, errors.New("width y height deben estar entre 16 y 4096")
+	}
+	if spec.Music != nil && spec.Music.Volume != nil && (*spec.Music.Volume < 0 || *spec.Music.Volume > 4) {
+		return nil, errors.New("music.volume debe ser un número entre 0 y 4")
+	}
+
+	probes := map[int]*ffprobeOutput{}
+	for i := range spec.Clips {
+		clip := &spec.Clips[i]
+		if clip.Source < 1 || clip.Source > len(inputs) {
+			return nil, fmt.Errorf("clip %d: source %d no existe (hay %d entradas, desde 1)", i+1, clip.Source, len(inputs))
+		}
+		probe, ok := probes[clip.Source]
+		if !ok {
+			var err error
+			if _, probe, err = probeMedia(ctx, inputs[clip.Source-1].Data); err != nil {
+				return nil, fmt.Errorf("entrada %d: %v", clip.Source, err)
+			}
+			probes[clip.Source] = probe
+		}
+
+		hasVideo := false
+		for _, stream := range probe.Streams {
+			switch {
+			case stream.CodecType == "video" && stream.Disposition.AttachedPic == 0:
+				if !hasVideo && i == 0 && spec.Width == 0 {
+					// yuv420p necesita dimensiones pares
+					spec.Width, spec.Height = stream.Width&^1, stream.Height&^1
+				}
+				hasVideo = true
+			case stream.CodecType == "audio":
+				clip.hasAudio = true
+			}
+		}
+		if !hasVideo {
+			return nil, fmt.Errorf("clip %d: la entrada %d no tiene pista de video", i+1, clip.Source)
+		}
+
+		sourceDuration, _ := strconv.ParseFloat(probe.Format.Duration, 64)
+		if clip.Out == 0 {
+			clip.Out = sourceDuration
+		}
+		if sourceDuration > 0 && clip.Out > sourceDuration {
+			clip.Out = sourceDuration
+		}
+		if clip.In < 0 || clip.Out <= clip.In {
+			return nil, fmt.Errorf("clip %d: in (%s) y out (%s) no forman un tramo válido", i+1, formatSeconds(clip.In), formatSeconds(clip.Out))
+		}
+		clip.duration = clip.Out - clip.In
+		if clip.Volume != nil && (*clip.Volume < 0 || *clip.Volume > 4) {
+			return nil, fmt.Errorf("clip %d: volume debe ser un número entre 0 y 4", i+1)
+		}
+
+		if clip.Transition == "" || clip.Transition == "none" {
+			clip.Transition = ""
+			continue
+		}
+		if i == 0 {
+			return nil, errors.New("clip 1: el primer clip no puede tener transition")
+		}
+		if !xfadeTransitions[clip.Transition] {
+			return nil, fmt.Errorf("clip %d: transition inválida %q", i+1, clip.Transition)
+		}
+		if clip.TransitionDuration == 0 {
+			clip.TransitionDuration = 0.5
+		}
+		previous := spec.Clips[i-1].duration
+		if clip.TransitionDuration < 0.1 || clip.TransitionDuration >= clip.duration || clip.TransitionDuration >= previous {
+			return nil, fmt.Errorf("clip %d: transition_duration debe estar entre 0.1 s y la duración de los clips que enlaza", i+1)
+		}
+	}
+	if spec.Width < 16 || spec.Height < 16 {
+		return nil, errors.New("no se pudo determinar el tamaño del video; indique width y height")
+	}
+	return &spec, nil
+}
+
+// timelineGraph arma el filtergraph: cada clip (entrada k) se escala al
+// tamaño de salida y se une al anterior con concat o con xfade y
+// acrossfade. Devuelve el grafo y la duración total.
+func timelineGraph(spec *timelineSpec) (string, float64) {
+	audioFormat := "aformat=sample_fmts=fltp:sample_rates=48000:channel_layouts=stereo"
+	var parts []string
+	for k, clip := range spec.Clips {
+		parts = append(parts, fmt.Sprintf("[%d:v:0]setpts=PTS-STARTPTS,scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,setsar=1,fps=%d,format=yuv420p,settb=AVTB[v%d]",
+			k, spec.Width, spec.Height, spec.Width, spec.Height, spec.FPS, k))
+
+		// Las fuentes sin audio aportan silencio para que concat y acrossfade
+		// reciban siempre los dos tipos de pista
+		duration := formatSeconds(clip.duration)
+		audio := fmt.Sprintf("anullsrc=r=48000:cl=stereo,%s,atrim=end=%s", audioFormat, duration)
+		if clip.hasAudio {
+			audio = fmt.Sprintf("[%d:a:0]asetpts=PTS-STARTPTS,aresample=48000,%s,apad,atrim=end=%s", k, audioFormat, duration)
+			if clip.Volume != nil {
+				audio += ",volume=" + strconv.FormatFloat(*clip.Volume, 'f', -1, 64)
+			}
+		}
+		parts = append(parts, fmt.Sprintf("%s[a%d]", audio, k))
+	}
+
+	video, audio := "[v0]", "[a0]"
+	total := spec.Clips[0].duration
+	for k := 1; k < len(spec.Clips); k++ {
+		clip := spec.Clips[k]
+		if clip.Transition == "" {
+			parts = append(parts, fmt.Sprintf("%s%s[v%d][a%d]concat=n=2:v=1:a=1[cv%d][xa%d]", video, audio, k, k, k, k),
+				fmt.Sprintf("[cv%d]settb=AVTB[xv%d]", k, k))
+			total += clip.duration
+		} else {
+			fade := formatSeconds(clip.TransitionDuration)
+			parts = append(parts,
+				fmt.Sprintf("%s[v%d]xfade=transition=%s:duration=%s:offset=%s[xv%d]", video, k, clip.Transition, fade, formatSeconds(total-clip.TransitionDuration), k),
+				fmt.Sprintf("%s[a%d]acrossfade=d=%s[xa%d]", audio, k, fade, k))
+			total += clip.duration - clip.TransitionDuration
+		}
+		video, audio = fmt.Sprintf("[xv%d]", k), fmt.Sprintf("[xa%d]", k)
+	}
+	parts = append(parts, video+"null[vout]")
+
+	if spec.Music == nil {
+		parts = append(parts, audio+"anull[aout]")
+		return strings.Join(parts, ";"), total
+	}
+
+	// La música es la última entrada; con ducking baja mientras suenan los
+	// clips, igual que en /mix-audio
+	volume := 0.3
+	if spec.Music.Volume != nil {
+		volume = *spec.Music.Volume
+	}
+	parts = append(parts, fmt.Sprintf("[%d:a:0]aresample=48000,%s,volume=%s[music]", len(spec.Clips), audioFormat, strconv.FormatFloat(volume, 'f', -1, 64)))
+	if spec.Music.Ducking {
+		parts = append(parts,
+			audio+"asplit=2[main][trigger]",
+			"[music][trigger]sidechaincompress=threshold=0.03:ratio=8:attack=20:release=400[ducked]",
+			"[main][ducked]amix=inputs=2:duration=first:normalize=0[aout]")
+	} else {
+		parts = append(parts, audio+"[music]amix=inputs=2:duration=first:normalize=0[aout]")
+	}
+	return strings.Join(parts, ";"), total
+}
+
+// stitchResult es el MP4 renderizado de la línea de tiempo
+type stitchResult struct {
+	Data     []byte
+	Duration float64
+}
+
+// stitchVideo renderiza la línea de tiempo en un MP4 H.264/AAC. Cada clip se
+// abre como una entrada propia con -ss/-t, así ffmpeg busca directamente el
+// punto de entrada en lugar de decodificar la fuente completa.
+func stitchVideo(ctx context.Context, inputs []inputFile, musicData []byte, spec *timelineSpec) (*stitchResult, error) {
+	paths := map[int]string{}
+	for _, clip := range spec.Clips {
+		if _, ok := paths[clip.Source]; ok {
+			continue
+		}
+		path, cleanup, err := writeTempInput(inputs[clip.Source-1].Data, "stitch-input-*")
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+		paths[clip.Source] = path
+	}
+	outputPath, cleanupOutput, err := createTempOutput("stitch-output-*.mp4")
+	if err != nil {
+		return nil, err
+	}
+	defer cleanupOutput()
+
+	var args []string
+	for _, clip := range spec.Clips {
+		args = append(args, "-ss", formatSeconds(clip.In), "-t", formatSeconds(clip.duration), "-i", paths[clip.Source])
+	}
+	if spec.Music != nil {
+		musicPath, cleanupMusic, err := writeTempInput(musicData, "stitch-music-*")
+		if err != nil {
+			return nil, err
+		}
+		defer cleanupMusic()
+		if spec.Music.Loop {
+			args = append(args, "-stream_loop", "-1")
+		}
+		args = append(args, "-i", musicPath)
+	}
+
+	graph, total := timelineGraph(spec)
+	recordDebug(ctx, "timeline_graph", graph)
+	args = append(args, "-filter_complex", graph, "-map", "[vout]", "-map", "[aout]",
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "23", "-pix_fmt", "yuv420p")
+	args = append(args, classThreadArgs(ctx, classBatch)...)
+	args = append(args, "-c:a", defaultAACEncoder, "-b:a", "128k",
+		"-t", formatSeconds(total), "-movflags", "+faststart", "-f", "mp4", "-y", outputPath)
+
+	cmd := ffmpegCommand(ctx, classBatch, args...)
+	var errBuffer bytes.Buffer
+	cmd.Stderr = &errBuffer
+
+	fmt.Printf("[stitch] %d clips de %d entradas, %s s\n", len(spec.Clips), len(paths), formatSeconds(total))
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error al renderizar la línea de tiempo: %v, detalles: %s", err, errBuffer.String())
+	}
+
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		return nil, fmt.Errorf("error al leer archivo de salida: %v", err)
+	}
+	if len(data) == 0 {
+		return nil, errors.New("la conversión produjo un archivo vacío")
+	}
+	return &stitchResult{Data: data, Duration: total}, nil
+}
+
+// processStitchVideo atiende /stitch-video: las fuentes llegan como file,
+// base64 o url repetidos y timeline indica los tramos, transiciones y música
+func processStitchVideo(c *gin.Context) {
+	if !validateAPIKey(c) {
+		return
+	}
+
+	inputs, err := getInputFiles(c)
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	spec, err := parseTimeline(ctx, c.PostForm("timeline"), inputs)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	var musicData []byte
+	if spec.Music != nil {
+		if musicData, err = getNamedInput(c, "music", "la música"); err != nil {
+			respondError(c, mediaErrorStatus(err, http.StatusBadRequest), err)
+			return
+		}
+	}
+
+	result, err := stitchVideo(ctx, inputs, musicData, spec)
+	if err == nil {
+		result.Data, err = interceptOutput(ctx, "mp4", result.Data)
+	}
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusInternalServerError), err)
+		return
+	}
+
+	if wantsBinaryResponse(c, "") {
+		writeBinaryResponse(c, result.Data, "video.mp4", "video/mp4", map[string]string{
+			"X-Format":   "mp4",
+			"X-Duration": formatSeconds(result.Duration),
+			"X-Clips":    strconv.Itoa(len(spec.Clips)),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, attachDebug(ctx, gin.H{
+		"format":     "mp4",
+		"duration":   result.Duration,
+		"clips":      len(spec.Clips),
+		"resolution": fmt.Sprintf("%dx%d", spec.Width, spec.Height),
+		"size":       len(result.Data),
+		"video":      base64.StdEncoding.EncodeToString(result.Data),
+	}))
+}
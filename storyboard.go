@@ -0,0 +1,341 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxStoryboardThumbnails limita las miniaturas de un storyboard: con
+// interval=1 alcanza para una hora de video
+const maxStoryboardThumbnails = 3600
+
+// maxStoryboardSheetSize es el ancho y el alto máximos de cada hoja, en
+// píxeles
+const maxStoryboardSheetSize = 8192
+
+// storyboardEncoders son los formatos de imagen de las hojas y sus argumentos
+// de codificación
+var storyboardEncoders = map[string][]string{
+	"jpg":  {"-c:v", "mjpeg", "-q:v", "4"},
+	"png":  {"-c:v", "png"},
+	"webp": {"-c:v", "libwebp", "-quality", "80"},
+}
+
+// storyboardOptions son los parámetros de /storyboard
+type storyboardOptions struct {
+	// Interval son los segundos entre miniaturas
+	Interval   float64
+	ThumbWidth int
+	Columns    int
+	Rows       int
+	Format     string
+	// KeyframesOnly decodifica solo los keyframes: mucho más rápido en videos
+	// largos, pero cada miniatura es el keyframe anterior a su tiempo
+	KeyframesOnly bool
+	// SpriteBaseURL se antepone al nombre de cada hoja en el VTT, para
+	// publicar las hojas en otra ubicación
+	SpriteBaseURL string
+}
+
+// storyboardSheet es una hoja de miniaturas
+type storyboardSheet struct {
+	Name string
+	Data []byte
+}
+
+// storyboard es el resultado de /storyboard
+type storyboard struct {
+	Sheets      []storyboardSheet
+	VTT         string
+	Duration    float64
+	Thumbnails  int
+	ThumbWidth  int
+	ThumbHeight int
+}
+
+// parseStoryboardInt lee un entero opcional de /storyboard dentro de
+// [low, high]
+func parseStoryboardInt(c *gin.Context, name string, fallback, low, high int) (int, error) {
+	value := c.PostForm(name)
+	if value == "" {
+		return fallback, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < low || parsed > high {
+		return 0, invalidParam(name, "%s debe estar entre %d y %d", name, low, high)
+	}
+	return parsed, nil
+}
+
+func parseStoryboardOptions(c *gin.Context) (storyboardOptions, error) {
+	opts := storyboardOptions{
+		Interval:      10,
+		Format:        strings.ToLower(c.DefaultPostForm("image_format", "jpg")),
+		KeyframesOnly: c.PostForm("keyframes_only") == "true",
+		SpriteBaseURL: c.PostForm("sprite_base_url"),
+	}
+	if value := c.PostForm("interval"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < 0.5 || parsed > 3600 {
+			return opts, invalidParam("interval", "interval debe estar entre 0.5 y 3600 segundos")
+		}
+		opts.Interval = parsed
+	}
+	var err error
+	if opts.ThumbWidth, err = parseStoryboardInt(c, "thumb_width", 160, 32, 640); err != nil {
+		return opts, err
+	}
+	if opts.Columns, err = parseStoryboardInt(c, "columns", 10, 1, 20); err != nil {
+		return opts, err
+	}
+	if opts.Rows, err = parseStoryboardInt(c, "rows", 10, 1, 20); err != nil {
+		return opts, err
+	}
+	if opts.Columns*opts.ThumbWidth > maxStoryboardSheetSize {
+		return opts, invalidParam("columns", "columns × thumb_width no puede superar %d píxeles", maxStoryboardSheetSize)
+	}
+	if opts.Format == "jpeg" {
+		opts.Format = "jpg"
+	}
+	if _, ok := storyboardEncoders[opts.Format]; !ok {
+		return opts, invalidParam("image_format", "image_format inválido %q (jpg, png o webp)", opts.Format)
+	}
+	// La URL va en cada cue del VTT: un salto de línea lo rompería
+	if strings.ContainsAny(opts.SpriteBaseURL, " \t\r\n") {
+		return opts, errors.New("sprite_base_url no puede contener espacios ni saltos de línea")
+	}
+	return opts, nil
+}
+
+// storyboardSheetName es el nombre de la hoja i (desde 0) en el VTT y el ZIP
+func storyboardSheetName(index int, format string) string {
+	return fmt.Sprintf("storyboard-%03d.%s", index+1, format)
+}
+
+// storyboardVTT arma el WebVTT que relaciona cada tramo de interval segundos
+// con su miniatura (sprite.jpg#xywh=x,y,w,h), el formato que usan los
+// reproductores para la vista previa al buscar
+func storyboardVTT(result *storyboard, opts storyboardOptions) string {
+	perSheet := opts.Columns * opts.Rows
+	var builder strings.Builder
+	builder.WriteString("WEBVTT\n")
+	for i := 0; i < result.Thumbnails; i++ {
+		start := float64(i) * opts.Interval
+		end := math.Min(start+opts.Interval, result.Duration)
+		position := i % perSheet
+		fmt.Fprintf(&builder, "\n%s --> %s\n%s%s#xywh=%d,%d,%d,%d\n",
+			subtitleTimestamp(start, "."), subtitleTimestamp(end, "."),
+			opts.SpriteBaseURL, storyboardSheetName(i/perSheet, opts.Format),
+			(position%opts.Columns)*result.ThumbWidth, (position/opts.Columns)*result.ThumbHeight,
+			result.ThumbWidth, result.ThumbHeight)
+	}
+	return builder.String()
+}
+
+// runStoryboard toma una miniatura cada interval segundos y las reúne en
+// hojas de columns × rows con el filtro tile. La última hoja queda completa,
+// con el espacio sobrante en negro.
+func runStoryboard(ctx context.Context, inputData []byte, opts storyboardOptions) (*storyboard, error) {
+	rotation, err := probeRotation(ctx, inputData)
+	if err != nil {
+		return nil, err
+	}
+	width, height, err := probeVideoDimensions(ctx, inputData, rotation)
+	if err != nil {
+		return nil, err
+	}
+	_, probe, err := probeMedia(ctx, inputData)
+	if err != nil {
+		return nil, err
+	}
+	duration, _ := strconv.ParseFloat(probe.Format.Duration, 64)
+	if duration <= 0 {
+		return nil, errors.New("no se pudo determinar la duración del video")
+	}
+
+	result := &storyboard{
+		Duration:   duration,
+		Thumbnails: int(math.Ceil(duration / opts.Interval)),
+		ThumbWidth: opts.ThumbWidth,
+		// Alto par con la proporción del video ya rotado
+		ThumbHeight: max(2, int(math.Round(float64(opts.ThumbWidth)*float64(height)/float64(width)/2))*2),
+	}
+	if result.Thumbnails > maxStoryboardThumbnails {
+		return nil, fmt.Errorf("el storyboard tendría %d miniaturas (máximo %d): usa un interval mayor", result.Thumbnails, maxStoryboardThumbnails)
+	}
+	if opts.Rows*result.ThumbHeight > maxStoryboardSheetSize {
+		return nil, invalidParam("rows", "rows × alto de la miniatura (%d) no puede superar %d píxeles", result.ThumbHeight, maxStoryboardSheetSize)
+	}
+
+	inputPath, cleanup, err := writeTempInput(inputData, "storyboard-input-*")
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	outputDir, err := os.MkdirTemp("", "storyboard-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(outputDir)
+
+	var args []string
+	if opts.KeyframesOnly {
+		args = append(args, "-skip_frame", "nokey")
+	}
+	graph := fmt.Sprintf("fps=1/%s,scale=%d:%d,tile=%dx%d",
+		strconv.FormatFloat(opts.Interval, 'f', -1, 64), result.ThumbWidth, result.ThumbHeight, opts.Columns, opts.Rows)
+	args = append(args, "-i", inputPath, "-map", "0:v:0", "-vf", graph)
+	args = append(args, storyboardEncoders[opts.Format]...)
+	args = append(args, "-f", "image2", "-y", filepath.Join(outputDir, "storyboard-%03d."+opts.Format))
+	if err := checkFilterArgs(args); err != nil {
+		return nil, err
+	}
+	cmd := ffmpegCommand(ctx, classBatch, args...)
+	var errBuffer bytes.Buffer
+	cmd.Stderr = &errBuffer
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error al generar el storyboard: %v, detalles: %s", err, errBuffer.String())
+	}
+
+	sheets := (result.Thumbnails + opts.Columns*opts.Rows - 1) / (opts.Columns * opts.Rows)
+	for i := 0; i < sheets; i++ {
+		name := storyboardSheetName(i, opts.Format)
+		data, err := os.ReadFile(filepath.Join(outputDir, name))
+		if err != nil {
+			return nil, fmt.Errorf("ffmpeg no generó la hoja %s: %v", name, err)
+		}
+		if data, err = interceptOutput(ctx, opts.Format, data); err != nil {
+			return nil, err
+		}
+		result.Sheets = append(result.Sheets, storyboardSheet{Name: name, Data: data})
+	}
+	vtt, err := interceptOutput(ctx, "vtt", []byte(storyboardVTT(result, opts)))
+	if err != nil {
+		return nil, err
+	}
+	result.VTT = string(vtt)
+	return result, nil
+}
+
+// storyboardView es el cuerpo JSON de /storyboard
+func storyboardView(result *storyboard, opts storyboardOptions) gin.H {
+	manifest := newArtifactManifest()
+	sheets := make([]gin.H, 0, len(result.Sheets))
+	for i, sheet := range result.Sheets {
+		entry := gin.H{
+			"index": i + 1,
+			"name":  sheet.Name,
+			"image": base64.StdEncoding.EncodeToString(sheet.Data),
+		}
+		manifest.add(entry, sheet.Name, opts.Format, sheet.Data)
+		sheets = append(sheets, entry)
+	}
+	manifest.add(gin.H{}, "storyboard.vtt", "vtt", []byte(result.VTT))
+	return gin.H{
+		"duration":     roundMillis(result.Duration),
+		"interval":     opts.Interval,
+		"thumbnails":   result.Thumbnails,
+		"thumb_width":  result.ThumbWidth,
+		"thumb_height": result.ThumbHeight,
+		"columns":      opts.Columns,
+		"rows":         opts.Rows,
+		"format":       opts.Format,
+		"sheets":       sheets,
+		"vtt":          result.VTT,
+		"manifest":     manifest,
+	}
+}
+
+// zipStoryboard empaqueta las hojas y storyboard.vtt
+func zipStoryboard(result *storyboard) ([]byte, error) {
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	files := append(append([]storyboardSheet{}, result.Sheets...), storyboardSheet{Name: "storyboard.vtt", Data: []byte(result.VTT)})
+	for _, file := range files {
+		entry, err := archive.CreateHeader(&zip.FileHeader{Name: file.Name, Method: zip.Store})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := entry.Write(file.Data); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// processStoryboard atiende /storyboard: hojas de miniaturas y el WebVTT
+// para la vista previa al buscar en un reproductor de video
+func processStoryboard(c *gin.Context) {
+	if !validateAPIKey(c) {
+		return
+	}
+
+	inputData, err := getInputData(c)
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+	opts, err := parseStoryboardOptions(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	// Los videos largos pueden procesarse en segundo plano con callback_url
+	callbackURL, err := parseCallbackURL(c.Request.Context(), c.PostForm("callback_url"))
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+	if callbackURL != "" {
+		job, err := submitJob(c.Request.Context(), "storyboard", callbackURL, inputData, func(ctx context.Context) (gin.H, error) {
+			result, err := runStoryboard(ctx, inputData, opts)
+			if err != nil {
+				return nil, err
+			}
+			return storyboardView(result, opts), nil
+		})
+		if err != nil {
+			respondError(c, http.StatusServiceUnavailable, err)
+			return
+		}
+		c.JSON(http.StatusAccepted, job.view())
+		return
+	}
+
+	ctx := c.Request.Context()
+	result, err := runStoryboard(ctx, inputData, opts)
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusInternalServerError), err)
+		return
+	}
+
+	if wantsZipResponse(c) {
+		archive, err := zipStoryboard(result)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error al crear el ZIP: " + err.Error()})
+			return
+		}
+		writeBinaryResponse(c, archive, "storyboard.zip", "application/zip", map[string]string{
+			"X-Thumbnails": strconv.Itoa(result.Thumbnails),
+			"X-Sheets":     strconv.Itoa(len(result.Sheets)),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, attachDebug(ctx, storyboardView(result, opts)))
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// streamHashAlgorithms son los valores de stream_hash y el nombre del hash en
+// el muxer streamhash de ffmpeg
+var streamHashAlgorithms = map[string]string{
+	"md5":    "md5",
+	"crc32":  "crc32",
+	"sha256": "sha256",
+}
+
+// parseStreamHash valida stream_hash (md5, crc32 o sha256); "" no calcula
+// nada
+func parseStreamHash(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	if _, ok := streamHashAlgorithms[value]; !ok {
+		return "", invalidParam("stream_hash", "stream_hash inválido %q (md5, crc32 o sha256)", value)
+	}
+	return value, nil
+}
+
+// streamHash es el hash del contenido decodificado de un stream
+type streamHash struct {
+	Index int    `json:"index"`
+	Type  string `json:"type"`
+	Hash  string `json:"hash"`
+}
+
+// streamHashReport compara los hashes de la entrada y de la salida. Match es
+// true cuando la conversión conservó exactamente el contenido, p. ej. al
+// cambiar de contenedor o convertir entre formatos sin pérdida.
+type streamHashReport struct {
+	Algorithm string       `json:"algorithm"`
+	Input     []streamHash `json:"input"`
+	Output    []streamHash `json:"output"`
+	Match     bool         `json:"match"`
+}
+
+// computeStreamHashes decodifica los streams con el muxer streamhash de
+// ffmpeg y devuelve un hash por stream, independiente del contenedor. El
+// audio se pasa a PCM de 32 bits para que 16 y 24 bits se comparen sin
+// truncar; el video queda en rawvideo con su formato de píxel. withVideo
+// incluye el video, sin las carátulas.
+func computeStreamHashes(ctx context.Context, data []byte, algorithm string, withVideo bool) ([]streamHash, error) {
+	inputSource, stdin, cleanup, err := ffmpegInput(data, "streamhash-input-*")
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	args := []string{"-flags", "+bitexact", "-i", inputSource}
+	if withVideo {
+		args = append(args, "-map", "0:V", "-map", "0:a?")
+	} else {
+		args = append(args, "-map", "0:a")
+	}
+	args = append(args,
+		"-c:a", "pcm_s32le",
+		"-fflags", "+bitexact",
+		"-f", "streamhash",
+		"-hash", streamHashAlgorithms[algorithm],
+		"pipe:1",
+	)
+	cmd := ffmpegCommand(ctx, classInteractive, args...)
+	cmd.Stdin = stdin
+	var output, errBuffer bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &errBuffer
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error al calcular stream_hash: %v, detalles: %s", err, errBuffer.String())
+	}
+	return parseStreamHashes(output.String())
+}
+
+// parseStreamHashes lee las líneas "0,a,MD5=..." del muxer streamhash
+func parseStreamHashes(output string) ([]streamHash, error) {
+	hashes := []streamHash{}
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		fields := strings.SplitN(line, ",", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("línea de streamhash inesperada %q", line)
+		}
+		index, err := strconv.Atoi(fields[0])
+		_, hash, ok := strings.Cut(fields[2], "=")
+		if err != nil || !ok {
+			return nil, fmt.Errorf("línea de streamhash inesperada %q", line)
+		}
+		kind := "audio"
+		if fields[1] == "v" {
+			kind = "video"
+		}
+		hashes = append(hashes, streamHash{Index: index, Type: kind, Hash: hash})
+	}
+	if len(hashes) == 0 {
+		return nil, errors.New("streamhash no devolvió ningún stream")
+	}
+	return hashes, nil
+}
+
+// compareStreamHashes calcula los hashes de la entrada y de la salida. Los
+// streams se comparan en orden.
+func compareStreamHashes(ctx context.Context, algorithm string, input, output []byte, withVideo bool) (*streamHashReport, error) {
+	inputHashes, err := computeStreamHashes(ctx, input, algorithm, withVideo)
+	if err != nil {
+		return nil, err
+	}
+	outputHashes, err := computeStreamHashes(ctx, output, algorithm, withVideo)
+	if err != nil {
+		return nil, err
+	}
+	match := len(inputHashes) == len(outputHashes)
+	for i := 0; match && i < len(inputHashes); i++ {
+		match = inputHashes[i].Type == outputHashes[i].Type && inputHashes[i].Hash == outputHashes[i].Hash
+	}
+	return &streamHashReport{Algorithm: algorithm, Input: inputHashes, Output: outputHashes, Match: match}, nil
+}
+
+// headers resume el informe para las respuestas binarias: los hashes de la
+// salida ("audio:0 md5=...") y si coinciden con la entrada
+func (report *streamHashReport) headers(headers map[string]string) {
+	described := make([]string, len(report.Output))
+	for i, hash := range report.Output {
+		described[i] = fmt.Sprintf("%s:%d %s=%s", hash.Type, hash.Index, report.Algorithm, hash.Hash)
+	}
+	headers["X-Stream-Hash"] = strings.Join(described, "; ")
+	headers["X-Stream-Hash-Match"] = strconv.FormatBool(report.Match)
+}
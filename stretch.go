@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// maxStretchDeviation es cuánto puede alejarse target_duration de la
+// duración de la entrada: más allá de ±20% atempo deja artefactos audibles
+const maxStretchDeviation = 0.2
+
+// parseTargetDuration valida target_duration (segundos o [hh:]mm:ss[.ms]).
+// Devuelve 0 si no se pidió.
+func parseTargetDuration(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	seconds, err := parseTimestamp(value)
+	if err != nil {
+		return 0, invalidParam("target_duration", "target_duration inválido: %v", err)
+	}
+	if seconds == 0 {
+		return 0, errors.New("target_duration debe ser mayor que cero")
+	}
+	return seconds, nil
+}
+
+// stretchSpeed mide la entrada y devuelve su duración y el factor de
+// velocidad que la lleva a target (source/target, como speed)
+func stretchSpeed(ctx context.Context, inputData []byte, target float64) (float64, float64, error) {
+	_, probe, err := probeMedia(ctx, inputData)
+	if err != nil {
+		return 0, 0, err
+	}
+	source, _ := strconv.ParseFloat(probe.Format.Duration, 64)
+	if source <= 0 {
+		return 0, 0, errors.New("no se pudo determinar la duración de la entrada para target_duration")
+	}
+	if ratio := target / source; ratio < 1-maxStretchDeviation || ratio > 1+maxStretchDeviation {
+		return 0, 0, fmt.Errorf("target_duration %s s está fuera del ±20%% de la duración de la entrada (%s s): use entre %s y %s s",
+			formatSeconds(target), formatSeconds(source),
+			formatSeconds(math.Ceil(source*(1-maxStretchDeviation)*1000)/1000), formatSeconds(math.Floor(source*(1+maxStretchDeviation)*1000)/1000))
+	}
+	recordDebug(ctx, "time_stretch", map[string]interface{}{
+		"source_duration": source,
+		"target_duration": target,
+	})
+	return source, source / target, nil
+}
+
+// exactDurationFilter completa con silencio y corta en target: atempo
+// redondea por bloques y la salida puede diferir en algunos milisegundos
+func exactDurationFilter(target float64) string {
+	return "apad,atrim=duration=" + formatSeconds(target)
+}
+
+// stretchReport es la representación de la respuesta
+func stretchReport(source, target, speed float64) map[string]interface{} {
+	return map[string]interface{}{
+		"source_duration": roundMillis(source),
+		"target_duration": target,
+		"speed":           math.Round(speed*10000) / 10000,
+	}
+}
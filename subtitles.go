@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// subtitleMaxCueSeconds corta los subtítulos por palabra que se alargan
+	// aunque no lleguen al máximo de caracteres
+	subtitleMaxCueSeconds = 5.0
+	// subtitleMaxGap es la pausa entre palabras que empieza un subtítulo nuevo
+	subtitleMaxGap = 1.0
+)
+
+// subtitleContentTypes son los tipos de cada formato de subtítulos
+var subtitleContentTypes = map[string]string{
+	"srt": "application/x-subrip",
+	"vtt": "text/vtt",
+}
+
+// subtitleOptions son los parámetros de /generate-subtitles
+type subtitleOptions struct {
+	// Format es srt o vtt
+	Format string
+	// Granularity es segment (un subtítulo por segmento del modelo) o word
+	// (palabras agrupadas hasta MaxLineLength caracteres)
+	Granularity   string
+	MaxLineLength int
+}
+
+// subtitleCue es un subtítulo; Words solo está presente con granularity=word
+type subtitleCue struct {
+	Start float64
+	End   float64
+	Text  string
+	Words []transcriptWord
+}
+
+// parseSubtitleOptions valida subtitle_format (srt o vtt), granularity
+// (segment o word) y max_line_length (20 a 84 caracteres, 42 por defecto)
+func parseSubtitleOptions(format, granularity, maxLineLength string) (*subtitleOptions, error) {
+	opts := &subtitleOptions{Format: "srt", Granularity: "segment", MaxLineLength: 42}
+	switch format {
+	case "", "srt":
+	case "vtt", "webvtt":
+		opts.Format = "vtt"
+	default:
+		return nil, invalidParam("subtitle_format", "subtitle_format inválido %q (srt o vtt)", format)
+	}
+	switch granularity {
+	case "", "segment":
+	case "word":
+		opts.Granularity = granularity
+	default:
+		return nil, invalidParam("granularity", "granularity inválido %q (segment o word)", granularity)
+	}
+	if maxLineLength != "" {
+		value, err := strconv.Atoi(maxLineLength)
+		if err != nil || value < 20 || value > 84 {
+			return nil, invalidParam("max_line_length", "max_line_length inválido %q (entre 20 y 84)", maxLineLength)
+		}
+		if opts.Granularity != "word" {
+			return nil, missingParam("max_line_length", "max_line_length requiere granularity=word")
+		}
+		opts.MaxLineLength = value
+	}
+	return opts, nil
+}
+
+// buildCues arma los subtítulos. Por palabra, un subtítulo se cierra al
+// llegar a MaxLineLength caracteres, a 5 segundos, tras una pausa de más de
+// un segundo o al final de una oración. Si el motor no devolvió palabras se
+// usan los segmentos.
+func buildCues(result *transcript, opts *subtitleOptions) []subtitleCue {
+	var cues []subtitleCue
+	if opts.Granularity != "word" || len(result.Words) == 0 {
+		for _, segment := range result.Segments {
+			if segment.Text != "" && segment.End > segment.Start {
+				cues = append(cues, subtitleCue{Start: segment.Start, End: segment.End, Text: segment.Text})
+			}
+		}
+		return cues
+	}
+
+	var current *subtitleCue
+	for _, word := range result.Words {
+		if word.Word == "" {
+			continue
+		}
+		if current != nil {
+			length := len([]rune(current.Text)) + 1 + len([]rune(word.Word))
+			if length > opts.MaxLineLength || word.End-current.Start > subtitleMaxCueSeconds || word.Start-current.End > subtitleMaxGap {
+				cues = append(cues, *current)
+				current = nil
+			}
+		}
+		if current == nil {
+			current = &subtitleCue{Start: word.Start, Text: word.Word}
+		} else {
+			current.Text += " " + word.Word
+		}
+		current.End = math.Max(word.End, current.Start)
+		current.Words = append(current.Words, word)
+		if strings.ContainsAny(word.Word[len(word.Word)-1:], ".?!") {
+			cues = append(cues, *current)
+			current = nil
+		}
+	}
+	if current != nil {
+		cues = append(cues, *current)
+	}
+	return cues
+}
+
+// subtitleTimestamp formatea hh:mm:ss,mmm (SRT) o hh:mm:ss.mmm (WebVTT)
+func subtitleTimestamp(seconds float64, separator string) string {
+	millis := int64(math.Round(seconds * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", millis/3600000, millis/60000%60, millis/1000%60, separator, millis%1000)
+}
+
+// renderSubtitles escribe los subtítulos en SRT o WebVTT. En WebVTT por
+// palabra, cada palabra después de la primera lleva su tiempo como etiqueta
+// <hh:mm:ss.mmm>, que los reproductores usan para resaltarla (karaoke).
+func renderSubtitles(cues []subtitleCue, format string) []byte {
+	var builder strings.Builder
+	if format == "vtt" {
+		builder.WriteString("WEBVTT\n\n")
+	}
+	for i, cue := range cues {
+		end := cue.End
+		// Un subtítulo sin duración no se muestra
+		if end <= cue.Start {
+			end = cue.Start + 0.001
+		}
+		if format == "vtt" {
+			fmt.Fprintf(&builder, "%s --> %s\n", subtitleTimestamp(cue.Start, "."), subtitleTimestamp(end, "."))
+			if len(cue.Words) > 1 {
+				builder.WriteString(cue.Words[0].Word)
+				for _, word := range cue.Words[1:] {
+					fmt.Fprintf(&builder, " <%s>%s", subtitleTimestamp(word.Start, "."), word.Word)
+				}
+				builder.WriteString("\n\n")
+				continue
+			}
+		} else {
+			fmt.Fprintf(&builder, "%d\n%s --> %s\n", i+1, subtitleTimestamp(cue.Start, ","), subtitleTimestamp(end, ","))
+		}
+		builder.WriteString(cue.Text + "\n\n")
+	}
+	return []byte(builder.String())
+}
+
+// generateSubtitles transcribe la entrada y devuelve los subtítulos
+func generateSubtitles(ctx context.Context, inputData []byte, language string, opts *subtitleOptions) ([]byte, *transcript, int, error) {
+	result, err := transcribeInput(ctx, inputData, language, opts.Granularity == "word")
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	cues := buildCues(result, opts)
+	return renderSubtitles(cues, opts.Format), result, len(cues), nil
+}
+
+// processGenerateSubtitles atiende POST /generate-subtitles: SRT o WebVTT de
+// una entrada de audio o video, a partir de la transcripción
+func processGenerateSubtitles(c *gin.Context) {
+	if !validateAPIKey(c) {
+		return
+	}
+	if activeTranscriber == nil {
+		respondError(c, http.StatusServiceUnavailable, notConfigured("la transcripción no está configurada (WHISPER_API_URL o WHISPER_CPP_MODEL)"))
+		return
+	}
+
+	inputData, err := getInputData(c)
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+
+	language, err := parseTranscribeLanguage(c.PostForm("language"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	opts, err := parseSubtitleOptions(c.PostForm("subtitle_format"), c.PostForm("granularity"), c.PostForm("max_line_length"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	run := func(ctx context.Context) (gin.H, error) {
+		subtitles, result, cues, err := generateSubtitles(ctx, inputData, language, opts)
+		if err != nil {
+			return nil, err
+		}
+		if subtitles, err = interceptOutput(ctx, opts.Format, subtitles); err != nil {
+			return nil, err
+		}
+		return gin.H{
+			"subtitles":   string(subtitles),
+			"format":      opts.Format,
+			"granularity": opts.Granularity,
+			"cues":        cues,
+			"language":    result.Language,
+			"duration":    roundMillis(result.Duration),
+			"engine":      activeTranscriber.Name(),
+		}, nil
+	}
+
+	// Con callback_url los subtítulos se generan en un trabajo
+	callbackURL, err := parseCallbackURL(c.Request.Context(), c.PostForm("callback_url"))
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+	if callbackURL != "" {
+		job, err := submitJob(c.Request.Context(), "generate-subtitles", callbackURL, inputData, run)
+		if err != nil {
+			respondError(c, http.StatusServiceUnavailable, err)
+			return
+		}
+		c.JSON(http.StatusAccepted, job.view())
+		return
+	}
+
+	// response=binary devuelve el archivo .srt o .vtt
+	if wantsBinaryResponse(c, "") {
+		subtitles, result, cues, err := generateSubtitles(c.Request.Context(), inputData, language, opts)
+		if err != nil {
+			respondError(c, mediaErrorStatus(err, http.StatusInternalServerError), err)
+			return
+		}
+		if subtitles, err = interceptOutput(c.Request.Context(), opts.Format, subtitles); err != nil {
+			respondError(c, mediaErrorStatus(err, http.StatusInternalServerError), err)
+			return
+		}
+		writeBinaryResponse(c, subtitles, "subtitles."+opts.Format, subtitleContentTypes[opts.Format], map[string]string{
+			"X-Format":   opts.Format,
+			"X-Language": result.Language,
+			"X-Cues":     strconv.Itoa(cues),
+			"X-Duration": formatSeconds(result.Duration),
+		})
+		return
+	}
+
+	response, err := run(c.Request.Context())
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusInternalServerError), err)
+		return
+	}
+	c.JSON(http.StatusOK, attachDebug(c.Request.Context(), response))
+}
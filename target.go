@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// platformTarget es la salida más compatible con una plataforma para cada
+// clase de medio (target=whatsapp, telegram, ios, android o web)
+type platformTarget struct {
+	Name string
+	// AudioFormat y AudioPreset son el formato y el preset de /process-audio
+	AudioFormat string
+	AudioPreset string
+	// VideoPreset es el preset de /video-to-mp4 (ver preset.go)
+	VideoPreset string
+	// MaxBytes es el tamaño máximo de archivo que acepta la plataforma (0
+	// sin límite); pasarlo solo genera una advertencia
+	MaxBytes int
+}
+
+// platformTargets: WhatsApp recibe notas de voz PTT y recomprime videos
+// grandes, Telegram acepta Opus como nota de voz, iOS y Android reproducen
+// AAC en M4A de forma nativa y MP3 es el formato que reproduce cualquier
+// navegador. El video siempre es H.264/AAC en MP4.
+var platformTargets = map[string]platformTarget{
+	"whatsapp": {AudioFormat: "ogg", AudioPreset: whatsappVoicePreset, VideoPreset: "hd_720p", MaxBytes: 16 << 20},
+	"telegram": {AudioFormat: "ogg", VideoPreset: "hd_1080p", MaxBytes: 50 << 20},
+	"ios":      {AudioFormat: "m4a", VideoPreset: "hd_1080p"},
+	"android":  {AudioFormat: "m4a", VideoPreset: "hd_1080p"},
+	"web":      {AudioFormat: "mp3", VideoPreset: "hd_1080p"},
+}
+
+// lookupPlatformTarget devuelve el target por nombre (nil si no se pidió)
+func lookupPlatformTarget(name string) (*platformTarget, error) {
+	if name == "" {
+		return nil, nil
+	}
+	target, ok := platformTargets[name]
+	if !ok {
+		return nil, invalidParam("target", "target desconocido %q (whatsapp, telegram, ios, android o web)", name)
+	}
+	target.Name = name
+	return &target, nil
+}
+
+// sizeWarning avisa si la salida supera el límite de la plataforma
+func (target *platformTarget) sizeWarning(size int) string {
+	if target.MaxBytes == 0 || size <= target.MaxBytes {
+		return ""
+	}
+	return fmt.Sprintf("la salida (%d bytes) supera el máximo de %s (%d bytes)", size, target.Name, target.MaxBytes)
+}
+
+// report agrega a la respuesta el target y, si corresponde, la advertencia
+// de tamaño
+func (target *platformTarget) report(response gin.H, size int) {
+	response["target"] = target.Name
+	if warning := target.sizeWarning(size); warning != "" {
+		warnings, _ := response["warnings"].([]string)
+		response["warnings"] = append(warnings, warning)
+	}
+}
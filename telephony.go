@@ -0,0 +1,58 @@
+package main
+
+// telephonyFormat describe una salida G.711 para centrales (Asterisk,
+// FreeSWITCH): 8 kHz mono en WAV o sin cabecera
+type telephonyFormat struct {
+	codec          string
+	rawMuxer       string
+	rawContentType string
+}
+
+var telephonyFormats = map[string]telephonyFormat{
+	"ulaw": {codec: "pcm_mulaw", rawMuxer: "mulaw", rawContentType: "audio/basic"},
+	"alaw": {codec: "pcm_alaw", rawMuxer: "alaw", rawContentType: "audio/x-alaw-basic"},
+}
+
+// telephonyOutputArgs son las opciones de ulaw/alaw en contenedor WAV
+func telephonyOutputArgs(format string) []string {
+	return []string{"-vn", "-c:a", telephonyFormats[format].codec, "-ar", "8000", "-ac", "1", "-f", "wav"}
+}
+
+// parseTelephonyContainer valida telephony_container (wav o raw) y devuelve
+// si la salida va sin cabecera
+func parseTelephonyContainer(value string) (bool, error) {
+	switch value {
+	case "", "wav":
+		return false, nil
+	case "raw":
+		return true, nil
+	}
+	return false, invalidParam("telephony_container", "telephony_container inválido %q (wav o raw)", value)
+}
+
+// applyTelephonyContainer cambia el muxer WAV por el crudo cuando se pidió
+// telephony_container=raw
+func (opts audioOptions) applyTelephonyContainer(args []string) []string {
+	target, ok := telephonyFormats[opts.Format]
+	if !ok || !opts.TelephonyRaw {
+		return args
+	}
+	return setOutputOption(args, "-f", target.rawMuxer)
+}
+
+// outputFilename es el nombre de archivo de la salida para adjuntos y
+// descargas: las salidas G.711 crudas usan .ulaw/.alaw como espera Asterisk
+func (opts audioOptions) outputFilename() string {
+	if _, ok := telephonyFormats[opts.Format]; ok && opts.TelephonyRaw {
+		return "audio." + opts.Format
+	}
+	return "audio." + fileExtensionForFormat(opts.Format)
+}
+
+// outputContentType es el MIME type de la salida
+func (opts audioOptions) outputContentType() string {
+	if target, ok := telephonyFormats[opts.Format]; ok && opts.TelephonyRaw {
+		return target.rawContentType
+	}
+	return contentTypeForFormat(opts.Format)
+}
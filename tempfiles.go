@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ffmpegInput prepara la entrada de un comando ffmpeg de una sola entrada:
+// por pipe:0 siempre que el contenedor se pueda leer en secuencia, así la
+// entrada no queda en claro en el disco aunque haya cifrado en reposo. Los
+// MP4/M4A/MOV necesitan seek para encontrar el moov y van a un archivo
+// temporal. El llamador asigna stdin a cmd.Stdin y llama a cleanup.
+func ffmpegInput(data []byte, pattern string) (source string, stdin io.Reader, cleanup func(), err error) {
+	if !isMP4orM4A(data) {
+		return "pipe:0", bytes.NewReader(data), func() {}, nil
+	}
+	path, cleanup, err := writeTempInput(data, pattern)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return path, nil, cleanup, nil
+}
+
+// writeTempInput guarda los datos en un archivo temporal y devuelve su ruta junto
+// con la función que lo elimina
+func writeTempInput(data []byte, pattern string) (string, func(), error) {
+	file, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", nil, fmt.Errorf("error creating temp input file: %v", err)
+	}
+	path := file.Name()
+	cleanup := func() {
+		os.Remove(path)
+	}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		cleanup()
+		return "", nil, fmt.Errorf("error writing to temp file: %v", err)
+	}
+	file.Close()
+
+	return path, cleanup, nil
+}
+
+// createTempOutput reserva una ruta temporal vacía para que ffmpeg escriba en ella
+func createTempOutput(pattern string) (string, func(), error) {
+	file, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", nil, fmt.Errorf("error creating temp output file: %v", err)
+	}
+	path := file.Name()
+	file.Close()
+
+	return path, func() { os.Remove(path) }, nil
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tenantContextKey guarda en el contexto de gin el tenant de la API key o
+// del token que autorizó la solicitud
+const tenantContextKey = "tenant"
+
+type tenantConfig struct {
+	// tenantKeys asocia cada API key de TENANT_KEYS con su tenant
+	tenantKeys map[string]string
+	// tenantStorageRegions son las regiones de STORAGE_REGIONS a las que
+	// puede subir cada tenant que las limita
+	tenantStorageRegions map[string][]string
+	// tenantFieldCases es el estilo de los campos JSON de cada tenant que lo
+	// fija (ver fieldCaseFor)
+	tenantFieldCases map[string]string
+	// tenantPrefix es el espacio de cada tenant en los buckets compartidos;
+	// {tenant} se reemplaza por el nombre
+	tenantPrefix string
+}
+
+var tenantNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]{0,62}$`)
+
+func loadTenantConfig(cfg *reloadableConfig) {
+	byTenant, err := readTenantKeys()
+	if err != nil {
+		fmt.Printf("%v, se ignora\n", err)
+	}
+	keys := map[string]string{}
+	regions := map[string][]string{}
+	fieldCases := map[string]string{}
+	for tenant, entry := range byTenant {
+		switch {
+		case !tenantNamePattern.MatchString(tenant):
+			fmt.Printf("TENANT_KEYS: nombre de tenant inválido %q, se ignora\n", tenant)
+		case entry.Key == "" || entry.Key == cfg.apiKey:
+			fmt.Printf("TENANT_KEYS: el tenant %s no tiene una key propia, se ignora\n", tenant)
+		case keys[entry.Key] != "":
+			fmt.Printf("TENANT_KEYS: los tenants %s y %s comparten key, se ignora %s\n", keys[entry.Key], tenant, tenant)
+		default:
+			keys[entry.Key] = tenant
+			if len(entry.StorageRegions) > 0 {
+				regions[tenant] = tenantRegions(cfg, tenant, entry.StorageRegions)
+			}
+			switch fieldCase := strings.ToLower(entry.FieldCase); fieldCase {
+			case "":
+			case fieldCaseSnake, fieldCaseCamel:
+				fieldCases[tenant] = fieldCase
+			default:
+				fmt.Printf("TENANT_KEYS: field_case inválido %q del tenant %s, se usa RESPONSE_FIELD_CASE\n", entry.FieldCase, tenant)
+			}
+		}
+	}
+
+	prefix := os.Getenv("TENANT_KEY_PREFIX")
+	if prefix == "" {
+		prefix = "tenants/{tenant}/"
+	}
+	if !strings.Contains(prefix, "{tenant}") {
+		fmt.Printf("TENANT_KEY_PREFIX debe contener {tenant}, se usa tenants/{tenant}/\n")
+		prefix = "tenants/{tenant}/"
+	}
+	prefix = strings.TrimLeft(prefix, "/")
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	cfg.tenantKeys, cfg.tenantStorageRegions, cfg.tenantFieldCases, cfg.tenantPrefix = keys, regions, fieldCases, prefix
+	if len(keys) > 0 {
+		fmt.Printf("Tenants configurados: %d (prefijo %s)\n", len(keys), prefix)
+	}
+}
+
+// tenantEntry es el valor de un tenant en TENANT_KEYS: la key sola, o un
+// objeto con la key y las restricciones del tenant
+type tenantEntry struct {
+	Key string `json:"key"`
+	// StorageRegions limita las subidas con credenciales del servidor a
+	// estas regiones de STORAGE_REGIONS
+	StorageRegions []string `json:"storage_regions"`
+	// FieldCase es el estilo de los campos JSON de sus respuestas (snake o
+	// camel) en lugar de RESPONSE_FIELD_CASE
+	FieldCase string `json:"field_case"`
+}
+
+func (entry *tenantEntry) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &entry.Key); err == nil {
+		return nil
+	}
+	type plainEntry tenantEntry
+	return json.Unmarshal(data, (*plainEntry)(entry))
+}
+
+// readTenantKeys decodifica TENANT_KEYS, un objeto JSON de tenant a API key
+// (o a tenantEntry)
+func readTenantKeys() (map[string]tenantEntry, error) {
+	byTenant := map[string]tenantEntry{}
+	if raw := strings.TrimSpace(os.Getenv("TENANT_KEYS")); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &byTenant); err != nil {
+			return nil, fmt.Errorf("TENANT_KEYS inválido: %v", err)
+		}
+	}
+	return byTenant, nil
+}
+
+// tenantRegions devuelve las storage_regions del tenant que existen en
+// STORAGE_REGIONS. Si ninguna existe, el tenant queda sin regiones
+// permitidas y sus subidas con credenciales del servidor se rechazan.
+func tenantRegions(cfg *reloadableConfig, tenant string, names []string) []string {
+	valid := []string{}
+	for _, name := range names {
+		if _, ok := cfg.storageRegions[name]; !ok {
+			fmt.Printf("TENANT_KEYS: la storage_region %s del tenant %s no está en STORAGE_REGIONS, se ignora\n", name, tenant)
+			continue
+		}
+		valid = append(valid, name)
+	}
+	return valid
+}
+
+// setRequestTenant registra el tenant de la solicitud en gin y en el
+// contexto que siguen los trabajos y las subidas
+func setRequestTenant(c *gin.Context, tenant string) {
+	if tenant == "" {
+		return
+	}
+	c.Set(tenantContextKey, tenant)
+	requestInfoFrom(c.Request.Context()).Tenant = tenant
+}
+
+// requestTenant devuelve el tenant de la solicitud; "" con la API key
+// principal
+func requestTenant(c *gin.Context) string {
+	tenant, _ := c.Get(tenantContextKey)
+	name, _ := tenant.(string)
+	return name
+}
+
+// tenantNamespace es el prefijo de las claves del tenant
+func tenantNamespace(tenant string) string {
+	return strings.ReplaceAll(config().tenantPrefix, "{tenant}", tenant)
+}
+
+// checkRelativeKey rechaza las claves que podrían salir de un prefijo: una
+// barra inicial, segmentos vacíos, "." o "..", barras invertidas o
+// caracteres de control
+func checkRelativeKey(key string) error {
+	if strings.HasPrefix(key, "/") || strings.Contains(key, `\`) {
+		return invalidParam("s3_key", "s3_key inválido %q: debe ser relativa al espacio del tenant", key)
+	}
+	for _, r := range key {
+		if r < 0x20 || r == 0x7f {
+			return invalidParam("s3_key", "s3_key inválido %q: contiene caracteres de control", key)
+		}
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return invalidParam("s3_key", "s3_key inválido %q: no puede tener segmentos vacíos, . ni ..", key)
+		}
+	}
+	return nil
+}
+
+// applyTenantNamespace antepone el espacio del tenant a la clave de un
+// destino con credenciales del servidor. Los destinos con credenciales
+// propias o URL prefirmada son del cliente y no se tocan.
+func applyTenantNamespace(c *gin.Context, dest *s3Destination) error {
+	tenant := requestTenant(c)
+	if dest == nil || !dest.shared || tenant == "" {
+		return nil
+	}
+	if err := checkRelativeKey(dest.Key); err != nil {
+		return err
+	}
+	dest.Key = tenantNamespace(tenant) + dest.Key
+	return nil
+}
+
+// checkTenantRead limita las entradas s3:// y gs:// que un tenant lee con
+// las credenciales del servidor a su propio espacio
+func checkTenantRead(ctx context.Context, key string) error {
+	tenant := requestInfoFrom(ctx).Tenant
+	if tenant == "" {
+		return nil
+	}
+	namespace := tenantNamespace(tenant)
+	relative, ok := strings.CutPrefix(key, namespace)
+	if !ok || checkRelativeKey(relative) != nil {
+		return errors.New("la clave está fuera del espacio del tenant (" + namespace + ")")
+	}
+	return nil
+}
+
+// tenantCacheKey separa las entradas de la caché de descargas por tenant:
+// un tenant no reutiliza lo que descargó otro. Las solicitudes con token
+// tampoco reutilizan las descargas hechas con la API key, que pueden venir
+// de hosts internos (ver tokenInputClient).
+func tenantCacheKey(ctx context.Context, url string) string {
+	info := requestInfoFrom(ctx)
+	if info.Token != nil {
+		url = "token " + url
+	}
+	if info.Tenant != "" {
+		return info.Tenant + " " + url
+	}
+	return url
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// withTestConfig publica una copia de la configuración vigente modificada
+// por edit y restaura la anterior al terminar el test
+func withTestConfig(t *testing.T, edit func(*reloadableConfig)) {
+	previous := config()
+	cfg := *previous
+	edit(&cfg)
+	activeConfig.Store(&cfg)
+	t.Cleanup(func() { activeConfig.Store(previous) })
+}
+
+func TestCheckRelativeKey(t *testing.T) {
+	tests := []struct {
+		key     string
+		wantErr bool
+	}{
+		{"audio.mp3", false},
+		{"2024/01/audio.mp3", false},
+		{"a..b/audio.mp3", false},
+		{"/audio.mp3", true},
+		{"../audio.mp3", true},
+		{"a/../../audio.mp3", true},
+		{"a/./audio.mp3", true},
+		{"a//audio.mp3", true},
+		{"a/", true},
+		{"", true},
+		{`a\audio.mp3`, true},
+		{"a/audio\n.mp3", true},
+		{"a/audio\x7f.mp3", true},
+	}
+	for _, tt := range tests {
+		err := checkRelativeKey(tt.key)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("checkRelativeKey(%q) = %v, wantErr %v", tt.key, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCheckTenantRead(t *testing.T) {
+	withTestConfig(t, func(cfg *reloadableConfig) { cfg.tenantPrefix = "tenants/{tenant}/" })
+
+	tests := []struct {
+		tenant  string
+		key     string
+		wantErr bool
+	}{
+		{"", "cualquier/clave.mp3", false},
+		{"acme", "tenants/acme/audio.mp3", false},
+		{"acme", "tenants/acme/2024/audio.mp3", false},
+		{"acme", "tenants/other/audio.mp3", true},
+		{"acme", "tenants/acme-2/audio.mp3", true},
+		{"acme", "tenants/acme/../other/audio.mp3", true},
+		{"acme", "tenants/acme//audio.mp3", true},
+		{"acme", "tenants/acme/", true},
+		{"acme", "audio.mp3", true},
+	}
+	for _, tt := range tests {
+		ctx := withRequestInfo(context.Background(), &requestInfo{Tenant: tt.tenant})
+		err := checkTenantRead(ctx, tt.key)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("checkTenantRead(%q, %q) = %v, wantErr %v", tt.tenant, tt.key, err, tt.wantErr)
+		}
+	}
+}
+
+func TestApplyTenantNamespace(t *testing.T) {
+	withTestConfig(t, func(cfg *reloadableConfig) { cfg.tenantPrefix = "tenants/{tenant}/" })
+
+	tests := []struct {
+		name    string
+		tenant  string
+		dest    s3Destination
+		wantKey string
+		wantErr bool
+	}{
+		{"tenant en bucket compartido", "acme", s3Destination{Key: "out/audio.mp3", shared: true}, "tenants/acme/out/audio.mp3", false},
+		{"API key principal", "", s3Destination{Key: "out/audio.mp3", shared: true}, "out/audio.mp3", false},
+		{"credenciales del cliente", "acme", s3Destination{Key: "/out/audio.mp3"}, "/out/audio.mp3", false},
+		{"clave absoluta", "acme", s3Destination{Key: "/out/audio.mp3", shared: true}, "/out/audio.mp3", true},
+		{"clave con ..", "acme", s3Destination{Key: "../other/audio.mp3", shared: true}, "../other/audio.mp3", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/process-audio", nil)
+			setRequestTenant(c, tt.tenant)
+
+			dest := tt.dest
+			err := applyTenantNamespace(c, &dest)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyTenantNamespace() = %v, wantErr %v", err, tt.wantErr)
+			}
+			if dest.Key != tt.wantKey {
+				t.Errorf("Key = %q, want %q", dest.Key, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestLookupRequestJobTenant(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	j := &job{ID: "tenant-test-job", info: &requestInfo{Tenant: "acme"}}
+	jobsMu.Lock()
+	jobs[j.ID] = j
+	jobsMu.Unlock()
+	defer func() {
+		jobsMu.Lock()
+		delete(jobs, j.ID)
+		jobsMu.Unlock()
+	}()
+
+	for tenant, wantOK := range map[string]bool{"acme": true, "other": false, "": false} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/jobs/"+j.ID, nil)
+		c.Params = gin.Params{{Key: "id", Value: j.ID}}
+		setRequestTenant(c, tenant)
+
+		got, ok := lookupRequestJob(c)
+		if ok != wantOK {
+			t.Errorf("tenant %q: ok = %v, want %v", tenant, ok, wantOK)
+		}
+		if ok && got != j {
+			t.Errorf("tenant %q: trabajo inesperado", tenant)
+		}
+		if !ok && w.Code != http.StatusNotFound {
+			t.Errorf("tenant %q: status = %d, want 404", tenant, w.Code)
+		}
+	}
+}
+
+func TestReadTenantKeysEntries(t *testing.T) {
+	t.Setenv("TENANT_KEYS", `{"acme": {"key": "key-1", "storage_regions": ["eu"]}, "globex": "key-2"}`)
+
+	byTenant, err := readTenantKeys()
+	if err != nil {
+		t.Fatalf("readTenantKeys() = %v", err)
+	}
+	if got := byTenant["acme"]; got.Key != "key-1" || len(got.StorageRegions) != 1 || got.StorageRegions[0] != "eu" {
+		t.Errorf("acme = %+v", got)
+	}
+	if got := byTenant["globex"]; got.Key != "key-2" || got.StorageRegions != nil {
+		t.Errorf("globex = %+v", got)
+	}
+}
+
+func TestCheckStorageResidencyTenant(t *testing.T) {
+	withTestConfig(t, func(cfg *reloadableConfig) {
+		cfg.tenantStorageRegions = map[string][]string{"acme": {"eu"}, "locked": {}}
+	})
+
+	tests := []struct {
+		name    string
+		tenant  string
+		dest    s3Destination
+		wantErr bool
+	}{
+		{"región permitida", "acme", s3Destination{StorageRegion: "eu", shared: true}, false},
+		{"otra región", "acme", s3Destination{StorageRegion: "us", shared: true}, true},
+		{"bucket sin región", "acme", s3Destination{Bucket: "audio", shared: true}, true},
+		{"credenciales del cliente", "acme", s3Destination{Bucket: "audio"}, false},
+		{"tenant sin regiones válidas", "locked", s3Destination{StorageRegion: "eu", shared: true}, true},
+		{"tenant sin restricción", "globex", s3Destination{Bucket: "audio", shared: true}, false},
+		{"API key principal", "", s3Destination{Bucket: "audio", shared: true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/process-audio", nil)
+			setRequestTenant(c, tt.tenant)
+
+			dest := tt.dest
+			if err := checkStorageResidency(c, &dest); (err != nil) != tt.wantErr {
+				t.Errorf("checkStorageResidency() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
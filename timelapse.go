@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// timelapseOptions acelera grabaciones largas (p. ej. cámaras de obra) en
+// /video-to-mp4: SpeedUp comprime el tiempo N veces y FrameStep conserva uno
+// de cada N cuadros. Solo uno de los dos está en uso.
+type timelapseOptions struct {
+	SpeedUp   int
+	FrameStep int
+	// FPS es la frecuencia de salida de speed_up (30 por defecto)
+	FPS int
+	// Deflicker suaviza las variaciones de brillo entre cuadros, típicas de
+	// las cámaras con exposición automática
+	Deflicker bool
+}
+
+// parseTimelapse valida speed_up (2 a 10000), frame_step (2 a 10000),
+// timelapse_fps (1 a 60, solo con speed_up) y deflicker. Devuelve nil si no se
+// pidió un timelapse.
+func parseTimelapse(speedUp, frameStep, fps, deflicker string) (*timelapseOptions, error) {
+	if speedUp == "" && frameStep == "" {
+		if fps != "" || deflicker == "true" {
+			return nil, missingParam("timelapse_fps", "timelapse_fps y deflicker requieren speed_up o frame_step")
+		}
+		return nil, nil
+	}
+	if speedUp != "" && frameStep != "" {
+		return nil, errors.New("speed_up y frame_step no se pueden combinar")
+	}
+
+	opts := &timelapseOptions{Deflicker: deflicker == "true", FPS: 30}
+	parse := func(name, value string, min, max int) (int, error) {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < min || parsed > max {
+			return 0, invalidParam(name, "%s inválido %q (entre %d y %d)", name, value, min, max)
+		}
+		return parsed, nil
+	}
+	var err error
+	if speedUp != "" {
+		if opts.SpeedUp, err = parse("speed_up", speedUp, 2, 10000); err != nil {
+			return nil, err
+		}
+	} else if opts.FrameStep, err = parse("frame_step", frameStep, 2, 10000); err != nil {
+		return nil, err
+	}
+	if fps != "" {
+		if opts.FrameStep != 0 {
+			return nil, conflictingParams("timelapse_fps", "timelapse_fps solo se aplica con speed_up; frame_step conserva la frecuencia de la entrada")
+		}
+		if opts.FPS, err = parse("timelapse_fps", fps, 1, 60); err != nil {
+			return nil, err
+		}
+	}
+	return opts, nil
+}
+
+// filters son los filtros de video del timelapse. speed_up reescribe los
+// tiempos y fps descarta los cuadros sobrantes; frame_step elige cada N-ésimo
+// cuadro y los renumera a la frecuencia de la entrada. deflicker va al final
+// porque el parpadeo aparece entre los cuadros que quedan.
+func (opts *timelapseOptions) filters() []string {
+	var filters []string
+	if opts.SpeedUp != 0 {
+		filters = append(filters, fmt.Sprintf("setpts=PTS/%d", opts.SpeedUp), fmt.Sprintf("fps=%d", opts.FPS))
+	} else {
+		filters = append(filters, fmt.Sprintf("select=not(mod(n\\,%d))", opts.FrameStep), "setpts=N/FRAME_RATE/TB")
+	}
+	if opts.Deflicker {
+		filters = append(filters, "deflicker=size=5:mode=am")
+	}
+	return filters
+}
+
+// describe resume el timelapse para transformations y X-Timelapse
+func (opts *timelapseOptions) describe() string {
+	description := fmt.Sprintf("speed_up %dx at %d fps", opts.SpeedUp, opts.FPS)
+	if opts.FrameStep != 0 {
+		description = fmt.Sprintf("frame_step 1/%d", opts.FrameStep)
+	}
+	if opts.Deflicker {
+		description += ", deflicker"
+	}
+	return description
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// conversionTokenKey guarda en el contexto de gin el token que autorizó la
+// solicitud
+const conversionTokenKey = "conversion_token"
+
+// tokenConfig acota lo que un backend puede delegar en un token
+type tokenConfig struct {
+	tokenMaxTTL   time.Duration
+	tokenMaxBytes int64
+	tokenMaxUses  int
+}
+
+var (
+	conversionTokensMu sync.Mutex
+	conversionTokens   = map[string]*conversionToken{}
+)
+
+func loadTokenConfig(cfg *reloadableConfig) {
+	cfg.tokenMaxTTL = envDuration("TOKEN_MAX_TTL", time.Hour)
+	cfg.tokenMaxBytes = envInt64("TOKEN_MAX_BYTES", 100<<20)
+	cfg.tokenMaxUses = envInt("TOKEN_MAX_USES", 100)
+}
+
+// conversionToken permite a un navegador llamar a endpoints de conversión
+// sin la API key: solo los de Endpoints, hasta MaxBytes de entrada, Uses
+// veces y antes de ExpiresAt
+type conversionToken struct {
+	ID        string
+	Endpoints []string
+	MaxBytes  int64
+	Uses      int
+	ExpiresAt time.Time
+	// StorageRegions limita las subidas a S3 a esas storage_region (ver
+	// residency.go); vacío no restringe
+	StorageRegions []string
+	// Tenant es el tenant de la key que creó el token: sus subidas van al
+	// mismo espacio (ver tenant.go)
+	Tenant string
+	// Grants son los permisos explícitos para usar recursos del servidor
+	// (ver tokenGrants); sin ellos el token no puede usarlos
+	Grants []string
+}
+
+// tokenGrants son los permisos que un token necesita, además del endpoint,
+// para usar credenciales o conexiones del servidor
+var tokenGrants = map[string]string{
+	"url_input":   "descargar url=http(s):// desde el servidor",
+	"cloud_input": "leer url=s3:// o gs:// con las credenciales del servidor",
+	"s3_output":   "subir a S3 con las credenciales del servidor",
+	"callback":    "callback_url",
+	"email":       "email_to",
+}
+
+// granted indica si el token recibió el permiso
+func (token *conversionToken) granted(grant string) bool {
+	for _, name := range token.Grants {
+		if name == grant {
+			return true
+		}
+	}
+	return false
+}
+
+// allows indica si el token cubre la ruta. Las operaciones se autorizan por
+// nombre (ops/normalize) o todas juntas (ops/:name).
+func (token *conversionToken) allows(c *gin.Context) bool {
+	endpoint := strings.TrimPrefix(c.FullPath(), "/")
+	for _, allowed := range token.Endpoints {
+		if allowed == endpoint || (endpoint == "ops/:name" && allowed == "ops/"+c.Param("name")) {
+			return true
+		}
+	}
+	return false
+}
+
+// bodyLimit es el tamaño máximo del cuerpo: la entrada en base64 más el
+// resto del formulario
+func (token *conversionToken) bodyLimit() int64 {
+	return token.MaxBytes*4/3 + 64<<10
+}
+
+// tokenLimitError rechaza una entrada mayor que la permitida por el token.
+// Size es 0 si la descarga se cortó sin conocer el tamaño total.
+type tokenLimitError struct {
+	Size  int64
+	Limit int64
+}
+
+func (e *tokenLimitError) Error() string {
+	if e.Size == 0 {
+		return fmt.Sprintf("la entrada supera el máximo del token (%d bytes)", e.Limit)
+	}
+	return fmt.Sprintf("la entrada (%d bytes) supera el máximo del token (%d bytes)", e.Size, e.Limit)
+}
+
+// tokenGrantError rechaza una opción que el token no tiene permitida
+type tokenGrantError struct {
+	Grant string
+}
+
+func (e *tokenGrantError) Error() string {
+	return fmt.Sprintf("el token no permite %s (requiere grants=%s)", tokenGrants[e.Grant], e.Grant)
+}
+
+var tokenEndpointPattern = regexp.MustCompile(`^[a-z0-9-]+(/[a-zA-Z0-9_.:-]+)?$`)
+
+// createToken atiende POST /tokens: un backend con la API key emite un
+// token de corta duración para que el navegador suba directo al conversor
+func createToken(c *gin.Context) {
+	// /tokens está fuera del grupo de conversiones: solo acepta la API key
+	if !validateAPIKey(c) {
+		return
+	}
+
+	cfg := config()
+	token := &conversionToken{
+		ID:       "ct_" + newRandomID(),
+		MaxBytes: 10 << 20,
+		Uses:     1,
+		Tenant:   requestTenant(c),
+	}
+	for _, endpoint := range strings.Split(c.DefaultPostForm("endpoints", "process-audio"), ",") {
+		endpoint = strings.Trim(strings.TrimSpace(endpoint), "/")
+		if endpoint == "" {
+			continue
+		}
+		if !tokenEndpointPattern.MatchString(endpoint) {
+			respondError(c, http.StatusBadRequest, invalidParam("endpoints", "endpoint inválido %q (p. ej. process-audio u ops/normalize)", endpoint))
+			return
+		}
+		token.Endpoints = append(token.Endpoints, endpoint)
+	}
+	if len(token.Endpoints) == 0 {
+		respondError(c, http.StatusBadRequest, invalidParam("endpoints", "endpoints no puede estar vacío"))
+		return
+	}
+
+	if value := c.PostForm("max_bytes"); value != "" {
+		maxBytes, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || maxBytes < 1 || maxBytes > cfg.tokenMaxBytes {
+			respondError(c, http.StatusBadRequest, invalidParam("max_bytes", "max_bytes debe estar entre 1 y %d", cfg.tokenMaxBytes))
+			return
+		}
+		token.MaxBytes = maxBytes
+	}
+	if value := c.PostForm("uses"); value != "" {
+		uses, err := strconv.Atoi(value)
+		if err != nil || uses < 1 || uses > cfg.tokenMaxUses {
+			respondError(c, http.StatusBadRequest, invalidParam("uses", "uses debe estar entre 1 y %d", cfg.tokenMaxUses))
+			return
+		}
+		token.Uses = uses
+	}
+	for _, name := range strings.Split(c.PostForm("storage_regions"), ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if _, ok := cfg.storageRegions[name]; !ok {
+			respondError(c, http.StatusBadRequest, invalidParam("storage_regions", "storage_region desconocida %q (configuradas: %s)", name, storageRegionNames(cfg.storageRegions)))
+			return
+		}
+		if allowed, ok := cfg.tenantStorageRegions[token.Tenant]; ok && !regionAllowed(allowed, name) {
+			respondError(c, http.StatusBadRequest, invalidParam("storage_regions", "el tenant %s no puede guardar en storage_region %q", token.Tenant, name))
+			return
+		}
+		token.StorageRegions = append(token.StorageRegions, name)
+	}
+	for _, grant := range strings.Split(c.PostForm("grants"), ",") {
+		if grant = strings.TrimSpace(grant); grant == "" {
+			continue
+		}
+		if _, ok := tokenGrants[grant]; !ok {
+			respondError(c, http.StatusBadRequest, invalidParam("grants", "grant desconocido %q (url_input, cloud_input, s3_output, callback o email)", grant))
+			return
+		}
+		token.Grants = append(token.Grants, grant)
+	}
+	ttl := 10 * time.Minute
+	if value := c.PostForm("ttl"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 || parsed > cfg.tokenMaxTTL {
+			respondError(c, http.StatusBadRequest, invalidParam("ttl", "ttl debe ser una duración de hasta %s (p. ej. 10m)", cfg.tokenMaxTTL))
+			return
+		}
+		ttl = parsed
+	}
+	token.ExpiresAt = time.Now().Add(ttl)
+
+	conversionTokensMu.Lock()
+	pruneConversionTokens(time.Now())
+	conversionTokens[token.ID] = token
+	conversionTokensMu.Unlock()
+
+	response := gin.H{
+		"token":      token.ID,
+		"endpoints":  token.Endpoints,
+		"max_bytes":  token.MaxBytes,
+		"uses":       token.Uses,
+		"expires_at": token.ExpiresAt.UTC().Format(time.RFC3339),
+	}
+	if len(token.StorageRegions) > 0 {
+		response["storage_regions"] = token.StorageRegions
+	}
+	if token.Tenant != "" {
+		response["tenant"] = token.Tenant
+	}
+	if len(token.Grants) > 0 {
+		response["grants"] = token.Grants
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// pruneConversionTokens olvida los tokens vencidos. Se llama con
+// conversionTokensMu tomado.
+func pruneConversionTokens(now time.Time) {
+	for id, token := range conversionTokens {
+		if now.After(token.ExpiresAt) {
+			delete(conversionTokens, id)
+		}
+	}
+}
+
+// tokenMiddleware acepta "Authorization: Bearer <token>" en los endpoints de
+// conversión. Cada solicitud autorizada consume un uso, aunque después falle.
+func tokenMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bearer, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || c.GetHeader("apikey") != "" {
+			c.Next()
+			return
+		}
+
+		conversionTokensMu.Lock()
+		token, found := conversionTokens[strings.TrimSpace(bearer)]
+		status, message := 0, ""
+		switch {
+		case !found || time.Now().After(token.ExpiresAt):
+			status, message = http.StatusUnauthorized, "Invalid or expired token"
+		case !token.allows(c):
+			status, message = http.StatusForbidden, "Token not valid for this endpoint"
+		case c.Request.ContentLength > token.bodyLimit():
+			status, message = http.StatusRequestEntityTooLarge, "Request exceeds the token size limit"
+		default:
+			token.Uses--
+			if token.Uses == 0 {
+				delete(conversionTokens, token.ID)
+			}
+		}
+		conversionTokensMu.Unlock()
+
+		if status != 0 {
+			c.JSON(status, gin.H{"error": message})
+			c.Abort()
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, token.bodyLimit())
+		c.Set(conversionTokenKey, token)
+		c.Next()
+	}
+}
+
+// checkTokenInputLimit aplica max_bytes del token al total de entradas
+// leídas, incluidas las descargadas desde una URL
+func checkTokenInputLimit(c *gin.Context, info *requestInfo) error {
+	value, ok := c.Get(conversionTokenKey)
+	if !ok {
+		return nil
+	}
+	token := value.(*conversionToken)
+	total := 0
+	for _, input := range info.Inputs {
+		total += len(input.Data)
+	}
+	if int64(total) > token.MaxBytes {
+		return &tokenLimitError{Size: int64(total), Limit: token.MaxBytes}
+	}
+	return nil
+}
+
+// checkTokenGrant rechaza el uso de un recurso del servidor (ver
+// tokenGrants) en una solicitud autorizada con un token que no lo permite.
+// Con la API key no hay restricción.
+func checkTokenGrant(ctx context.Context, grant string) error {
+	token := requestInfoFrom(ctx).Token
+	if token == nil || token.granted(grant) {
+		return nil
+	}
+	return &tokenGrantError{Grant: grant}
+}
+
+// tokenInputClient descarga las url= de las solicitudes con token. Cada
+// conexión pasa por publicDialer y no usa el proxy del entorno, así un
+// navegador no alcanza la red interna ni el servicio de metadatos de la nube.
+var tokenInputClient = &http.Client{
+	Timeout: 60 * time.Second,
+	Transport: &http.Transport{
+		DialContext:         publicDialer.DialContext,
+		ForceAttemptHTTP2:   true,
+		MaxIdleConns:        10,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+}
+
+// inputClient devuelve el cliente para descargar una url=. Con la API key es
+// client; con un token requiere grants=url_input y usa tokenInputClient.
+func inputClient(ctx context.Context, client *http.Client) (*http.Client, error) {
+	if requestInfoFrom(ctx).Token == nil {
+		return client, nil
+	}
+	if err := checkTokenGrant(ctx, "url_input"); err != nil {
+		return nil, err
+	}
+	return tokenInputClient, nil
+}
+
+// checkTokenStorage rechaza las subidas con credenciales del servidor (un
+// bucket compartido o una storage_region) salvo que el token tenga
+// grants=s3_output o nombre esa storage_region en storage_regions
+func checkTokenStorage(ctx context.Context, dest *s3Destination) error {
+	token := requestInfoFrom(ctx).Token
+	if token == nil || dest == nil || !dest.shared || token.granted("s3_output") {
+		return nil
+	}
+	for _, name := range token.StorageRegions {
+		if dest.StorageRegion == name {
+			return nil
+		}
+	}
+	return &tokenGrantError{Grant: "s3_output"}
+}
+
+// readInputBody lee el cuerpo de una entrada descargada. Con un token, corta
+// la descarga en cuanto supera lo que queda de max_bytes en lugar de
+// descargarla entera y rechazarla después.
+func readInputBody(ctx context.Context, resp *http.Response) ([]byte, error) {
+	info := requestInfoFrom(ctx)
+	if info.Token == nil {
+		return io.ReadAll(resp.Body)
+	}
+	remaining := info.Token.MaxBytes
+	for _, input := range info.Inputs {
+		remaining -= int64(len(input.Data))
+	}
+	if resp.ContentLength > remaining {
+		return nil, &tokenLimitError{Size: resp.ContentLength, Limit: info.Token.MaxBytes}
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, remaining+1))
+	if err == nil && int64(len(data)) > remaining {
+		return nil, &tokenLimitError{Limit: info.Token.MaxBytes}
+	}
+	return data, err
+}
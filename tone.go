@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// toneMaxSeconds limita la duración de las señales generadas
+const toneMaxSeconds = 3600
+
+// toneFormats son los formatos de salida de /generate-tone
+var toneFormats = map[string]bool{
+	"ogg": true, "mp3": true, "m4a": true, "aac": true, "mp4": true, "wav": true, "flac": true,
+	"alac": true, "amr": true, "amr-wb": true, "ulaw": true, "alaw": true,
+}
+
+// toneOptions son los parámetros de /generate-tone
+type toneOptions struct {
+	// Signal es sine, white_noise, pink_noise o silence
+	Signal   string
+	Duration float64
+	// Frequency solo se usa con sine
+	Frequency float64
+	// LevelDB es el pico en dBFS; no se usa con silence
+	LevelDB    float64
+	SampleRate int
+	Channels   int
+	Format     string
+}
+
+// parseToneOptions valida signal, duration (segundos o [hh:]mm:ss[.ms], 1 s
+// por defecto), frequency (1 a 20000 Hz, 1000 por defecto), level_db (-90 a
+// 0 dBFS, -20 por defecto), sample_rate (8000 a 192000 Hz, 48000 por
+// defecto), channels (1 o 2) y el formato de salida
+func parseToneOptions(signal, duration, frequency, level, sampleRate, channels, format string) (*toneOptions, error) {
+	opts := &toneOptions{Signal: "sine", Duration: 1, Frequency: 1000, LevelDB: -20, SampleRate: 48000, Channels: 1, Format: format}
+	switch signal {
+	case "":
+	case "sine", "white_noise", "pink_noise", "silence":
+		opts.Signal = signal
+	default:
+		return nil, invalidParam("signal", "signal inválido %q (sine, white_noise, pink_noise o silence)", signal)
+	}
+	if duration != "" {
+		seconds, err := parseTimestamp(duration)
+		if err != nil {
+			return nil, invalidParam("duration", "duration inválido: %v", err)
+		}
+		if seconds <= 0 || seconds > toneMaxSeconds {
+			return nil, invalidParam("duration", "duration inválido %q (mayor que cero y hasta %d segundos)", duration, toneMaxSeconds)
+		}
+		opts.Duration = seconds
+	}
+	parse := func(name, value string, min, max float64, target *float64) error {
+		if value == "" {
+			return nil
+		}
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < min || parsed > max {
+			return invalidParam(name, "%s inválido %q (entre %s y %s)", name, value,
+				strconv.FormatFloat(min, 'f', -1, 64), strconv.FormatFloat(max, 'f', -1, 64))
+		}
+		*target = parsed
+		return nil
+	}
+	if frequency != "" && opts.Signal != "sine" {
+		return nil, conflictingParams("frequency", "frequency solo se usa con signal=sine")
+	}
+	if err := parse("frequency", frequency, 1, 20000, &opts.Frequency); err != nil {
+		return nil, err
+	}
+	if level != "" && opts.Signal == "silence" {
+		return nil, conflictingParams("level_db", "level_db no se combina con signal=silence")
+	}
+	if err := parse("level_db", level, -90, 0, &opts.LevelDB); err != nil {
+		return nil, err
+	}
+	if sampleRate != "" {
+		value, err := strconv.Atoi(sampleRate)
+		if err != nil || value < 8000 || value > 192000 {
+			return nil, invalidParam("sample_rate", "sample_rate inválido %q (entre 8000 y 192000)", sampleRate)
+		}
+		opts.SampleRate = value
+	}
+	switch channels {
+	case "", "1":
+	case "2":
+		opts.Channels = 2
+	default:
+		return nil, invalidParam("channels", "channels inválido %q (1 o 2)", channels)
+	}
+	if !toneFormats[format] {
+		return nil, invalidParam("output_format", "output_format inválido %q para /generate-tone", format)
+	}
+	// La frecuencia no puede superar Nyquist
+	if opts.Signal == "sine" && opts.Frequency >= float64(opts.SampleRate)/2 {
+		return nil, fmt.Errorf("frequency debe ser menor que la mitad de sample_rate (%d Hz)", opts.SampleRate/2)
+	}
+	return opts, nil
+}
+
+// lavfiSource es la fuente de ffmpeg de la señal. El nivel es el pico: la
+// senoidal se genera con aevalsrc para fijar su amplitud exacta.
+func (opts *toneOptions) lavfiSource() string {
+	layout := "mono"
+	if opts.Channels == 2 {
+		layout = "stereo"
+	}
+	amplitude := strconv.FormatFloat(math.Pow(10, opts.LevelDB/20), 'f', 6, 64)
+	switch opts.Signal {
+	case "white_noise", "pink_noise":
+		color := "white"
+		if opts.Signal == "pink_noise" {
+			color = "pink"
+		}
+		return fmt.Sprintf("anoisesrc=color=%s:amplitude=%s:sample_rate=%d,aformat=channel_layouts=%s", color, amplitude, opts.SampleRate, layout)
+	case "silence":
+		return fmt.Sprintf("anullsrc=r=%d:cl=%s", opts.SampleRate, layout)
+	default:
+		return fmt.Sprintf("aevalsrc=%s*sin(2*PI*%s*t):s=%d:c=%s", amplitude,
+			strconv.FormatFloat(opts.Frequency, 'f', -1, 64), opts.SampleRate, layout)
+	}
+}
+
+// generateTone genera la señal como WAV de 16 bits y la codifica en el
+// formato pedido con el mismo pipeline que /process-audio
+func generateTone(ctx context.Context, opts *toneOptions) ([]byte, error) {
+	cmd := ffmpegCommand(ctx, classInteractive,
+		"-f", "lavfi",
+		"-i", opts.lavfiSource(),
+		"-t", formatSeconds(opts.Duration),
+		"-c:a", "pcm_s16le",
+		"-f", "wav",
+		"pipe:1",
+	)
+	var output, errBuffer bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &errBuffer
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error al generar la señal: %v, detalles: %s", err, errBuffer.String())
+	}
+	if opts.Format == "wav" {
+		return output.Bytes(), nil
+	}
+
+	data, _, err := convertAudio(ctx, output.Bytes(), audioOptions{Format: opts.Format, DisableCodecCopy: true})
+	return data, err
+}
+
+// processGenerateTone atiende POST /generate-tone: tonos, ruido o silencio
+// para pruebas de telefonía y audio de relleno, sin entrada
+func processGenerateTone(c *gin.Context) {
+	if !validateAPIKey(c) {
+		return
+	}
+
+	opts, err := parseToneOptions(c.PostForm("signal"), c.PostForm("duration"), c.PostForm("frequency"), c.PostForm("level_db"),
+		c.PostForm("sample_rate"), c.PostForm("channels"), negotiateFormat(c, audioNegotiationFormats, "wav"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	data, err := generateTone(ctx, opts)
+	if err == nil {
+		data, err = interceptOutput(ctx, opts.Format, data)
+	}
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusInternalServerError), err)
+		return
+	}
+	format := audioOptions{Format: opts.Format}
+
+	if wantsBinaryResponse(c, "") {
+		writeBinaryResponse(c, data, format.outputFilename(), format.outputContentType(), map[string]string{
+			"X-Signal":   opts.Signal,
+			"X-Duration": formatSeconds(opts.Duration),
+		})
+		return
+	}
+
+	response := gin.H{
+		"audio":       base64.StdEncoding.EncodeToString(data),
+		"format":      opts.Format,
+		"signal":      opts.Signal,
+		"duration":    opts.Duration,
+		"sample_rate": opts.SampleRate,
+		"channels":    opts.Channels,
+	}
+	if opts.Signal == "sine" {
+		response["frequency"] = opts.Frequency
+	}
+	if opts.Signal != "silence" {
+		response["level_db"] = opts.LevelDB
+	}
+	c.JSON(http.StatusOK, attachDebug(ctx, response))
+}
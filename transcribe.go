@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// whisperSampleRate es la frecuencia que esperan los modelos Whisper
+const whisperSampleRate = 16000
+
+var (
+	transcribeTimeout    time.Duration
+	transcribeMaxSeconds int
+	// activeTranscriber es nil si no hay whisper.cpp ni API configurados
+	activeTranscriber transcriber
+)
+
+var transcribeLanguageRe = regexp.MustCompile(`^[a-z]{2,3}$`)
+
+// transcriptSegment es un tramo del texto con sus tiempos en segundos
+type transcriptSegment struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Text  string  `json:"text"`
+}
+
+// transcriptWord es una palabra con sus tiempos en segundos
+type transcriptWord struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Word  string  `json:"word"`
+}
+
+// transcript es el resultado de una transcripción. Words solo está presente
+// si se pidieron los tiempos por palabra.
+type transcript struct {
+	Text     string
+	Language string
+	Segments []transcriptSegment
+	Words    []transcriptWord
+	// Duration es la duración del audio transcrito
+	Duration float64
+}
+
+// transcriber transcribe un WAV mono de 16 kHz. language vacío deja que el
+// modelo detecte el idioma; words pide además los tiempos de cada palabra.
+type transcriber interface {
+	Name() string
+	Transcribe(ctx context.Context, wav []byte, language string, words bool) (*transcript, error)
+}
+
+// loadTranscribeConfig elige el motor de /transcribe: una API compatible con
+// la de OpenAI (WHISPER_API_URL) o el binario de whisper.cpp con un modelo
+// local (WHISPER_CPP_MODEL). La API tiene prioridad si están los dos.
+func loadTranscribeConfig() {
+	transcribeTimeout = envDuration("TRANSCRIBE_TIMEOUT", 10*time.Minute)
+	transcribeMaxSeconds = envInt("TRANSCRIBE_MAX_SECONDS", 3600)
+
+	if url := strings.TrimSpace(os.Getenv("WHISPER_API_URL")); url != "" {
+		model := os.Getenv("WHISPER_API_MODEL")
+		if model == "" {
+			model = "whisper-1"
+		}
+		activeTranscriber = &whisperAPI{url: url, key: os.Getenv("WHISPER_API_KEY"), model: model}
+		fmt.Printf("Transcripción: API %s (modelo %s)\n", url, model)
+		return
+	}
+	if model := strings.TrimSpace(os.Getenv("WHISPER_CPP_MODEL")); model != "" {
+		bin := os.Getenv("WHISPER_CPP_BIN")
+		if bin == "" {
+			bin = "whisper-cli"
+		}
+		activeTranscriber = &whisperCPP{bin: bin, model: model}
+		fmt.Printf("Transcripción: whisper.cpp %s (modelo %s)\n", bin, model)
+	}
+}
+
+// whisperAPI usa POST /v1/audio/transcriptions con verbose_json, que incluye
+// los segmentos con tiempos
+type whisperAPI struct {
+	url   string
+	key   string
+	model string
+}
+
+func (w *whisperAPI) Name() string {
+	return "api:" + w.model
+}
+
+func (w *whisperAPI) Transcribe(ctx context.Context, wav []byte, language string, words bool) (*transcript, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", "audio.wav")
+	if err != nil {
+		return nil, err
+	}
+	part.Write(wav)
+	form.WriteField("model", w.model)
+	form.WriteField("response_format", "verbose_json")
+	form.WriteField("timestamp_granularities[]", "segment")
+	if words {
+		form.WriteField("timestamp_granularities[]", "word")
+	}
+	if language != "" {
+		form.WriteField("language", language)
+	}
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if w.key != "" {
+		req.Header.Set("Authorization", "Bearer "+w.key)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 32<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("estado inesperado %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	var result struct {
+		Text     string              `json:"text"`
+		Language string              `json:"language"`
+		Segments []transcriptSegment `json:"segments"`
+		Words    []transcriptWord    `json:"words"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("respuesta inválida: %v", err)
+	}
+	return &transcript{Text: result.Text, Language: result.Language, Segments: result.Segments, Words: result.Words}, nil
+}
+
+// whisperCPP ejecuta el binario de whisper.cpp con salida JSON (-oj)
+type whisperCPP struct {
+	bin   string
+	model string
+}
+
+func (w *whisperCPP) Name() string {
+	return "whisper.cpp:" + filepath.Base(w.model)
+}
+
+// Con words, -ml 1 -sow hace que cada segmento de la salida sea una palabra.
+func (w *whisperCPP) Transcribe(ctx context.Context, wav []byte, language string, words bool) (*transcript, error) {
+	workDir, err := os.MkdirTemp("", "transcribe-*")
+	if err != nil {
+		return nil, fmt.Errorf("error al crear la carpeta temporal: %v", err)
+	}
+	defer os.RemoveAll(workDir)
+	wavPath := filepath.Join(workDir, "audio.wav")
+	if err := os.WriteFile(wavPath, wav, 0o600); err != nil {
+		return nil, fmt.Errorf("error al escribir el audio: %v", err)
+	}
+	if language == "" {
+		language = "auto"
+	}
+
+	outputPrefix := filepath.Join(workDir, "transcript")
+	args := []string{"-m", w.model, "-f", wavPath, "-l", language, "-oj", "-of", outputPrefix, "-np"}
+	if words {
+		args = append(args, "-ml", "1", "-sow")
+	}
+	cmd := exec.CommandContext(ctx, w.bin, args...)
+	var errBuffer bytes.Buffer
+	cmd.Stderr = &errBuffer
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%v, detalles: %s", err, errBuffer.String())
+	}
+
+	data, err := os.ReadFile(outputPrefix + ".json")
+	if err != nil {
+		return nil, fmt.Errorf("whisper.cpp no produjo la transcripción: %v", err)
+	}
+	var result struct {
+		Result struct {
+			Language string `json:"language"`
+		} `json:"result"`
+		Transcription []struct {
+			// Offsets están en milisegundos
+			Offsets struct {
+				From int64 `json:"from"`
+				To   int64 `json:"to"`
+			} `json:"offsets"`
+			Text string `json:"text"`
+		} `json:"transcription"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("transcripción inválida: %v", err)
+	}
+
+	transcribed := &transcript{Language: result.Result.Language}
+	var text []string
+	for _, segment := range result.Transcription {
+		segmentText := strings.TrimSpace(segment.Text)
+		if segmentText == "" {
+			continue
+		}
+		start, end := float64(segment.Offsets.From)/1000, float64(segment.Offsets.To)/1000
+		if words {
+			transcribed.Words = append(transcribed.Words, transcriptWord{Start: start, End: end, Word: segmentText})
+		} else {
+			transcribed.Segments = append(transcribed.Segments, transcriptSegment{Start: start, End: end, Text: segmentText})
+		}
+		text = append(text, segmentText)
+	}
+	transcribed.Text = strings.Join(text, " ")
+	return transcribed, nil
+}
+
+// parseTranscribeLanguage valida language (código ISO 639-1, p. ej. "es"; ""
+// o "auto" detectan el idioma)
+func parseTranscribeLanguage(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" || value == "auto" {
+		return "", nil
+	}
+	if !transcribeLanguageRe.MatchString(value) {
+		return "", invalidParam("language", "language inválido %q (código ISO 639-1, p. ej. es o en, o auto)", value)
+	}
+	return value, nil
+}
+
+// transcribeInput convierte la entrada a WAV mono de 16 kHz y la transcribe.
+// Solo se transcriben los primeros TRANSCRIBE_MAX_SECONDS segundos.
+func transcribeInput(ctx context.Context, inputData []byte, language string, words bool) (*transcript, error) {
+	pcm, err := decodeMonoPCM(ctx, inputData, whisperSampleRate, transcribeMaxSeconds)
+	if err != nil {
+		return nil, err
+	}
+	if len(pcm) == 0 {
+		return nil, errors.New("la entrada no tiene audio para transcribir")
+	}
+	duration := float64(len(pcm)/2) / whisperSampleRate
+
+	transcribeCtx, cancel := context.WithTimeout(ctx, transcribeTimeout)
+	defer cancel()
+	started := time.Now()
+	result, err := activeTranscriber.Transcribe(transcribeCtx, wavFromPCM(pcm, whisperSampleRate), language, words)
+	if err != nil {
+		return nil, fmt.Errorf("error en la transcripción (%s): %v", activeTranscriber.Name(), err)
+	}
+	fmt.Printf("[transcribe] %s s transcritos con %s en %s\n", formatSeconds(duration), activeTranscriber.Name(), time.Since(started).Round(time.Millisecond))
+	recordDebug(ctx, "transcriber", activeTranscriber.Name())
+
+	if result.Segments == nil {
+		result.Segments = []transcriptSegment{}
+	}
+	for i := range result.Segments {
+		result.Segments[i].Start = roundMillis(result.Segments[i].Start)
+		result.Segments[i].End = roundMillis(math.Min(result.Segments[i].End, duration))
+		result.Segments[i].Text = strings.TrimSpace(result.Segments[i].Text)
+	}
+	for i := range result.Words {
+		result.Words[i].Start = roundMillis(result.Words[i].Start)
+		result.Words[i].End = roundMillis(math.Min(result.Words[i].End, duration))
+		result.Words[i].Word = strings.TrimSpace(result.Words[i].Word)
+	}
+	if language != "" {
+		result.Language = language
+	}
+	result.Text = strings.TrimSpace(result.Text)
+	result.Duration = duration
+	return result, nil
+}
+
+// runTranscribe transcribe la entrada y arma la respuesta de /transcribe
+func runTranscribe(ctx context.Context, inputData []byte, language string) (gin.H, error) {
+	result, err := transcribeInput(ctx, inputData, language, false)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{
+		"text":     result.Text,
+		"language": result.Language,
+		"segments": result.Segments,
+		"duration": roundMillis(result.Duration),
+		"engine":   activeTranscriber.Name(),
+	}, nil
+}
+
+// processTranscribe atiende POST /transcribe: el texto de la entrada con los
+// tiempos de cada segmento, sin que el cliente tenga que convertirla antes
+func processTranscribe(c *gin.Context) {
+	if !validateAPIKey(c) {
+		return
+	}
+	if activeTranscriber == nil {
+		respondError(c, http.StatusServiceUnavailable, notConfigured("la transcripción no está configurada (WHISPER_API_URL o WHISPER_CPP_MODEL)"))
+		return
+	}
+
+	inputData, err := getInputData(c)
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+
+	language, err := parseTranscribeLanguage(c.PostForm("language"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	run := func(ctx context.Context) (gin.H, error) {
+		return runTranscribe(ctx, inputData, language)
+	}
+
+	// Con callback_url la transcripción se encola y el resultado se envía por POST
+	callbackURL, err := parseCallbackURL(c.Request.Context(), c.PostForm("callback_url"))
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+	if callbackURL != "" {
+		job, err := submitJob(c.Request.Context(), "transcribe", callbackURL, inputData, run)
+		if err != nil {
+			respondError(c, http.StatusServiceUnavailable, err)
+			return
+		}
+		c.JSON(http.StatusAccepted, job.view())
+		return
+	}
+
+	response, err := run(c.Request.Context())
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusInternalServerError), err)
+		return
+	}
+	c.JSON(http.StatusOK, attachDebug(c.Request.Context(), response))
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// audioTrim es el recorte pedido con start y duration (o end), en segundos.
+// Duration == 0 significa hasta el final.
+type audioTrim struct {
+	Start    float64
+	Duration float64
+}
+
+// parseAudioTrim interpreta start, duration y end; duration y end son
+// excluyentes
+func parseAudioTrim(start, duration, end string) (audioTrim, error) {
+	var trim audioTrim
+	var err error
+
+	if start != "" {
+		if trim.Start, err = parseTimestamp(start); err != nil {
+			return trim, invalidParam("start", "start inválido: %v", err)
+		}
+	}
+
+	switch {
+	case duration != "" && end != "":
+		return trim, errors.New("use duration o end, no ambos")
+	case duration != "":
+		if trim.Duration, err = parseTimestamp(duration); err != nil {
+			return trim, invalidParam("duration", "duration inválido: %v", err)
+		}
+		if trim.Duration == 0 {
+			return trim, errors.New("duration debe ser mayor que cero")
+		}
+	case end != "":
+		endSeconds, err := parseTimestamp(end)
+		if err != nil {
+			return trim, invalidParam("end", "end inválido: %v", err)
+		}
+		if endSeconds <= trim.Start {
+			return trim, errors.New("end debe ser posterior a start")
+		}
+		trim.Duration = endSeconds - trim.Start
+	}
+
+	return trim, nil
+}
+
+// parseTimestamp acepta segundos ("12.5") o [hh:]mm:ss[.ms]
+func parseTimestamp(value string) (float64, error) {
+	parts := strings.Split(strings.TrimSpace(value), ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("%q no es un tiempo válido", value)
+	}
+
+	total := 0.0
+	for i, part := range parts {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("%q no es un tiempo válido", value)
+		}
+		// Minutos y segundos deben ser < 60 cuando hay un campo superior
+		if i > 0 && n >= 60 {
+			return 0, fmt.Errorf("%q no es un tiempo válido", value)
+		}
+		total = total*60 + n
+	}
+	return total, nil
+}
+
+func (trim audioTrim) isSet() bool {
+	return trim.Start > 0 || trim.Duration > 0
+}
+
+// outputArgs devuelve -ss/-t como opciones de salida: funcionan igual con
+// entradas por pipe y el corte es exacto porque se aplica tras decodificar
+func (trim audioTrim) outputArgs() []string {
+	var args []string
+	if trim.Start > 0 {
+		args = append(args, "-ss", formatSeconds(trim.Start))
+	}
+	if trim.Duration > 0 {
+		args = append(args, "-t", formatSeconds(trim.Duration))
+	}
+	return args
+}
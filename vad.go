@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	vadSampleRate = 16000
+	// vadMaxSeconds limita la decodificación: una nota de voz dura minutos
+	vadMaxSeconds = 3600
+	// Tramas de 32 ms cada 20 ms
+	vadFrameSize = 512
+	vadHop       = 320
+	// vadMinLevel es el nivel mínimo de la banda de voz para que una trama
+	// cuente como voz aunque el ruido de fondo sea muy bajo
+	vadMinLevel = -50.0
+	// vadMinBandRatio es la parte de la energía que debe caer en la banda de
+	// voz (300-3400 Hz): descarta el zumbido grave y el siseo
+	vadMinBandRatio = 0.25
+)
+
+// vadOptions son los parámetros de /vad
+type vadOptions struct {
+	// MarginDB es cuánto debe superar una trama al ruido de fondo
+	MarginDB           float64
+	MinSpeechDuration  float64
+	MinSilenceDuration float64
+}
+
+// speechSegment es un tramo con voz, en segundos desde el inicio
+type speechSegment struct {
+	Start    float64 `json:"start"`
+	End      float64 `json:"end"`
+	Duration float64 `json:"duration"`
+}
+
+// vadReport es el resultado de detectSpeech
+type vadReport struct {
+	Segments     []speechSegment
+	Duration     float64
+	NoiseFloorDB float64
+	ThresholdDB  float64
+}
+
+// parseVADOptions valida margin_db (3 a 30 dB, 12 por defecto),
+// min_speech_duration (0.25 s) y min_silence_duration (0.3 s), entre 0.02 y
+// 10 segundos
+func parseVADOptions(margin, minSpeech, minSilence string) (*vadOptions, error) {
+	opts := &vadOptions{MarginDB: 12, MinSpeechDuration: 0.25, MinSilenceDuration: 0.3}
+	parse := func(name, value string, min, max float64, target *float64) error {
+		if value == "" {
+			return nil
+		}
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < min || parsed > max {
+			return invalidParam(name, "%s inválido %q (entre %s y %s)", name, value,
+				strconv.FormatFloat(min, 'f', -1, 64), strconv.FormatFloat(max, 'f', -1, 64))
+		}
+		*target = parsed
+		return nil
+	}
+	if err := parse("margin_db", margin, 3, 30, &opts.MarginDB); err != nil {
+		return nil, err
+	}
+	if err := parse("min_speech_duration", minSpeech, 0.02, 10, &opts.MinSpeechDuration); err != nil {
+		return nil, err
+	}
+	if err := parse("min_silence_duration", minSilence, 0.02, 10, &opts.MinSilenceDuration); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// detectSpeech decodifica la entrada a 16 kHz mono y marca como voz las
+// tramas cuya energía en la banda de voz supera el ruido de fondo (el
+// percentil 10 de las tramas) en MarginDB. Los tramos se unen si los separa
+// menos de MinSilenceDuration y se descartan los más cortos que
+// MinSpeechDuration.
+func detectSpeech(ctx context.Context, inputData []byte, opts *vadOptions) (*vadReport, error) {
+	pcm, err := decodeMonoPCM(ctx, inputData, vadSampleRate, vadMaxSeconds)
+	if err != nil {
+		return nil, err
+	}
+	samples := pcmSamples(pcm)
+	report := &vadReport{Segments: []speechSegment{}, Duration: float64(len(samples)) / vadSampleRate}
+	if len(samples) < vadFrameSize {
+		report.NoiseFloorDB, report.ThresholdDB = math.Inf(-1), vadMinLevel
+		return report, nil
+	}
+
+	window := hannWindow(vadFrameSize)
+	binHz := float64(vadSampleRate) / vadFrameSize
+	var levels, ratios []float64
+	for start := 0; start+vadFrameSize <= len(samples); start += vadHop {
+		magnitudes := frameMagnitudes(samples[start:start+vadFrameSize], window)
+		total, band := 0.0, 0.0
+		for k, magnitude := range magnitudes {
+			energy := magnitude * magnitude
+			total += energy
+			if frequency := float64(k) * binHz; frequency >= 300 && frequency <= 3400 {
+				band += energy
+			}
+		}
+		// Energía de la banda relativa a una senoidal a escala completa
+		// con la misma ventana
+		levels = append(levels, 10*math.Log10(band/float64(vadFrameSize*vadFrameSize)*16+1e-12))
+		ratio := 0.0
+		if total > 0 {
+			ratio = band / total
+		}
+		ratios = append(ratios, ratio)
+	}
+
+	sorted := append([]float64(nil), levels...)
+	sort.Float64s(sorted)
+	report.NoiseFloorDB = sorted[len(sorted)/10]
+	report.ThresholdDB = math.Max(report.NoiseFloorDB+opts.MarginDB, vadMinLevel)
+
+	frameSeconds := float64(vadHop) / vadSampleRate
+	frameLength := float64(vadFrameSize) / vadSampleRate
+	var segments []speechSegment
+	for i, level := range levels {
+		if level < report.ThresholdDB || ratios[i] < vadMinBandRatio {
+			continue
+		}
+		start := float64(i) * frameSeconds
+		end := math.Min(start+frameLength, report.Duration)
+		if last := len(segments) - 1; last >= 0 && start-segments[last].End < opts.MinSilenceDuration {
+			segments[last].End = end
+			continue
+		}
+		segments = append(segments, speechSegment{Start: start, End: end})
+	}
+	for _, segment := range segments {
+		if segment.End-segment.Start < opts.MinSpeechDuration {
+			continue
+		}
+		report.Segments = append(report.Segments, speechSegment{
+			Start:    roundMillis(segment.Start),
+			End:      roundMillis(segment.End),
+			Duration: roundMillis(segment.End - segment.Start),
+		})
+	}
+	return report, nil
+}
+
+// processVAD atiende POST /vad: los tramos con voz de la entrada, p. ej. para
+// descartar notas de voz vacías antes de pagar por la transcripción
+func processVAD(c *gin.Context) {
+	if !validateAPIKey(c) {
+		return
+	}
+
+	inputData, err := getInputData(c)
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+
+	opts, err := parseVADOptions(c.PostForm("margin_db"), c.PostForm("min_speech_duration"), c.PostForm("min_silence_duration"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	report, err := detectSpeech(c.Request.Context(), inputData, opts)
+	if err != nil {
+		respondError(c, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	total := 0.0
+	for _, segment := range report.Segments {
+		total += segment.Duration
+	}
+	response := gin.H{
+		"segments":       report.Segments,
+		"count":          len(report.Segments),
+		"has_speech":     len(report.Segments) > 0,
+		"total_speech":   roundMillis(total),
+		"duration":       roundMillis(report.Duration),
+		"noise_floor_db": finiteOrNil(math.Round(report.NoiseFloorDB*10) / 10),
+		"threshold_db":   math.Round(report.ThresholdDB*10) / 10,
+	}
+	if report.Duration > 0 {
+		response["speech_ratio"] = math.Round(total/report.Duration*1000) / 1000
+	}
+	c.JSON(http.StatusOK, attachDebug(c.Request.Context(), response))
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	verbosityMachine = "machine"
+	verbosityHuman   = "human"
+)
+
+// defaultVerbosity es el modo de los errores sin ?verbosity; "" conserva el
+// cuerpo {"error": "..."} de siempre
+var defaultVerbosity string
+
+// requestErrorKey guarda en el contexto de gin el error que respondió la
+// solicitud (ver respondError)
+const requestErrorKey = "request_error"
+
+// requestError es un error de la solicitud con su código estable y, si lo
+// hay, el parámetro responsable. Lo crea el código que valida la solicitud,
+// así el código no depende del texto del mensaje.
+type requestError struct {
+	code    string
+	param   string
+	message string
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+// invalidParam: param tiene un valor fuera de su formato o rango
+func invalidParam(param string, format string, args ...interface{}) error {
+	return &requestError{code: "invalid_parameter", param: param, message: fmt.Sprintf(format, args...)}
+}
+
+// conflictingParams: param no se puede usar junto con otra opción pedida
+func conflictingParams(param string, format string, args ...interface{}) error {
+	return &requestError{code: "conflicting_parameters", param: param, message: fmt.Sprintf(format, args...)}
+}
+
+// missingParam: param depende de otro parámetro que no se envió
+func missingParam(param string, format string, args ...interface{}) error {
+	return &requestError{code: "missing_parameter", param: param, message: fmt.Sprintf(format, args...)}
+}
+
+// inputOutOfRange: la entrada es demasiado corta, larga o grande para la
+// operación
+func inputOutOfRange(format string, args ...interface{}) error {
+	return &requestError{code: "input_out_of_range", message: fmt.Sprintf(format, args...)}
+}
+
+// notConfigured: la función necesita variables de entorno que no están
+func notConfigured(format string, args ...interface{}) error {
+	return &requestError{code: "not_configured", message: fmt.Sprintf(format, args...)}
+}
+
+// respondError responde {"error": mensaje} y guarda err para que
+// verbosityMiddleware tome su código
+func respondError(c *gin.Context, status int, err error) {
+	c.Set(requestErrorKey, err)
+	c.JSON(status, gin.H{"error": err.Error()})
+}
+
+// statusCodes es el código de los errores que ninguna regla reconoce
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            "bad_request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusConflict:              "conflict",
+	http.StatusRequestEntityTooLarge: "payload_too_large",
+	http.StatusUnsupportedMediaType:  "unsupported_media_type",
+	http.StatusUnprocessableEntity:   "unprocessable_input",
+	http.StatusLocked:                "quarantined",
+	http.StatusTooManyRequests:       "rate_limited",
+	http.StatusInternalServerError:   "internal_error",
+	http.StatusNotImplemented:        "not_implemented",
+	http.StatusBadGateway:            "upstream_error",
+	http.StatusServiceUnavailable:    "unavailable",
+	http.StatusGatewayTimeout:        "timeout",
+}
+
+// humanMessages son la explicación y la sugerencia en inglés de cada código
+var humanMessages = map[string][2]string{
+	"unauthorized":           {"The request is not authenticated.", "Send the API key in the apikey header, or a valid conversion token."},
+	"invalid_parameter":      {"A parameter has a value outside its allowed format or range.", "Check the allowed values for this parameter in the README."},
+	"conflicting_parameters": {"Two or more parameters cannot be used together.", "Remove one of the conflicting parameters and retry."},
+	"missing_parameter":      {"A parameter depends on another one that was not sent.", "Send the required companion parameter, or drop this one."},
+	"input_out_of_range":     {"The input is too short, too long or too large for this operation.", "Trim or re-encode the input, or adjust the requested length."},
+	"not_configured":         {"This feature is not configured on the server.", "Ask the operator to set the environment variables listed in the README."},
+	"media_rejected":         {"An interceptor rejected the media.", "Check the input with the service that rejected it."},
+	"bad_request":            {"The request could not be processed as sent.", "Check the input fields (file, base64 or url) and the parameters."},
+	"forbidden":              {"The request is not allowed.", "Check the token scope, origin or storage residency rules."},
+	"not_found":              {"The requested resource does not exist.", "Check the ID or path; results and jobs expire."},
+	"conflict":               {"The input conflicts with the current state.", "The input may have been processed already; see the encode marker settings."},
+	"payload_too_large":      {"The input is larger than allowed.", "Send a smaller file or use a token with a higher byte limit."},
+	"unsupported_media_type": {"The input is not the kind of media this endpoint expects.", "Use the suggested endpoint, or send auto=true where supported."},
+	"unprocessable_input":    {"The input could not be decoded or analyzed.", "Make sure the file is valid media and not truncated."},
+	"quarantined":            {"The input crashed the converter before and is quarantined.", "Contact the operator to inspect /admin/quarantine."},
+	"rate_limited":           {"Too many requests.", "Retry later, after the time in Retry-After if present."},
+	"internal_error":         {"The conversion failed on the server.", "Retry; if it fails again, send debug=true and report the details."},
+	"not_implemented":        {"This ffmpeg build lacks a filter the requested options need.", "Drop the option named in the error, or ask the operator for a full ffmpeg build."},
+	"upstream_error":         {"An external service failed.", "Retry later."},
+	"unavailable":            {"The service cannot take this request right now.", "Retry later; the job queue may be full."},
+	"timeout":                {"The operation took too long.", "Retry with a shorter input or use callback_url."},
+}
+
+func loadVerbosityConfig() {
+	value := strings.ToLower(strings.TrimSpace(os.Getenv("ERROR_VERBOSITY")))
+	switch value {
+	case "", verbosityMachine, verbosityHuman:
+		defaultVerbosity = value
+	default:
+		fmt.Printf("Valor inválido para ERROR_VERBOSITY (%s), se conservan los mensajes originales\n", value)
+	}
+}
+
+// verbosityFor devuelve el modo pedido en ?verbosity o el global
+func verbosityFor(c *gin.Context) string {
+	switch strings.ToLower(c.Query("verbosity")) {
+	case verbosityMachine:
+		return verbosityMachine
+	case verbosityHuman:
+		return verbosityHuman
+	}
+	return defaultVerbosity
+}
+
+// classifyError devuelve el código estable de un error y el parámetro
+// responsable, si el error lo trae. Los errores sin código toman el del
+// estado HTTP.
+func classifyError(status int, err error) (string, string) {
+	var coded *requestError
+	if errors.As(err, &coded) {
+		return coded.code, coded.param
+	}
+	var rejected *MediaRejectedError
+	if errors.As(err, &rejected) {
+		return "media_rejected", ""
+	}
+	if code, ok := statusCodes[status]; ok {
+		return code, ""
+	}
+	if status >= http.StatusInternalServerError {
+		return "internal_error", ""
+	}
+	return "bad_request", ""
+}
+
+// verbosityMiddleware reescribe los errores JSON según ?verbosity:
+//   - machine: solo códigos estables ({"error": "invalid_parameter",
+//     "param": "bitrate", "status": 400}), sin texto que pueda cambiar
+//   - human: el mensaje original con una explicación y una sugerencia
+//
+// Las respuestas correctas pasan sin cambios.
+func verbosityMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		mode := verbosityFor(c)
+		if mode == "" {
+			c.Next()
+			return
+		}
+
+		writer := &verbosityWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		if writer.buffering {
+			err, _ := c.Get(requestErrorKey)
+			cause, _ := err.(error)
+			writer.ResponseWriter.Write(rewriteErrorBody(writer.body.Bytes(), writer.Status(), mode, cause))
+		}
+	}
+}
+
+// verbosityWriter retiene el cuerpo de las respuestas JSON de error
+type verbosityWriter struct {
+	gin.ResponseWriter
+	decided   bool
+	buffering bool
+	body      bytes.Buffer
+}
+
+func (w *verbosityWriter) decide() {
+	if w.decided {
+		return
+	}
+	w.decided = true
+	w.buffering = w.Status() >= http.StatusBadRequest && strings.Contains(w.Header().Get("Content-Type"), "json")
+	if w.buffering {
+		w.Header().Del("Content-Length")
+	}
+}
+
+func (w *verbosityWriter) Write(data []byte) (int, error) {
+	w.decide()
+	if w.buffering {
+		return w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *verbosityWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// rewriteErrorBody arma el cuerpo del modo pedido. Los campos que no son
+// texto (detected_type, suggested_endpoint, job_id...) se conservan; si el
+// cuerpo no tiene un error en texto se devuelve sin cambios. cause es el error
+// guardado por respondError, o nil.
+func rewriteErrorBody(body []byte, status int, mode string, cause error) []byte {
+	var value map[string]interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return body
+	}
+	if _, ok := value["error"].(string); !ok {
+		return body
+	}
+
+	code, param := classifyError(status, cause)
+	value["status"] = status
+	if param != "" {
+		value["param"] = param
+	}
+	if mode == verbosityMachine {
+		value["error"] = code
+		delete(value, "details")
+	} else {
+		value["code"] = code
+		value["message"] = humanMessages[code][0]
+		value["suggestion"] = humanMessages[code][1]
+	}
+
+	rewritten, err := json.Marshal(value)
+	if err != nil {
+		return body
+	}
+	return rewritten
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestVerbosityMachineCodes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name      string
+		status    int
+		err       error
+		wantCode  string
+		wantParam string
+	}{
+		{"parámetro inválido", http.StatusBadRequest, invalidParam("bitrate", "bitrate inválido %q", "x"), "invalid_parameter", "bitrate"},
+		{"combinación", http.StatusBadRequest, conflictingParams("gain_db", "gain_db no se combina con normalize ni replaygain"), "conflicting_parameters", "gain_db"},
+		{"error envuelto", http.StatusBadRequest, fmt.Errorf("opciones: %w", missingParam("pad_position", "pad_position requiere pad_to_duration")), "missing_parameter", "pad_position"},
+		{"sin código", http.StatusBadRequest, errors.New("bitrate inválido, pero sin tipo"), "bad_request", ""},
+		{"interceptor", http.StatusUnprocessableEntity, &MediaRejectedError{Interceptor: "antivirus", Reason: "virus"}, "media_rejected", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(verbosityMiddleware())
+			router.GET("/", func(c *gin.Context) { respondError(c, tt.status, tt.err) })
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?verbosity=machine", nil))
+
+			var body map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("cuerpo inválido %q: %v", w.Body.String(), err)
+			}
+			if body["error"] != tt.wantCode {
+				t.Errorf("error = %v, want %q", body["error"], tt.wantCode)
+			}
+			param, _ := body["param"].(string)
+			if param != tt.wantParam {
+				t.Errorf("param = %q, want %q", param, tt.wantParam)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+)
+
+// videoConflict es una combinación de opciones que /video-to-mp4 rechaza
+type videoConflict struct {
+	param   string
+	applies func(opts *videoToMp4Options) bool
+	message string
+	// missing indica que falta un parámetro, no que sobra
+	missing bool
+}
+
+// videoToMp4Conflicts se revisan en orden; se informa la primera que aplica
+var videoToMp4Conflicts = []videoConflict{
+	{"target_duration", func(opts *videoToMp4Options) bool {
+		return opts.TargetDuration > 0 && opts.Timelapse != nil
+	}, "target_duration no se combina con speed_up ni frame_step", false},
+	{"pad_to_duration", func(opts *videoToMp4Options) bool {
+		return opts.Padding != nil && (opts.Timelapse != nil || opts.TargetDuration > 0)
+	}, "pad_to_duration no se combina con speed_up, frame_step ni target_duration", false},
+	{"parallel", func(opts *videoToMp4Options) bool {
+		return opts.Parallel && (opts.Timelapse != nil || opts.TargetDuration > 0 || opts.Padding != nil)
+	}, "parallel no se combina con speed_up, frame_step, target_duration ni pad_to_duration", false},
+	{"fast_start", func(opts *videoToMp4Options) bool {
+		return opts.FastStart && !opts.Async && opts.CallbackURL == ""
+	}, "fast_start requiere async=true o callback_url", true},
+}
+
+// checkConflicts devuelve el error de la primera combinación rechazada
+func (opts *videoToMp4Options) checkConflicts() error {
+	for _, conflict := range videoToMp4Conflicts {
+		if !conflict.applies(opts) {
+			continue
+		}
+		if conflict.missing {
+			return missingParam(conflict.param, "%s", conflict.message)
+		}
+		return conflictingParams(conflict.param, "%s", conflict.message)
+	}
+	return nil
+}
+
+// parseVideoToMp4Form lee las opciones de /video-to-mp4 enviadas como
+// formulario o query. El cuerpo JSON las reemplaza después campo a campo.
+func parseVideoToMp4Form(c *gin.Context) (videoToMp4Options, error) {
+	opts := videoToMp4Options{
+		// Destinatario opcional para enviar el resultado por email
+		EmailTo: c.PostForm("email_to"),
+		// async=true encola la conversión y devuelve un job_id para consultar en /jobs/:id
+		Async: c.PostForm("async") == "true" || c.Query("async") == "true",
+		// callback_url recibe por POST el resultado cuando termina la conversión
+		CallbackURL: c.PostForm("callback_url"),
+		// response=binary (o Accept: video/mp4) devuelve el MP4 directamente
+		Binary: wantsBinaryResponse(c, ""),
+		// aspect + crop (center, focal con focal_x/focal_y, o smart)
+		Aspect: c.PostForm("aspect"),
+		Crop:   c.PostForm("crop"),
+		// preserve_rotation=true mantiene la rotación como metadata
+		PreserveRotation: c.PostForm("preserve_rotation") == "true" || c.Query("preserve_rotation") == "true",
+		// parallel=true divide los videos largos y codifica los segmentos a la vez
+		Parallel: c.PostForm("parallel") == "true" || c.Query("parallel") == "true",
+		// fast_start=true devuelve una vista previa 480p mientras la conversión
+		// completa sigue en segundo plano
+		FastStart: c.PostForm("fast_start") == "true" || c.Query("fast_start") == "true",
+	}
+	var err error
+
+	// preset ajusta resolución, aspecto y orientación a las reglas de una plataforma
+	opts.PresetName = c.PostForm("preset")
+	if opts.PresetName == "" {
+		opts.PresetName = c.Query("preset")
+	}
+	// target elige el preset más compatible con la plataforma
+	opts.TargetName = c.PostForm("target")
+	if opts.TargetName == "" {
+		opts.TargetName = c.Query("target")
+	}
+
+	if opts.Focus, err = validateFraming(opts.Aspect, opts.Crop, c.PostForm("focal_x"), c.PostForm("focal_y")); err != nil {
+		return opts, err
+	}
+	// audio_bitrate, audio_sample_rate, audio_channels, aac_encoder y
+	// aac_profile ajustan la pista de audio del MP4
+	if opts.AudioParams, opts.aacArgs, err = parseVideoAudioOptions(c.PostForm("audio_bitrate"), c.PostForm("audio_sample_rate"),
+		c.PostForm("audio_channels"), c.PostForm("aac_encoder"), c.PostForm("aac_profile")); err != nil {
+		return opts, err
+	}
+	// speed_up o frame_step (con timelapse_fps y deflicker) generan un
+	// timelapse de grabaciones largas
+	if opts.Timelapse, err = parseTimelapse(c.PostForm("speed_up"), c.PostForm("frame_step"),
+		c.PostForm("timelapse_fps"), c.PostForm("deflicker")); err != nil {
+		return opts, err
+	}
+	// target_duration estira o comprime el video a una duración exacta (±20%)
+	if opts.TargetDuration, err = parseTargetDuration(c.PostForm("target_duration")); err != nil {
+		return opts, err
+	}
+	// pad_to_duration y pad_position congelan cuadros hasta una duración exacta
+	if opts.Padding, err = parseDurationPadding(c.PostForm("pad_to_duration"), c.PostForm("pad_position")); err != nil {
+		return opts, err
+	}
+	// stream_hash compara el video y el audio decodificados de la entrada y la salida
+	if opts.StreamHash, err = parseStreamHash(c.PostForm("stream_hash")); err != nil {
+		return opts, err
+	}
+	// Destino S3 opcional en lugar de devolver el video en base64
+	if opts.S3, err = parseS3Destination(c); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// resolve completa las opciones ya leídas (del formulario o del JSON):
+// busca el target y el preset, valida callback_url y el permiso de email, y
+// rechaza las combinaciones de videoToMp4Conflicts
+func (opts *videoToMp4Options) resolve(ctx context.Context) error {
+	// target usa el preset de la plataforma salvo que se pida otro
+	target, err := lookupPlatformTarget(opts.TargetName)
+	if err != nil {
+		return err
+	}
+	opts.Target = target
+	if opts.Target != nil && opts.PresetName == "" {
+		opts.PresetName = opts.Target.VideoPreset
+	}
+	if opts.Preset, err = lookupVideoPreset(opts.PresetName); err != nil {
+		return err
+	}
+
+	// aspect recorta a un formato social sobre el preset (o sin él)
+	if opts.Aspect != "" {
+		fit := videoPreset{AllowPortrait: true}
+		if opts.Preset != nil {
+			fit = *opts.Preset
+		}
+		fit.Aspect = opts.Aspect
+		fit.Fit = "crop"
+		fit.AllowPortrait = true
+		opts.Preset = &fit
+	}
+
+	if opts.CallbackURL, err = parseCallbackURL(ctx, opts.CallbackURL); err != nil {
+		return err
+	}
+	if opts.EmailTo != "" {
+		if err := checkTokenGrant(ctx, "email"); err != nil {
+			return err
+		}
+	}
+	return opts.checkConflicts()
+}
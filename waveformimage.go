@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// waveformImageOptions son los parámetros de /waveform-image
+type waveformImageOptions struct {
+	Format string
+	Width  int
+	Height int
+	// Color y Background son RRGGBB o RRGGBBAA; Background vacío es transparente
+	Color      string
+	Background string
+	// Bars es la cantidad de barras del SVG
+	Bars int
+}
+
+var waveformColorPattern = regexp.MustCompile(`^[0-9A-Fa-f]{6}([0-9A-Fa-f]{2})?$`)
+
+// parseWaveformColor acepta #RRGGBB, #RRGGBBAA o lo mismo con 0x; devuelve
+// los dígitos sin prefijo
+func parseWaveformColor(name, value string) (string, error) {
+	digits := strings.TrimPrefix(strings.TrimPrefix(value, "#"), "0x")
+	if !waveformColorPattern.MatchString(digits) {
+		return "", invalidParam(name, "%s inválido %q (#RRGGBB o #RRGGBBAA)", name, value)
+	}
+	return strings.ToUpper(digits), nil
+}
+
+// parseWaveformImageOptions lee los campos del formulario con sus valores por
+// defecto: PNG de 640x128, barras verdes y fondo transparente
+func parseWaveformImageOptions(c *gin.Context) (waveformImageOptions, error) {
+	opts := waveformImageOptions{
+		Format: negotiateFormat(c, []string{"png", "svg"}, "png"),
+		Width:  640,
+		Height: 128,
+	}
+	if opts.Format != "png" && opts.Format != "svg" {
+		return opts, invalidParam("output_format", "output_format inválido %q (png o svg)", opts.Format)
+	}
+	var err error
+	if opts.Width, opts.Height, err = parseImageSize(c, opts.Width, opts.Height); err != nil {
+		return opts, err
+	}
+	if opts.Color, err = parseWaveformColor("color", c.DefaultPostForm("color", "#25D366")); err != nil {
+		return opts, err
+	}
+	if value := c.DefaultPostForm("background", "transparent"); value != "transparent" {
+		if opts.Background, err = parseWaveformColor("background", value); err != nil {
+			return opts, err
+		}
+	}
+
+	// Por defecto una barra de 2 px cada 4 px
+	opts.Bars = opts.Width / 4
+	if value := c.PostForm("bars"); value != "" {
+		bars, err := strconv.Atoi(value)
+		if err != nil || bars < 8 || bars > opts.Width {
+			return opts, invalidParam("bars", "bars debe estar entre 8 y width (%d)", opts.Width)
+		}
+		opts.Bars = bars
+	}
+	return opts, nil
+}
+
+// parseImageSize lee width y height para las imágenes generadas a partir
+// del audio
+func parseImageSize(c *gin.Context, width, height int) (int, int, error) {
+	if value := c.PostForm("width"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 16 || parsed > 4096 {
+			return 0, 0, invalidParam("width", "width debe estar entre 16 y 4096")
+		}
+		width = parsed
+	}
+	if value := c.PostForm("height"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 16 || parsed > 2048 {
+			return 0, 0, invalidParam("height", "height debe estar entre 16 y 2048")
+		}
+		height = parsed
+	}
+	return width, height, nil
+}
+
+// renderAudioPicture ejecuta un filtro que convierte el audio en una sola
+// imagen PNG (showwavespic, showspectrumpic)
+func renderAudioPicture(ctx context.Context, inputData []byte, graph string) ([]byte, error) {
+	inputPath, cleanup, err := writeTempInput(inputData, "picture-input-*")
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	cmd := ffmpegCommand(ctx, classInteractive,
+		"-i", inputPath,
+		"-filter_complex", graph,
+		"-frames:v", "1",
+		"-c:v", "png",
+		"-f", "image2pipe",
+		"pipe:1",
+	)
+	var output, errBuffer bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &errBuffer
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error al generar la imagen: %v, detalles: %s", err, errBuffer.String())
+	}
+	if output.Len() == 0 {
+		return nil, fmt.Errorf("la imagen generada está vacía")
+	}
+	return output.Bytes(), nil
+}
+
+// renderWaveformPNG dibuja la forma de onda con showwavespic. Con fondo se
+// superpone sobre una imagen de color; sin fondo queda transparente.
+func renderWaveformPNG(ctx context.Context, inputData []byte, opts waveformImageOptions) ([]byte, error) {
+	size := fmt.Sprintf("%dx%d", opts.Width, opts.Height)
+	graph := fmt.Sprintf("[0:a]aformat=channel_layouts=mono,showwavespic=s=%s:colors=0x%s", size, opts.Color)
+	if opts.Background != "" {
+		graph += fmt.Sprintf("[wave];color=c=0x%s:s=%s[bg];[bg][wave]overlay=format=auto", opts.Background, size)
+	}
+	return renderAudioPicture(ctx, inputData, graph)
+}
+
+// renderWaveformSVG dibuja barras redondeadas y centradas a partir de los
+// mismos niveles (0-100) que la forma de onda de WhatsApp
+func renderWaveformSVG(ctx context.Context, inputData []byte, opts waveformImageOptions) ([]byte, error) {
+	levels, err := audioWaveform(ctx, inputData, opts.Bars)
+	if err != nil {
+		return nil, err
+	}
+
+	step := float64(opts.Width) / float64(opts.Bars)
+	barWidth := step / 2
+	fill, opacity := svgColor(opts.Color)
+
+	var svg strings.Builder
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`, opts.Width, opts.Height, opts.Width, opts.Height)
+	if opts.Background != "" {
+		bgFill, bgOpacity := svgColor(opts.Background)
+		fmt.Fprintf(&svg, `<rect width="100%%" height="100%%" fill="%s" fill-opacity="%s"/>`, bgFill, bgOpacity)
+	}
+	fmt.Fprintf(&svg, `<g fill="%s" fill-opacity="%s">`, fill, opacity)
+	for i, level := range levels {
+		// Las barras en silencio conservan un mínimo visible
+		height := float64(opts.Height) * float64(level) / 100
+		if height < barWidth {
+			height = barWidth
+		}
+		x := float64(i)*step + (step-barWidth)/2
+		y := (float64(opts.Height) - height) / 2
+		fmt.Fprintf(&svg, `<rect x="%.2f" y="%.2f" width="%.2f" height="%.2f" rx="%.2f"/>`, x, y, barWidth, height, barWidth/2)
+	}
+	svg.WriteString("</g></svg>")
+	return []byte(svg.String()), nil
+}
+
+// svgColor separa RRGGBBAA en el color y su opacidad
+func svgColor(digits string) (string, string) {
+	if len(digits) == 8 {
+		alpha, _ := strconv.ParseUint(digits[6:], 16, 8)
+		return "#" + digits[:6], strconv.FormatFloat(float64(alpha)/255, 'f', 3, 64)
+	}
+	return "#" + digits, "1"
+}
+
+// processWaveformImage atiende /waveform-image: una vista previa de la forma
+// de onda para notas de voz en apps de chat
+func processWaveformImage(c *gin.Context) {
+	if !validateAPIKey(c) {
+		return
+	}
+
+	inputData, err := getInputData(c)
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusBadRequest), err)
+		return
+	}
+
+	opts, err := parseWaveformImageOptions(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	var image []byte
+	contentType := "image/png"
+	if opts.Format == "svg" {
+		image, err = renderWaveformSVG(ctx, inputData, opts)
+		contentType = "image/svg+xml"
+	} else {
+		image, err = renderWaveformPNG(ctx, inputData, opts)
+	}
+	if err == nil {
+		image, err = interceptOutput(ctx, opts.Format, image)
+	}
+	if err != nil {
+		respondError(c, mediaErrorStatus(err, http.StatusInternalServerError), err)
+		return
+	}
+
+	if wantsBinaryResponse(c, "") {
+		writeBinaryResponse(c, image, "waveform."+opts.Format, contentType, map[string]string{
+			"X-Format": opts.Format,
+			"X-Width":  strconv.Itoa(opts.Width),
+			"X-Height": strconv.Itoa(opts.Height),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, attachDebug(ctx, gin.H{
+		"format": opts.Format,
+		"width":  opts.Width,
+		"height": opts.Height,
+		"size":   len(image),
+		"image":  base64.StdEncoding.EncodeToString(image),
+	}))
+}
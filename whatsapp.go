@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// whatsappVoicePreset es el valor de preset para notas de voz (PTT)
+	whatsappVoicePreset = "whatsapp_voice"
+	// whatsappWaveformSamples es la cantidad de barras que muestra WhatsApp
+	whatsappWaveformSamples = 64
+	// whatsappWaveformRate es la frecuencia a la que se decodifica el audio
+	// para calcular la forma de onda
+	whatsappWaveformRate = 8000
+)
+
+// WhatsApp solo reproduce como nota de voz el Opus mono de 16 a 24 kbps
+const (
+	whatsappMinBitrate     = 16000
+	whatsappMaxBitrate     = 24000
+	whatsappDefaultBitrate = 24000
+)
+
+// whatsappVoiceOpusArgs son las opciones de libopus del preset. opus_bitrate
+// puede bajar el bitrate dentro del rango que acepta WhatsApp.
+func whatsappVoiceOpusArgs(bitrate string) ([]string, error) {
+	value := whatsappDefaultBitrate
+	if bitrate != "" {
+		params, err := parseAudioParams(bitrate, "", "")
+		if err != nil || params.Bitrate < whatsappMinBitrate || params.Bitrate > whatsappMaxBitrate {
+			return nil, invalidParam("opus_bitrate", "opus_bitrate inválido %q para %s (16k a 24k)", bitrate, whatsappVoicePreset)
+		}
+		value = params.Bitrate
+	}
+	return []string{
+		"-b:a", strconv.Itoa(value),
+		"-ar", "48000",
+		"-ac", "1",
+		"-application", "voip",
+		"-vbr", "on",
+		"-frame_duration", "20",
+	}, nil
+}
+
+// addWhatsAppWaveform agrega la forma de onda que WhatsApp espera en el
+// payload de la nota de voz: 64 valores de 0 a 100, como arreglo y en base64
+func addWhatsAppWaveform(ctx context.Context, response gin.H, audioData []byte) error {
+	waveform, err := audioWaveform(ctx, audioData, whatsappWaveformSamples)
+	if err != nil {
+		return err
+	}
+
+	values := make([]int, len(waveform))
+	for i, value := range waveform {
+		values[i] = int(value)
+	}
+	response["waveform"] = values
+	response["waveform_base64"] = base64.StdEncoding.EncodeToString(waveform)
+	return nil
+}
+
+// audioWaveform decodifica el audio a PCM mono y promedia la amplitud
+// absoluta de samples bloques, normalizada a 0-100 respecto del más alto
+func audioWaveform(ctx context.Context, audioData []byte, samples int) ([]byte, error) {
+	cmd := ffmpegCommand(ctx, classInteractive,
+		"-i", "pipe:0",
+		"-vn",
+		"-ac", "1",
+		"-ar", strconv.Itoa(whatsappWaveformRate),
+		"-f", "s16le",
+		"pipe:1",
+	)
+	cmd.Stdin = bytes.NewReader(audioData)
+	var output, errBuffer bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &errBuffer
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error al calcular la forma de onda: %v, detalles: %s", err, errBuffer.String())
+	}
+
+	pcm := make([]int16, output.Len()/2)
+	binary.Read(bytes.NewReader(output.Bytes()), binary.LittleEndian, pcm)
+
+	waveform := make([]byte, samples)
+	blockSize := len(pcm) / samples
+	if blockSize == 0 {
+		return waveform, nil
+	}
+
+	averages := make([]float64, samples)
+	peak := 0.0
+	for i := range averages {
+		sum := 0.0
+		for _, sample := range pcm[i*blockSize : (i+1)*blockSize] {
+			sum += math.Abs(float64(sample))
+		}
+		averages[i] = sum / float64(blockSize)
+		peak = math.Max(peak, averages[i])
+	}
+	if peak == 0 {
+		return waveform, nil
+	}
+	for i, average := range averages {
+		waveform[i] = byte(math.Floor(100 * average / peak))
+	}
+	return waveform, nil
+}